@@ -4,14 +4,20 @@ import (
 	"context"
 	"flag"
 	"github.com/co1seam/ember-backend-auth/config"
+	"github.com/co1seam/ember-backend-auth/internal/adapters/health"
+	"github.com/co1seam/ember-backend-auth/internal/adapters/mail"
+	"github.com/co1seam/ember-backend-auth/internal/adapters/metrics"
 	"github.com/co1seam/ember-backend-auth/internal/adapters/repository"
+	"github.com/co1seam/ember-backend-auth/internal/adapters/rest"
 	"github.com/co1seam/ember-backend-auth/internal/adapters/rpc"
+	"github.com/co1seam/ember-backend-auth/internal/adapters/tracing"
 	"github.com/co1seam/ember-backend-auth/internal/core/models"
 	"github.com/co1seam/ember-backend-auth/internal/core/services"
 	"github.com/co1seam/ember-backend-auth/pkg/logger"
 	"log"
 	"log/slog"
 	"os"
+	"time"
 )
 
 func main() {
@@ -26,13 +32,40 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// Access logs are written at info level, so they only show with
+	// APP_LOG_LEVEL set to info or debug.
+	level := slog.LevelError
+	if cfg.App.LogLevel != "" {
+		if err := level.UnmarshalText([]byte(cfg.App.LogLevel)); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	log := logger.New(ctx, logger.Options{
-		Level:     slog.LevelError,
+		Level:     level,
 		AddSource: true,
 		JSON:      true,
 		Output:    os.Stdout,
 	})
 
+	shutdownTracing, err := tracing.Setup(ctx, &cfg.Tracing)
+	if err != nil {
+		log.Error("error: ", err)
+		return
+	}
+
+	// The probes are served from the start, so that the service reports
+	// itself alive but not ready while it connects and migrates.
+	checker := health.NewChecker(&cfg.Health)
+	metricsServer := metrics.NewServer(&cfg.Metrics)
+	metricsServer.Handle("/healthz", checker.Liveness())
+	metricsServer.Handle("/readyz", checker.Readiness())
+	go func() {
+		if err := metricsServer.Run(); err != nil {
+			log.Error("error: ", err)
+		}
+	}()
+
 	db, err := repository.NewPostgres(ctx, &cfg.Database)
 	if err != nil {
 		err := log.Error("error: ", err)
@@ -41,22 +74,75 @@ func main() {
 		}
 	}
 
+	checker.SetMigrating(true)
+	if err := db.Migrate(); err != nil {
+		log.Error("error: ", err)
+		return
+	}
+	checker.SetMigrating(false)
+
 	cache := repository.NewRedis(cfg.Redis.Host, cfg.Redis.Port)
 
+	checker.Add(health.Check{Name: "postgres", Critical: true, Run: db.DB.PingContext})
+	checker.Add(health.Check{Name: "redis", Critical: true, Run: func(ctx context.Context) error {
+		return cache.Redis.Ping(ctx).Err()
+	}})
+	if cfg.Health.CheckSMTP {
+		checker.Add(health.Check{Name: "smtp", Run: mail.NewSMTP(&cfg.SMTP).Ping})
+	}
+	checker.Start()
+
+	metrics.RegisterDB(db.DB, cfg.Database.Name)
+	metrics.RegisterRedis(cache.Redis)
+
 	opts := &models.Options{
 		Logger: log,
 		Config: cfg,
 	}
 
 	repos := repository.NewRepository(db.DB, cache, opts)
-	service := services.NewService(repos, opts)
+	service, err := services.NewService(repos, opts)
+	if err != nil {
+		log.Error("error: ", err)
+		return
+	}
 	handler := rpc.NewHandler(service, opts)
 
-	server := rpc.NewServer()
-	if err := server.Run(handler); err != nil {
+	server, err := rpc.NewServer(checker, handler, opts)
+	if err != nil {
+		log.Error("error: ", err)
+		return
+	}
+
+	httpServer := rest.NewServer()
+	go func() {
+		if err := httpServer.Run(rest.NewHandler(service, server.LocalAuth(), opts), cfg.HTTP.Host+":"+cfg.HTTP.Port); err != nil {
+			log.Error("error: ", err)
+		}
+	}()
+
+	if err := server.Run(); err != nil {
 		return
 	}
 
+	if err := httpServer.Shutdown(); err != nil {
+		log.Error("error: ", err)
+	}
+
+	// Queued audit events are written before the database goes away.
+	closeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := service.Close(closeCtx); err != nil {
+		log.Error("error: ", err)
+	}
+	checker.Close()
+	if err := metricsServer.Shutdown(closeCtx); err != nil {
+		log.Error("error: ", err)
+	}
+	if err := shutdownTracing(closeCtx); err != nil {
+		log.Error("error: ", err)
+	}
+
 	if err := db.DB.Close(); err != nil {
 		log.Error("error: ", err)
 	}
@@ -1,5 +1,8 @@
 package config
 
+import "time"
+
+// App configures the gRPC server, which listens on Host:Port.
 type App struct {
 	Host     string `mapstructure:"APP_HOST"`
 	Port     string `mapstructure:"APP_PORT"`
@@ -21,9 +24,11 @@ type SMTP struct {
 }
 
 type Token struct {
-	Secret          string `mapstructure:"TOKEN_SECRET"`
-	RefreshTokenTTL string `mapstructure:"TOKEN_REFRESH_TTL"`
-	AccessTokenTTL  string `mapstructure:"TOKEN_ACCESS_TTL"`
+	Secret          string        `mapstructure:"TOKEN_SECRET"`
+	RefreshTokenTTL time.Duration `mapstructure:"TOKEN_REFRESH_TTL"`
+	AccessTokenTTL  time.Duration `mapstructure:"TOKEN_ACCESS_TTL"`
+	// Issuer is the iss claim of the tokens, set from OAUTH_ISSUER.
+	Issuer string `mapstructure:"-"`
 }
 
 type Redis struct {
@@ -31,10 +36,208 @@ type Redis struct {
 	Port string `mapstructure:"REDIS_PORT"`
 }
 
+type HTTP struct {
+	Host string `mapstructure:"HTTP_HOST"`
+	Port string `mapstructure:"HTTP_PORT"`
+}
+
+type OAuth struct {
+	Issuer       string        `mapstructure:"OAUTH_ISSUER"`
+	CodeTTL      time.Duration `mapstructure:"OAUTH_CODE_TTL"`
+	SessionTTL   time.Duration `mapstructure:"OAUTH_SESSION_TTL"`
+	CookieSecure bool          `mapstructure:"OAUTH_COOKIE_SECURE"`
+}
+
+type OIDC struct {
+	SigningKeyFile string        `mapstructure:"OIDC_SIGNING_KEY_FILE"`
+	IDTokenTTL     time.Duration `mapstructure:"OIDC_ID_TOKEN_TTL"`
+}
+
+// Provider is an upstream identity provider. OpenID Connect providers only
+// need an issuer; plain OAuth 2.0 providers set the endpoint URLs instead.
+type Provider struct {
+	Name         string   `mapstructure:"-"`
+	Issuer       string   `mapstructure:"ISSUER"`
+	ClientID     string   `mapstructure:"CLIENT_ID"`
+	ClientSecret string   `mapstructure:"CLIENT_SECRET"`
+	Scopes       []string `mapstructure:"SCOPES"`
+	AuthURL      string   `mapstructure:"AUTH_URL"`
+	TokenURL     string   `mapstructure:"TOKEN_URL"`
+	UserInfoURL  string   `mapstructure:"USERINFO_URL"`
+	TrustEmail   bool     `mapstructure:"TRUST_EMAIL"`
+}
+
+// Federation lists upstream providers by name in IDP_PROVIDERS. Each
+// provider is configured with IDP_<NAME>_* variables, e.g. IDP_GOOGLE_ISSUER.
+type Federation struct {
+	ProviderNames []string   `mapstructure:"IDP_PROVIDERS"`
+	Providers     []Provider `mapstructure:"-"`
+}
+
+type Account struct {
+	ReauthMaxAge time.Duration `mapstructure:"ACCOUNT_REAUTH_MAX_AGE"`
+}
+
+// RBAC names the role every new user is given on sign-up.
+type RBAC struct {
+	DefaultRole string `mapstructure:"RBAC_DEFAULT_ROLE"`
+}
+
+// Relations configures relationship-based authorization. The schema file
+// declares namespaces and relation rewrites.
+type Relations struct {
+	SchemaFile string        `mapstructure:"RELATIONS_SCHEMA_FILE"`
+	CacheTTL   time.Duration `mapstructure:"RELATIONS_CACHE_TTL"`
+	MaxDepth   int           `mapstructure:"RELATIONS_MAX_DEPTH"`
+}
+
+// Invitation configures organization invitations. AcceptURL is the page the
+// emailed link points to; the token is appended as the "token" parameter.
+type Invitation struct {
+	AcceptURL string        `mapstructure:"INVITE_ACCEPT_URL"`
+	TTL       time.Duration `mapstructure:"INVITE_TTL"`
+	MaxTTL    time.Duration `mapstructure:"INVITE_MAX_TTL"`
+}
+
+// TokenExchange configures RFC 8693 token exchange. Audiences lists the
+// backends exchanged tokens may be issued for.
+type TokenExchange struct {
+	Audiences        []string      `mapstructure:"TOKEN_EXCHANGE_AUDIENCES"`
+	ImpersonationTTL time.Duration `mapstructure:"TOKEN_EXCHANGE_IMPERSONATION_TTL"`
+}
+
+// Audit configures the audit log writer. Events are buffered and written in
+// batches of up to BatchSize every FlushInterval; events older than
+// Retention are purged every PurgeInterval. The head of every audit chain
+// is signed every CheckpointInterval with the key of OIDC_SIGNING_KEY_FILE,
+// which is then required. Checkpoints default to hourly when a key is
+// configured and are off otherwise; a negative interval disables them.
+type Audit struct {
+	BufferSize    int           `mapstructure:"AUDIT_BUFFER_SIZE"`
+	BatchSize     int           `mapstructure:"AUDIT_BATCH_SIZE"`
+	FlushInterval time.Duration `mapstructure:"AUDIT_FLUSH_INTERVAL"`
+	Retention     time.Duration `mapstructure:"AUDIT_RETENTION"`
+	PurgeInterval time.Duration `mapstructure:"AUDIT_PURGE_INTERVAL"`
+
+	CheckpointInterval time.Duration `mapstructure:"AUDIT_CHECKPOINT_INTERVAL"`
+}
+
+// Events configures publishing of domain events from the outbox. Sinks
+// lists the publishers events are delivered to: "redis" appends them to
+// RedisStream, "webhook" posts them to WebhookURL. Failed deliveries are
+// retried with exponential backoff of up to MaxBackoff.
+type Events struct {
+	Sinks         []string      `mapstructure:"EVENTS_SINKS"`
+	RedisStream   string        `mapstructure:"EVENTS_REDIS_STREAM"`
+	RedisMaxLen   int64         `mapstructure:"EVENTS_REDIS_MAX_LEN"`
+	WebhookURL    string        `mapstructure:"EVENTS_WEBHOOK_URL"`
+	WebhookSecret string        `mapstructure:"EVENTS_WEBHOOK_SECRET"`
+	RelayInterval time.Duration `mapstructure:"EVENTS_RELAY_INTERVAL"`
+	BatchSize     int           `mapstructure:"EVENTS_BATCH_SIZE"`
+	MaxBackoff    time.Duration `mapstructure:"EVENTS_MAX_BACKOFF"`
+	Retention     time.Duration `mapstructure:"EVENTS_RETENTION"`
+}
+
+// Webhooks configures delivery to webhook subscriptions. Failed deliveries
+// are retried up to MaxAttempts times, backing off exponentially from
+// BaseBackoff to MaxBackoff; a subscription is disabled after DisableAfter
+// failed attempts in a row. AllowHTTP permits plain http URLs and
+// AllowPrivateNetworks deliveries to loopback, private and link-local
+// addresses, for development.
+type Webhooks struct {
+	Interval     time.Duration `mapstructure:"WEBHOOK_INTERVAL"`
+	BatchSize    int           `mapstructure:"WEBHOOK_BATCH_SIZE"`
+	Timeout      time.Duration `mapstructure:"WEBHOOK_TIMEOUT"`
+	MaxAttempts  int           `mapstructure:"WEBHOOK_MAX_ATTEMPTS"`
+	BaseBackoff  time.Duration `mapstructure:"WEBHOOK_BASE_BACKOFF"`
+	MaxBackoff   time.Duration `mapstructure:"WEBHOOK_MAX_BACKOFF"`
+	DisableAfter int           `mapstructure:"WEBHOOK_DISABLE_AFTER"`
+	AllowHTTP    bool          `mapstructure:"WEBHOOK_ALLOW_HTTP"`
+
+	AllowPrivateNetworks bool `mapstructure:"WEBHOOK_ALLOW_PRIVATE_NETWORKS"`
+}
+
+// Metrics configures the Prometheus endpoint, which is served on its own
+// listener so that it is not exposed with the public HTTP API.
+type Metrics struct {
+	Addr string `mapstructure:"METRICS_ADDR"`
+	Path string `mapstructure:"METRICS_PATH"`
+}
+
+// Tracing configures OpenTelemetry tracing. Spans are exported over OTLP/gRPC
+// to Endpoint; without one, trace context is still propagated but nothing
+// is exported. SampleRatio is the fraction of new traces recorded.
+type Tracing struct {
+	Endpoint    string  `mapstructure:"TRACING_OTLP_ENDPOINT"`
+	Insecure    bool    `mapstructure:"TRACING_OTLP_INSECURE"`
+	ServiceName string  `mapstructure:"TRACING_SERVICE_NAME"`
+	SampleRatio float64 `mapstructure:"TRACING_SAMPLE_RATIO"`
+}
+
+// Health configures the dependency checks behind the gRPC health service
+// and the /readyz probe. Each check runs every CheckInterval and fails
+// after CheckTimeout. SMTP reachability is only checked if CheckSMTP is set,
+// and does not affect readiness.
+type Health struct {
+	CheckInterval time.Duration `mapstructure:"HEALTH_CHECK_INTERVAL"`
+	CheckTimeout  time.Duration `mapstructure:"HEALTH_CHECK_TIMEOUT"`
+	CheckSMTP     bool          `mapstructure:"HEALTH_CHECK_SMTP"`
+}
+
+// TLS configures transport security of the gRPC server. Without CertFile it
+// serves plaintext. With ClientCAFile, client certificates are verified
+// against it when presented, and required if RequireClientCert is set. The
+// files are reloaded when they change, checked every ReloadInterval.
+type TLS struct {
+	CertFile          string        `mapstructure:"GRPC_TLS_CERT_FILE"`
+	KeyFile           string        `mapstructure:"GRPC_TLS_KEY_FILE"`
+	ClientCAFile      string        `mapstructure:"GRPC_TLS_CLIENT_CA_FILE"`
+	RequireClientCert bool          `mapstructure:"GRPC_TLS_REQUIRE_CLIENT_CERT"`
+	ReloadInterval    time.Duration `mapstructure:"GRPC_TLS_RELOAD_INTERVAL"`
+}
+
+// GRPC configures how the gRPC server handles requests. Unary requests
+// without a deadline get DefaultTimeout, unless MethodTimeouts sets one for
+// their method as a "/package.Service/Method=duration" entry. The
+// x-forwarded-for metadata is only believed from the addresses or CIDR
+// ranges of TrustedProxies.
+type GRPC struct {
+	DefaultTimeout time.Duration `mapstructure:"GRPC_DEFAULT_TIMEOUT"`
+	MethodTimeouts []string      `mapstructure:"GRPC_METHOD_TIMEOUTS"`
+	TrustedProxies []string      `mapstructure:"GRPC_TRUSTED_PROXIES"`
+}
+
+// Gateway configures the HTTP/JSON auth API the web frontend signs in
+// through. CORSOrigins lists the exact origins allowed to call it with
+// credentials; the refresh token cookie is set for CookieDomain, or the
+// host of the API if empty.
+type Gateway struct {
+	CORSOrigins  []string `mapstructure:"GATEWAY_CORS_ORIGINS"`
+	CookieDomain string   `mapstructure:"GATEWAY_COOKIE_DOMAIN"`
+}
+
 type Config struct {
-	App      App      `mapstructure:",squash"`
-	Database Database `mapstructure:",squash"`
-	SMTP     SMTP     `mapstructure:",squash"`
-	Token    Token    `mapstructure:",squash"`
-	Redis    Redis    `mapstructure:",squash"`
+	App           App           `mapstructure:",squash"`
+	Database      Database      `mapstructure:",squash"`
+	SMTP          SMTP          `mapstructure:",squash"`
+	Token         Token         `mapstructure:",squash"`
+	Redis         Redis         `mapstructure:",squash"`
+	HTTP          HTTP          `mapstructure:",squash"`
+	OAuth         OAuth         `mapstructure:",squash"`
+	OIDC          OIDC          `mapstructure:",squash"`
+	Federation    Federation    `mapstructure:",squash"`
+	Account       Account       `mapstructure:",squash"`
+	RBAC          RBAC          `mapstructure:",squash"`
+	Relations     Relations     `mapstructure:",squash"`
+	Invitation    Invitation    `mapstructure:",squash"`
+	TokenExchange TokenExchange `mapstructure:",squash"`
+	Audit         Audit         `mapstructure:",squash"`
+	Events        Events        `mapstructure:",squash"`
+	Webhooks      Webhooks      `mapstructure:",squash"`
+	Metrics       Metrics       `mapstructure:",squash"`
+	Tracing       Tracing       `mapstructure:",squash"`
+	Health        Health        `mapstructure:",squash"`
+	TLS           TLS           `mapstructure:",squash"`
+	GRPC          GRPC          `mapstructure:",squash"`
+	Gateway       Gateway       `mapstructure:",squash"`
 }
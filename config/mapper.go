@@ -8,6 +8,7 @@ import (
 	"os"
 	"reflect"
 	"strings"
+	"time"
 )
 
 func New(path *string) (*Config, error) {
@@ -15,7 +16,7 @@ func New(path *string) (*Config, error) {
 		err := godotenv.Load(*path)
 		if err != nil {
 			if os.IsNotExist(err) {
-				log.Printf("Notice: .env file not found at %s", path)
+				log.Printf("Notice: .env file not found at %s", *path)
 			} else {
 				return nil, fmt.Errorf("error loading .env file: %v", err)
 			}
@@ -34,8 +35,58 @@ func New(path *string) (*Config, error) {
 	}
 
 	var cfg Config
+	if err := decode(envVars, &cfg); err != nil {
+		return nil, err
+	}
+
+	for _, name := range cfg.Federation.ProviderNames {
+		provider, err := decodeProvider(envVars, name)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Federation.Providers = append(cfg.Federation.Providers, provider)
+	}
+
+	// Cookies are only sent cross-origin to explicitly allowed origins.
+	for _, origin := range cfg.Gateway.CORSOrigins {
+		if strings.TrimSpace(origin) == "*" {
+			return nil, fmt.Errorf("GATEWAY_CORS_ORIGINS must list origins, not %q", origin)
+		}
+	}
+
+	cfg.setDefaults()
+
+	// A key generated at start-up would make every checkpoint signed with it
+	// unverifiable after a restart.
+	if cfg.Audit.CheckpointInterval > 0 && cfg.OIDC.SigningKeyFile == "" {
+		return nil, fmt.Errorf("OIDC_SIGNING_KEY_FILE is required to sign audit checkpoints; unset AUDIT_CHECKPOINT_INTERVAL to disable them")
+	}
+
+	return &cfg, nil
+}
+
+func decodeProvider(envVars map[string]interface{}, name string) (Provider, error) {
+	name = strings.TrimSpace(name)
+	prefix := "IDP_" + strings.ToUpper(name) + "_"
+
+	vars := make(map[string]interface{})
+	for key, value := range envVars {
+		if strings.HasPrefix(key, prefix) {
+			vars[strings.TrimPrefix(key, prefix)] = value
+		}
+	}
+
+	provider := Provider{Name: strings.ToLower(name)}
+	if err := decode(vars, &provider); err != nil {
+		return Provider{}, fmt.Errorf("provider %s: %w", name, err)
+	}
+
+	return provider, nil
+}
+
+func decode(input map[string]interface{}, result interface{}) error {
 	decoderConfig := &mapstructure.DecoderConfig{
-		Result:           &cfg,
+		Result:           result,
 		WeaklyTypedInput: true,
 		ErrorUnused:      false,
 		TagName:          "mapstructure",
@@ -60,12 +111,145 @@ func New(path *string) (*Config, error) {
 
 	decoder, err := mapstructure.NewDecoder(decoderConfig)
 	if err != nil {
-		return nil, fmt.Errorf("decoder creation failed: %v", err)
+		return fmt.Errorf("decoder creation failed: %v", err)
 	}
 
-	if err := decoder.Decode(envVars); err != nil {
-		return nil, fmt.Errorf("decoding failed: %v", err)
+	if err := decoder.Decode(input); err != nil {
+		return fmt.Errorf("decoding failed: %v", err)
 	}
 
-	return &cfg, nil
+	return nil
+}
+
+func (c *Config) setDefaults() {
+	if c.Token.AccessTokenTTL == 0 {
+		c.Token.AccessTokenTTL = 15 * time.Minute
+	}
+	if c.Token.RefreshTokenTTL == 0 {
+		c.Token.RefreshTokenTTL = 72 * time.Hour
+	}
+	if c.App.Port == "" {
+		c.App.Port = "50051"
+	}
+	if c.HTTP.Port == "" {
+		c.HTTP.Port = "8080"
+	}
+	if c.OAuth.Issuer == "" {
+		c.OAuth.Issuer = "http://localhost:" + c.HTTP.Port
+	}
+	c.Token.Issuer = c.OAuth.Issuer
+	if c.OAuth.CodeTTL == 0 {
+		c.OAuth.CodeTTL = time.Minute
+	}
+	if c.OAuth.SessionTTL == 0 {
+		c.OAuth.SessionTTL = 24 * time.Hour
+	}
+	if c.OIDC.IDTokenTTL == 0 {
+		c.OIDC.IDTokenTTL = time.Hour
+	}
+	if c.Account.ReauthMaxAge == 0 {
+		c.Account.ReauthMaxAge = 5 * time.Minute
+	}
+	if c.RBAC.DefaultRole == "" {
+		c.RBAC.DefaultRole = "user"
+	}
+	if c.Relations.CacheTTL == 0 {
+		c.Relations.CacheTTL = 10 * time.Second
+	}
+	if c.Relations.MaxDepth == 0 {
+		c.Relations.MaxDepth = 25
+	}
+	if c.Invitation.AcceptURL == "" {
+		c.Invitation.AcceptURL = c.OAuth.Issuer + "/invitations/accept"
+	}
+	if c.Invitation.TTL == 0 {
+		c.Invitation.TTL = 7 * 24 * time.Hour
+	}
+	if c.Invitation.MaxTTL == 0 {
+		c.Invitation.MaxTTL = 30 * 24 * time.Hour
+	}
+	if c.TokenExchange.ImpersonationTTL == 0 {
+		c.TokenExchange.ImpersonationTTL = 15 * time.Minute
+	}
+	if c.Audit.BufferSize == 0 {
+		c.Audit.BufferSize = 1024
+	}
+	if c.Audit.BatchSize == 0 {
+		c.Audit.BatchSize = 100
+	}
+	if c.Audit.FlushInterval == 0 {
+		c.Audit.FlushInterval = time.Second
+	}
+	if c.Audit.Retention == 0 {
+		c.Audit.Retention = 365 * 24 * time.Hour
+	}
+	if c.Audit.PurgeInterval == 0 {
+		c.Audit.PurgeInterval = time.Hour
+	}
+	if c.Audit.CheckpointInterval == 0 && c.OIDC.SigningKeyFile != "" {
+		c.Audit.CheckpointInterval = time.Hour
+	}
+	if c.Events.RedisStream == "" {
+		c.Events.RedisStream = "ember:events:user"
+	}
+	if c.Events.RedisMaxLen == 0 {
+		c.Events.RedisMaxLen = 100000
+	}
+	if c.Events.RelayInterval == 0 {
+		c.Events.RelayInterval = time.Second
+	}
+	if c.Events.BatchSize == 0 {
+		c.Events.BatchSize = 100
+	}
+	if c.Events.MaxBackoff == 0 {
+		c.Events.MaxBackoff = 10 * time.Minute
+	}
+	if c.Events.Retention == 0 {
+		c.Events.Retention = 7 * 24 * time.Hour
+	}
+	if c.Webhooks.Interval == 0 {
+		c.Webhooks.Interval = time.Second
+	}
+	if c.Webhooks.BatchSize == 0 {
+		c.Webhooks.BatchSize = 20
+	}
+	if c.Webhooks.Timeout == 0 {
+		c.Webhooks.Timeout = 10 * time.Second
+	}
+	if c.Webhooks.MaxAttempts == 0 {
+		c.Webhooks.MaxAttempts = 10
+	}
+	if c.Webhooks.BaseBackoff == 0 {
+		c.Webhooks.BaseBackoff = 30 * time.Second
+	}
+	if c.Webhooks.MaxBackoff == 0 {
+		c.Webhooks.MaxBackoff = 6 * time.Hour
+	}
+	if c.Webhooks.DisableAfter == 0 {
+		c.Webhooks.DisableAfter = 20
+	}
+	if c.Metrics.Addr == "" {
+		c.Metrics.Addr = ":9090"
+	}
+	if c.Metrics.Path == "" {
+		c.Metrics.Path = "/metrics"
+	}
+	if c.Tracing.ServiceName == "" {
+		c.Tracing.ServiceName = "ember-backend-auth"
+	}
+	if c.Tracing.SampleRatio == 0 {
+		c.Tracing.SampleRatio = 1
+	}
+	if c.Health.CheckInterval == 0 {
+		c.Health.CheckInterval = 10 * time.Second
+	}
+	if c.Health.CheckTimeout == 0 {
+		c.Health.CheckTimeout = 3 * time.Second
+	}
+	if c.TLS.ReloadInterval == 0 {
+		c.TLS.ReloadInterval = 30 * time.Second
+	}
+	if c.GRPC.DefaultTimeout == 0 {
+		c.GRPC.DefaultTimeout = 10 * time.Second
+	}
 }
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewCheckpointInterval(t *testing.T) {
+	// Unset, restoring the environment after the test.
+	for _, key := range []string{"OIDC_SIGNING_KEY_FILE", "AUDIT_CHECKPOINT_INTERVAL"} {
+		t.Setenv(key, "")
+		_ = os.Unsetenv(key)
+	}
+
+	cfg, err := New(nil)
+	if err != nil {
+		t.Fatalf("no signing key: %v", err)
+	}
+	if cfg.Audit.CheckpointInterval != 0 {
+		t.Fatalf("got checkpoints every %s without a signing key, want none", cfg.Audit.CheckpointInterval)
+	}
+
+	t.Setenv("AUDIT_CHECKPOINT_INTERVAL", "1h")
+	if _, err := New(nil); err == nil || !strings.Contains(err.Error(), "OIDC_SIGNING_KEY_FILE") {
+		t.Fatalf("got %v, want an error naming OIDC_SIGNING_KEY_FILE", err)
+	}
+
+	t.Setenv("AUDIT_CHECKPOINT_INTERVAL", "-1s")
+	if _, err := New(nil); err != nil {
+		t.Fatalf("checkpoints disabled: %v", err)
+	}
+
+	_ = os.Unsetenv("AUDIT_CHECKPOINT_INTERVAL")
+	t.Setenv("OIDC_SIGNING_KEY_FILE", "/etc/ember/signing.pem")
+	cfg, err = New(nil)
+	if err != nil {
+		t.Fatalf("checkpoints with a key: %v", err)
+	}
+	if cfg.Audit.CheckpointInterval != time.Hour {
+		t.Fatalf("got checkpoints every %s with a signing key, want hourly", cfg.Audit.CheckpointInterval)
+	}
+}
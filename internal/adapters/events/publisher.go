@@ -0,0 +1,32 @@
+package events
+
+import (
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/config"
+	"github.com/co1seam/ember-backend-auth/internal/adapters/repository"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"strings"
+)
+
+// NewPublishers builds the sinks listed in the events config.
+func NewPublishers(cfg *config.Events, cache *repository.Redis) ([]ports.IEventPublisher, error) {
+	publishers := make([]ports.IEventPublisher, 0, len(cfg.Sinks))
+	for _, sink := range cfg.Sinks {
+		switch strings.ToLower(strings.TrimSpace(sink)) {
+		case "":
+			continue
+		case models.EventSinkRedis:
+			publishers = append(publishers, NewRedisStream(cache, cfg.RedisStream, cfg.RedisMaxLen))
+		case models.EventSinkWebhook:
+			if cfg.WebhookURL == "" {
+				return nil, fmt.Errorf("the webhook event sink needs EVENTS_WEBHOOK_URL")
+			}
+			publishers = append(publishers, NewWebhook(cfg.WebhookURL, cfg.WebhookSecret))
+		default:
+			return nil, fmt.Errorf("unknown event sink %q", sink)
+		}
+	}
+
+	return publishers, nil
+}
@@ -0,0 +1,47 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/co1seam/ember-backend-auth/internal/adapters/repository"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/go-redis/redis/v8"
+	"strconv"
+)
+
+// RedisStream appends events to a Redis stream, trimmed to about maxLen
+// entries. Consumers read it with consumer groups.
+type RedisStream struct {
+	cache  *repository.Redis
+	stream string
+	maxLen int64
+}
+
+func NewRedisStream(cache *repository.Redis, stream string, maxLen int64) *RedisStream {
+	return &RedisStream{cache: cache, stream: stream, maxLen: maxLen}
+}
+
+func (r *RedisStream) Name() string {
+	return models.EventSinkRedis
+}
+
+// Publish adds the event as an entry with its ID, type and version as
+// separate fields, so that consumers can filter without decoding it.
+func (r *RedisStream) Publish(ctx context.Context, event *models.DomainEvent) error {
+	envelope, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return r.cache.Redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: r.stream,
+		MaxLen: r.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"id":      event.ID,
+			"type":    event.Type,
+			"version": strconv.Itoa(event.Version),
+			"event":   envelope,
+		},
+	}).Err()
+}
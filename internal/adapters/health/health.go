@@ -0,0 +1,249 @@
+// Package health tracks whether the service can serve requests. It checks
+// the dependencies periodically and reports the result through the
+// grpc.health.v1 service and the /healthz and /readyz HTTP probes.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/co1seam/ember-backend-auth/config"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Check is a dependency check. A failing critical check makes the service
+// not ready; other checks are only reported.
+type Check struct {
+	Name     string
+	Critical bool
+	Run      func(ctx context.Context) error
+}
+
+type Result struct {
+	Healthy   bool      `json:"healthy"`
+	Critical  bool      `json:"critical"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+type Report struct {
+	Ready  bool              `json:"ready"`
+	Reason string            `json:"reason,omitempty"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Checker is not ready until every critical check passed once, while
+// migrations run, and from the moment the server starts stopping.
+type Checker struct {
+	cfg    *config.Health
+	server *health.Server
+
+	mu        sync.RWMutex
+	checks    []Check
+	results   map[string]Result
+	services  []string
+	migrating bool
+	stopping  bool
+
+	stop chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+func NewChecker(cfg *config.Health) *Checker {
+	c := &Checker{
+		cfg:     cfg,
+		server:  health.NewServer(),
+		results: make(map[string]Result),
+		stop:    make(chan struct{}),
+	}
+	c.update()
+
+	return c
+}
+
+// Server is the grpc.health.v1 service. The overall status is reported for
+// the empty service name and every gRPC service, and the status of each
+// dependency for its check name.
+func (c *Checker) Server() healthpb.HealthServer {
+	return c.server
+}
+
+func (c *Checker) Add(check Check) {
+	c.mu.Lock()
+	c.checks = append(c.checks, check)
+	c.mu.Unlock()
+}
+
+// SetServices names the gRPC services whose status follows the overall one.
+func (c *Checker) SetServices(services []string) {
+	c.mu.Lock()
+	c.services = services
+	c.mu.Unlock()
+
+	c.update()
+}
+
+func (c *Checker) SetMigrating(migrating bool) {
+	c.mu.Lock()
+	c.migrating = migrating
+	c.mu.Unlock()
+
+	c.update()
+}
+
+// Start runs the checks now and then every check interval.
+func (c *Checker) Start() {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		ticker := time.NewTicker(c.cfg.CheckInterval)
+		defer ticker.Stop()
+
+		for {
+			c.runChecks()
+
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Shutdown reports the service as not serving for good, so that load
+// balancers stop sending requests while the server drains.
+func (c *Checker) Shutdown() {
+	c.mu.Lock()
+	c.stopping = true
+	c.mu.Unlock()
+
+	c.update()
+	c.server.Shutdown()
+}
+
+// Close stops checking.
+func (c *Checker) Close() {
+	c.once.Do(func() { close(c.stop) })
+	c.wg.Wait()
+}
+
+func (c *Checker) Report() Report {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	report := Report{Ready: true, Checks: make(map[string]Result, len(c.results))}
+	for name, result := range c.results {
+		report.Checks[name] = result
+	}
+
+	switch {
+	case c.stopping:
+		report.Ready, report.Reason = false, "shutting down"
+	case c.migrating:
+		report.Ready, report.Reason = false, "running migrations"
+	default:
+		for _, check := range c.checks {
+			if !check.Critical {
+				continue
+			}
+			if result, ok := c.results[check.Name]; !ok {
+				report.Ready, report.Reason = false, check.Name+" not checked yet"
+				break
+			} else if !result.Healthy {
+				report.Ready, report.Reason = false, check.Name+" is unhealthy"
+				break
+			}
+		}
+		if len(c.checks) == 0 {
+			report.Ready, report.Reason = false, "starting"
+		}
+	}
+
+	return report
+}
+
+// Liveness answers /healthz. The process is alive as long as it answers;
+// failing dependencies are not a reason to restart it.
+func (c *Checker) Liveness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte("ok\n"))
+	})
+}
+
+// Readiness answers /readyz with the report, and 503 when not ready.
+func (c *Checker) Readiness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		report := c.Report()
+
+		w.Header().Set("Content-Type", "application/json")
+		if !report.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
+
+func (c *Checker) runChecks() {
+	c.mu.RLock()
+	checks := append([]Check(nil), c.checks...)
+	c.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), c.cfg.CheckTimeout)
+			defer cancel()
+
+			results[i] = Result{Healthy: true, Critical: check.Critical, CheckedAt: time.Now()}
+			if err := check.Run(ctx); err != nil {
+				results[i].Healthy, results[i].Error = false, err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+
+	c.mu.Lock()
+	for i, check := range checks {
+		c.results[check.Name] = results[i]
+	}
+	c.mu.Unlock()
+
+	c.update()
+}
+
+// update publishes the current state to the gRPC health service.
+func (c *Checker) update() {
+	report := c.Report()
+
+	c.mu.RLock()
+	services := c.services
+	c.mu.RUnlock()
+
+	overall := healthpb.HealthCheckResponse_NOT_SERVING
+	if report.Ready {
+		overall = healthpb.HealthCheckResponse_SERVING
+	}
+	c.server.SetServingStatus("", overall)
+	for _, service := range services {
+		c.server.SetServingStatus(service, overall)
+	}
+
+	for name, result := range report.Checks {
+		status := healthpb.HealthCheckResponse_NOT_SERVING
+		if result.Healthy {
+			status = healthpb.HealthCheckResponse_SERVING
+		}
+		c.server.SetServingStatus(name, status)
+	}
+}
@@ -0,0 +1,341 @@
+package idp
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/config"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/golang-jwt/jwt/v5"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const jwksRefreshInterval = 5 * time.Minute
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+	TokenType   string `json:"token_type"`
+	Error       string `json:"error"`
+}
+
+// Provider talks to a single upstream identity provider. Endpoints are taken
+// from the provider's discovery document unless configured explicitly.
+type Provider struct {
+	cfg         config.Provider
+	redirectURL string
+	client      *http.Client
+
+	mu          sync.Mutex
+	metadata    *metadata
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+func NewProvider(cfg config.Provider, redirectURL string) *Provider {
+	return &Provider{
+		cfg:         cfg,
+		redirectURL: redirectURL,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// NewProviders builds every provider listed in the federation config, with
+// callbacks under the issuer's /federation/<name>/callback path.
+func NewProviders(cfg *config.Config) map[string]*Provider {
+	providers := make(map[string]*Provider, len(cfg.Federation.Providers))
+	for _, provider := range cfg.Federation.Providers {
+		redirectURL := cfg.OAuth.Issuer + "/federation/" + provider.Name + "/callback"
+		providers[provider.Name] = NewProvider(provider, redirectURL)
+	}
+
+	return providers
+}
+
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	target, err := url.Parse(meta.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+
+	query := target.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", p.redirectURL)
+	query.Set("scope", strings.Join(p.scopes(), " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", models.CodeChallengeMethodS256)
+	target.RawQuery = query.Encode()
+
+	return target.String(), nil
+}
+
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*models.ExternalIdentity, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {models.GrantTypeAuthorizationCode},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURL},
+		"code_verifier": {codeVerifier},
+		"client_id":     {p.cfg.ClientID},
+		"client_secret": {p.cfg.ClientSecret},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token tokenResponse
+	if err := p.do(req, &token); err != nil {
+		return nil, fmt.Errorf("%s token exchange: %w", p.cfg.Name, err)
+	}
+	if token.Error != "" {
+		return nil, fmt.Errorf("%s token exchange: %s", p.cfg.Name, token.Error)
+	}
+
+	var claims map[string]interface{}
+	if token.IDToken != "" {
+		claims, err = p.verifyIDToken(ctx, meta, token.IDToken, nonce)
+	} else {
+		claims, err = p.userInfo(ctx, meta, token.AccessToken)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &models.ExternalIdentity{
+		Provider:      p.cfg.Name,
+		Subject:       stringClaim(claims, "sub"),
+		Email:         stringClaim(claims, "email"),
+		EmailVerified: p.cfg.TrustEmail || boolClaim(claims, "email_verified"),
+		Name:          stringClaim(claims, "name"),
+	}
+	if identity.Subject == "" {
+		identity.Subject = stringClaim(claims, "id")
+	}
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("%s did not return a subject", p.cfg.Name)
+	}
+
+	return identity, nil
+}
+
+func (p *Provider) verifyIDToken(ctx context.Context, meta *metadata, idToken, nonce string) (map[string]interface{}, error) {
+	token, err := jwt.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, meta, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s id_token: %w", p.cfg.Name, err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("%s id_token: invalid claims", p.cfg.Name)
+	}
+
+	if stringClaim(claims, "nonce") != nonce {
+		return nil, fmt.Errorf("%s id_token: nonce mismatch", p.cfg.Name)
+	}
+
+	return claims, nil
+}
+
+func (p *Provider) userInfo(ctx context.Context, meta *metadata, accessToken string) (map[string]interface{}, error) {
+	if meta.UserInfoEndpoint == "" {
+		return nil, fmt.Errorf("%s returned no id_token and has no userinfo endpoint", p.cfg.Name)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, meta.UserInfoEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	var claims map[string]interface{}
+	if err := p.do(req, &claims); err != nil {
+		return nil, fmt.Errorf("%s userinfo: %w", p.cfg.Name, err)
+	}
+
+	return claims, nil
+}
+
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	meta := &metadata{Issuer: p.cfg.Issuer}
+	if p.cfg.Issuer != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.do(req, meta); err != nil {
+			return nil, fmt.Errorf("%s discovery: %w", p.cfg.Name, err)
+		}
+		if meta.Issuer != p.cfg.Issuer {
+			return nil, fmt.Errorf("%s discovery: issuer mismatch %q", p.cfg.Name, meta.Issuer)
+		}
+	}
+
+	if p.cfg.AuthURL != "" {
+		meta.AuthorizationEndpoint = p.cfg.AuthURL
+	}
+	if p.cfg.TokenURL != "" {
+		meta.TokenEndpoint = p.cfg.TokenURL
+	}
+	if p.cfg.UserInfoURL != "" {
+		meta.UserInfoEndpoint = p.cfg.UserInfoURL
+	}
+
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" {
+		return nil, fmt.Errorf("%s: authorization and token endpoints are required", p.cfg.Name)
+	}
+
+	p.metadata = meta
+	return meta, nil
+}
+
+// key returns the provider's signing key with the given ID, refetching the
+// JWKS when the key is unknown so that provider key rotation is picked up.
+func (p *Provider) key(ctx context.Context, meta *metadata, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	if time.Since(p.keysFetched) < jwksRefreshInterval && p.keys != nil {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	if meta.JWKSURI == "" {
+		return nil, errors.New("provider has no jwks_uri")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, meta.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var set jsonWebKeySet
+	if err := p.do(req, &set); err != nil {
+		return nil, fmt.Errorf("%s jwks: %w", p.cfg.Name, err)
+	}
+
+	keys, err := set.publicKeys()
+	if err != nil {
+		return nil, fmt.Errorf("%s jwks: %w", p.cfg.Name, err)
+	}
+	p.keys = keys
+	p.keysFetched = time.Now()
+
+	key, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (p *Provider) do(req *http.Request, result interface{}) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("unexpected response (status %d): %w", resp.StatusCode, err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (p *Provider) scopes() []string {
+	if len(p.cfg.Scopes) > 0 {
+		return p.cfg.Scopes
+	}
+	return []string{models.ScopeOpenID, models.ScopeEmail, models.ScopeProfile}
+}
+
+func stringClaim(claims map[string]interface{}, key string) string {
+	switch value := claims[key].(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
+
+// boolClaim accepts both JSON booleans and the "true" strings some providers
+// (e.g. Apple) send for email_verified.
+func boolClaim(claims map[string]interface{}, key string) bool {
+	switch value := claims[key].(type) {
+	case bool:
+		return value
+	case string:
+		return value == "true"
+	default:
+		return false
+	}
+}
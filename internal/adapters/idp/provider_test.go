@@ -0,0 +1,316 @@
+package idp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/co1seam/ember-backend-auth/config"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockProvider is an OIDC provider serving discovery, JWKS, token and
+// userinfo endpoints. The token endpoint returns idToken, or no ID token
+// when it is empty.
+type mockProvider struct {
+	server *httptest.Server
+	issuer string
+
+	mu       sync.Mutex
+	keys     map[string]*rsa.PrivateKey
+	idToken  string
+	userInfo map[string]interface{}
+	requests map[string]int
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+
+	m := &mockProvider{keys: map[string]*rsa.PrivateKey{}, requests: map[string]int{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		m.count("discovery")
+		writeJSON(w, map[string]string{
+			"issuer":                 m.issuer,
+			"authorization_endpoint": m.issuer + "/authorize",
+			"token_endpoint":         m.issuer + "/token",
+			"userinfo_endpoint":      m.issuer + "/userinfo",
+			"jwks_uri":               m.issuer + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		m.count("jwks")
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		var keys []map[string]string
+		for kid, key := range m.keys {
+			keys = append(keys, map[string]string{
+				"kty": "RSA",
+				"kid": kid,
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		writeJSON(w, map[string]interface{}{"keys": keys})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		m.count("token")
+		if r.FormValue("code") != "good-code" || r.FormValue("code_verifier") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		writeJSON(w, map[string]string{"access_token": "upstream-access", "token_type": "Bearer", "id_token": m.idToken})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		m.count("userinfo")
+		if r.Header.Get("Authorization") != "Bearer upstream-access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			writeJSON(w, map[string]string{"error": "invalid_token"})
+			return
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		writeJSON(w, m.userInfo)
+	})
+
+	m.server = httptest.NewServer(mux)
+	m.issuer = m.server.URL
+	t.Cleanup(m.server.Close)
+
+	return m
+}
+
+func (m *mockProvider) count(endpoint string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[endpoint]++
+}
+
+func (m *mockProvider) rotate(t *testing.T, kid string) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys = map[string]*rsa.PrivateKey{kid: key}
+}
+
+// sign issues an ID token with kid, starting from valid claims for the
+// client and applying overrides.
+func (m *mockProvider) sign(t *testing.T, kid string, overrides jwt.MapClaims) {
+	t.Helper()
+
+	claims := jwt.MapClaims{
+		"iss":            m.issuer,
+		"aud":            "client",
+		"sub":            "upstream-user",
+		"email":          "user@example.com",
+		"email_verified": true,
+		"nonce":          "nonce",
+		"exp":            time.Now().Add(time.Minute).Unix(),
+	}
+	for key, value := range overrides {
+		claims[key] = value
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, ok := m.keys[kid]
+	if !ok {
+		var err error
+		if key, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			t.Fatal(err)
+		}
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.idToken = signed
+}
+
+func (m *mockProvider) provider() *Provider {
+	return NewProvider(config.Provider{Name: "mock", Issuer: m.issuer, ClientID: "client", ClientSecret: "secret"}, "https://auth.example.com/federation/mock/callback")
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func TestDiscovery(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider()
+
+	target, err := p.AuthCodeURL(context.Background(), "state", "nonce", "challenge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(target, m.issuer+"/authorize?") {
+		t.Fatalf("authorization URL %q does not use the discovered endpoint", target)
+	}
+	for _, param := range []string{"state=state", "nonce=nonce", "code_challenge=challenge", "code_challenge_method=S256", "client_id=client"} {
+		if !strings.Contains(target, param) {
+			t.Errorf("authorization URL %q lacks %s", target, param)
+		}
+	}
+
+	if _, err := p.AuthCodeURL(context.Background(), "state", "nonce", "challenge"); err != nil {
+		t.Fatal(err)
+	}
+	if m.requests["discovery"] != 1 {
+		t.Errorf("discovery fetched %d times, want 1", m.requests["discovery"])
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	m := newMockProvider(t)
+	p := NewProvider(config.Provider{Name: "mock", Issuer: m.issuer + "/", ClientID: "client"}, "https://auth.example.com/callback")
+
+	if _, err := p.AuthCodeURL(context.Background(), "state", "nonce", "challenge"); err == nil || !strings.Contains(err.Error(), "issuer mismatch") {
+		t.Fatalf("got %v, want an issuer mismatch", err)
+	}
+}
+
+func TestExchangeIDToken(t *testing.T) {
+	m := newMockProvider(t)
+	m.rotate(t, "k1")
+	m.sign(t, "k1", nil)
+
+	identity, err := m.provider().Exchange(context.Background(), "good-code", "verifier", "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Subject != "upstream-user" || identity.Email != "user@example.com" || !identity.EmailVerified {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+	if m.requests["userinfo"] != 0 {
+		t.Error("userinfo was called although an ID token was returned")
+	}
+}
+
+func TestExchangeRejectsIDTokens(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides jwt.MapClaims
+		nonce     string
+		want      string
+	}{
+		{name: "nonce", nonce: "other", want: "nonce mismatch"},
+		{name: "issuer", overrides: jwt.MapClaims{"iss": "https://evil.example.com"}, nonce: "nonce", want: "issuer"},
+		{name: "audience", overrides: jwt.MapClaims{"aud": "other-client"}, nonce: "nonce", want: "audience"},
+		{name: "expired", overrides: jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}, nonce: "nonce", want: "expired"},
+		{name: "missing expiry", overrides: jwt.MapClaims{"exp": nil}, nonce: "nonce", want: "exp"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockProvider(t)
+			m.rotate(t, "k1")
+			m.sign(t, "k1", tt.overrides)
+
+			_, err := m.provider().Exchange(context.Background(), "good-code", "verifier", tt.nonce)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got %v, want an error about %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExchangeRejectsForeignKey(t *testing.T) {
+	m := newMockProvider(t)
+	m.rotate(t, "k1")
+	// Signed with a key of the same ID that the provider does not publish.
+	m.sign(t, "k2", nil)
+
+	if _, err := m.provider().Exchange(context.Background(), "good-code", "verifier", "nonce"); err == nil {
+		t.Fatal("an ID token signed with an unpublished key was accepted")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider()
+
+	m.rotate(t, "k1")
+	m.sign(t, "k1", nil)
+	if _, err := p.Exchange(context.Background(), "good-code", "verifier", "nonce"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unknown keys are not refetched more than once per refresh interval,
+	// so that tokens with made-up key IDs cannot hammer the provider.
+	m.rotate(t, "k2")
+	m.sign(t, "k2", nil)
+	if _, err := p.Exchange(context.Background(), "good-code", "verifier", "nonce"); err == nil {
+		t.Fatal("a key was refetched within the refresh interval")
+	}
+	if m.requests["jwks"] != 1 {
+		t.Fatalf("JWKS fetched %d times, want 1", m.requests["jwks"])
+	}
+
+	p.mu.Lock()
+	p.keysFetched = time.Now().Add(-jwksRefreshInterval)
+	p.mu.Unlock()
+
+	if _, err := p.Exchange(context.Background(), "good-code", "verifier", "nonce"); err != nil {
+		t.Fatalf("rotated key was not picked up: %v", err)
+	}
+	if m.requests["jwks"] != 2 {
+		t.Fatalf("JWKS fetched %d times, want 2", m.requests["jwks"])
+	}
+}
+
+func TestExchangeUserInfoFallback(t *testing.T) {
+	m := newMockProvider(t)
+	m.userInfo = map[string]interface{}{"id": float64(42), "email": "octo@example.com", "name": "Octo", "email_verified": "true"}
+
+	identity, err := m.provider().Exchange(context.Background(), "good-code", "verifier", "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Subject != "42" || identity.Email != "octo@example.com" || !identity.EmailVerified || identity.Name != "Octo" {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+	if m.requests["userinfo"] != 1 {
+		t.Errorf("userinfo called %d times, want 1", m.requests["userinfo"])
+	}
+}
+
+func TestExchangeUserInfoWithoutSubject(t *testing.T) {
+	m := newMockProvider(t)
+	m.userInfo = map[string]interface{}{"email": "octo@example.com"}
+
+	if _, err := m.provider().Exchange(context.Background(), "good-code", "verifier", "nonce"); err == nil {
+		t.Fatal("an identity without a subject was accepted")
+	}
+}
+
+func TestExchangeInvalidCode(t *testing.T) {
+	m := newMockProvider(t)
+
+	if _, err := m.provider().Exchange(context.Background(), "bad-code", "verifier", "nonce"); err == nil {
+		t.Fatal("a rejected code was accepted")
+	}
+}
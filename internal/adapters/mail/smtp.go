@@ -0,0 +1,85 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/config"
+	"github.com/co1seam/ember-backend-auth/internal/adapters/tracing"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+)
+
+type SMTP struct {
+	cfg *config.SMTP
+}
+
+func NewSMTP(cfg *config.SMTP) *SMTP {
+	return &SMTP{cfg: cfg}
+}
+
+func (s *SMTP) Send(ctx context.Context, to, subject, body string) (err error) {
+	port, _ := strconv.Atoi(s.cfg.Port)
+	_, span := tracing.Start(ctx, "smtp send",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.ServerAddress(s.cfg.Host), semconv.ServerPort(port)),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	message := []byte(
+		fmt.Sprintf("From: %s\r\n"+
+			"To: %s\r\n"+
+			"Subject: %s\r\n"+
+			"MIME-Version: 1.0\r\n"+
+			"Content-Type: text/plain; charset=UTF-8\r\n"+
+			"\r\n"+
+			"%s\r\n",
+			s.cfg.From,
+			to,
+			mime.BEncoding.Encode("UTF-8", subject),
+			body),
+	)
+
+	return smtp.SendMail(s.cfg.Host+":"+s.cfg.Port, nil, s.cfg.From, []string{to}, message)
+}
+
+// Ping checks that the mail server accepts connections and greets.
+func (s *SMTP) Ping(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.cfg.Host+":"+s.cfg.Port)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	return client.Quit()
+}
+
+// SendTemplate renders the named template from the templates directory and
+// sends the result.
+func (s *SMTP) SendTemplate(ctx context.Context, to, name string, data interface{}) error {
+	subject, body, err := render(name, data)
+	if err != nil {
+		return fmt.Errorf("rendering %s email: %w", name, err)
+	}
+
+	return s.Send(ctx, to, subject, body)
+}
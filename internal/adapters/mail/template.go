@@ -0,0 +1,27 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var templateFiles embed.FS
+
+// templates holds one "<name>.subject" and one "<name>.body" definition per
+// email the service sends.
+var templates = template.Must(template.ParseFS(templateFiles, "templates/*.tmpl"))
+
+func render(name string, data interface{}) (string, string, error) {
+	var subject, body bytes.Buffer
+
+	if err := templates.ExecuteTemplate(&subject, name+".subject", data); err != nil {
+		return "", "", err
+	}
+	if err := templates.ExecuteTemplate(&body, name+".body", data); err != nil {
+		return "", "", err
+	}
+
+	return subject.String(), body.String(), nil
+}
@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Counters of the authentication flows.
+var (
+	SignUps = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ember_auth_sign_ups_total",
+		Help: "Total number of accounts signed up.",
+	})
+	SignIns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ember_auth_sign_ins_total",
+		Help: "Total number of sign-in attempts by outcome and, for failures, reason.",
+	}, []string{"outcome", "reason"})
+	OTPs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ember_auth_otps_total",
+		Help: "Total number of one-time passwords by event: sent, verified or expired.",
+	}, []string{"event"})
+	RefreshRotations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ember_auth_refresh_rotations_total",
+		Help: "Total number of refresh tokens exchanged for new ones, by flow: auth or oauth.",
+	}, []string{"flow"})
+	RefreshTokenReuses = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ember_auth_refresh_token_reuse_total",
+		Help: "Total number of refresh tokens presented again after they were rotated; each revokes its session.",
+	})
+)
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"strings"
+	"time"
+)
+
+// The gRPC metrics use the names and labels of go-grpc-prometheus, so that
+// existing dashboards work with them.
+var (
+	grpcStarted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_started_total",
+		Help: "Total number of RPCs started on the server.",
+	}, []string{"grpc_type", "grpc_service", "grpc_method"})
+	grpcHandled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_handled_total",
+		Help: "Total number of RPCs completed on the server, regardless of success or failure.",
+	}, []string{"grpc_type", "grpc_service", "grpc_method", "grpc_code"})
+	grpcHandlingSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_handling_seconds",
+		Help:    "Histogram of response latency (seconds) of gRPC that had been application-level handled by the server.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"grpc_type", "grpc_service", "grpc_method"})
+)
+
+// UnaryServerInterceptor counts unary RPCs by method and status code and
+// observes their latency.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		done := observeRPC("unary", info.FullMethod)
+		resp, err := handler(ctx, req)
+		done(err)
+
+		return resp, err
+	}
+}
+
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		kind := "bidi_stream"
+		switch {
+		case info.IsClientStream && !info.IsServerStream:
+			kind = "client_stream"
+		case !info.IsClientStream && info.IsServerStream:
+			kind = "server_stream"
+		}
+
+		done := observeRPC(kind, info.FullMethod)
+		err := handler(srv, ss)
+		done(err)
+
+		return err
+	}
+}
+
+func observeRPC(kind, fullMethod string) func(error) {
+	service, method := splitMethod(fullMethod)
+	grpcStarted.WithLabelValues(kind, service, method).Inc()
+	start := time.Now()
+
+	return func(err error) {
+		grpcHandled.WithLabelValues(kind, service, method, status.Code(err).String()).Inc()
+		grpcHandlingSeconds.WithLabelValues(kind, service, method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// splitMethod splits "/package.Service/Method".
+func splitMethod(fullMethod string) (string, string) {
+	service, method, ok := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	if !ok {
+		return "unknown", "unknown"
+	}
+
+	return service, method
+}
@@ -0,0 +1,46 @@
+// Package metrics defines the Prometheus metrics of the service and serves
+// them for scraping.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"github.com/co1seam/ember-backend-auth/config"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"time"
+)
+
+// Server serves the metrics to Prometheus, and other operational endpoints
+// such as probes added with Handle.
+type Server struct {
+	mux  *http.ServeMux
+	http *http.Server
+}
+
+func NewServer(cfg *config.Metrics) *Server {
+	mux := http.NewServeMux()
+	mux.Handle(cfg.Path, promhttp.Handler())
+
+	return &Server{mux: mux, http: &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}}
+}
+
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+func (s *Server) Run() error {
+	if err := s.http.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.http.Shutdown(ctx)
+}
@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"database/sql"
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// RegisterDB reports the connection pool statistics of the database.
+func RegisterDB(db *sql.DB, name string) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// RegisterRedis reports the connection pool statistics of the Redis client.
+func RegisterRedis(client *redis.Client) {
+	stats := func(value func(*redis.PoolStats) uint32) func() float64 {
+		return func() float64 { return float64(value(client.PoolStats())) }
+	}
+
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "ember_redis_pool_hits_total",
+		Help: "Total number of times a free Redis connection was found in the pool.",
+	}, stats(func(s *redis.PoolStats) uint32 { return s.Hits }))
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "ember_redis_pool_misses_total",
+		Help: "Total number of times no free Redis connection was found in the pool.",
+	}, stats(func(s *redis.PoolStats) uint32 { return s.Misses }))
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "ember_redis_pool_timeouts_total",
+		Help: "Total number of times waiting for a Redis connection timed out.",
+	}, stats(func(s *redis.PoolStats) uint32 { return s.Timeouts }))
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "ember_redis_pool_total_connections",
+		Help: "Number of connections in the Redis pool.",
+	}, stats(func(s *redis.PoolStats) uint32 { return s.TotalConns }))
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "ember_redis_pool_idle_connections",
+		Help: "Number of idle connections in the Redis pool.",
+	}, stats(func(s *redis.PoolStats) uint32 { return s.IdleConns }))
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "ember_redis_pool_stale_connections_total",
+		Help: "Total number of stale Redis connections removed from the pool.",
+	}, stats(func(s *redis.PoolStats) uint32 { return s.StaleConns }))
+}
@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/lib/pq"
+)
+
+const apiKeyColumns = "key_id, user_id, key_name, key_prefix, scopes, expires_at, last_used_at, revoked_at, created_at"
+
+type APIKey struct {
+	db   *sql.DB
+	opts *models.Options
+}
+
+func NewAPIKey(db *sql.DB, opts *models.Options) *APIKey {
+	return &APIKey{
+		db:   db,
+		opts: opts,
+	}
+}
+
+func (a *APIKey) CreateAPIKey(ctx context.Context, key *models.APIKey, keyHash string) (string, error) {
+	var id string
+
+	query := fmt.Sprintf(`INSERT INTO %s (user_id, key_name, key_prefix, key_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING key_id`, models.APIKeyTable)
+	err := a.db.QueryRowContext(ctx, query, key.UserID, key.Name, key.Prefix, keyHash, pq.Array(key.Scopes), key.ExpiresAt).Scan(&id)
+	if err != nil {
+		if isPQError(err, foreignKeyViolation) {
+			return "", models.ErrNotFound
+		}
+		return "", err
+	}
+
+	return id, nil
+}
+
+func (a *APIKey) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE key_hash = $1", apiKeyColumns, models.APIKeyTable)
+
+	return a.scan(a.db.QueryRowContext(ctx, query, keyHash))
+}
+
+// ListAPIKeys returns the keys of a user that were not revoked, newest first.
+func (a *APIKey) ListAPIKeys(ctx context.Context, userID string) ([]models.APIKey, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE user_id = $1 AND revoked_at IS NULL ORDER BY created_at DESC, key_id", apiKeyColumns, models.APIKeyTable)
+	rows, err := a.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		key, err := a.scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (a *APIKey) RevokeAPIKey(ctx context.Context, userID, keyID string) error {
+	query := fmt.Sprintf("UPDATE %s SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND key_id = $2 AND revoked_at IS NULL", models.APIKeyTable)
+	res, err := a.db.ExecContext(ctx, query, userID, keyID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
+// RevokeUserAPIKeys revokes every key of the user.
+func (a *APIKey) RevokeUserAPIKeys(ctx context.Context, userID string) error {
+	query := fmt.Sprintf("UPDATE %s SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL", models.APIKeyTable)
+	_, err := a.db.ExecContext(ctx, query, userID)
+
+	return err
+}
+
+// TouchAPIKey records that a key was used. The timestamp is only written once
+// a minute, so that busy keys do not cause a write on every request.
+func (a *APIKey) TouchAPIKey(ctx context.Context, keyID string) error {
+	query := fmt.Sprintf(`UPDATE %s SET last_used_at = CURRENT_TIMESTAMP
+		WHERE key_id = $1 AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute')`, models.APIKeyTable)
+	_, err := a.db.ExecContext(ctx, query, keyID)
+
+	return err
+}
+
+func (a *APIKey) scan(row interface{ Scan(...interface{}) error }) (*models.APIKey, error) {
+	var (
+		key        models.APIKey
+		expiresAt  sql.NullTime
+		lastUsedAt sql.NullTime
+		revokedAt  sql.NullTime
+	)
+
+	err := row.Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		pq.Array(&key.Scopes),
+		&expiresAt,
+		&lastUsedAt,
+		&revokedAt,
+		&key.CreateAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+		return nil, err
+	}
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+
+	return &key, nil
+}
@@ -0,0 +1,416 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/lib/pq"
+	"sort"
+	"strings"
+	"time"
+)
+
+// purgeBatchSize bounds how many events a single retention delete removes,
+// so that purging a large backlog does not hold long locks.
+const purgeBatchSize = 10000
+
+const auditColumns = `event_id, event_type, COALESCE(user_id::text, ''), COALESCE(org_id::text, ''), session_id,
+	COALESCE(host(ip_address), ''), user_agent, outcome, reason, metadata, created_at, COALESCE(chain_seq, 0), prev_hash, event_hash`
+
+type Audit struct {
+	db   *sql.DB
+	opts *models.Options
+}
+
+func NewAudit(db *sql.DB, opts *models.Options) *Audit {
+	return &Audit{
+		db:   db,
+		opts: opts,
+	}
+}
+
+func (a *Audit) Record(ctx context.Context, event *models.AuditEvent) error {
+	return a.RecordBatch(ctx, []*models.AuditEvent{event})
+}
+
+// RecordBatch appends the events to their chains in a single transaction.
+// The heads of the chains are locked in a fixed order, so that concurrent
+// writers append one after the other without deadlocking. Events keep the
+// time they were logged at, not the time they were written.
+func (a *Audit) RecordBatch(ctx context.Context, events []*models.AuditEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	heads := map[string]*models.AuditChainHead{}
+	for _, event := range events {
+		heads[event.OrgID] = nil
+	}
+	chains := make([]string, 0, len(heads))
+	for chainID := range heads {
+		chains = append(chains, chainID)
+	}
+	sort.Strings(chains)
+
+	lock := fmt.Sprintf(`INSERT INTO %s (chain_id) VALUES ($1)
+		ON CONFLICT (chain_id) DO UPDATE SET chain_id = EXCLUDED.chain_id
+		RETURNING last_seq, last_hash`, models.AuditChainTable)
+	for _, chainID := range chains {
+		head := &models.AuditChainHead{ChainID: chainID}
+		if err := tx.QueryRowContext(ctx, lock, chainID).Scan(&head.LastSeq, &head.LastHash); err != nil {
+			return err
+		}
+		heads[chainID] = head
+	}
+
+	const columns = 13
+	values := make([]string, 0, len(events))
+	args := make([]interface{}, 0, len(events)*columns)
+	for i, event := range events {
+		if event.Metadata == nil {
+			event.Metadata = map[string]string{}
+		}
+		if event.CreateAt.IsZero() {
+			event.CreateAt = time.Now()
+		}
+		event.CreateAt = event.CreateAt.Round(time.Microsecond)
+
+		head := heads[event.OrgID]
+		head.LastSeq++
+		event.Seq, event.PrevHash = head.LastSeq, head.LastHash
+		event.Hash = event.ChainHash()
+		head.LastHash = event.Hash
+
+		metadata, err := json.Marshal(event.Metadata)
+		if err != nil {
+			return err
+		}
+
+		n := i * columns
+		values = append(values, fmt.Sprintf("($%d, NULLIF($%d, '')::uuid, NULLIF($%d, '')::uuid, $%d, NULLIF($%d, '')::inet, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)",
+			n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9, n+10, n+11, n+12, n+13))
+		args = append(args, event.Type, event.UserID, event.OrgID, event.SessionID, event.IP, event.UserAgent, event.Outcome, event.Reason,
+			metadata, event.CreateAt, event.Seq, event.PrevHash, event.Hash)
+	}
+
+	query := fmt.Sprintf(`INSERT INTO %s (event_type, user_id, org_id, session_id, ip_address, user_agent, outcome, reason, metadata, created_at,
+		chain_seq, prev_hash, event_hash) VALUES %s`, models.AuditTable, strings.Join(values, ", "))
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+
+	update := fmt.Sprintf("UPDATE %s SET last_seq = $2, last_hash = $3, updated_at = CURRENT_TIMESTAMP WHERE chain_id = $1", models.AuditChainTable)
+	for _, chainID := range chains {
+		head := heads[chainID]
+		if _, err := tx.ExecContext(ctx, update, chainID, head.LastSeq, head.LastHash); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (a *Audit) QueryAuditEvents(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.UserID != "" {
+		where("user_id = $%d::uuid", filter.UserID)
+	}
+	if filter.OrgID != "" {
+		where("org_id = $%d::uuid", filter.OrgID)
+	}
+	if len(filter.Types) > 0 {
+		where("event_type = ANY($%d)", pq.Array(filter.Types))
+	}
+	if filter.Outcome != "" {
+		where("outcome = $%d", filter.Outcome)
+	}
+	if !filter.Since.IsZero() {
+		where("created_at >= $%d", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		where("created_at < $%d", filter.Until)
+	}
+	if filter.BeforeID > 0 {
+		where("event_id < $%d", filter.BeforeID)
+	}
+	if filter.AfterID > 0 {
+		where("event_id > $%d", filter.AfterID)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s", auditColumns, models.AuditTable)
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	order := "DESC"
+	if filter.Ascending {
+		order = "ASC"
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(" ORDER BY event_id %s LIMIT $%d", order, len(args))
+
+	return a.query(ctx, query, args...)
+}
+
+// ChainEvents returns up to limit events of the chain following afterSeq,
+// in chain order.
+func (a *Audit) ChainEvents(ctx context.Context, chainID string, afterSeq int64, limit int) ([]models.AuditEvent, error) {
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE COALESCE(org_id::text, '') = $1 AND chain_seq > $2
+		ORDER BY chain_seq LIMIT $3`, auditColumns, models.AuditTable)
+
+	return a.query(ctx, query, chainID, afterSeq, limit)
+}
+
+func (a *Audit) AuditChains(ctx context.Context) ([]models.AuditChainHead, error) {
+	query := fmt.Sprintf("SELECT chain_id, last_seq, last_hash, updated_at FROM %s ORDER BY chain_id", models.AuditChainTable)
+
+	return a.queryHeads(ctx, query)
+}
+
+func (a *Audit) AuditChain(ctx context.Context, chainID string) (*models.AuditChainHead, error) {
+	query := fmt.Sprintf("SELECT chain_id, last_seq, last_hash, updated_at FROM %s WHERE chain_id = $1", models.AuditChainTable)
+
+	var head models.AuditChainHead
+	err := a.db.QueryRowContext(ctx, query, chainID).Scan(&head.ChainID, &head.LastSeq, &head.LastHash, &head.UpdateAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &head, nil
+}
+
+// UncheckpointedChains returns the heads of the chains that grew since
+// their last checkpoint.
+func (a *Audit) UncheckpointedChains(ctx context.Context) ([]models.AuditChainHead, error) {
+	query := fmt.Sprintf(`SELECT c.chain_id, c.last_seq, c.last_hash, c.updated_at FROM %s c
+		WHERE c.last_seq > COALESCE((SELECT MAX(k.chain_seq) FROM %s k WHERE k.chain_id = c.chain_id), 0)
+		ORDER BY c.chain_id`, models.AuditChainTable, models.AuditCheckpointTable)
+
+	return a.queryHeads(ctx, query)
+}
+
+// RecordCheckpoint stores a checkpoint. Checkpoints of the same chain
+// position made by another instance are kept as they are.
+func (a *Audit) RecordCheckpoint(ctx context.Context, checkpoint *models.AuditCheckpoint) error {
+	query := fmt.Sprintf(`INSERT INTO %s (chain_id, chain_seq, event_hash, signature) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (chain_id, chain_seq) DO NOTHING`, models.AuditCheckpointTable)
+	_, err := a.db.ExecContext(ctx, query, checkpoint.ChainID, checkpoint.Seq, checkpoint.Hash, checkpoint.Signature)
+
+	return err
+}
+
+func (a *Audit) AuditCheckpoints(ctx context.Context, chainID string) ([]models.AuditCheckpoint, error) {
+	query := fmt.Sprintf(`SELECT checkpoint_id, chain_id, chain_seq, event_hash, signature, created_at FROM %s
+		WHERE chain_id = $1 ORDER BY chain_seq`, models.AuditCheckpointTable)
+
+	rows, err := a.db.QueryContext(ctx, query, chainID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checkpoints []models.AuditCheckpoint
+	for rows.Next() {
+		var checkpoint models.AuditCheckpoint
+		err := rows.Scan(&checkpoint.ID, &checkpoint.ChainID, &checkpoint.Seq, &checkpoint.Hash, &checkpoint.Signature, &checkpoint.CreateAt)
+		if err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, checkpoint)
+	}
+
+	return checkpoints, rows.Err()
+}
+
+// RecordPurgeWatermark stores the watermark of a chain, unless the chain
+// has one further along already.
+func (a *Audit) RecordPurgeWatermark(ctx context.Context, watermark *models.AuditPurgeWatermark) error {
+	query := fmt.Sprintf(`INSERT INTO %[1]s (chain_id, chain_seq, event_hash, signature) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (chain_id) DO UPDATE SET chain_seq = EXCLUDED.chain_seq, event_hash = EXCLUDED.event_hash,
+			signature = EXCLUDED.signature, updated_at = CURRENT_TIMESTAMP
+		WHERE %[1]s.chain_seq < EXCLUDED.chain_seq`, models.AuditWatermarkTable)
+	_, err := a.db.ExecContext(ctx, query, watermark.ChainID, watermark.Seq, watermark.Hash, watermark.Signature)
+
+	return err
+}
+
+func (a *Audit) AuditPurgeWatermark(ctx context.Context, chainID string) (*models.AuditPurgeWatermark, error) {
+	query := fmt.Sprintf("SELECT chain_id, chain_seq, event_hash, signature, updated_at FROM %s WHERE chain_id = $1", models.AuditWatermarkTable)
+
+	var watermark models.AuditPurgeWatermark
+	err := a.db.QueryRowContext(ctx, query, chainID).Scan(&watermark.ChainID, &watermark.Seq, &watermark.Hash, &watermark.Signature, &watermark.UpdateAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &watermark, nil
+}
+
+// PurgeAuditEvents deletes the events created before the given time and
+// returns the range of every chain it deleted. Events are deleted oldest
+// first up to the last one written before that time, so that the chains
+// only ever lose their beginning and never have holes.
+func (a *Audit) PurgeAuditEvents(ctx context.Context, before time.Time) ([]models.AuditPurgedRange, error) {
+	var last sql.NullInt64
+	query := fmt.Sprintf("SELECT MAX(event_id) FROM %s WHERE created_at < $1", models.AuditTable)
+	if err := a.db.QueryRowContext(ctx, query, before).Scan(&last); err != nil {
+		return nil, err
+	}
+	if !last.Valid {
+		return nil, nil
+	}
+
+	query = fmt.Sprintf(`DELETE FROM %[1]s WHERE event_id IN
+		(SELECT event_id FROM %[1]s WHERE event_id <= $1 ORDER BY event_id LIMIT $2)
+		RETURNING COALESCE(org_id::text, ''), COALESCE(chain_seq, 0), COALESCE(event_hash, '')`, models.AuditTable)
+
+	ranges := map[string]*models.AuditPurgedRange{}
+	var chains []string
+	for {
+		rows, err := a.db.QueryContext(ctx, query, last.Int64, purgeBatchSize)
+		if err != nil {
+			return purgedRanges(ranges, chains), err
+		}
+
+		var deleted int
+		for rows.Next() {
+			var (
+				chainID, hash string
+				seq           int64
+			)
+			if err := rows.Scan(&chainID, &seq, &hash); err != nil {
+				rows.Close()
+				return purgedRanges(ranges, chains), err
+			}
+			deleted++
+
+			// Events written before the chains existed have no place in
+			// them.
+			if seq == 0 {
+				continue
+			}
+			r, ok := ranges[chainID]
+			if !ok {
+				r = &models.AuditPurgedRange{ChainID: chainID, FirstSeq: seq}
+				ranges[chainID] = r
+				chains = append(chains, chainID)
+			}
+			r.FirstSeq = min(r.FirstSeq, seq)
+			if seq > r.LastSeq {
+				r.LastSeq, r.LastHash = seq, hash
+			}
+			r.Events++
+		}
+		if err := rows.Close(); err != nil {
+			return purgedRanges(ranges, chains), err
+		}
+		if err := rows.Err(); err != nil {
+			return purgedRanges(ranges, chains), err
+		}
+		if deleted < purgeBatchSize {
+			return purgedRanges(ranges, chains), nil
+		}
+	}
+}
+
+func purgedRanges(ranges map[string]*models.AuditPurgedRange, chains []string) []models.AuditPurgedRange {
+	purged := make([]models.AuditPurgedRange, 0, len(chains))
+	for _, chainID := range chains {
+		purged = append(purged, *ranges[chainID])
+	}
+
+	return purged
+}
+
+func (a *Audit) query(ctx context.Context, query string, args ...interface{}) ([]models.AuditEvent, error) {
+	rows, err := a.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.AuditEvent
+	for rows.Next() {
+		event, err := a.scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *event)
+	}
+
+	return events, rows.Err()
+}
+
+func (a *Audit) queryHeads(ctx context.Context, query string) ([]models.AuditChainHead, error) {
+	rows, err := a.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var heads []models.AuditChainHead
+	for rows.Next() {
+		var head models.AuditChainHead
+		if err := rows.Scan(&head.ChainID, &head.LastSeq, &head.LastHash, &head.UpdateAt); err != nil {
+			return nil, err
+		}
+		heads = append(heads, head)
+	}
+
+	return heads, rows.Err()
+}
+
+func (a *Audit) scan(row interface{ Scan(...interface{}) error }) (*models.AuditEvent, error) {
+	var (
+		event    models.AuditEvent
+		metadata []byte
+	)
+
+	err := row.Scan(
+		&event.ID,
+		&event.Type,
+		&event.UserID,
+		&event.OrgID,
+		&event.SessionID,
+		&event.IP,
+		&event.UserAgent,
+		&event.Outcome,
+		&event.Reason,
+		&metadata,
+		&event.CreateAt,
+		&event.Seq,
+		&event.PrevHash,
+		&event.Hash,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(metadata, &event.Metadata); err != nil {
+		return nil, err
+	}
+
+	return &event, nil
+}
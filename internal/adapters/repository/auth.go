@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/co1seam/ember-backend-auth/internal/core/models"
 )
@@ -20,25 +21,54 @@ func NewAuthorization(db *sql.DB, opts *models.Options) *Authorization {
 }
 
 func (a *Authorization) Create(ctx context.Context, entity ...interface{}) (interface{}, error) {
-	var id int
+	var id string
 	user := entity[0].(models.SignUpRequest)
 
-	query := fmt.Sprintf("INSERT INTO %s (user_name,user_email,user_password) VALUES ($1, $2, $3) RETURNING user_id", models.UserTable)
-	err := a.db.QueryRowContext(ctx, query, user.Name, user.Email, user.Password).Scan(&id)
+	tx, err := a.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
+
+	// The user is created together with the default role in one statement, so
+	// that no user ever exists without it.
+	query := fmt.Sprintf(`WITH created AS (INSERT INTO %s (user_name,user_email,user_password,user_status) VALUES ($1, $2, $3, COALESCE(NULLIF($5, ''), 'pending')) RETURNING user_id),
+		assigned AS (INSERT INTO %s (user_id, role_name) SELECT created.user_id, r.role_name FROM created, %s r WHERE r.role_name = $4)
+		SELECT user_id FROM created`, models.UserTable, models.UserRoleTable, models.RoleTable)
+	err = tx.QueryRowContext(ctx, query, user.Name, user.Email, user.Password, a.opts.Config.RBAC.DefaultRole, user.Status).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	status := user.Status
+	if status == "" {
+		status = models.UserStatusPending
+	}
+	event, err := models.NewUserEvent(models.EventUserSignedUp, models.UserEventData{UserID: id, Email: user.Email, Name: user.Name, Status: status})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeOutboxEvent(ctx, tx, event); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 
 	return id, nil
 }
 
 func (a *Authorization) Read(ctx context.Context, entity ...interface{}) (interface{}, error) {
-	var id int
+	var id string
 	request := entity[0].(models.SignInRequest)
 
 	query := fmt.Sprintf("SELECT user_id FROM %s WHERE user_email = $1 AND user_password = $2", models.UserTable)
 	err := a.db.QueryRowContext(ctx, query, request.Email, request.Password).Scan(&id)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrUnauthorized
+		}
 		return nil, err
 	}
 
@@ -46,7 +76,41 @@ func (a *Authorization) Read(ctx context.Context, entity ...interface{}) (interf
 }
 
 func (a *Authorization) Update(ctx context.Context, entity ...interface{}) (interface{}, error) {
-	return nil, nil
+	request := entity[0].(models.SetPasswordRequest)
+
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf("UPDATE %s SET user_password = $1, updated_at = CURRENT_TIMESTAMP WHERE user_id = $2", models.UserTable)
+	res, err := tx.ExecContext(ctx, query, request.Password, request.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rows == 0 {
+		return nil, models.ErrNotFound
+	}
+
+	event, err := models.NewUserEvent(models.EventUserPasswordChanged, models.UserEventData{UserID: request.UserID})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeOutboxEvent(ctx, tx, event); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return request.UserID, nil
 }
 
 func (a *Authorization) Delete(ctx context.Context, filter ...interface{}) (interface{}, error) {
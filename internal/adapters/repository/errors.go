@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"errors"
+	"github.com/lib/pq"
+)
+
+// Postgres error codes the repositories translate into domain errors.
+const (
+	foreignKeyViolation = "23503"
+	uniqueViolation     = "23505"
+)
+
+func isPQError(err error, code string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && string(pqErr.Code) == code
+}
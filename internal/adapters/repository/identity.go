@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+)
+
+type Identity struct {
+	db   *sql.DB
+	opts *models.Options
+}
+
+func NewIdentity(db *sql.DB, opts *models.Options) *Identity {
+	return &Identity{
+		db:   db,
+		opts: opts,
+	}
+}
+
+func (i *Identity) GetIdentity(ctx context.Context, provider, subject string) (*models.LinkedIdentity, error) {
+	var (
+		identity models.LinkedIdentity
+		email    sql.NullString
+	)
+
+	query := fmt.Sprintf("SELECT provider, subject, user_id, email, created_at, last_login_at FROM %s WHERE provider = $1 AND subject = $2", models.IdentityTable)
+	err := i.db.QueryRowContext(ctx, query, provider, subject).Scan(
+		&identity.Provider,
+		&identity.Subject,
+		&identity.UserID,
+		&email,
+		&identity.CreateAt,
+		&identity.LastLoginAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+		return nil, err
+	}
+	identity.Email = email.String
+
+	return &identity, nil
+}
+
+func (i *Identity) ListIdentities(ctx context.Context, userID string) ([]models.LinkedIdentity, error) {
+	query := fmt.Sprintf("SELECT provider, subject, user_id, email, created_at, last_login_at FROM %s WHERE user_id = $1 ORDER BY created_at", models.IdentityTable)
+	rows, err := i.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []models.LinkedIdentity
+	for rows.Next() {
+		var (
+			identity models.LinkedIdentity
+			email    sql.NullString
+		)
+		if err := rows.Scan(
+			&identity.Provider,
+			&identity.Subject,
+			&identity.UserID,
+			&email,
+			&identity.CreateAt,
+			&identity.LastLoginAt,
+		); err != nil {
+			return nil, err
+		}
+		identity.Email = email.String
+		identities = append(identities, identity)
+	}
+
+	return identities, rows.Err()
+}
+
+func (i *Identity) CreateIdentity(ctx context.Context, identity *models.LinkedIdentity) error {
+	query := fmt.Sprintf("INSERT INTO %s (provider, subject, user_id, email) VALUES ($1, $2, $3, NULLIF($4, ''))", models.IdentityTable)
+	_, err := i.db.ExecContext(ctx, query, identity.Provider, identity.Subject, identity.UserID, identity.Email)
+
+	return err
+}
+
+// CreateUserWithIdentity registers a password-less user together with the
+// external identity it was created from and the default role.
+func (i *Identity) CreateUserWithIdentity(ctx context.Context, user *models.User, identity *models.LinkedIdentity) (string, error) {
+	tx, err := i.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var id string
+	query := fmt.Sprintf("INSERT INTO %s (user_name, user_email) VALUES (NULLIF($1, ''), $2) RETURNING user_id", models.UserTable)
+	if err := tx.QueryRowContext(ctx, query, user.Name, user.Email).Scan(&id); err != nil {
+		return "", err
+	}
+
+	query = fmt.Sprintf("INSERT INTO %s (provider, subject, user_id, email) VALUES ($1, $2, $3, NULLIF($4, ''))", models.IdentityTable)
+	if _, err := tx.ExecContext(ctx, query, identity.Provider, identity.Subject, id, identity.Email); err != nil {
+		return "", err
+	}
+
+	query = fmt.Sprintf("INSERT INTO %s (user_id, role_name) SELECT $1, role_name FROM %s WHERE role_name = $2", models.UserRoleTable, models.RoleTable)
+	if _, err := tx.ExecContext(ctx, query, id, i.opts.Config.RBAC.DefaultRole); err != nil {
+		return "", err
+	}
+
+	event, err := models.NewUserEvent(models.EventUserSignedUp, models.UserEventData{UserID: id, Email: user.Email, Name: user.Name, Status: models.UserStatusActive})
+	if err != nil {
+		return "", err
+	}
+	if err := writeOutboxEvent(ctx, tx, event); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+func (i *Identity) TouchIdentity(ctx context.Context, provider, subject string) error {
+	query := fmt.Sprintf("UPDATE %s SET last_login_at = CURRENT_TIMESTAMP WHERE provider = $1 AND subject = $2", models.IdentityTable)
+	_, err := i.db.ExecContext(ctx, query, provider, subject)
+
+	return err
+}
+
+// DeleteIdentity unlinks an identity unless it is the last way the user can
+// sign in, in which case models.ErrLastLoginMethod is returned. Under READ
+// COMMITTED a single statement would not do: two unlinks of a user's last
+// two identities would each count the other and both delete. The user row
+// is locked instead, so that unlinks of the same user run one at a time and
+// each sees what the previous one deleted.
+func (i *Identity) DeleteIdentity(ctx context.Context, userID, provider, subject string) error {
+	tx, err := i.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var hasPassword bool
+	query := fmt.Sprintf("SELECT user_password IS NOT NULL FROM %s WHERE user_id = $1 FOR UPDATE", models.UserTable)
+	if err := tx.QueryRowContext(ctx, query, userID).Scan(&hasPassword); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrNotFound
+		}
+		return err
+	}
+
+	var identities int
+	query = fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE user_id = $1", models.IdentityTable)
+	if err := tx.QueryRowContext(ctx, query, userID).Scan(&identities); err != nil {
+		return err
+	}
+	if !hasPassword && identities <= 1 {
+		return models.ErrLastLoginMethod
+	}
+
+	query = fmt.Sprintf("DELETE FROM %s WHERE user_id = $1 AND provider = $2 AND subject = $3", models.IdentityTable)
+	res, err := tx.ExecContext(ctx, query, userID, provider, subject)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return models.ErrNotFound
+	}
+
+	return tx.Commit()
+}
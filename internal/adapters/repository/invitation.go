@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"time"
+)
+
+const invitationColumns = `invitation_id, org_id, email, member_role, COALESCE(invited_by::text, ''), expires_at,
+	accepted_at, COALESCE(accepted_by::text, ''), revoked_at, created_at, updated_at`
+
+// Invitation stores organization invitations. Like Organization, every
+// query except the token lookup is scoped by an explicit org_id.
+type Invitation struct {
+	db   *sql.DB
+	opts *models.Options
+}
+
+func NewInvitation(db *sql.DB, opts *models.Options) *Invitation {
+	return &Invitation{
+		db:   db,
+		opts: opts,
+	}
+}
+
+// CreateInvitation stores a new invitation. Expired invitations for the same
+// address are revoked first so they do not block a fresh one.
+func (i *Invitation) CreateInvitation(ctx context.Context, invitation *models.Invitation, tokenHash string) (string, error) {
+	tx, err := i.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`UPDATE %s SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE org_id = $1 AND lower(email) = lower($2) AND accepted_at IS NULL AND revoked_at IS NULL
+		AND expires_at <= CURRENT_TIMESTAMP`, models.InvitationTable)
+	if _, err := tx.ExecContext(ctx, query, invitation.OrgID, invitation.Email); err != nil {
+		return "", err
+	}
+
+	var id string
+	query = fmt.Sprintf(`INSERT INTO %s (org_id, email, member_role, invited_by, token_hash, expires_at)
+		VALUES ($1, $2, $3, NULLIF($4, '')::uuid, $5, $6) RETURNING invitation_id`, models.InvitationTable)
+	err = tx.QueryRowContext(ctx, query, invitation.OrgID, invitation.Email, invitation.Role, invitation.InvitedBy, tokenHash, invitation.ExpiresAt).Scan(&id)
+	switch {
+	case isPQError(err, uniqueViolation):
+		return "", models.ErrInvitationExists
+	case isPQError(err, foreignKeyViolation):
+		return "", models.ErrNotFound
+	case err != nil:
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+func (i *Invitation) GetInvitation(ctx context.Context, orgID, invitationID string) (*models.Invitation, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE org_id = $1 AND invitation_id = $2", invitationColumns, models.InvitationTable)
+
+	return i.scan(i.db.QueryRowContext(ctx, query, orgID, invitationID))
+}
+
+func (i *Invitation) GetInvitationByTokenHash(ctx context.Context, tokenHash string) (*models.Invitation, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE token_hash = $1", invitationColumns, models.InvitationTable)
+
+	return i.scan(i.db.QueryRowContext(ctx, query, tokenHash))
+}
+
+// ListInvitations returns the open, possibly expired, invitations of an
+// organization, newest first.
+func (i *Invitation) ListInvitations(ctx context.Context, orgID string) ([]models.Invitation, error) {
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE org_id = $1 AND accepted_at IS NULL AND revoked_at IS NULL
+		ORDER BY created_at DESC, invitation_id`, invitationColumns, models.InvitationTable)
+	rows, err := i.db.QueryContext(ctx, query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invitations []models.Invitation
+	for rows.Next() {
+		invitation, err := i.scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, *invitation)
+	}
+
+	return invitations, rows.Err()
+}
+
+// RenewInvitation replaces the token of an open invitation and extends it.
+func (i *Invitation) RenewInvitation(ctx context.Context, orgID, invitationID, tokenHash string, expiresAt time.Time) error {
+	query := fmt.Sprintf(`UPDATE %s SET token_hash = $3, expires_at = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE org_id = $1 AND invitation_id = $2 AND accepted_at IS NULL AND revoked_at IS NULL`, models.InvitationTable)
+
+	return i.exec(ctx, query, orgID, invitationID, tokenHash, expiresAt)
+}
+
+func (i *Invitation) RevokeInvitation(ctx context.Context, orgID, invitationID string) error {
+	query := fmt.Sprintf(`UPDATE %s SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE org_id = $1 AND invitation_id = $2 AND accepted_at IS NULL AND revoked_at IS NULL`, models.InvitationTable)
+
+	return i.exec(ctx, query, orgID, invitationID)
+}
+
+// DeleteInvitation removes an invitation that was never accepted, such as
+// one whose email could not be sent.
+func (i *Invitation) DeleteInvitation(ctx context.Context, orgID, invitationID string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE org_id = $1 AND invitation_id = $2 AND accepted_at IS NULL", models.InvitationTable)
+
+	return i.exec(ctx, query, orgID, invitationID)
+}
+
+// AcceptInvitation marks a pending invitation accepted, adds the user to the
+// organization and, when the invitation was sent to the user's address,
+// marks that address verified. An existing membership keeps its role.
+func (i *Invitation) AcceptInvitation(ctx context.Context, invitationID, userID string) error {
+	tx, err := i.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var orgID, email, role string
+	query := fmt.Sprintf(`UPDATE %s SET accepted_at = CURRENT_TIMESTAMP, accepted_by = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE invitation_id = $1 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING org_id, email, member_role`, models.InvitationTable)
+	err = tx.QueryRowContext(ctx, query, invitationID, userID).Scan(&orgID, &email, &role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrInvitationInvalid
+		}
+		return err
+	}
+
+	query = fmt.Sprintf("INSERT INTO %s (org_id, user_id, member_role) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING", models.OrganizationMemberTable)
+	if _, err := tx.ExecContext(ctx, query, orgID, userID, role); err != nil {
+		return err
+	}
+
+	var verified string
+	query = fmt.Sprintf(`UPDATE %s SET user_email_verified_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND lower(user_email) = lower($2) AND user_email_verified_at IS NULL RETURNING user_email`, models.UserTable)
+	err = tx.QueryRowContext(ctx, query, userID, email).Scan(&verified)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Sent to another address, or the address is verified already.
+		return tx.Commit()
+	}
+	if err != nil {
+		return err
+	}
+
+	event, err := models.NewUserEvent(models.EventUserEmailVerified, models.UserEventData{UserID: userID, Email: verified})
+	if err != nil {
+		return err
+	}
+	if err := writeOutboxEvent(ctx, tx, event); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (i *Invitation) exec(ctx context.Context, query string, args ...interface{}) error {
+	res, err := i.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
+func (i *Invitation) scan(row interface{ Scan(...interface{}) error }) (*models.Invitation, error) {
+	var (
+		invitation models.Invitation
+		acceptedAt sql.NullTime
+		revokedAt  sql.NullTime
+	)
+
+	err := row.Scan(
+		&invitation.ID,
+		&invitation.OrgID,
+		&invitation.Email,
+		&invitation.Role,
+		&invitation.InvitedBy,
+		&invitation.ExpiresAt,
+		&acceptedAt,
+		&invitation.AcceptedBy,
+		&revokedAt,
+		&invitation.CreateAt,
+		&invitation.UpdateAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+		return nil, err
+	}
+	if acceptedAt.Valid {
+		invitation.AcceptedAt = &acceptedAt.Time
+	}
+	if revokedAt.Valid {
+		invitation.RevokedAt = &revokedAt.Time
+	}
+
+	return &invitation, nil
+}
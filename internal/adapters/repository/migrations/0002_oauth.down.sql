@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS oauth_consents;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS oauth_clients;
+
+ALTER TABLE users ALTER COLUMN user_id DROP DEFAULT;
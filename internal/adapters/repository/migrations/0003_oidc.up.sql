@@ -0,0 +1 @@
+ALTER TABLE sessions ADD COLUMN auth_time TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP;
@@ -0,0 +1,39 @@
+CREATE TABLE roles (
+    role_name VARCHAR(64) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE permissions (
+    permission_name VARCHAR(128) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE role_permissions (
+    role_name VARCHAR(64) NOT NULL REFERENCES roles (role_name) ON DELETE CASCADE,
+    permission_name VARCHAR(128) NOT NULL REFERENCES permissions (permission_name) ON DELETE CASCADE,
+    PRIMARY KEY (role_name, permission_name)
+);
+
+CREATE TABLE user_roles (
+    user_id UUID NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    role_name VARCHAR(64) NOT NULL REFERENCES roles (role_name) ON DELETE CASCADE,
+    granted_by UUID REFERENCES users (user_id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, role_name)
+);
+
+INSERT INTO roles (role_name, description) VALUES
+    ('user', 'Default role of every registered user'),
+    ('admin', 'Full administrative access');
+
+INSERT INTO permissions (permission_name, description) VALUES
+    ('roles:read', 'View the roles of any user'),
+    ('roles:manage', 'Assign and revoke roles');
+
+INSERT INTO role_permissions (role_name, permission_name) VALUES
+    ('admin', 'roles:read'),
+    ('admin', 'roles:manage');
+
+INSERT INTO user_roles (user_id, role_name) SELECT user_id, 'user' FROM users;
@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE permission_name = 'relations:write';
+DROP TABLE IF EXISTS relation_revision;
+DROP TABLE IF EXISTS relation_tuples;
@@ -0,0 +1,28 @@
+CREATE TABLE relation_tuples (
+    namespace VARCHAR(64) NOT NULL,
+    object_id VARCHAR(255) NOT NULL,
+    relation VARCHAR(64) NOT NULL,
+    subject_namespace VARCHAR(64) NOT NULL,
+    subject_id VARCHAR(255) NOT NULL,
+    subject_relation VARCHAR(64) NOT NULL DEFAULT '',
+    revision BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (namespace, object_id, relation, subject_namespace, subject_id, subject_relation)
+);
+
+CREATE INDEX relation_tuples_subject_idx ON relation_tuples (subject_namespace, subject_id, subject_relation);
+
+-- A single row counter instead of a sequence: it is updated inside the write
+-- transaction, so a revision only becomes visible together with its tuples.
+CREATE TABLE relation_revision (
+    singleton BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (singleton),
+    revision BIGINT NOT NULL
+);
+
+INSERT INTO relation_revision (revision) VALUES (0);
+
+INSERT INTO permissions (permission_name, description) VALUES
+    ('relations:write', 'Write and delete relation tuples');
+
+INSERT INTO role_permissions (role_name, permission_name) VALUES
+    ('admin', 'relations:write');
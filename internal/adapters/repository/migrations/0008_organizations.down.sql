@@ -0,0 +1,4 @@
+DELETE FROM permissions WHERE permission_name = 'organizations:domains';
+DROP TABLE IF EXISTS organization_domains;
+DROP TABLE IF EXISTS organization_members;
+DROP TABLE IF EXISTS organizations;
@@ -0,0 +1,35 @@
+CREATE TABLE organizations (
+    org_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    org_name VARCHAR(255) NOT NULL,
+    org_slug VARCHAR(64) UNIQUE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE organization_members (
+    org_id UUID NOT NULL REFERENCES organizations (org_id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    member_role VARCHAR(32) NOT NULL CHECK (member_role IN ('owner', 'admin', 'member')),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (org_id, user_id)
+);
+
+CREATE INDEX organization_members_user_id_idx ON organization_members (user_id, created_at);
+
+-- Users signing up with an email in one of these domains join the
+-- organization automatically. A domain belongs to at most one organization.
+CREATE TABLE organization_domains (
+    domain VARCHAR(255) PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations (org_id) ON DELETE CASCADE,
+    member_role VARCHAR(32) NOT NULL DEFAULT 'member' CHECK (member_role IN ('admin', 'member')),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX organization_domains_org_id_idx ON organization_domains (org_id);
+
+INSERT INTO permissions (permission_name, description) VALUES
+    ('organizations:domains', 'Register email domains for organization auto-join');
+
+INSERT INTO role_permissions (role_name, permission_name) VALUES
+    ('admin', 'organizations:domains');
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS invitations;
+ALTER TABLE users DROP COLUMN IF EXISTS user_email_verified_at;
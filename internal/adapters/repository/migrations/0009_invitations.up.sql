@@ -0,0 +1,22 @@
+ALTER TABLE users ADD COLUMN user_email_verified_at TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE invitations (
+    invitation_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    org_id UUID NOT NULL REFERENCES organizations (org_id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    member_role VARCHAR(32) NOT NULL CHECK (member_role IN ('owner', 'admin', 'member')),
+    invited_by UUID REFERENCES users (user_id) ON DELETE SET NULL,
+    -- SHA-256 of the token sent by email. Resending replaces it, which
+    -- invalidates the previous link.
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    accepted_at TIMESTAMP WITH TIME ZONE,
+    accepted_by UUID REFERENCES users (user_id) ON DELETE SET NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- At most one open invitation per address and organization.
+CREATE UNIQUE INDEX invitations_open_email_idx ON invitations (org_id, lower(email))
+    WHERE accepted_at IS NULL AND revoked_at IS NULL;
@@ -0,0 +1,4 @@
+DELETE FROM permissions WHERE permission_name = 'service_accounts:manage';
+DELETE FROM oauth_clients WHERE client_id IN (SELECT client_id FROM service_accounts);
+DROP TABLE IF EXISTS oauth_client_keys;
+DROP TABLE IF EXISTS service_accounts;
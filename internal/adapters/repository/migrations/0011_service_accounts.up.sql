@@ -0,0 +1,24 @@
+-- A service account is a confidential OAuth client that acts on its own
+-- behalf. Its client_id is the subject of its tokens and its client scopes
+-- are the permissions it may request.
+CREATE TABLE service_accounts (
+    client_id VARCHAR(255) PRIMARY KEY REFERENCES oauth_clients (client_id) ON DELETE CASCADE,
+    description TEXT NOT NULL DEFAULT '',
+    created_by UUID REFERENCES users (user_id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Public keys for private_key_jwt client authentication (RFC 7523).
+CREATE TABLE oauth_client_keys (
+    client_id VARCHAR(255) NOT NULL REFERENCES oauth_clients (client_id) ON DELETE CASCADE,
+    key_id VARCHAR(64) NOT NULL,
+    public_key TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (client_id, key_id)
+);
+
+INSERT INTO permissions (permission_name, description) VALUES
+    ('service_accounts:manage', 'Create and manage service accounts');
+
+INSERT INTO role_permissions (role_name, permission_name) VALUES
+    ('admin', 'service_accounts:manage');
@@ -0,0 +1,2 @@
+DELETE FROM permissions WHERE permission_name = 'users:impersonate';
+DELETE FROM roles WHERE role_name = 'support';
@@ -0,0 +1,8 @@
+INSERT INTO roles (role_name, description) VALUES
+    ('support', 'Support staff allowed to impersonate users');
+
+INSERT INTO permissions (permission_name, description) VALUES
+    ('users:impersonate', 'Obtain tokens acting as another user through token exchange');
+
+INSERT INTO role_permissions (role_name, permission_name) VALUES
+    ('support', 'users:impersonate');
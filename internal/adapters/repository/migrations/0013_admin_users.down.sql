@@ -0,0 +1,5 @@
+DELETE FROM permissions WHERE permission_name IN ('users:read', 'users:manage');
+DROP INDEX IF EXISTS users_created_at_idx;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS user_disabled_reason,
+    DROP COLUMN IF EXISTS user_disabled_at;
@@ -0,0 +1,15 @@
+-- Disabled users can no longer sign in; the reason is shown to administrators.
+ALTER TABLE users
+    ADD COLUMN user_disabled_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN user_disabled_reason TEXT NOT NULL DEFAULT '';
+
+-- Keyset pagination of the admin user listing.
+CREATE INDEX users_created_at_idx ON users (created_at, user_id);
+
+INSERT INTO permissions (permission_name, description) VALUES
+    ('users:read', 'List and view user accounts'),
+    ('users:manage', 'Create, update, disable and sign out user accounts');
+
+INSERT INTO role_permissions (role_name, permission_name) VALUES
+    ('admin', 'users:read'),
+    ('admin', 'users:manage');
@@ -0,0 +1,13 @@
+ALTER TABLE users
+    ADD COLUMN user_disabled_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN user_disabled_reason TEXT NOT NULL DEFAULT '';
+
+UPDATE users SET user_disabled_at = COALESCE(user_status_changed_at, CURRENT_TIMESTAMP), user_disabled_reason = user_status_reason
+    WHERE user_status <> 'active';
+
+DROP INDEX IF EXISTS users_status_idx;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS user_status_changed_by,
+    DROP COLUMN IF EXISTS user_status_changed_at,
+    DROP COLUMN IF EXISTS user_status_reason,
+    DROP COLUMN IF EXISTS user_status;
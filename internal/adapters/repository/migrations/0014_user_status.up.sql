@@ -0,0 +1,17 @@
+-- The account status replaces the disabled flag. Which transitions between
+-- statuses are allowed is decided by the service.
+ALTER TABLE users
+    ADD COLUMN user_status VARCHAR(16) NOT NULL DEFAULT 'active'
+        CHECK (user_status IN ('pending', 'active', 'locked', 'disabled', 'deleted')),
+    ADD COLUMN user_status_reason TEXT NOT NULL DEFAULT '',
+    ADD COLUMN user_status_changed_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN user_status_changed_by UUID REFERENCES users (user_id) ON DELETE SET NULL;
+
+UPDATE users SET user_status = 'disabled', user_status_reason = user_disabled_reason, user_status_changed_at = user_disabled_at
+    WHERE user_disabled_at IS NOT NULL;
+
+ALTER TABLE users
+    DROP COLUMN user_disabled_at,
+    DROP COLUMN user_disabled_reason;
+
+CREATE INDEX users_status_idx ON users (user_status);
@@ -0,0 +1,10 @@
+DELETE FROM permissions WHERE permission_name = 'audit:read';
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+DROP FUNCTION IF EXISTS audit_events_append_only();
+DROP INDEX IF EXISTS audit_events_type_idx;
+DROP INDEX IF EXISTS audit_events_created_at_idx;
+ALTER TABLE audit_events
+    DROP COLUMN IF EXISTS reason,
+    DROP COLUMN IF EXISTS user_agent,
+    DROP COLUMN IF EXISTS ip_address,
+    DROP COLUMN IF EXISTS session_id;
@@ -0,0 +1,26 @@
+-- Authentication events record where a request came from and why it failed.
+ALTER TABLE audit_events
+    ADD COLUMN session_id VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN ip_address INET,
+    ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+    ADD COLUMN reason TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX audit_events_created_at_idx ON audit_events (created_at);
+CREATE INDEX audit_events_type_idx ON audit_events (event_type, created_at);
+
+-- The audit log is append-only. Rows are only ever deleted by the retention
+-- policy.
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only BEFORE UPDATE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+INSERT INTO permissions (permission_name, description) VALUES
+    ('audit:read', 'Read the audit log of every user');
+
+INSERT INTO role_permissions (role_name, permission_name) VALUES
+    ('admin', 'audit:read');
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS audit_checkpoints;
+DROP TABLE IF EXISTS audit_chains;
+DROP INDEX IF EXISTS audit_events_chain_idx;
+ALTER TABLE audit_events
+    DROP COLUMN IF EXISTS event_hash,
+    DROP COLUMN IF EXISTS prev_hash,
+    DROP COLUMN IF EXISTS chain_seq,
+    DROP COLUMN IF EXISTS org_id;
@@ -0,0 +1,32 @@
+-- Audit events form one hash chain per organization, and one for events
+-- that belong to no organization (chain_id ''). Each event stores the hash
+-- of its predecessor, so that editing or removing an event breaks the chain.
+-- Events recorded before this migration are not part of any chain.
+ALTER TABLE audit_events
+    ADD COLUMN org_id UUID,
+    ADD COLUMN chain_seq BIGINT,
+    ADD COLUMN prev_hash VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN event_hash VARCHAR(64) NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX audit_events_chain_idx ON audit_events ((COALESCE(org_id::text, '')), chain_seq)
+    WHERE chain_seq IS NOT NULL;
+
+-- The head of every chain. Writers lock it while appending events.
+CREATE TABLE audit_chains (
+    chain_id VARCHAR(64) PRIMARY KEY,
+    last_seq BIGINT NOT NULL DEFAULT 0,
+    last_hash VARCHAR(64) NOT NULL DEFAULT '',
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Checkpoints are signed with the service's signing key, so the chain up to
+-- a checkpoint cannot be rewritten without the key.
+CREATE TABLE audit_checkpoints (
+    checkpoint_id BIGSERIAL PRIMARY KEY,
+    chain_id VARCHAR(64) NOT NULL,
+    chain_seq BIGINT NOT NULL,
+    event_hash VARCHAR(64) NOT NULL,
+    signature TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (chain_id, chain_seq)
+);
@@ -0,0 +1,18 @@
+-- Domain events are written here in the same transaction as the change they
+-- describe, and published by the relay afterwards. An event stays until every
+-- sink accepted it, so it is delivered at least once.
+CREATE TABLE outbox_events (
+    event_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    event_type VARCHAR(64) NOT NULL,
+    schema_version INTEGER NOT NULL,
+    subject VARCHAR(64) NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error TEXT NOT NULL DEFAULT '',
+    published_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX outbox_events_pending_idx ON outbox_events (next_attempt_at, created_at) WHERE published_at IS NULL;
+CREATE INDEX outbox_events_published_idx ON outbox_events (published_at) WHERE published_at IS NOT NULL;
@@ -0,0 +1,5 @@
+INSERT INTO permissions (permission_name, description) VALUES
+    ('relations:read', 'Check and list the relations of other subjects');
+
+INSERT INTO role_permissions (role_name, permission_name) VALUES
+    ('admin', 'relations:read');
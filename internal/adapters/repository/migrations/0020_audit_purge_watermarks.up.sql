@@ -0,0 +1,12 @@
+-- The retention purge removes the beginning of every chain. The watermark
+-- records, signed with the service's signing key, up to which event a chain
+-- was purged, so that verification tells events removed by the purge from
+-- events removed by anyone else. Chains purged before this migration get
+-- their watermark at the next purge.
+CREATE TABLE audit_purge_watermarks (
+    chain_id VARCHAR(64) PRIMARY KEY,
+    chain_seq BIGINT NOT NULL,
+    event_hash VARCHAR(64) NOT NULL,
+    signature TEXT NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
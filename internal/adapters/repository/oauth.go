@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/lib/pq"
+)
+
+type OAuth struct {
+	db   *sql.DB
+	opts *models.Options
+}
+
+func NewOAuth(db *sql.DB, opts *models.Options) *OAuth {
+	return &OAuth{
+		db:   db,
+		opts: opts,
+	}
+}
+
+func (o *OAuth) GetClient(ctx context.Context, clientID string) (*models.Client, error) {
+	var (
+		client models.Client
+		secret sql.NullString
+	)
+
+	query := fmt.Sprintf(`SELECT client_id, client_secret_hash, client_name, client_type, redirect_uris, grant_types, scopes,
+		first_party, created_at, updated_at FROM %s WHERE client_id = $1`, models.ClientTable)
+	err := o.db.QueryRowContext(ctx, query, clientID).Scan(
+		&client.ID,
+		&secret,
+		&client.Name,
+		&client.Type,
+		pq.Array(&client.RedirectURIs),
+		pq.Array(&client.GrantTypes),
+		pq.Array(&client.Scopes),
+		&client.FirstParty,
+		&client.CreateAt,
+		&client.UpdateAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+		return nil, err
+	}
+	client.SecretHash = secret.String
+
+	return &client, nil
+}
+
+func (o *OAuth) CreateClient(ctx context.Context, client *models.Client) error {
+	query := fmt.Sprintf(`INSERT INTO %s (client_id, client_secret_hash, client_name, client_type, redirect_uris, grant_types,
+		scopes, first_party) VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7, $8)`, models.ClientTable)
+	_, err := o.db.ExecContext(ctx, query,
+		client.ID,
+		client.SecretHash,
+		client.Name,
+		client.Type,
+		pq.Array(client.RedirectURIs),
+		pq.Array(client.GrantTypes),
+		pq.Array(client.Scopes),
+		client.FirstParty,
+	)
+
+	return err
+}
+
+func (o *OAuth) GetConsent(ctx context.Context, userID, clientID string) (*models.Consent, error) {
+	var consent models.Consent
+
+	query := fmt.Sprintf("SELECT user_id, client_id, scopes, granted_at, revoked_at FROM %s WHERE user_id = $1 AND client_id = $2", models.ConsentTable)
+	err := o.db.QueryRowContext(ctx, query, userID, clientID).Scan(
+		&consent.UserID,
+		&consent.ClientID,
+		pq.Array(&consent.Scopes),
+		&consent.GrantedAt,
+		&consent.RevokedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &consent, nil
+}
+
+func (o *OAuth) SaveConsent(ctx context.Context, consent *models.Consent) error {
+	query := fmt.Sprintf(`INSERT INTO %s (user_id, client_id, scopes) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, client_id) DO UPDATE SET scopes = EXCLUDED.scopes, granted_at = CURRENT_TIMESTAMP, revoked_at = NULL`,
+		models.ConsentTable)
+	_, err := o.db.ExecContext(ctx, query, consent.UserID, consent.ClientID, pq.Array(consent.Scopes))
+
+	return err
+}
+
+func (o *OAuth) RevokeConsent(ctx context.Context, userID, clientID string) error {
+	query := fmt.Sprintf("UPDATE %s SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND client_id = $2", models.ConsentTable)
+	_, err := o.db.ExecContext(ctx, query, userID, clientID)
+
+	return err
+}
+
+func (o *OAuth) ListClientKeys(ctx context.Context, clientID string) ([]models.ClientKey, error) {
+	query := fmt.Sprintf("SELECT client_id, key_id, public_key, created_at FROM %s WHERE client_id = $1 ORDER BY created_at, key_id", models.ClientKeyTable)
+	rows, err := o.db.QueryContext(ctx, query, clientID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []models.ClientKey
+	for rows.Next() {
+		var key models.ClientKey
+		if err := rows.Scan(&key.ClientID, &key.ID, &key.PublicKey, &key.CreateAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// AddClientKey registers a public key. Adding a key the client already has
+// is not an error.
+func (o *OAuth) AddClientKey(ctx context.Context, key *models.ClientKey) error {
+	query := fmt.Sprintf("INSERT INTO %s (client_id, key_id, public_key) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING", models.ClientKeyTable)
+	_, err := o.db.ExecContext(ctx, query, key.ClientID, key.ID, key.PublicKey)
+	if isPQError(err, foreignKeyViolation) {
+		return models.ErrNotFound
+	}
+
+	return err
+}
+
+func (o *OAuth) RemoveClientKey(ctx context.Context, clientID, keyID string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE client_id = $1 AND key_id = $2", models.ClientKeyTable)
+	res, err := o.db.ExecContext(ctx, query, clientID, keyID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,287 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+)
+
+// Organization stores tenants and their memberships. Every query on tenant
+// data (memberships, domains and, in the Invitation repository, invitations)
+// is scoped by an explicit org_id so that one tenant can never read or change
+// another tenant's rows; only ListMemberships, which answers "which tenants
+// does this user belong to", crosses tenants by design.
+//
+// Tenant isolation stops there. Users, sessions, API keys, role assignments
+// and the audit log are global: a user belongs to any number of
+// organizations, and the permissions guarding those queries (users:manage,
+// audit:read, roles:manage) are server-wide grants that organization roles
+// never confer. The org_id claim selects the tenant for organization RPCs; it
+// does not narrow what the rest of the API returns.
+type Organization struct {
+	db   *sql.DB
+	opts *models.Options
+}
+
+func NewOrganization(db *sql.DB, opts *models.Options) *Organization {
+	return &Organization{
+		db:   db,
+		opts: opts,
+	}
+}
+
+// CreateOrganization creates an organization with ownerID as its first owner.
+func (o *Organization) CreateOrganization(ctx context.Context, org *models.Organization, ownerID string) (string, error) {
+	tx, err := o.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var id string
+	query := fmt.Sprintf("INSERT INTO %s (org_name, org_slug) VALUES ($1, $2) RETURNING org_id", models.OrganizationTable)
+	if err := tx.QueryRowContext(ctx, query, org.Name, org.Slug).Scan(&id); err != nil {
+		if isPQError(err, uniqueViolation) {
+			return "", models.ErrOrgSlugTaken
+		}
+		return "", err
+	}
+
+	query = fmt.Sprintf("INSERT INTO %s (org_id, user_id, member_role) VALUES ($1, $2, $3)", models.OrganizationMemberTable)
+	if _, err := tx.ExecContext(ctx, query, id, ownerID, models.OrgRoleOwner); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+func (o *Organization) GetOrganization(ctx context.Context, orgID string) (*models.Organization, error) {
+	var org models.Organization
+
+	query := fmt.Sprintf("SELECT org_id, org_name, org_slug, created_at, updated_at FROM %s WHERE org_id = $1", models.OrganizationTable)
+	err := o.db.QueryRowContext(ctx, query, orgID).Scan(&org.ID, &org.Name, &org.Slug, &org.CreateAt, &org.UpdateAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &org, nil
+}
+
+// ListMemberships returns the organizations of a user, oldest membership
+// first.
+func (o *Organization) ListMemberships(ctx context.Context, userID string) ([]models.Membership, error) {
+	query := fmt.Sprintf(`SELECT m.org_id, o.org_name, o.org_slug, m.user_id, m.member_role, m.created_at
+		FROM %s m JOIN %s o ON o.org_id = m.org_id
+		WHERE m.user_id = $1 ORDER BY m.created_at, m.org_id`, models.OrganizationMemberTable, models.OrganizationTable)
+	rows, err := o.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var memberships []models.Membership
+	for rows.Next() {
+		var m models.Membership
+		if err := rows.Scan(&m.OrgID, &m.OrgName, &m.OrgSlug, &m.UserID, &m.Role, &m.CreateAt); err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, m)
+	}
+
+	return memberships, rows.Err()
+}
+
+func (o *Organization) GetMembership(ctx context.Context, orgID, userID string) (*models.Membership, error) {
+	var m models.Membership
+
+	query := fmt.Sprintf("SELECT org_id, user_id, member_role, created_at FROM %s WHERE org_id = $1 AND user_id = $2", models.OrganizationMemberTable)
+	err := o.db.QueryRowContext(ctx, query, orgID, userID).Scan(&m.OrgID, &m.UserID, &m.Role, &m.CreateAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNotMember
+		}
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+func (o *Organization) ListMembers(ctx context.Context, orgID string) ([]models.Membership, error) {
+	query := fmt.Sprintf(`SELECT m.org_id, m.user_id, u.user_email, m.member_role, m.created_at
+		FROM %s m JOIN %s u ON u.user_id = m.user_id
+		WHERE m.org_id = $1 ORDER BY m.created_at, m.user_id`, models.OrganizationMemberTable, models.UserTable)
+	rows, err := o.db.QueryContext(ctx, query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []models.Membership
+	for rows.Next() {
+		var m models.Membership
+		if err := rows.Scan(&m.OrgID, &m.UserID, &m.Email, &m.Role, &m.CreateAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+
+	return members, rows.Err()
+}
+
+// AddMember adds a user to an organization. Adding an existing member is not
+// an error and leaves the current role untouched.
+func (o *Organization) AddMember(ctx context.Context, orgID, userID, role string) error {
+	query := fmt.Sprintf("INSERT INTO %s (org_id, user_id, member_role) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING", models.OrganizationMemberTable)
+	_, err := o.db.ExecContext(ctx, query, orgID, userID, role)
+	if isPQError(err, foreignKeyViolation) {
+		return models.ErrNotFound
+	}
+
+	return err
+}
+
+// UpdateMemberRole changes a member's role. Demoting the last owner fails with
+// models.ErrLastOwner.
+func (o *Organization) UpdateMemberRole(ctx context.Context, orgID, userID, role string) error {
+	return o.changeMember(ctx, orgID, userID, role != models.OrgRoleOwner, func(tx *sql.Tx) (sql.Result, error) {
+		query := fmt.Sprintf("UPDATE %s SET member_role = $3, updated_at = CURRENT_TIMESTAMP WHERE org_id = $1 AND user_id = $2", models.OrganizationMemberTable)
+		return tx.ExecContext(ctx, query, orgID, userID, role)
+	})
+}
+
+// RemoveMember removes a user from an organization unless they are its last
+// owner.
+func (o *Organization) RemoveMember(ctx context.Context, orgID, userID string) error {
+	return o.changeMember(ctx, orgID, userID, true, func(tx *sql.Tx) (sql.Result, error) {
+		query := fmt.Sprintf("DELETE FROM %s WHERE org_id = $1 AND user_id = $2", models.OrganizationMemberTable)
+		return tx.ExecContext(ctx, query, orgID, userID)
+	})
+}
+
+// changeMember applies change to a membership, refusing with
+// models.ErrLastOwner when it takes the owner role away from the last owner.
+// Under READ COMMITTED a statement counting owners in a subquery would not
+// do: two owners demoting each other would each count the other and both
+// succeed. The organization row is locked instead, so that membership
+// changes in one organization run one at a time and each sees the owners
+// the previous one left.
+func (o *Organization) changeMember(ctx context.Context, orgID, userID string, losesOwnership bool, change func(tx *sql.Tx) (sql.Result, error)) error {
+	tx, err := o.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf("SELECT org_id FROM %s WHERE org_id = $1 FOR UPDATE", models.OrganizationTable)
+	if err := tx.QueryRowContext(ctx, query, orgID).Scan(&orgID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrNotMember
+		}
+		return err
+	}
+
+	var role string
+	query = fmt.Sprintf("SELECT member_role FROM %s WHERE org_id = $1 AND user_id = $2", models.OrganizationMemberTable)
+	if err := tx.QueryRowContext(ctx, query, orgID, userID).Scan(&role); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrNotMember
+		}
+		return err
+	}
+
+	if losesOwnership && role == models.OrgRoleOwner {
+		var owners int
+		query = fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE org_id = $1 AND member_role = $2", models.OrganizationMemberTable)
+		if err := tx.QueryRowContext(ctx, query, orgID, models.OrgRoleOwner).Scan(&owners); err != nil {
+			return err
+		}
+		if owners <= 1 {
+			return models.ErrLastOwner
+		}
+	}
+
+	if _, err := change(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (o *Organization) AddDomain(ctx context.Context, orgID, domain, role string) error {
+	query := fmt.Sprintf("INSERT INTO %s (domain, org_id, member_role) VALUES ($1, $2, $3)", models.OrganizationDomainTable)
+	_, err := o.db.ExecContext(ctx, query, domain, orgID, role)
+	switch {
+	case isPQError(err, uniqueViolation):
+		return models.ErrDomainTaken
+	case isPQError(err, foreignKeyViolation):
+		return models.ErrNotFound
+	}
+
+	return err
+}
+
+func (o *Organization) ListDomains(ctx context.Context, orgID string) ([]models.OrganizationDomain, error) {
+	query := fmt.Sprintf("SELECT domain, org_id, member_role, created_at FROM %s WHERE org_id = $1 ORDER BY domain", models.OrganizationDomainTable)
+	rows, err := o.db.QueryContext(ctx, query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var domains []models.OrganizationDomain
+	for rows.Next() {
+		var d models.OrganizationDomain
+		if err := rows.Scan(&d.Domain, &d.OrgID, &d.Role, &d.CreateAt); err != nil {
+			return nil, err
+		}
+		domains = append(domains, d)
+	}
+
+	return domains, rows.Err()
+}
+
+func (o *Organization) RemoveDomain(ctx context.Context, orgID, domain string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE org_id = $1 AND domain = $2", models.OrganizationDomainTable)
+	res, err := o.db.ExecContext(ctx, query, orgID, domain)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
+// JoinByDomain adds the user to the organization owning the email domain, if
+// any, and returns its ID.
+func (o *Organization) JoinByDomain(ctx context.Context, userID, domain string) (string, error) {
+	var orgID string
+
+	query := fmt.Sprintf(`INSERT INTO %s (org_id, user_id, member_role)
+		SELECT org_id, $1, member_role FROM %s WHERE domain = $2
+		ON CONFLICT DO NOTHING RETURNING org_id`, models.OrganizationMemberTable, models.OrganizationDomainTable)
+	err := o.db.QueryRowContext(ctx, query, userID, domain).Scan(&orgID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", models.ErrNotFound
+		}
+		return "", err
+	}
+
+	return orgID, nil
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"slices"
+	"time"
+)
+
+type Outbox struct {
+	db   *sql.DB
+	opts *models.Options
+}
+
+func NewOutbox(db *sql.DB, opts *models.Options) *Outbox {
+	return &Outbox{
+		db:   db,
+		opts: opts,
+	}
+}
+
+// execer is a *sql.DB or *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// writeOutboxEvent adds the event to the outbox as part of the transaction
+// making the change it describes.
+func writeOutboxEvent(ctx context.Context, tx execer, event *models.DomainEvent) error {
+	query := fmt.Sprintf("INSERT INTO %s (event_type, schema_version, subject, payload) VALUES ($1, $2, $3, $4)", models.OutboxTable)
+	_, err := tx.ExecContext(ctx, query, event.Type, event.Version, event.Subject, []byte(event.Data))
+
+	return err
+}
+
+// PublishOutboxEvents hands up to limit due events, oldest first, to
+// publish. The events are claimed first by moving them lease into the
+// future, in a statement of their own, so that no transaction stays open
+// while publish waits on the network; concurrent relays skip claimed events
+// and a relay that dies leaves them due again once the lease ends. Published
+// events are then marked as such; failed ones are retried after a backoff
+// doubling with every attempt, up to maxBackoff.
+func (o *Outbox) PublishOutboxEvents(ctx context.Context, limit int, lease, maxBackoff time.Duration, publish func(event *models.DomainEvent) error) (int, error) {
+	events, err := o.claimOutboxEvents(ctx, limit, lease)
+	if err != nil {
+		return 0, err
+	}
+
+	published := fmt.Sprintf("UPDATE %s SET published_at = CURRENT_TIMESTAMP, attempts = attempts + 1, last_error = '' WHERE event_id = $1", models.OutboxTable)
+	failed := fmt.Sprintf(`UPDATE %s SET attempts = attempts + 1, last_error = $2,
+			next_attempt_at = CURRENT_TIMESTAMP + LEAST(INTERVAL '1 second' * POWER(2, LEAST(attempts, 30)), $3 * INTERVAL '1 second')
+		WHERE event_id = $1`, models.OutboxTable)
+
+	var count int
+	for i := range events {
+		if err := publish(&events[i]); err != nil {
+			if _, err := o.db.ExecContext(ctx, failed, events[i].ID, err.Error(), maxBackoff.Seconds()); err != nil {
+				return count, err
+			}
+			continue
+		}
+
+		if _, err := o.db.ExecContext(ctx, published, events[i].ID); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// claimOutboxEvents leases up to limit due events, oldest first.
+func (o *Outbox) claimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]models.DomainEvent, error) {
+	query := fmt.Sprintf(`UPDATE %[1]s SET next_attempt_at = CURRENT_TIMESTAMP + $2 * INTERVAL '1 second'
+		WHERE event_id IN (SELECT event_id FROM %[1]s
+			WHERE published_at IS NULL AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY created_at LIMIT $1 FOR UPDATE SKIP LOCKED)
+		RETURNING event_id, event_type, schema_version, subject, payload, created_at, attempts`, models.OutboxTable)
+	rows, err := o.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.DomainEvent
+	for rows.Next() {
+		var (
+			event   models.DomainEvent
+			payload []byte
+		)
+		if err := rows.Scan(&event.ID, &event.Type, &event.Version, &event.Subject, &payload, &event.OccurredAt, &event.Attempts); err != nil {
+			return nil, err
+		}
+		event.Data = payload
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// RETURNING does not keep the order of the subquery.
+	slices.SortFunc(events, func(a, b models.DomainEvent) int {
+		return a.OccurredAt.Compare(b.OccurredAt)
+	})
+
+	return events, nil
+}
+
+// PurgeOutboxEvents deletes events that were published before the given
+// time.
+func (o *Outbox) PurgeOutboxEvents(ctx context.Context, before time.Time) (int64, error) {
+	query := fmt.Sprintf("DELETE FROM %s WHERE published_at < $1", models.OutboxTable)
+	res, err := o.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
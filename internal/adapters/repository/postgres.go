@@ -4,12 +4,15 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"github.com/XSAM/otelsql"
 	"github.com/co1seam/ember-backend-auth/config"
 	_ "github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
 type Postgres struct {
 	DB       *sql.DB
+	dsn      string
 	migrator *Migrator
 }
 
@@ -22,7 +25,16 @@ func NewPostgres(ctx context.Context, cfg *config.Database) (*Postgres, error) {
 		cfg.Pass,
 	)
 
-	db, err := sql.Open("postgres", dsn)
+	// Every query gets a span; the connection housekeeping around it does
+	// not, as it would only add noise to traces.
+	db, err := otelsql.Open("postgres", dsn,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBNamespace(cfg.Name)),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			OmitConnResetSession: true,
+			OmitConnPrepare:      true,
+			OmitRows:             true,
+		}),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("error connecting to postgres: %w", err)
 	}
@@ -31,22 +43,26 @@ func NewPostgres(ctx context.Context, cfg *config.Database) (*Postgres, error) {
 		return nil, fmt.Errorf("error pinging postgres: %w", err)
 	}
 
-	migrationDB, err := sql.Open("postgres", dsn)
+	return &Postgres{
+		DB:       db,
+		dsn:      dsn,
+		migrator: NewMigrator(),
+	}, nil
+}
+
+// Migrate applies the migrations not applied yet.
+func (pg *Postgres) Migrate() error {
+	migrationDB, err := sql.Open("postgres", pg.dsn)
 	if err != nil {
-		return nil, fmt.Errorf("error connecting to postgres for migrations: %w", err)
+		return fmt.Errorf("error connecting to postgres for migrations: %w", err)
 	}
 	defer migrationDB.Close()
 
-	migrator := NewMigrator()
-
-	if err := migrator.Up(migrationDB); err != nil {
-		return nil, fmt.Errorf("error running migrations: %w", err)
+	if err := pg.migrator.Up(migrationDB); err != nil {
+		return fmt.Errorf("error running migrations: %w", err)
 	}
 
-	return &Postgres{
-		DB:       db,
-		migrator: migrator,
-	}, nil
+	return nil
 }
 
 func (pg *Postgres) Close() error {
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/lib/pq"
+)
+
+type RBAC struct {
+	db   *sql.DB
+	opts *models.Options
+}
+
+func NewRBAC(db *sql.DB, opts *models.Options) *RBAC {
+	return &RBAC{
+		db:   db,
+		opts: opts,
+	}
+}
+
+func (r *RBAC) ListRoles(ctx context.Context) ([]models.Role, error) {
+	query := fmt.Sprintf(`SELECT r.role_name, r.description, COALESCE(array_agg(rp.permission_name ORDER BY rp.permission_name) FILTER (WHERE rp.permission_name IS NOT NULL), '{}')
+		FROM %s r LEFT JOIN %s rp ON rp.role_name = r.role_name
+		GROUP BY r.role_name, r.description ORDER BY r.role_name`, models.RoleTable, models.RolePermissionTable)
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []models.Role
+	for rows.Next() {
+		var role models.Role
+		if err := rows.Scan(&role.Name, &role.Description, pq.Array(&role.Permissions)); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// GetGrants returns the roles of a user and the union of their permissions.
+func (r *RBAC) GetGrants(ctx context.Context, userID string) (*models.Grants, error) {
+	grants := &models.Grants{Roles: []string{}, Permissions: []string{}}
+
+	query := fmt.Sprintf(`SELECT COALESCE(array_agg(DISTINCT ur.role_name), '{}'),
+		COALESCE(array_agg(DISTINCT rp.permission_name) FILTER (WHERE rp.permission_name IS NOT NULL), '{}')
+		FROM %s ur LEFT JOIN %s rp ON rp.role_name = ur.role_name
+		WHERE ur.user_id = $1`, models.UserRoleTable, models.RolePermissionTable)
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(pq.Array(&grants.Roles), pq.Array(&grants.Permissions))
+	if err != nil {
+		return nil, err
+	}
+
+	return grants, nil
+}
+
+// AssignRole grants a role to a user. Assigning a role the user already has
+// is not an error. models.ErrNotFound is returned for unknown users or roles.
+func (r *RBAC) AssignRole(ctx context.Context, userID, role, grantedBy string) error {
+	query := fmt.Sprintf("INSERT INTO %s (user_id, role_name, granted_by) VALUES ($1, $2, NULLIF($3, '')::uuid) ON CONFLICT DO NOTHING", models.UserRoleTable)
+	_, err := r.db.ExecContext(ctx, query, userID, role, grantedBy)
+
+	if isPQError(err, foreignKeyViolation) {
+		return models.ErrNotFound
+	}
+
+	return err
+}
+
+func (r *RBAC) RevokeRole(ctx context.Context, userID, role string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE user_id = $1 AND role_name = $2", models.UserRoleTable)
+	res, err := r.db.ExecContext(ctx, query, userID, role)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"github.com/co1seam/ember-backend-auth/internal/adapters/tracing"
 	"github.com/go-redis/redis/v8"
 )
 
@@ -14,5 +15,7 @@ func NewRedis(host, port string) *Redis {
 		Password: "",
 		DB:       0,
 	})
+	client.AddHook(tracing.RedisHook{})
+
 	return &Redis{Redis: client}
 }
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+)
+
+type Relation struct {
+	db   *sql.DB
+	opts *models.Options
+}
+
+func NewRelation(db *sql.DB, opts *models.Options) *Relation {
+	return &Relation{
+		db:   db,
+		opts: opts,
+	}
+}
+
+// WriteTuples applies writes and deletes atomically and returns the new
+// revision. Writing a tuple that already exists is not an error.
+func (r *Relation) WriteTuples(ctx context.Context, writes, deletes []models.RelationTuple) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var revision int64
+	query := fmt.Sprintf("UPDATE %s SET revision = revision + 1 RETURNING revision", models.RelationRevisionTable)
+	if err := tx.QueryRowContext(ctx, query).Scan(&revision); err != nil {
+		return 0, err
+	}
+
+	query = fmt.Sprintf(`DELETE FROM %s WHERE namespace = $1 AND object_id = $2 AND relation = $3
+		AND subject_namespace = $4 AND subject_id = $5 AND subject_relation = $6`, models.RelationTupleTable)
+	for _, tuple := range deletes {
+		if _, err := tx.ExecContext(ctx, query, tupleArgs(tuple)...); err != nil {
+			return 0, err
+		}
+	}
+
+	query = fmt.Sprintf(`INSERT INTO %s (namespace, object_id, relation, subject_namespace, subject_id, subject_relation, revision)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT DO NOTHING`, models.RelationTupleTable)
+	for _, tuple := range writes {
+		if _, err := tx.ExecContext(ctx, query, append(tupleArgs(tuple), revision)...); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return revision, nil
+}
+
+func (r *Relation) HasTuple(ctx context.Context, tuple models.RelationTuple) (bool, error) {
+	var exists bool
+
+	query := fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s WHERE namespace = $1 AND object_id = $2 AND relation = $3
+		AND subject_namespace = $4 AND subject_id = $5 AND subject_relation = $6)`, models.RelationTupleTable)
+	err := r.db.QueryRowContext(ctx, query, tupleArgs(tuple)...).Scan(&exists)
+
+	return exists, err
+}
+
+// ReadTuples returns every tuple stored for object#relation.
+func (r *Relation) ReadTuples(ctx context.Context, object models.ObjectRef, relation string) ([]models.RelationTuple, error) {
+	query := fmt.Sprintf(`SELECT subject_namespace, subject_id, subject_relation FROM %s
+		WHERE namespace = $1 AND object_id = $2 AND relation = $3 ORDER BY subject_namespace, subject_id, subject_relation`, models.RelationTupleTable)
+	rows, err := r.db.QueryContext(ctx, query, object.Namespace, object.ID, relation)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tuples []models.RelationTuple
+	for rows.Next() {
+		tuple := models.RelationTuple{Object: object, Relation: relation}
+		if err := rows.Scan(&tuple.Subject.Namespace, &tuple.Subject.ID, &tuple.Subject.Relation); err != nil {
+			return nil, err
+		}
+		tuples = append(tuples, tuple)
+	}
+
+	return tuples, rows.Err()
+}
+
+// ListObjectIDs returns up to limit objects of a namespace that take part in
+// at least one tuple, which are the only ones any relation can hold for, in
+// ID order after the ID after.
+func (r *Relation) ListObjectIDs(ctx context.Context, namespace, after string, limit int) ([]string, error) {
+	query := fmt.Sprintf("SELECT DISTINCT object_id FROM %s WHERE namespace = $1 AND object_id > $2 ORDER BY object_id LIMIT $3", models.RelationTupleTable)
+	rows, err := r.db.QueryContext(ctx, query, namespace, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+func (r *Relation) Revision(ctx context.Context) (int64, error) {
+	var revision int64
+
+	query := fmt.Sprintf("SELECT revision FROM %s", models.RelationRevisionTable)
+	err := r.db.QueryRowContext(ctx, query).Scan(&revision)
+
+	return revision, err
+}
+
+func tupleArgs(tuple models.RelationTuple) []interface{} {
+	return []interface{}{
+		tuple.Object.Namespace,
+		tuple.Object.ID,
+		tuple.Relation,
+		tuple.Subject.Namespace,
+		tuple.Subject.ID,
+		tuple.Subject.Relation,
+	}
+}
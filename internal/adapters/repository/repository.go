@@ -7,13 +7,39 @@ import (
 )
 
 type Repository struct {
-	Authorization ports.IAuthRepo
-	Cache         *Redis
+	Authorization  ports.IAuthRepo
+	OAuth          ports.IOAuthRepo
+	Session        ports.ISessionRepo
+	User           ports.IUserRepo
+	Identity       ports.IIdentityRepo
+	Audit          ports.IAuditRepo
+	RBAC           ports.IRBACRepo
+	Relation       ports.IRelationRepo
+	Organization   ports.IOrganizationRepo
+	Invitation     ports.IInvitationRepo
+	APIKey         ports.IAPIKeyRepo
+	ServiceAccount ports.IServiceAccountRepo
+	Outbox         ports.IOutboxRepo
+	Webhook        ports.IWebhookRepo
+	Cache          *Redis
 }
 
 func NewRepository(db *sql.DB, cache *Redis, opts *models.Options) *Repository {
 	return &Repository{
-		Authorization: NewAuthorization(db, opts),
-		Cache:         cache,
+		Authorization:  NewAuthorization(db, opts),
+		OAuth:          NewOAuth(db, opts),
+		Session:        NewSession(db, opts),
+		User:           NewUser(db, opts),
+		Identity:       NewIdentity(db, opts),
+		Audit:          NewAudit(db, opts),
+		RBAC:           NewRBAC(db, opts),
+		Relation:       NewRelation(db, opts),
+		Organization:   NewOrganization(db, opts),
+		Invitation:     NewInvitation(db, opts),
+		APIKey:         NewAPIKey(db, opts),
+		ServiceAccount: NewServiceAccount(db, opts),
+		Outbox:         NewOutbox(db, opts),
+		Webhook:        NewWebhook(db, opts),
+		Cache:          cache,
 	}
 }
@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/lib/pq"
+)
+
+// ServiceAccount stores service accounts together with the OAuth clients
+// they authenticate as.
+type ServiceAccount struct {
+	db   *sql.DB
+	opts *models.Options
+}
+
+func NewServiceAccount(db *sql.DB, opts *models.Options) *ServiceAccount {
+	return &ServiceAccount{
+		db:   db,
+		opts: opts,
+	}
+}
+
+// CreateServiceAccount creates the account and its confidential client,
+// which may only use the client credentials grant.
+func (s *ServiceAccount) CreateServiceAccount(ctx context.Context, account *models.ServiceAccount, secretHash string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`INSERT INTO %s (client_id, client_secret_hash, client_name, client_type, grant_types, scopes)
+		VALUES ($1, $2, $3, $4, $5, $6)`, models.ClientTable)
+	_, err = tx.ExecContext(ctx, query,
+		account.ID,
+		secretHash,
+		account.Name,
+		models.ClientTypeConfidential,
+		pq.Array([]string{models.GrantTypeClientCredentials}),
+		pq.Array(account.Permissions),
+	)
+	if err != nil {
+		return err
+	}
+
+	query = fmt.Sprintf("INSERT INTO %s (client_id, description, created_by) VALUES ($1, $2, NULLIF($3, '')::uuid)", models.ServiceAccountTable)
+	if _, err := tx.ExecContext(ctx, query, account.ID, account.Description, account.CreatedBy); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *ServiceAccount) GetServiceAccount(ctx context.Context, accountID string) (*models.ServiceAccount, error) {
+	query := fmt.Sprintf(`SELECT a.client_id, c.client_name, a.description, c.scopes, COALESCE(a.created_by::text, ''), a.created_at
+		FROM %s a JOIN %s c ON c.client_id = a.client_id WHERE a.client_id = $1`, models.ServiceAccountTable, models.ClientTable)
+
+	return s.scan(s.db.QueryRowContext(ctx, query, accountID))
+}
+
+func (s *ServiceAccount) ListServiceAccounts(ctx context.Context) ([]models.ServiceAccount, error) {
+	query := fmt.Sprintf(`SELECT a.client_id, c.client_name, a.description, c.scopes, COALESCE(a.created_by::text, ''), a.created_at
+		FROM %s a JOIN %s c ON c.client_id = a.client_id ORDER BY c.client_name, a.client_id`, models.ServiceAccountTable, models.ClientTable)
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []models.ServiceAccount
+	for rows.Next() {
+		account, err := s.scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, *account)
+	}
+
+	return accounts, rows.Err()
+}
+
+func (s *ServiceAccount) UpdateServiceAccountSecret(ctx context.Context, accountID, secretHash string) error {
+	query := fmt.Sprintf(`UPDATE %s SET client_secret_hash = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE client_id = $1 AND client_id IN (SELECT client_id FROM %s)`, models.ClientTable, models.ServiceAccountTable)
+
+	return s.exec(ctx, query, accountID, secretHash)
+}
+
+// DeleteServiceAccount deletes the account's client, which cascades to the
+// account and its keys.
+func (s *ServiceAccount) DeleteServiceAccount(ctx context.Context, accountID string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE client_id = $1 AND client_id IN (SELECT client_id FROM %s)", models.ClientTable, models.ServiceAccountTable)
+
+	return s.exec(ctx, query, accountID)
+}
+
+func (s *ServiceAccount) exec(ctx context.Context, query string, args ...interface{}) error {
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *ServiceAccount) scan(row interface{ Scan(...interface{}) error }) (*models.ServiceAccount, error) {
+	var account models.ServiceAccount
+
+	err := row.Scan(
+		&account.ID,
+		&account.Name,
+		&account.Description,
+		pq.Array(&account.Permissions),
+		&account.CreatedBy,
+		&account.CreateAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &account, nil
+}
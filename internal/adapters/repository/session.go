@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"time"
+)
+
+type Session struct {
+	db   *sql.DB
+	opts *models.Options
+}
+
+func NewSession(db *sql.DB, opts *models.Options) *Session {
+	return &Session{
+		db:   db,
+		opts: opts,
+	}
+}
+
+const sessionColumns = "session_id, user_id, COALESCE(client_id, ''), scope, refresh_token_hash, expires_at, auth_time, revoked_at, created_at, updated_at"
+
+func (s *Session) CreateSession(ctx context.Context, session *models.Session) (string, error) {
+	var id string
+
+	query := fmt.Sprintf(`INSERT INTO %s (user_id, client_id, scope, refresh_token_hash, expires_at, auth_time)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6) RETURNING session_id`, models.SessionTable)
+	err := s.db.QueryRowContext(ctx, query,
+		session.UserID,
+		session.ClientID,
+		session.Scope,
+		session.RefreshTokenHash,
+		session.ExpiresAt,
+		session.AuthTime,
+	).Scan(&id)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+func (s *Session) GetSession(ctx context.Context, sessionID string) (*models.Session, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE session_id = $1", sessionColumns, models.SessionTable)
+
+	return s.scan(s.db.QueryRowContext(ctx, query, sessionID))
+}
+
+func (s *Session) GetSessionByRefreshToken(ctx context.Context, refreshTokenHash string) (*models.Session, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE refresh_token_hash = $1", sessionColumns, models.SessionTable)
+
+	return s.scan(s.db.QueryRowContext(ctx, query, refreshTokenHash))
+}
+
+func (s *Session) RotateRefreshToken(ctx context.Context, sessionID, oldHash, newHash string, expiresAt time.Time) error {
+	query := fmt.Sprintf(`UPDATE %s SET refresh_token_hash = $1, expires_at = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE session_id = $3 AND refresh_token_hash = $4 AND revoked_at IS NULL`, models.SessionTable)
+	res, err := s.db.ExecContext(ctx, query, newHash, expiresAt, sessionID, oldHash)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *Session) RevokeSession(ctx context.Context, sessionID string) error {
+	query := fmt.Sprintf("UPDATE %s SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE session_id = $1 AND revoked_at IS NULL", models.SessionTable)
+	_, err := s.db.ExecContext(ctx, query, sessionID)
+
+	return err
+}
+
+func (s *Session) RevokeUserSessions(ctx context.Context, userID string) error {
+	query := fmt.Sprintf("UPDATE %s SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL", models.SessionTable)
+	_, err := s.db.ExecContext(ctx, query, userID)
+
+	return err
+}
+
+func (s *Session) scan(row *sql.Row) (*models.Session, error) {
+	var session models.Session
+
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.ClientID,
+		&session.Scope,
+		&session.RefreshTokenHash,
+		&session.ExpiresAt,
+		&session.AuthTime,
+		&session.RevokedAt,
+		&session.CreateAt,
+		&session.UpdateAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &session, nil
+}
@@ -0,0 +1,240 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"strings"
+)
+
+// likeEscaper escapes the LIKE wildcards in user input.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+type User struct {
+	db   *sql.DB
+	opts *models.Options
+}
+
+func NewUser(db *sql.DB, opts *models.Options) *User {
+	return &User{
+		db:   db,
+		opts: opts,
+	}
+}
+
+const userColumns = `user_id, user_name, user_email, user_email_verified_at, user_status, user_status_reason, user_status_changed_at,
+	COALESCE(user_status_changed_by::text, ''), created_at, updated_at`
+
+func (u *User) GetUser(ctx context.Context, userID string) (*models.User, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE user_id = $1", userColumns, models.UserTable)
+
+	return u.scan(u.db.QueryRowContext(ctx, query, userID))
+}
+
+func (u *User) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE user_email = $1", userColumns, models.UserTable)
+
+	return u.scan(u.db.QueryRowContext(ctx, query, email))
+}
+
+func (u *User) HasPassword(ctx context.Context, userID string) (bool, error) {
+	var hasPassword bool
+
+	query := fmt.Sprintf("SELECT user_password IS NOT NULL FROM %s WHERE user_id = $1", models.UserTable)
+	err := u.db.QueryRowContext(ctx, query, userID).Scan(&hasPassword)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, models.ErrNotFound
+		}
+		return false, err
+	}
+
+	return hasPassword, nil
+}
+
+// ListUsers returns up to filter.Limit users after the cursor, oldest first.
+// The email filter matches any part of the address, ignoring case.
+func (u *User) ListUsers(ctx context.Context, filter models.UserFilter) ([]models.User, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Email != "" {
+		where("user_email ILIKE '%%' || $%d || '%%'", likeEscaper.Replace(filter.Email))
+	}
+	if filter.Status != "" {
+		where("user_status = $%d", filter.Status)
+	}
+	if !filter.CreatedAfter.IsZero() {
+		where("created_at >= $%d", filter.CreatedAfter)
+	}
+	if !filter.CreatedBefore.IsZero() {
+		where("created_at < $%d", filter.CreatedBefore)
+	}
+	if filter.After != nil {
+		args = append(args, filter.After.CreateAt, filter.After.UserID)
+		conditions = append(conditions, fmt.Sprintf("(created_at, user_id) > ($%d, $%d::uuid)", len(args)-1, len(args)))
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s", userColumns, models.UserTable)
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(" ORDER BY created_at, user_id LIMIT $%d", len(args))
+
+	rows, err := u.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		user, err := u.scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+
+	return users, rows.Err()
+}
+
+// UpdateUser changes the name and email that are set. A new email address
+// has not been verified yet.
+func (u *User) UpdateUser(ctx context.Context, userID string, update models.UpdateUserRequest) error {
+	query := fmt.Sprintf(`UPDATE %s SET
+			user_name = COALESCE($2, user_name),
+			user_email = COALESCE($3, user_email),
+			user_email_verified_at = CASE WHEN $3 IS NULL OR $3 = user_email THEN user_email_verified_at END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1`, models.UserTable)
+	err := u.exec(ctx, u.db, query, userID, update.Name, update.Email)
+	if isPQError(err, uniqueViolation) {
+		return models.ErrIdentityConflict
+	}
+
+	return err
+}
+
+// VerifyEmail marks the email address of the user as verified. Only the
+// first verification is published as an event.
+func (u *User) VerifyEmail(ctx context.Context, userID string) error {
+	tx, err := u.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var email string
+	query := fmt.Sprintf(`UPDATE %s SET user_email_verified_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND user_email_verified_at IS NULL RETURNING user_email`, models.UserTable)
+	err = tx.QueryRowContext(ctx, query, userID).Scan(&email)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Either the user does not exist or the email is verified already.
+		_, err := u.GetUser(ctx, userID)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	event, err := models.NewUserEvent(models.EventUserEmailVerified, models.UserEventData{UserID: userID, Email: email})
+	if err != nil {
+		return err
+	}
+	if err := writeOutboxEvent(ctx, tx, event); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ChangeUserStatus moves the user from change.From to change.To. It fails
+// with ErrInvalidStatusTransition when the status is no longer change.From,
+// so that concurrent changes cannot skip the state machine. Deleting the
+// user is published as an event.
+func (u *User) ChangeUserStatus(ctx context.Context, userID string, change models.StatusChange) error {
+	tx, err := u.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`UPDATE %s SET user_status = $3, user_status_reason = $4, user_status_changed_at = CURRENT_TIMESTAMP,
+			user_status_changed_by = NULLIF($5, '')::uuid, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND user_status = $2`, models.UserTable)
+	err = u.exec(ctx, tx, query, userID, change.From, change.To, change.Reason, change.ActorID)
+	if errors.Is(err, models.ErrNotFound) {
+		return models.ErrInvalidStatusTransition
+	}
+	if err != nil {
+		return err
+	}
+
+	if change.To == models.UserStatusDeleted {
+		event, err := models.NewUserEvent(models.EventUserDeleted, models.UserEventData{UserID: userID, Reason: change.Reason, ActorID: change.ActorID})
+		if err != nil {
+			return err
+		}
+		if err := writeOutboxEvent(ctx, tx, event); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (u *User) exec(ctx context.Context, db execer, query string, args ...interface{}) error {
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
+func (u *User) scan(row interface{ Scan(...interface{}) error }) (*models.User, error) {
+	var (
+		user models.User
+		name sql.NullString
+	)
+
+	err := row.Scan(
+		&user.ID,
+		&name,
+		&user.Email,
+		&user.EmailVerifiedAt,
+		&user.Status,
+		&user.StatusReason,
+		&user.StatusChangedAt,
+		&user.StatusChangedBy,
+		&user.CreateAt,
+		&user.UpdateAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+		return nil, err
+	}
+	user.Name = name.String
+
+	return &user, nil
+}
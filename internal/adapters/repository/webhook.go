@@ -0,0 +1,354 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/lib/pq"
+	"strings"
+	"time"
+)
+
+const webhookColumns = `subscription_id, url, event_types, secret, description, active, consecutive_failures, disabled_at,
+	disabled_reason, COALESCE(created_by::text, ''), created_at, updated_at`
+
+const deliveryColumns = `delivery_id, subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+	last_status_code, last_error, delivered_at, created_at`
+
+type Webhook struct {
+	db   *sql.DB
+	opts *models.Options
+}
+
+func NewWebhook(db *sql.DB, opts *models.Options) *Webhook {
+	return &Webhook{
+		db:   db,
+		opts: opts,
+	}
+}
+
+func (w *Webhook) CreateWebhook(ctx context.Context, subscription *models.WebhookSubscription) error {
+	query := fmt.Sprintf(`INSERT INTO %s (url, event_types, secret, description, created_by) VALUES ($1, $2, $3, $4, NULLIF($5, '')::uuid)
+		RETURNING subscription_id, active, created_at, updated_at`, models.WebhookSubscriptionTable)
+
+	return w.db.QueryRowContext(ctx, query, subscription.URL, pq.Array(subscription.EventTypes), subscription.Secret,
+		subscription.Description, subscription.CreatedBy).
+		Scan(&subscription.ID, &subscription.Active, &subscription.CreateAt, &subscription.UpdateAt)
+}
+
+func (w *Webhook) GetWebhook(ctx context.Context, subscriptionID string) (*models.WebhookSubscription, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE subscription_id = $1", webhookColumns, models.WebhookSubscriptionTable)
+
+	subscription, err := w.scanWebhook(w.db.QueryRowContext(ctx, query, subscriptionID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+
+	return subscription, err
+}
+
+// ListWebhooks returns every subscription, or only the active ones.
+func (w *Webhook) ListWebhooks(ctx context.Context, activeOnly bool) ([]models.WebhookSubscription, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s", webhookColumns, models.WebhookSubscriptionTable)
+	if activeOnly {
+		query += " WHERE active"
+	}
+	query += " ORDER BY created_at, subscription_id"
+
+	rows, err := w.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscriptions []models.WebhookSubscription
+	for rows.Next() {
+		subscription, err := w.scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, *subscription)
+	}
+
+	return subscriptions, rows.Err()
+}
+
+// UpdateWebhook changes the fields that are set. Activating a subscription
+// forgets its failures; deactivating it records when.
+func (w *Webhook) UpdateWebhook(ctx context.Context, subscriptionID string, update models.UpdateWebhookRequest) error {
+	var eventTypes interface{}
+	if update.EventTypes != nil {
+		eventTypes = pq.Array(update.EventTypes)
+	}
+
+	query := fmt.Sprintf(`UPDATE %s SET
+			url = COALESCE($2, url),
+			event_types = COALESCE($3, event_types),
+			description = COALESCE($4, description),
+			consecutive_failures = CASE WHEN $5::boolean THEN 0 ELSE consecutive_failures END,
+			disabled_at = CASE WHEN $5::boolean THEN NULL WHEN NOT $5::boolean AND active THEN CURRENT_TIMESTAMP ELSE disabled_at END,
+			disabled_reason = CASE WHEN $5::boolean THEN '' WHEN NOT $5::boolean AND active THEN 'disabled by an administrator' ELSE disabled_reason END,
+			active = COALESCE($5::boolean, active),
+			updated_at = CURRENT_TIMESTAMP
+		WHERE subscription_id = $1`, models.WebhookSubscriptionTable)
+
+	return w.exec(ctx, query, subscriptionID, update.URL, eventTypes, update.Description, update.Active)
+}
+
+func (w *Webhook) DeleteWebhook(ctx context.Context, subscriptionID string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE subscription_id = $1", models.WebhookSubscriptionTable)
+
+	return w.exec(ctx, query, subscriptionID)
+}
+
+// CreateWebhookDeliveries queues the event for the subscriptions. An event
+// queued for a subscription before is not queued again.
+func (w *Webhook) CreateWebhookDeliveries(ctx context.Context, event *models.WebhookEvent, payload []byte, subscriptionIDs []string) error {
+	query := fmt.Sprintf(`INSERT INTO %s (subscription_id, event_id, event_type, payload)
+		SELECT id, $2, $3, $4 FROM unnest($1::uuid[]) AS id
+		ON CONFLICT (subscription_id, event_id) DO NOTHING`, models.WebhookDeliveryTable)
+	_, err := w.db.ExecContext(ctx, query, pq.Array(subscriptionIDs), event.ID, event.Type, payload)
+
+	return err
+}
+
+// ClaimWebhookDeliveries returns up to limit due deliveries of active
+// subscriptions and postpones them by lease, so that other instances leave
+// them alone while they are attempted.
+func (w *Webhook) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	query := fmt.Sprintf(`UPDATE %[1]s SET next_attempt_at = CURRENT_TIMESTAMP + $2 * INTERVAL '1 second'
+		WHERE delivery_id IN (
+			SELECT d.delivery_id FROM %[1]s d JOIN %[2]s s ON s.subscription_id = d.subscription_id
+			WHERE d.status = 'pending' AND d.next_attempt_at <= CURRENT_TIMESTAMP AND s.active
+			ORDER BY d.next_attempt_at LIMIT $1 FOR UPDATE OF d SKIP LOCKED)
+		RETURNING %[3]s`, models.WebhookDeliveryTable, models.WebhookSubscriptionTable, deliveryColumns)
+
+	return w.queryDeliveries(ctx, query, limit, lease.Seconds())
+}
+
+// RecordWebhookAttempt logs the attempt and updates the delivery: it
+// succeeded, is retried at next, or failed for good when next is zero. The
+// failures of the subscription in a row are counted, and it is disabled
+// once they reach disableAfter, which is reported.
+func (w *Webhook) RecordWebhookAttempt(ctx context.Context, subscriptionID string, attempt *models.WebhookAttempt, next time.Time, disableAfter int) (bool, error) {
+	tx, err := w.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf("INSERT INTO %s (delivery_id, status_code, error, duration_ms) VALUES ($1, $2, $3, $4)", models.WebhookAttemptTable)
+	_, err = tx.ExecContext(ctx, query, attempt.DeliveryID, attempt.StatusCode, attempt.Error, attempt.Duration.Milliseconds())
+	if err != nil {
+		return false, err
+	}
+
+	status := models.WebhookDeliveryPending
+	switch {
+	case attempt.Succeeded():
+		status = models.WebhookDeliverySucceeded
+	case next.IsZero():
+		status = models.WebhookDeliveryFailed
+	}
+
+	query = fmt.Sprintf(`UPDATE %s SET status = $2, attempts = attempts + 1, last_status_code = $3, last_error = $4,
+			next_attempt_at = COALESCE($5, next_attempt_at),
+			delivered_at = CASE WHEN $2 = 'succeeded' THEN CURRENT_TIMESTAMP ELSE delivered_at END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE delivery_id = $1`, models.WebhookDeliveryTable)
+	var nextAttempt *time.Time
+	if !next.IsZero() {
+		nextAttempt = &next
+	}
+	_, err = tx.ExecContext(ctx, query, attempt.DeliveryID, status, attempt.StatusCode, attempt.Error, nextAttempt)
+	if err != nil {
+		return false, err
+	}
+
+	var disabled bool
+	if attempt.Succeeded() {
+		query = fmt.Sprintf("UPDATE %s SET consecutive_failures = 0 WHERE subscription_id = $1", models.WebhookSubscriptionTable)
+		_, err = tx.ExecContext(ctx, query, subscriptionID)
+	} else {
+		query = fmt.Sprintf(`UPDATE %s SET consecutive_failures = consecutive_failures + 1,
+				disabled_at = CASE WHEN active AND consecutive_failures + 1 >= $2 THEN CURRENT_TIMESTAMP ELSE disabled_at END,
+				disabled_reason = CASE WHEN active AND consecutive_failures + 1 >= $2 THEN $3 ELSE disabled_reason END,
+				active = active AND consecutive_failures + 1 < $2,
+				updated_at = CURRENT_TIMESTAMP
+			WHERE subscription_id = $1 RETURNING disabled_at IS NOT NULL AND NOT active AND consecutive_failures = $2`, models.WebhookSubscriptionTable)
+		reason := fmt.Sprintf("disabled after %d failed deliveries in a row", disableAfter)
+		err = tx.QueryRowContext(ctx, query, subscriptionID, disableAfter, reason).Scan(&disabled)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return disabled, tx.Commit()
+}
+
+func (w *Webhook) GetWebhookDelivery(ctx context.Context, deliveryID string) (*models.WebhookDelivery, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE delivery_id = $1", deliveryColumns, models.WebhookDeliveryTable)
+
+	delivery, err := w.scanDelivery(w.db.QueryRowContext(ctx, query, deliveryID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+
+	return delivery, err
+}
+
+func (w *Webhook) ListWebhookDeliveries(ctx context.Context, filter models.WebhookDeliveryFilter) ([]models.WebhookDelivery, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.SubscriptionID != "" {
+		where("subscription_id = $%d::uuid", filter.SubscriptionID)
+	}
+	if filter.Status != "" {
+		where("status = $%d", filter.Status)
+	}
+	if filter.Before != "" {
+		where(fmt.Sprintf("(created_at, delivery_id) < (SELECT created_at, delivery_id FROM %s WHERE delivery_id = $%%d::uuid)", models.WebhookDeliveryTable), filter.Before)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s", deliveryColumns, models.WebhookDeliveryTable)
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(" ORDER BY created_at DESC, delivery_id DESC LIMIT $%d", len(args))
+
+	return w.queryDeliveries(ctx, query, args...)
+}
+
+func (w *Webhook) ListWebhookAttempts(ctx context.Context, deliveryID string) ([]models.WebhookAttempt, error) {
+	query := fmt.Sprintf(`SELECT status_code, error, duration_ms, attempted_at FROM %s WHERE delivery_id = $1
+		ORDER BY attempted_at, attempt_id`, models.WebhookAttemptTable)
+
+	rows, err := w.db.QueryContext(ctx, query, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []models.WebhookAttempt
+	for rows.Next() {
+		attempt := models.WebhookAttempt{DeliveryID: deliveryID}
+		var duration int64
+		if err := rows.Scan(&attempt.StatusCode, &attempt.Error, &duration, &attempt.AttemptAt); err != nil {
+			return nil, err
+		}
+		attempt.Duration = time.Duration(duration) * time.Millisecond
+		attempts = append(attempts, attempt)
+	}
+
+	return attempts, rows.Err()
+}
+
+// ReplayWebhookDelivery queues the delivery again with a fresh retry budget,
+// whatever its outcome was.
+func (w *Webhook) ReplayWebhookDelivery(ctx context.Context, deliveryID string) error {
+	query := fmt.Sprintf(`UPDATE %s SET status = 'pending', attempts = 0, next_attempt_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE delivery_id = $1`, models.WebhookDeliveryTable)
+
+	return w.exec(ctx, query, deliveryID)
+}
+
+func (w *Webhook) exec(ctx context.Context, query string, args ...interface{}) error {
+	res, err := w.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
+func (w *Webhook) queryDeliveries(ctx context.Context, query string, args ...interface{}) ([]models.WebhookDelivery, error) {
+	rows, err := w.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		delivery, err := w.scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func (w *Webhook) scanWebhook(row interface{ Scan(...interface{}) error }) (*models.WebhookSubscription, error) {
+	var subscription models.WebhookSubscription
+
+	err := row.Scan(
+		&subscription.ID,
+		&subscription.URL,
+		pq.Array(&subscription.EventTypes),
+		&subscription.Secret,
+		&subscription.Description,
+		&subscription.Active,
+		&subscription.ConsecutiveFailures,
+		&subscription.DisabledAt,
+		&subscription.DisabledReason,
+		&subscription.CreatedBy,
+		&subscription.CreateAt,
+		&subscription.UpdateAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &subscription, nil
+}
+
+func (w *Webhook) scanDelivery(row interface{ Scan(...interface{}) error }) (*models.WebhookDelivery, error) {
+	var (
+		delivery models.WebhookDelivery
+		payload  []byte
+	)
+
+	err := row.Scan(
+		&delivery.ID,
+		&delivery.SubscriptionID,
+		&delivery.EventID,
+		&delivery.EventType,
+		&payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.LastStatusCode,
+		&delivery.LastError,
+		&delivery.DeliveredAt,
+		&delivery.CreateAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	delivery.Payload = payload
+
+	return &delivery, nil
+}
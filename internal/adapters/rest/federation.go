@@ -0,0 +1,126 @@
+package rest
+
+import (
+	"errors"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"github.com/gofiber/fiber/v2"
+	"time"
+)
+
+// federationCookie holds the pre-auth binding of a login with an upstream
+// provider. It is Lax, as the provider redirects back with a top-level GET.
+const federationCookie = "ember_federation"
+
+type Federation struct {
+	service ports.IFederationService
+	opts    *models.Options
+}
+
+func NewFederation(service ports.IFederationService, opts *models.Options) *Federation {
+	return &Federation{
+		service: service,
+		opts:    opts,
+	}
+}
+
+func (f *Federation) Register(app *fiber.App) {
+	app.Get("/federation/:provider", f.Begin)
+	app.Get("/federation/:provider/link", f.Link)
+	app.Get("/federation/:provider/callback", f.Callback)
+}
+
+func (f *Federation) Begin(c *fiber.Ctx) error {
+	target, binding, err := f.service.Begin(c.Context(), c.Params("provider"), c.Query("return_to"), "")
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).SendString("unknown identity provider")
+		}
+		return f.serverError(c, err)
+	}
+
+	return f.redirect(c, target, binding)
+}
+
+// Link continues a link started with Account.LinkIdentity. It needs the
+// browser session of the user who started it.
+func (f *Federation) Link(c *fiber.Ctx) error {
+	session, ok := readBrowserSession(c, f.opts)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).SendString("sign in to link an account")
+	}
+
+	target, binding, err := f.service.ContinueLink(c.Context(), c.Params("provider"), c.Query("ticket"), session.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			return c.Status(fiber.StatusNotFound).SendString("unknown identity provider")
+		case errors.Is(err, models.ErrUnauthorized):
+			return c.Status(fiber.StatusBadRequest).SendString("link request expired, please try again")
+		}
+		return f.serverError(c, err)
+	}
+
+	return f.redirect(c, target, binding)
+}
+
+// redirect sends the user agent to the provider with the binding of the
+// login in its pre-auth cookie.
+func (f *Federation) redirect(c *fiber.Ctx, target, binding string) error {
+	c.Cookie(&fiber.Cookie{
+		Name:     federationCookie,
+		Value:    binding,
+		Path:     "/federation",
+		Expires:  time.Now().Add(10 * time.Minute),
+		Secure:   f.opts.Config.OAuth.CookieSecure,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	return c.Redirect(target, fiber.StatusFound)
+}
+
+func (f *Federation) Callback(c *fiber.Ctx) error {
+	if reason := c.Query("error"); reason != "" {
+		return c.Status(fiber.StatusBadRequest).SendString("sign in was cancelled: " + reason)
+	}
+
+	binding := c.Cookies(federationCookie)
+	c.Cookie(&fiber.Cookie{
+		Name:     federationCookie,
+		Path:     "/federation",
+		Expires:  time.Unix(0, 0),
+		Secure:   f.opts.Config.OAuth.CookieSecure,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	login, err := f.service.Complete(c.Context(), c.Params("provider"), c.Query("code"), c.Query("state"), binding)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			return c.Status(fiber.StatusNotFound).SendString("unknown identity provider")
+		case errors.Is(err, models.ErrUnauthorized):
+			return c.Status(fiber.StatusBadRequest).SendString("sign in request expired, please try again")
+		case errors.Is(err, models.ErrIdentityConflict):
+			return c.Status(fiber.StatusConflict).SendString("an account with this email already exists, sign in with your password to link it")
+		case models.IsAccountStatusError(err):
+			return c.Status(fiber.StatusForbidden).SendString(err.Error())
+		}
+		return f.serverError(c, err)
+	}
+
+	if !login.Linked {
+		if err := setBrowserSession(c, f.opts, browserSession{UserID: login.UserID, AuthTime: login.AuthTime}); err != nil {
+			return f.serverError(c, err)
+		}
+	}
+
+	return c.Redirect(login.ReturnTo, fiber.StatusFound)
+}
+
+func (f *Federation) serverError(c *fiber.Ctx, err error) error {
+	_ = f.opts.Logger.Error("federation request failed", "path", c.Path(), "error", err)
+
+	return c.Status(fiber.StatusInternalServerError).SendString("sign in failed")
+}
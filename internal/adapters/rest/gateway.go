@@ -0,0 +1,355 @@
+package rest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	authv1 "github.com/co1seam/ember-backend-api-contracts/gen/go/auth"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"strings"
+	"time"
+)
+
+const (
+	gatewayPath = "/api/v1/auth"
+
+	refreshCookie = "ember_refresh"
+	csrfCookie    = "ember_csrf"
+	csrfHeader    = "X-CSRF-Token"
+)
+
+// httpStatuses maps gRPC codes to the HTTP statuses of the gateway, as
+// grpc-gateway does.
+var httpStatuses = map[codes.Code]int{
+	codes.InvalidArgument:    fiber.StatusBadRequest,
+	codes.FailedPrecondition: fiber.StatusBadRequest,
+	codes.OutOfRange:         fiber.StatusBadRequest,
+	codes.Unauthenticated:    fiber.StatusUnauthorized,
+	codes.PermissionDenied:   fiber.StatusForbidden,
+	codes.NotFound:           fiber.StatusNotFound,
+	codes.AlreadyExists:      fiber.StatusConflict,
+	codes.Aborted:            fiber.StatusConflict,
+	codes.ResourceExhausted:  fiber.StatusTooManyRequests,
+	codes.Canceled:           499,
+	codes.Unimplemented:      fiber.StatusNotImplemented,
+	codes.Unavailable:        fiber.StatusServiceUnavailable,
+	codes.DeadlineExceeded:   fiber.StatusGatewayTimeout,
+}
+
+// Gateway serves the Auth operations as an HTTP/JSON API for the web
+// frontend. Requests are handled by the gRPC Auth service in process,
+// through the interceptors of the gRPC server, with the client address and
+// user agent passed as metadata, so that both APIs audit, log, count and
+// time out requests the same way.
+//
+// The refresh token never reaches the frontend's scripts: it is kept in an
+// HttpOnly cookie scoped to the API. Requests authenticated with that
+// cookie must echo the CSRF token, which is derived from the refresh token
+// and handed out in the response body and a readable cookie.
+type Gateway struct {
+	auth authv1.AuthServer
+	opts *models.Options
+}
+
+func NewGateway(auth authv1.AuthServer, opts *models.Options) *Gateway {
+	return &Gateway{
+		auth: auth,
+		opts: opts,
+	}
+}
+
+func (g *Gateway) Register(app *fiber.App) {
+	api := app.Group(gatewayPath, recover.New())
+	if origins := g.opts.Config.Gateway.CORSOrigins; len(origins) > 0 {
+		api.Use(cors.New(cors.Config{
+			AllowOrigins:     strings.Join(origins, ","),
+			AllowMethods:     fiber.MethodPost,
+			AllowHeaders:     strings.Join([]string{fiber.HeaderAuthorization, fiber.HeaderContentType, csrfHeader}, ","),
+			AllowCredentials: true,
+			MaxAge:           int(time.Hour.Seconds()),
+		}))
+	}
+
+	api.Post("/otp", g.SendOTP)
+	api.Post("/otp/verify", g.VerifyOTP)
+	api.Post("/sign-up", g.SignUp)
+	api.Post("/sign-in", g.SignIn)
+	api.Post("/refresh", g.Refresh)
+	api.Post("/sign-out", g.SignOut)
+	api.Post("/validate", g.Validate)
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	CSRFToken   string `json:"csrf_token"`
+}
+
+type gatewayError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+func (g *Gateway) SendOTP(c *fiber.Ctx) error {
+	var req models.SendOtpRequest
+	if err := parseJSON(c, &req); err != nil {
+		return g.error(c, err)
+	}
+
+	if _, err := g.auth.SendOTP(g.context(c), &authv1.SendOTPRequest{Email: req.Email}); err != nil {
+		return g.error(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusAccepted)
+}
+
+func (g *Gateway) VerifyOTP(c *fiber.Ctx) error {
+	var req models.VerifyOtpRequest
+	if err := parseJSON(c, &req); err != nil {
+		return g.error(c, err)
+	}
+
+	resp, err := g.auth.VerifyOTP(g.context(c), &authv1.VerifyOTPRequest{Otp: req.OTP})
+	if err != nil {
+		return g.error(c, err)
+	}
+
+	return c.JSON(fiber.Map{"email": resp.Email})
+}
+
+func (g *Gateway) SignUp(c *fiber.Ctx) error {
+	var req models.SignUpRequest
+	if err := parseJSON(c, &req); err != nil {
+		return g.error(c, err)
+	}
+
+	_, err := g.auth.SignUp(g.context(c), &authv1.SignUpRequest{
+		Username: req.Name,
+		Email:    req.Email,
+		Password: req.Password,
+	})
+	if err != nil {
+		return g.error(c, err)
+	}
+
+	// New accounts sign in once their email address is verified.
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"status": models.UserStatusPending})
+}
+
+func (g *Gateway) SignIn(c *fiber.Ctx) error {
+	var req models.SignInRequest
+	if err := parseJSON(c, &req); err != nil {
+		return g.error(c, err)
+	}
+
+	resp, err := g.auth.SignIn(g.context(c), &authv1.SignInRequest{
+		Email:    req.Email,
+		Password: req.Password,
+	})
+	if err != nil {
+		return g.error(c, err)
+	}
+
+	return g.tokens(c, fiber.StatusOK, resp.AccessToken, resp.RefreshToken)
+}
+
+// Refresh rotates the refresh token of the cookie and returns a new access
+// token.
+func (g *Gateway) Refresh(c *fiber.Ctx) error {
+	refreshToken, err := g.cookieAuth(c)
+	if err != nil {
+		return g.error(c, err)
+	}
+
+	resp, err := g.auth.RefreshToken(g.context(c), &authv1.RefreshTokenRequest{RefreshToken: refreshToken})
+	if err != nil {
+		if status.Code(err) == codes.Unauthenticated {
+			g.clearCookies(c)
+		}
+		return g.error(c, err)
+	}
+
+	return g.tokens(c, fiber.StatusOK, resp.AccessToken, resp.RefreshToken)
+}
+
+// SignOut ends the sign-in of the cookie, revoking its refresh token and
+// the access tokens issued with it, and removes the cookies of the browser.
+// A sign-in that ended already is signed out of just the same.
+func (g *Gateway) SignOut(c *fiber.Ctx) error {
+	refreshToken, err := g.cookieAuth(c)
+	if err != nil {
+		return g.error(c, err)
+	}
+
+	if _, err := g.auth.SignOut(g.context(c), &authv1.SignOutRequest{AccessToken: refreshToken}); err != nil && status.Code(err) != codes.Unauthenticated {
+		return g.error(c, err)
+	}
+
+	g.clearCookies(c)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (g *Gateway) Validate(c *fiber.Ctx) error {
+	token := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if token == "" {
+		return g.error(c, status.Error(codes.Unauthenticated, "missing bearer token"))
+	}
+
+	resp, err := g.auth.ValidateToken(g.context(c), &authv1.ValidateTokenRequest{AccessToken: token})
+	if err != nil {
+		return g.error(c, err)
+	}
+
+	return c.JSON(fiber.Map{"subject": resp.Subject})
+}
+
+// context carries what the gRPC service reads from the metadata of a
+// request. Credentials are left out, as every call passes them in its
+// request message.
+func (g *Gateway) context(c *fiber.Ctx) context.Context {
+	md := metadata.Pairs(
+		"x-forwarded-for", c.IP(),
+		"user-agent", c.Get(fiber.HeaderUserAgent),
+	)
+
+	return metadata.NewIncomingContext(c.Context(), md)
+}
+
+// cookieAuth returns the refresh token of the cookie, after checking the
+// CSRF token of the request against it.
+func (g *Gateway) cookieAuth(c *fiber.Ctx) (string, error) {
+	refreshToken := c.Cookies(refreshCookie)
+	if refreshToken == "" {
+		return "", status.Error(codes.Unauthenticated, "missing refresh token")
+	}
+
+	expected := g.csrfToken(refreshToken)
+	if !hmac.Equal([]byte(c.Get(csrfHeader)), []byte(expected)) {
+		st, err := status.New(codes.PermissionDenied, "invalid CSRF token").WithDetails(&errdetails.ErrorInfo{
+			Reason: "CSRF_TOKEN_MISMATCH",
+		})
+		if err != nil {
+			return "", status.Error(codes.PermissionDenied, "invalid CSRF token")
+		}
+		return "", st.Err()
+	}
+
+	return refreshToken, nil
+}
+
+// csrfToken binds the CSRF token to the refresh token, so that it changes
+// with every rotation and needs no state of its own.
+func (g *Gateway) csrfToken(refreshToken string) string {
+	mac := hmac.New(sha256.New, []byte(g.opts.Config.Token.Secret))
+	mac.Write([]byte("csrf:" + refreshToken))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// tokens sets the refresh token and CSRF cookies and returns the access
+// token.
+func (g *Gateway) tokens(c *fiber.Ctx, statusCode int, accessToken, refreshToken string) error {
+	expires := time.Now().Add(g.opts.Config.Token.RefreshTokenTTL)
+	csrf := g.csrfToken(refreshToken)
+
+	setCookie(c, g.cookie(refreshCookie, refreshToken, gatewayPath, expires, true))
+	setCookie(c, g.cookie(csrfCookie, csrf, "/", expires, false))
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(statusCode).JSON(tokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(g.opts.Config.Token.AccessTokenTTL.Seconds()),
+		CSRFToken:   csrf,
+	})
+}
+
+func (g *Gateway) clearCookies(c *fiber.Ctx) {
+	setCookie(c, g.cookie(refreshCookie, "", gatewayPath, time.Unix(0, 0), true))
+	setCookie(c, g.cookie(csrfCookie, "", "/", time.Unix(0, 0), false))
+}
+
+// cookie builds a cookie of the gateway. Only the CSRF cookie is readable
+// by scripts, which must send its value back.
+func (g *Gateway) cookie(name, value, path string, expires time.Time, httpOnly bool) *models.Cookie {
+	return &models.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   g.opts.Config.Gateway.CookieDomain,
+		Expires:  expires,
+		Secure:   true,
+		HTTPOnly: httpOnly,
+		SameSite: fiber.CookieSameSiteStrictMode,
+	}
+}
+
+func setCookie(c *fiber.Ctx, cookie *models.Cookie) {
+	c.Cookie(&fiber.Cookie{
+		Name:     cookie.Name,
+		Value:    cookie.Value,
+		Path:     cookie.Path,
+		Domain:   cookie.Domain,
+		Expires:  cookie.Expires,
+		Secure:   cookie.Secure,
+		HTTPOnly: cookie.HTTPOnly,
+		SameSite: cookie.SameSite,
+	})
+}
+
+// parseJSON parses the body of a request, which must be sent as JSON.
+// Browsers post forms and plain text to other sites without a CORS
+// preflight, so accepting them would let any site sign a visitor in to an
+// account of its choosing.
+func parseJSON(c *fiber.Ctx, out interface{}) error {
+	if !c.Is("json") {
+		st, err := status.New(codes.InvalidArgument, "request body must be application/json").WithDetails(&errdetails.ErrorInfo{
+			Reason: "UNSUPPORTED_MEDIA_TYPE",
+		})
+		if err != nil {
+			return status.Error(codes.InvalidArgument, "request body must be application/json")
+		}
+		return st.Err()
+	}
+
+	if err := c.BodyParser(out); err != nil {
+		return status.Error(codes.InvalidArgument, "invalid request body")
+	}
+
+	return nil
+}
+
+// error writes a gRPC error as JSON, with the ErrorInfo reason if it has
+// one. Internal errors are logged and not described to the client.
+func (g *Gateway) error(c *fiber.Ctx, err error) error {
+	st := status.Convert(err)
+
+	statusCode, ok := httpStatuses[st.Code()]
+	if !ok {
+		_ = g.opts.Logger.ErrorContext(c.Context(), "gateway request failed", "path", c.Path(), "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(gatewayError{
+			Code:    codes.Internal.String(),
+			Message: "internal error",
+		})
+	}
+
+	response := gatewayError{Code: st.Code().String(), Message: st.Message()}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			response.Reason = info.Reason
+		}
+	}
+
+	return c.Status(statusCode).JSON(response)
+}
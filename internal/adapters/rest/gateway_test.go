@@ -0,0 +1,121 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	authv1 "github.com/co1seam/ember-backend-api-contracts/gen/go/auth"
+	"github.com/co1seam/ember-backend-auth/config"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeAuth signs in anyone and records sign-outs.
+type fakeAuth struct {
+	authv1.UnimplementedAuthServer
+	signedOut []string
+}
+
+func (f *fakeAuth) SignIn(_ context.Context, req *authv1.SignInRequest) (*authv1.SignInResponse, error) {
+	return &authv1.SignInResponse{AccessToken: "access", RefreshToken: "refresh:" + req.Email}, nil
+}
+
+func (f *fakeAuth) SignOut(_ context.Context, req *authv1.SignOutRequest) (*authv1.SignOutResponse, error) {
+	if req.AccessToken == "expired" {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+	f.signedOut = append(f.signedOut, req.AccessToken)
+
+	return &authv1.SignOutResponse{}, nil
+}
+
+func newTestGateway() (*fiber.App, *Gateway, *fakeAuth) {
+	cfg := &config.Config{}
+	cfg.Token = config.Token{Secret: "secret", AccessTokenTTL: time.Minute, RefreshTokenTTL: time.Hour}
+
+	auth := &fakeAuth{}
+	g := NewGateway(auth, &models.Options{Config: cfg})
+	app := fiber.New()
+	g.Register(app)
+
+	return app, g, auth
+}
+
+func TestGatewayRequiresJSON(t *testing.T) {
+	app, _, _ := newTestGateway()
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{name: "sign in", path: "/sign-in", contentType: fiber.MIMEApplicationJSON, body: `{"email":"user@example.com","password":"secret"}`, status: fiber.StatusOK},
+		{name: "sign in with charset", path: "/sign-in", contentType: fiber.MIMEApplicationJSONCharsetUTF8, body: `{"email":"user@example.com","password":"secret"}`, status: fiber.StatusOK},
+		{name: "sign in from a form", path: "/sign-in", contentType: fiber.MIMEApplicationForm, body: "email=user@example.com&password=secret", status: fiber.StatusBadRequest},
+		{name: "sign in as plain text", path: "/sign-in", contentType: fiber.MIMETextPlain, body: `{"email":"user@example.com","password":"secret"}`, status: fiber.StatusBadRequest},
+		{name: "sign up from a form", path: "/sign-up", contentType: fiber.MIMEApplicationForm, body: "email=user@example.com&password=secret", status: fiber.StatusBadRequest},
+		{name: "malformed JSON", path: "/sign-in", contentType: fiber.MIMEApplicationJSON, body: `{"email":`, status: fiber.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, gatewayPath+tt.path, strings.NewReader(tt.body))
+			req.Header.Set(fiber.HeaderContentType, tt.contentType)
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Fatalf("got status %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+func TestGatewaySignOut(t *testing.T) {
+	app, g, auth := newTestGateway()
+
+	tests := []struct {
+		name    string
+		refresh string
+		csrf    string
+		status  int
+		revoked bool
+	}{
+		{name: "signed in", refresh: "refresh", csrf: g.csrfToken("refresh"), status: fiber.StatusNoContent, revoked: true},
+		{name: "sign-in ended already", refresh: "expired", csrf: g.csrfToken("expired"), status: fiber.StatusNoContent},
+		{name: "wrong CSRF token", refresh: "refresh", csrf: g.csrfToken("other"), status: fiber.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth.signedOut = nil
+
+			req := httptest.NewRequest(http.MethodPost, gatewayPath+"/sign-out", nil)
+			req.AddCookie(&http.Cookie{Name: refreshCookie, Value: tt.refresh})
+			req.Header.Set(csrfHeader, tt.csrf)
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status {
+				var body gatewayError
+				_ = json.NewDecoder(resp.Body).Decode(&body)
+				t.Fatalf("got status %d (%+v), want %d", resp.StatusCode, body, tt.status)
+			}
+			if revoked := len(auth.signedOut) == 1 && auth.signedOut[0] == tt.refresh; revoked != tt.revoked {
+				t.Fatalf("signed out %v, want revoked %v", auth.signedOut, tt.revoked)
+			}
+		})
+	}
+}
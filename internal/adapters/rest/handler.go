@@ -0,0 +1,36 @@
+package rest
+
+import (
+	authv1 "github.com/co1seam/ember-backend-api-contracts/gen/go/auth"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/core/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+type Handler struct {
+	OAuth      *OAuth
+	OIDC       *OIDC
+	Federation *Federation
+	Gateway    *Gateway
+	opts       *models.Options
+}
+
+// NewHandler creates the HTTP handlers. auth serves the JSON gateway, which
+// handles its requests with the gRPC Auth service; it should be the
+// server's LocalAuth, so that they pass through its interceptors.
+func NewHandler(service *services.Service, auth authv1.AuthServer, opts *models.Options) *Handler {
+	return &Handler{
+		OAuth:      NewOAuth(service.OAuth, service.Authorization, service.Federation, opts),
+		OIDC:       NewOIDC(service.OIDC, opts),
+		Federation: NewFederation(service.Federation, opts),
+		Gateway:    NewGateway(auth, opts),
+		opts:       opts,
+	}
+}
+
+func (h *Handler) Register(app *fiber.App) {
+	h.OAuth.Register(app)
+	h.OIDC.Register(app)
+	h.Federation.Register(app)
+	h.Gateway.Register(app)
+}
@@ -0,0 +1,347 @@
+package rest
+
+import (
+	"bytes"
+	"embed"
+	"encoding/base64"
+	"errors"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"github.com/gofiber/fiber/v2"
+	"html/template"
+	"net/url"
+	"strings"
+	"time"
+)
+
+//go:embed templates/*.html
+var templates embed.FS
+
+var authorizeTemplate = template.Must(template.ParseFS(templates, "templates/authorize.html"))
+
+type OAuth struct {
+	service    ports.IOAuthService
+	auth       ports.IAuthService
+	federation ports.IFederationService
+	opts       *models.Options
+}
+
+func NewOAuth(service ports.IOAuthService, auth ports.IAuthService, federation ports.IFederationService, opts *models.Options) *OAuth {
+	return &OAuth{
+		service:    service,
+		auth:       auth,
+		federation: federation,
+		opts:       opts,
+	}
+}
+
+func (o *OAuth) Register(app *fiber.App) {
+	app.Get("/authorize", o.Authorize)
+	app.Post("/authorize", o.Authorize)
+	app.Post("/token", o.Token)
+	app.Post("/revoke", o.Revoke)
+	app.Post("/introspect", o.Introspect)
+}
+
+type authorizePage struct {
+	ClientName    string
+	Request       models.AuthorizeRequest
+	Scopes        []string
+	Providers     []string
+	ReturnTo      string
+	Authenticated bool
+	Error         string
+}
+
+func (o *OAuth) Authorize(c *fiber.Ctx) error {
+	req := models.AuthorizeRequest{
+		ResponseType:        o.param(c, "response_type"),
+		ClientID:            o.param(c, "client_id"),
+		RedirectURI:         o.param(c, "redirect_uri"),
+		Scope:               o.param(c, "scope"),
+		State:               o.param(c, "state"),
+		CodeChallenge:       o.param(c, "code_challenge"),
+		CodeChallengeMethod: o.param(c, "code_challenge_method"),
+		Nonce:               o.param(c, "nonce"),
+		Prompt:              o.param(c, "prompt"),
+		MaxAge:              o.param(c, "max_age"),
+	}
+
+	client, err := o.service.LookupClient(c.Context(), req.ClientID, req.RedirectURI)
+	if err != nil {
+		var oauthErr *models.OAuthError
+		if errors.As(err, &oauthErr) {
+			return c.Status(fiber.StatusBadRequest).SendString(oauthErr.Error())
+		}
+		return o.serverError(c, err)
+	}
+
+	if err := o.service.ValidateAuthorizeRequest(client, req); err != nil {
+		return o.redirectError(c, req, err)
+	}
+
+	page := authorizePage{
+		ClientName: client.Name,
+		Request:    req,
+		Providers:  o.federation.Providers(),
+		ReturnTo:   o.authorizeURL(req),
+	}
+	if !client.FirstParty {
+		page.Scopes = models.ParseScope(req.Scope)
+	}
+
+	promptNone := models.HasScope(req.Prompt, models.PromptNone)
+
+	session, authenticated := readBrowserSession(c, o.opts)
+	if authenticated && o.service.RequiresLogin(req, session.AuthTime) {
+		authenticated = false
+	}
+
+	if !authenticated && promptNone {
+		return o.redirectError(c, req, models.NewOAuthError("login_required", ""))
+	}
+
+	if !authenticated && c.Method() == fiber.MethodPost && c.FormValue("decision") == "approve" {
+		id, err := o.auth.Read(c.Context(), models.SignInRequest{
+			Email:    c.FormValue("email"),
+			Password: c.FormValue("password"),
+		})
+		if err != nil {
+			switch {
+			case models.IsAccountStatusError(err):
+				page.Error = "Sign in failed: " + err.Error()
+				return o.render(c, fiber.StatusForbidden, page)
+			case errors.Is(err, models.ErrUnauthorized):
+				page.Error = "Invalid email or password"
+				return o.render(c, fiber.StatusUnauthorized, page)
+			}
+			return o.serverError(c, err)
+		}
+
+		session = browserSession{UserID: id.(string), AuthTime: time.Now()}
+		if err := setBrowserSession(c, o.opts, session); err != nil {
+			return o.serverError(c, err)
+		}
+		authenticated = true
+	}
+	page.Authenticated = authenticated
+
+	if c.Method() == fiber.MethodPost && c.FormValue("decision") == "deny" {
+		return o.redirectError(c, req, models.NewOAuthError("access_denied", "the resource owner denied the request"))
+	}
+
+	if !authenticated {
+		return o.render(c, fiber.StatusOK, page)
+	}
+
+	needsConsent, err := o.service.NeedsConsent(c.Context(), client, session.UserID, req.Scope)
+	if err != nil {
+		return o.serverError(c, err)
+	}
+
+	if models.HasScope(req.Prompt, models.PromptConsent) && c.Method() != fiber.MethodPost {
+		needsConsent = true
+		page.Scopes = models.ParseScope(req.Scope)
+	}
+
+	if needsConsent {
+		if promptNone {
+			return o.redirectError(c, req, models.NewOAuthError("consent_required", ""))
+		}
+
+		if c.Method() != fiber.MethodPost || c.FormValue("decision") != "approve" {
+			return o.render(c, fiber.StatusOK, page)
+		}
+
+		if err := o.service.GrantConsent(c.Context(), session.UserID, client.ID, req.Scope); err != nil {
+			return o.serverError(c, err)
+		}
+	}
+
+	code, err := o.service.Authorize(c.Context(), req, session.UserID, session.AuthTime)
+	if err != nil {
+		return o.serverError(c, err)
+	}
+
+	return c.Redirect(o.redirectURL(req, url.Values{"code": {code}}), fiber.StatusFound)
+}
+
+func (o *OAuth) Token(c *fiber.Ctx) error {
+	clientID, clientSecret := o.clientCredentials(c)
+
+	response, err := o.service.Token(c.Context(), models.TokenRequest{
+		GrantType:    c.FormValue("grant_type"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Code:         c.FormValue("code"),
+		RedirectURI:  c.FormValue("redirect_uri"),
+		CodeVerifier: c.FormValue("code_verifier"),
+		RefreshToken: c.FormValue("refresh_token"),
+		Scope:        c.FormValue("scope"),
+
+		ClientAssertionType: c.FormValue("client_assertion_type"),
+		ClientAssertion:     c.FormValue("client_assertion"),
+
+		SubjectToken:       c.FormValue("subject_token"),
+		SubjectTokenType:   c.FormValue("subject_token_type"),
+		ActorToken:         c.FormValue("actor_token"),
+		ActorTokenType:     c.FormValue("actor_token_type"),
+		RequestedTokenType: c.FormValue("requested_token_type"),
+		Audience:           o.formValues(c, "audience"),
+		RequestedSubject:   c.FormValue("requested_subject"),
+		Reason:             c.FormValue("reason"),
+	})
+	if err != nil {
+		return o.tokenError(c, err)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(response)
+}
+
+func (o *OAuth) Revoke(c *fiber.Ctx) error {
+	clientID, clientSecret := o.clientCredentials(c)
+
+	if err := o.service.Revoke(c.Context(), c.FormValue("token"), c.FormValue("token_type_hint"), clientID, clientSecret); err != nil {
+		return o.tokenError(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (o *OAuth) Introspect(c *fiber.Ctx) error {
+	clientID, clientSecret := o.clientCredentials(c)
+
+	introspection, err := o.service.Introspect(c.Context(), c.FormValue("token"), c.FormValue("token_type_hint"), clientID, clientSecret)
+	if err != nil {
+		return o.tokenError(c, err)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(introspection)
+}
+
+func (o *OAuth) param(c *fiber.Ctx, key string) string {
+	if c.Method() == fiber.MethodPost {
+		return c.FormValue(key)
+	}
+	return c.Query(key)
+}
+
+// clientCredentials reads client authentication from HTTP Basic (RFC 6749
+// section 2.3.1) and falls back to client_secret_post form parameters.
+func (o *OAuth) clientCredentials(c *fiber.Ctx) (string, string) {
+	header := c.Get(fiber.HeaderAuthorization)
+	if strings.HasPrefix(header, "Basic ") {
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, "Basic "))
+		if err == nil {
+			id, secret, ok := strings.Cut(string(raw), ":")
+			if ok {
+				id, _ = url.QueryUnescape(id)
+				secret, _ = url.QueryUnescape(secret)
+				return id, secret
+			}
+		}
+	}
+
+	return c.FormValue("client_id"), c.FormValue("client_secret")
+}
+
+func (o *OAuth) render(c *fiber.Ctx, status int, page authorizePage) error {
+	var buf bytes.Buffer
+	if err := authorizeTemplate.Execute(&buf, page); err != nil {
+		return o.serverError(c, err)
+	}
+
+	c.Set(fiber.HeaderXFrameOptions, "DENY")
+	c.Type("html", "utf-8")
+	return c.Status(status).Send(buf.Bytes())
+}
+
+// authorizeURL rebuilds the authorization request as a local URL, so that a
+// login with an upstream provider can resume it afterwards.
+func (o *OAuth) authorizeURL(req models.AuthorizeRequest) string {
+	query := url.Values{}
+	for key, value := range map[string]string{
+		"response_type":         req.ResponseType,
+		"client_id":             req.ClientID,
+		"redirect_uri":          req.RedirectURI,
+		"scope":                 req.Scope,
+		"state":                 req.State,
+		"code_challenge":        req.CodeChallenge,
+		"code_challenge_method": req.CodeChallengeMethod,
+		"nonce":                 req.Nonce,
+		"max_age":               req.MaxAge,
+	} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+
+	return "/authorize?" + query.Encode()
+}
+
+func (o *OAuth) redirectURL(req models.AuthorizeRequest, params url.Values) string {
+	target, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		return req.RedirectURI
+	}
+
+	query := target.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	query.Set("iss", o.opts.Config.OAuth.Issuer)
+	target.RawQuery = query.Encode()
+
+	return target.String()
+}
+
+func (o *OAuth) redirectError(c *fiber.Ctx, req models.AuthorizeRequest, err error) error {
+	var oauthErr *models.OAuthError
+	if !errors.As(err, &oauthErr) {
+		return o.serverError(c, err)
+	}
+
+	params := url.Values{"error": {oauthErr.Code}}
+	if oauthErr.Description != "" {
+		params.Set("error_description", oauthErr.Description)
+	}
+
+	return c.Redirect(o.redirectURL(req, params), fiber.StatusFound)
+}
+
+func (o *OAuth) tokenError(c *fiber.Ctx, err error) error {
+	var oauthErr *models.OAuthError
+	if !errors.As(err, &oauthErr) {
+		return o.serverError(c, err)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	if oauthErr.Code == "invalid_client" {
+		if strings.HasPrefix(c.Get(fiber.HeaderAuthorization), "Basic ") {
+			c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="ember"`)
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(oauthErr)
+	}
+
+	return c.Status(fiber.StatusBadRequest).JSON(oauthErr)
+}
+
+func (o *OAuth) serverError(c *fiber.Ctx, err error) error {
+	_ = o.opts.Logger.Error("oauth request failed", "path", c.Path(), "error", err)
+
+	return c.Status(fiber.StatusInternalServerError).JSON(models.NewOAuthError("server_error", ""))
+}
+
+// formValues returns every value of a repeatable form parameter.
+func (o *OAuth) formValues(c *fiber.Ctx, key string) []string {
+	var values []string
+	for _, value := range c.Request().PostArgs().PeekMulti(key) {
+		values = append(values, string(value))
+	}
+	return values
+}
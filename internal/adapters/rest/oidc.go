@@ -0,0 +1,62 @@
+package rest
+
+import (
+	"errors"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"github.com/gofiber/fiber/v2"
+	"strings"
+)
+
+type OIDC struct {
+	service ports.IOIDCService
+	opts    *models.Options
+}
+
+func NewOIDC(service ports.IOIDCService, opts *models.Options) *OIDC {
+	return &OIDC{
+		service: service,
+		opts:    opts,
+	}
+}
+
+func (o *OIDC) Register(app *fiber.App) {
+	app.Get("/.well-known/openid-configuration", o.Discovery)
+	app.Get("/.well-known/jwks.json", o.JWKS)
+	app.Get("/userinfo", o.UserInfo)
+	app.Post("/userinfo", o.UserInfo)
+}
+
+func (o *OIDC) Discovery(c *fiber.Ctx) error {
+	return c.JSON(o.service.Discovery())
+}
+
+func (o *OIDC) JWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=3600")
+	return c.JSON(o.service.JWKS())
+}
+
+func (o *OIDC) UserInfo(c *fiber.Ctx) error {
+	header := c.Get(fiber.HeaderAuthorization)
+	if !strings.HasPrefix(header, "Bearer ") {
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="ember"`)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	info, err := o.service.UserInfo(c.Context(), strings.TrimPrefix(header, "Bearer "))
+	if err != nil {
+		var oauthErr *models.OAuthError
+		if !errors.As(err, &oauthErr) {
+			_ = o.opts.Logger.Error("userinfo request failed", "error", err)
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="ember", error="`+oauthErr.Code+`"`)
+		if oauthErr.Code == "insufficient_scope" {
+			return c.SendStatus(fiber.StatusForbidden)
+		}
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	return c.JSON(info)
+}
@@ -0,0 +1,33 @@
+package rest
+
+import (
+	"fmt"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/gofiber/fiber/v2"
+)
+
+var successColor = lipgloss.Color("#98FF98") // Mint
+
+type Server struct {
+	app *fiber.App
+}
+
+func NewServer() *Server {
+	return &Server{app: fiber.New(fiber.Config{DisableStartupMessage: true})}
+}
+
+func (s *Server) Run(handler *Handler, addr string) error {
+	handler.Register(s.app)
+
+	fmt.Printf("\n%s\n\n",
+		lipgloss.NewStyle().
+			Foreground(successColor).
+			Bold(true).
+			Render("⇨ HTTP server started on "+addr))
+
+	return s.app.Listen(addr)
+}
+
+func (s *Server) Shutdown() error {
+	return s.app.Shutdown()
+}
@@ -0,0 +1,68 @@
+package rest
+
+import (
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/core/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"time"
+)
+
+const sessionCookie = "ember_session"
+
+// browserSession is the single sign-on session of the user agent, kept in a
+// signed cookie so that /authorize can skip the login form.
+type browserSession struct {
+	UserID   string
+	AuthTime time.Time
+}
+
+func readBrowserSession(c *fiber.Ctx, opts *models.Options) (browserSession, bool) {
+	value := c.Cookies(sessionCookie)
+	if value == "" {
+		return browserSession{}, false
+	}
+
+	claims, err := services.VerifyJWT(value, &opts.Config.Token)
+	if err != nil {
+		return browserSession{}, false
+	}
+
+	if tokenType, _ := claims["type"].(string); tokenType != "browser" {
+		return browserSession{}, false
+	}
+
+	sub, err := claims.GetSubject()
+	if err != nil || sub == "" {
+		return browserSession{}, false
+	}
+
+	authTime, _ := claims["auth_time"].(float64)
+
+	return browserSession{UserID: sub, AuthTime: time.Unix(int64(authTime), 0)}, true
+}
+
+func setBrowserSession(c *fiber.Ctx, opts *models.Options, session browserSession) error {
+	ttl := opts.Config.OAuth.SessionTTL
+
+	value, err := services.CreateJWT(ttl, &opts.Config.Token, jwt.MapClaims{
+		"sub":       session.UserID,
+		"type":      "browser",
+		"auth_time": session.AuthTime.Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     sessionCookie,
+		Value:    value,
+		Path:     "/",
+		Expires:  time.Now().Add(ttl),
+		Secure:   opts.Config.OAuth.CookieSecure,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	accountv1 "github.com/co1seam/ember-backend-auth/gen/go/account"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+type Account struct {
+	accountv1.UnimplementedAccountServer
+	service ports.IAccountService
+	opts    *models.Options
+}
+
+func NewAccount(service ports.IAccountService, opts *models.Options) *Account {
+	return &Account{
+		service: service,
+		opts:    opts,
+	}
+}
+
+func (a *Account) ListLoginMethods(ctx context.Context, _ *accountv1.ListLoginMethodsRequest) (*accountv1.ListLoginMethodsResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	methods, err := a.service.ListLoginMethods(ctx, caller.UserID)
+	if err != nil {
+		return nil, accountError(err)
+	}
+
+	response := &accountv1.ListLoginMethodsResponse{}
+	for _, method := range methods {
+		item := &accountv1.LoginMethod{
+			Type:      method.Type,
+			Provider:  method.Provider,
+			Subject:   method.Subject,
+			Email:     method.Email,
+			CreatedAt: method.CreateAt.Format(time.RFC3339),
+		}
+		if !method.LastUsedAt.IsZero() {
+			item.LastUsedAt = method.LastUsedAt.Format(time.RFC3339)
+		}
+		response.Methods = append(response.Methods, item)
+	}
+
+	return response, nil
+}
+
+func (a *Account) LinkIdentity(ctx context.Context, req *accountv1.LinkIdentityRequest) (*accountv1.LinkIdentityResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := a.service.LinkIdentity(ctx, caller.UserID, caller.AuthTime, req.Provider, req.ReturnTo)
+	if err != nil {
+		return nil, accountError(err)
+	}
+
+	return &accountv1.LinkIdentityResponse{AuthorizationUrl: url}, nil
+}
+
+func (a *Account) UnlinkIdentity(ctx context.Context, req *accountv1.UnlinkIdentityRequest) (*accountv1.UnlinkIdentityResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.service.UnlinkIdentity(ctx, caller.UserID, req.Provider, req.Subject); err != nil {
+		return nil, accountError(err)
+	}
+
+	return &accountv1.UnlinkIdentityResponse{Success: true}, nil
+}
+
+func accountError(err error) error {
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, models.ErrLastLoginMethod):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, models.ErrReauthenticationRequired):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, models.ErrIdentityConflict):
+		return status.Error(codes.AlreadyExists, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
@@ -0,0 +1,249 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	adminv1 "github.com/co1seam/ember-backend-auth/gen/go/admin"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+type Admin struct {
+	adminv1.UnimplementedAdminAuthServer
+	service ports.IAdminService
+	opts    *models.Options
+}
+
+func NewAdmin(service ports.IAdminService, opts *models.Options) *Admin {
+	return &Admin{
+		service: service,
+		opts:    opts,
+	}
+}
+
+func (a *Admin) ListUsers(ctx context.Context, req *adminv1.ListUsersRequest) (*adminv1.ListUsersResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := models.UserFilter{
+		Email:  req.Email,
+		Status: req.Status,
+		Limit:  int(req.PageSize),
+	}
+	if req.Cursor != "" {
+		if filter.After, err = models.ParseUserCursor(req.Cursor); err != nil {
+			return nil, adminError(err)
+		}
+	}
+	if filter.CreatedAfter, err = parseTime(req.CreatedAfter, "created_after"); err != nil {
+		return nil, adminError(err)
+	}
+	if filter.CreatedBefore, err = parseTime(req.CreatedBefore, "created_before"); err != nil {
+		return nil, adminError(err)
+	}
+
+	page, err := a.service.ListUsers(ctx, caller.UserID, filter)
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	response := &adminv1.ListUsersResponse{NextCursor: page.NextCursor}
+	for _, user := range page.Users {
+		response.Users = append(response.Users, userInfo(&user))
+	}
+
+	return response, nil
+}
+
+func (a *Admin) GetUser(ctx context.Context, req *adminv1.GetUserRequest) (*adminv1.GetUserResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := a.service.GetUser(ctx, caller.UserID, req.UserId)
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	return &adminv1.GetUserResponse{User: userInfo(user)}, nil
+}
+
+func (a *Admin) CreateUser(ctx context.Context, req *adminv1.CreateUserRequest) (*adminv1.CreateUserResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user := models.SignUpRequest{
+		Name:     req.Name,
+		Email:    req.Email,
+		Password: req.Password,
+	}
+
+	created, err := a.service.CreateUser(ctx, caller.UserID, user, req.EmailVerified)
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	return &adminv1.CreateUserResponse{User: userInfo(created)}, nil
+}
+
+func (a *Admin) UpdateUser(ctx context.Context, req *adminv1.UpdateUserRequest) (*adminv1.UpdateUserResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	update := models.UpdateUserRequest{Name: req.Name, Email: req.Email}
+
+	user, err := a.service.UpdateUser(ctx, caller.UserID, req.UserId, update)
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	return &adminv1.UpdateUserResponse{User: userInfo(user)}, nil
+}
+
+func (a *Admin) DisableUser(ctx context.Context, req *adminv1.DisableUserRequest) (*adminv1.DisableUserResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.service.DisableUser(ctx, caller.UserID, req.UserId, req.Reason); err != nil {
+		return nil, adminError(err)
+	}
+
+	return &adminv1.DisableUserResponse{Success: true}, nil
+}
+
+func (a *Admin) EnableUser(ctx context.Context, req *adminv1.EnableUserRequest) (*adminv1.EnableUserResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.service.EnableUser(ctx, caller.UserID, req.UserId, req.Reason); err != nil {
+		return nil, adminError(err)
+	}
+
+	return &adminv1.EnableUserResponse{Success: true}, nil
+}
+
+func (a *Admin) LockUser(ctx context.Context, req *adminv1.LockUserRequest) (*adminv1.LockUserResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.service.LockUser(ctx, caller.UserID, req.UserId, req.Reason); err != nil {
+		return nil, adminError(err)
+	}
+
+	return &adminv1.LockUserResponse{Success: true}, nil
+}
+
+func (a *Admin) DeleteUser(ctx context.Context, req *adminv1.DeleteUserRequest) (*adminv1.DeleteUserResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.service.DeleteUser(ctx, caller.UserID, req.UserId, req.Reason); err != nil {
+		return nil, adminError(err)
+	}
+
+	return &adminv1.DeleteUserResponse{Success: true}, nil
+}
+
+func (a *Admin) ForceLogout(ctx context.Context, req *adminv1.ForceLogoutRequest) (*adminv1.ForceLogoutResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.service.ForceLogout(ctx, caller.UserID, req.UserId); err != nil {
+		return nil, adminError(err)
+	}
+
+	return &adminv1.ForceLogoutResponse{Success: true}, nil
+}
+
+// ResetMFA is part of the admin contract, but users cannot enroll second
+// factors yet, so there is nothing to reset.
+func (a *Admin) ResetMFA(ctx context.Context, _ *adminv1.ResetMFARequest) (*adminv1.ResetMFAResponse, error) {
+	if _, err := authenticated(ctx); err != nil {
+		return nil, err
+	}
+
+	return nil, status.Error(codes.Unimplemented, "multi-factor authentication is not supported yet, users have no second factors to reset")
+}
+
+func (a *Admin) SetPassword(ctx context.Context, req *adminv1.SetPasswordRequest) (*adminv1.SetPasswordResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.service.SetPassword(ctx, caller.UserID, req.UserId, req.Password); err != nil {
+		return nil, adminError(err)
+	}
+
+	return &adminv1.SetPasswordResponse{Success: true}, nil
+}
+
+func userInfo(user *models.User) *adminv1.User {
+	info := &adminv1.User{
+		UserId:          user.ID,
+		Name:            user.Name,
+		Email:           user.Email,
+		Status:          user.Status,
+		EmailVerified:   user.EmailVerifiedAt != nil,
+		StatusReason:    user.StatusReason,
+		StatusChangedBy: user.StatusChangedBy,
+		CreatedAt:       user.CreateAt.Format(time.RFC3339),
+		UpdatedAt:       user.UpdateAt.Format(time.RFC3339),
+	}
+	if user.StatusChangedAt != nil {
+		info.StatusChangedAt = user.StatusChangedAt.Format(time.RFC3339)
+	}
+
+	return info
+}
+
+func parseTime(value, field string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s must be an RFC 3339 timestamp", models.ErrInvalidUserInput, field)
+	}
+
+	return t, nil
+}
+
+func adminError(err error) error {
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, models.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, models.ErrInvalidUserInput), errors.Is(err, models.ErrInvalidCursor):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, models.ErrIdentityConflict):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, models.ErrInvalidStatusTransition), errors.Is(err, models.ErrAccountDeleted):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
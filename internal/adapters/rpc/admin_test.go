@@ -0,0 +1,20 @@
+package rpc
+
+import (
+	"context"
+	adminv1 "github.com/co1seam/ember-backend-auth/gen/go/admin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func TestResetMFA(t *testing.T) {
+	a := NewAdmin(nil, testOptions())
+
+	if _, err := a.ResetMFA(context.Background(), &adminv1.ResetMFARequest{UserId: "member"}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("got %v, want an unauthenticated caller refused", err)
+	}
+	if _, err := a.ResetMFA(withPrincipal(reader), &adminv1.ResetMFARequest{UserId: "member"}); status.Code(err) != codes.Unimplemented {
+		t.Fatalf("got %v, want the missing second factors reported", err)
+	}
+}
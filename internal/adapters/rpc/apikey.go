@@ -0,0 +1,106 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	apikeyv1 "github.com/co1seam/ember-backend-auth/gen/go/apikey"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// APIKey manages the caller's personal access tokens. It requires an access
+// token, so an API key cannot be used to mint further keys.
+type APIKey struct {
+	apikeyv1.UnimplementedAPIKeyServer
+	service ports.IAPIKeyService
+	opts    *models.Options
+}
+
+func NewAPIKey(service ports.IAPIKeyService, opts *models.Options) *APIKey {
+	return &APIKey{
+		service: service,
+		opts:    opts,
+	}
+}
+
+func (a *APIKey) CreateAPIKey(ctx context.Context, req *apikeyv1.CreateAPIKeyRequest) (*apikeyv1.CreateAPIKeyResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	key, secret, err := a.service.CreateAPIKey(ctx, caller.UserID, req.Name, req.Scopes, time.Duration(req.ExpiresIn)*time.Second)
+	if err != nil {
+		return nil, apiKeyError(err)
+	}
+
+	return &apikeyv1.CreateAPIKeyResponse{Key: apiKeyInfo(key), Secret: secret}, nil
+}
+
+func (a *APIKey) ListAPIKeys(ctx context.Context, _ *apikeyv1.ListAPIKeysRequest) (*apikeyv1.ListAPIKeysResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := a.service.ListAPIKeys(ctx, caller.UserID)
+	if err != nil {
+		return nil, apiKeyError(err)
+	}
+
+	response := &apikeyv1.ListAPIKeysResponse{}
+	for _, key := range keys {
+		response.Keys = append(response.Keys, apiKeyInfo(&key))
+	}
+
+	return response, nil
+}
+
+func (a *APIKey) RevokeAPIKey(ctx context.Context, req *apikeyv1.RevokeAPIKeyRequest) (*apikeyv1.RevokeAPIKeyResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.service.RevokeAPIKey(ctx, caller.UserID, req.KeyId); err != nil {
+		return nil, apiKeyError(err)
+	}
+
+	return &apikeyv1.RevokeAPIKeyResponse{Success: true}, nil
+}
+
+func apiKeyInfo(key *models.APIKey) *apikeyv1.APIKeyInfo {
+	info := &apikeyv1.APIKeyInfo{
+		KeyId:     key.ID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreateAt.Format(time.RFC3339),
+	}
+	if key.ExpiresAt != nil {
+		info.ExpiresAt = key.ExpiresAt.Format(time.RFC3339)
+	}
+	if key.LastUsedAt != nil {
+		info.LastUsedAt = key.LastUsedAt.Format(time.RFC3339)
+	}
+
+	return info
+}
+
+func apiKeyError(err error) error {
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, models.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, models.ErrInvalidAPIKeyInput):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, models.ErrInvalidAPIKey):
+		return status.Error(codes.Unauthenticated, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
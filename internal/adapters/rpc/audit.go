@@ -0,0 +1,199 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	auditv1 "github.com/co1seam/ember-backend-auth/gen/go/audit"
+	"github.com/co1seam/ember-backend-auth/internal/adapters/metrics"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"net"
+	"strconv"
+	"time"
+)
+
+type Audit struct {
+	auditv1.UnimplementedAuditServer
+	service ports.IAuditService
+	opts    *models.Options
+}
+
+func NewAudit(service ports.IAuditService, opts *models.Options) *Audit {
+	return &Audit{
+		service: service,
+		opts:    opts,
+	}
+}
+
+func (a *Audit) QueryAuditEvents(ctx context.Context, req *auditv1.QueryAuditEventsRequest) (*auditv1.QueryAuditEventsResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := models.AuditFilter{
+		UserID:  req.UserId,
+		Types:   req.EventTypes,
+		Outcome: req.Outcome,
+		Limit:   int(req.PageSize),
+	}
+	if req.Cursor != "" {
+		if filter.BeforeID, err = strconv.ParseInt(req.Cursor, 10, 64); err != nil || filter.BeforeID <= 0 {
+			return nil, status.Error(codes.InvalidArgument, "invalid cursor")
+		}
+	}
+	if filter.Since, err = parseTime(req.Since, "since"); err != nil {
+		return nil, auditError(err)
+	}
+	if filter.Until, err = parseTime(req.Until, "until"); err != nil {
+		return nil, auditError(err)
+	}
+
+	page, err := a.service.QueryEvents(ctx, caller.UserID, filter)
+	if err != nil {
+		return nil, auditError(err)
+	}
+
+	response := &auditv1.QueryAuditEventsResponse{NextCursor: page.NextCursor}
+	for _, event := range page.Events {
+		response.Events = append(response.Events, &auditv1.AuditEvent{
+			EventId:   event.ID,
+			EventType: event.Type,
+			UserId:    event.UserID,
+			SessionId: event.SessionID,
+			IpAddress: event.IP,
+			UserAgent: event.UserAgent,
+			Outcome:   event.Outcome,
+			Reason:    event.Reason,
+			Metadata:  event.Metadata,
+			CreatedAt: event.CreateAt.Format(time.RFC3339),
+		})
+	}
+
+	return response, nil
+}
+
+// newAuditEvent starts an event about the current request, recording the
+// address and user agent of the client, the request ID, and its certificate
+// identity when it authenticated with one.
+func newAuditEvent(ctx context.Context, eventType string) *models.AuditEvent {
+	ip, userAgent := clientInfo(ctx)
+
+	event := &models.AuditEvent{
+		Type:      eventType,
+		IP:        ip,
+		UserAgent: userAgent,
+		Metadata:  map[string]string{},
+	}
+	if id := requestID(ctx); id != "" {
+		event.Metadata["request_id"] = id
+	}
+	if identity, ok := peerIdentity(ctx); ok {
+		event.Metadata["client_identity"] = identity.ID()
+	}
+
+	return event
+}
+
+// logAuditEvent completes the event with the outcome of the request. The
+// reason of a failure is the ErrorInfo reason of the returned status if it
+// has one, and its message otherwise.
+func logAuditEvent(ctx context.Context, audit ports.IAuditLog, event *models.AuditEvent, err error) {
+	// The reason metrics are labelled with is the ErrorInfo reason or the
+	// status code, as messages can carry anything.
+	var reason string
+
+	event.Outcome = models.AuditOutcomeSuccess
+	if err != nil {
+		event.Outcome = models.AuditOutcomeFailure
+
+		st := status.Convert(err)
+		event.Reason, reason = st.Message(), st.Code().String()
+		for _, detail := range st.Details() {
+			if info, ok := detail.(*errdetails.ErrorInfo); ok {
+				event.Reason, reason = info.Reason, info.Reason
+			}
+		}
+	}
+
+	audit.Log(ctx, event)
+	countAuthEvent(event, reason)
+}
+
+// countAuthEvent updates the metrics of the authentication flows.
+func countAuthEvent(event *models.AuditEvent, reason string) {
+	success := event.Outcome == models.AuditOutcomeSuccess
+
+	switch event.Type {
+	case models.AuditSignUp:
+		if success {
+			metrics.SignUps.Inc()
+		}
+	case models.AuditSignIn:
+		metrics.SignIns.WithLabelValues(event.Outcome, reason).Inc()
+	case models.AuditOTPSent:
+		if success {
+			metrics.OTPs.WithLabelValues("sent").Inc()
+		}
+	case models.AuditOTPVerified:
+		if success {
+			metrics.OTPs.WithLabelValues("verified").Inc()
+		}
+	case models.AuditTokenRefreshed:
+		if success {
+			metrics.RefreshRotations.WithLabelValues("auth").Inc()
+		}
+	}
+}
+
+// clientInfo returns the address and user agent of the client. The address
+// is the one clientAddressUnaryInterceptor resolved, or that of the peer.
+func clientInfo(ctx context.Context) (string, string) {
+	address, ok := ctx.Value(clientAddressKey{}).(string)
+	if !ok {
+		address = peerAddress(ctx)
+	}
+
+	var userAgent string
+	if values := metadata.ValueFromIncomingContext(ctx, "user-agent"); len(values) > 0 {
+		userAgent = values[0]
+	}
+
+	return address, userAgent
+}
+
+// peerAddress returns the address of the connection the request came over,
+// or an empty string if there is none.
+func peerAddress(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	address := p.Addr.String()
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+	if ip := net.ParseIP(address); ip != nil {
+		return ip.String()
+	}
+
+	return ""
+}
+
+func auditError(err error) error {
+	switch {
+	case errors.Is(err, models.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, models.ErrInvalidAuditFilter), errors.Is(err, models.ErrInvalidUserInput):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, fmt.Sprintf("failed to query audit events: %v", err))
+	}
+}
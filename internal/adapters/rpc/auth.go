@@ -2,37 +2,70 @@ package rpc
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	authv1 "github.com/co1seam/ember-backend-api-contracts/gen/go/auth"
-	"github.com/co1seam/ember-backend-auth/config"
 	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/core/services"
 	"github.com/co1seam/ember-backend-auth/internal/ports"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
-	"strconv"
+	"strings"
 	"time"
 )
 
+const (
+	principalTypeHeader = "principal-type"
+	actorHeader         = "actor"
+	scopeHeader         = "scope"
+
+	// errorDomain names this service in the ErrorInfo details of errors.
+	errorDomain = "auth.ember"
+)
+
+// accountStatusReasons are the ErrorInfo reasons telling clients why an
+// account may not sign in.
+var accountStatusReasons = map[error]string{
+	models.ErrAccountPending:  "ACCOUNT_PENDING",
+	models.ErrAccountLocked:   "ACCOUNT_LOCKED",
+	models.ErrAccountDisabled: "ACCOUNT_DISABLED",
+	models.ErrAccountDeleted:  "ACCOUNT_DELETED",
+}
+
 type Authorization struct {
 	authv1.UnimplementedAuthServer
 	service ports.IAuthService
+	tokens  ports.IOAuthService
+	apiKeys ports.IAPIKeyService
+	audit   ports.IAuditLog
+	issuer  *tokenIssuer
 	opts    *models.Options
 }
 
-func NewAuthorization(service ports.IAuthService, opts *models.Options) *Authorization {
+func NewAuthorization(service ports.IAuthService, tokens ports.IOAuthService, apiKeys ports.IAPIKeyService, audit ports.IAuditLog, issuer *tokenIssuer, opts *models.Options) *Authorization {
 	return &Authorization{
 		service: service,
+		tokens:  tokens,
+		apiKeys: apiKeys,
+		audit:   audit,
+		issuer:  issuer,
 		opts:    opts,
 	}
 }
 
-func (a *Authorization) SendOTP(ctx context.Context, req *authv1.SendOTPRequest) (*authv1.SendOTPResponse, error) {
+func (a *Authorization) SendOTP(ctx context.Context, req *authv1.SendOTPRequest) (_ *authv1.SendOTPResponse, err error) {
 	otp := models.SendOtpRequest{
 		Email: req.Email,
 	}
 
-	err := a.service.SendOTP(ctx, otp.Email)
+	event := newAuditEvent(ctx, models.AuditOTPSent)
+	event.Metadata["email"] = otp.Email
+	defer func() { logAuditEvent(ctx, a.audit, event, err) }()
+
+	err = a.service.SendOTP(ctx, otp.Email)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
@@ -40,53 +73,69 @@ func (a *Authorization) SendOTP(ctx context.Context, req *authv1.SendOTPRequest)
 	return &authv1.SendOTPResponse{Success: true}, nil
 }
 
-func (a *Authorization) VerifyOTP(ctx context.Context, req *authv1.VerifyOTPRequest) (*authv1.VerifyOTPResponse, error) {
+func (a *Authorization) VerifyOTP(ctx context.Context, req *authv1.VerifyOTPRequest) (_ *authv1.VerifyOTPResponse, err error) {
 	user := models.VerifyOtpRequest{
 		OTP: req.Otp,
 	}
 
-	fmt.Println(req.Otp)
-	fmt.Println(user.OTP)
+	event := newAuditEvent(ctx, models.AuditOTPVerified)
+	defer func() { logAuditEvent(ctx, a.audit, event, err) }()
 
 	email, err := a.service.VerifyOTP(ctx, user.OTP)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
+	event.Metadata["email"] = email
 
 	return &authv1.VerifyOTPResponse{Email: email}, nil
 }
 
-func (a *Authorization) SignUp(ctx context.Context, req *authv1.SignUpRequest) (*authv1.SignUpResponse, error) {
+func (a *Authorization) SignUp(ctx context.Context, req *authv1.SignUpRequest) (_ *authv1.SignUpResponse, err error) {
 	user := models.SignUpRequest{
 		Name:     req.Username,
 		Email:    req.Email,
 		Password: req.Password,
+		Status:   models.UserStatusPending,
 	}
 
+	event := newAuditEvent(ctx, models.AuditSignUp)
+	event.Metadata["email"] = user.Email
+	defer func() { logAuditEvent(ctx, a.audit, event, err) }()
+
 	id, err := a.service.Create(ctx, user)
 	if err != nil {
 		return &authv1.SignUpResponse{AccessToken: "", RefreshToken: ""}, status.Error(codes.Internal, err.Error())
 	}
+	event.UserID = id.(string)
 
-	tokens, err := createTokens(id.(int), &a.opts.Config.Token)
-	if err != nil {
-		return &authv1.SignUpResponse{}, status.Error(codes.Internal, err.Error())
+	// The account stays pending, and cannot sign in or join an organization
+	// by its email domain, until VerifyOTP proves the address. Should the
+	// code not arrive, SendOTP sends another.
+	if err := a.service.SendOTP(ctx, user.Email); err != nil {
+		_ = a.opts.Logger.ErrorContext(ctx, "failed to send sign-up OTP", "user_id", event.UserID, "error", err)
 	}
 
-	return &authv1.SignUpResponse{AccessToken: tokens[1], RefreshToken: tokens[0]}, nil
+	return &authv1.SignUpResponse{}, nil
 }
 
-func (a *Authorization) SignIn(ctx context.Context, req *authv1.SignInRequest) (*authv1.SignInResponse, error) {
+func (a *Authorization) SignIn(ctx context.Context, req *authv1.SignInRequest) (_ *authv1.SignInResponse, err error) {
 	user := models.SignInRequest{
 		Email:    req.Email,
 		Password: req.Password,
 	}
 
+	event := newAuditEvent(ctx, models.AuditSignIn)
+	event.Metadata["email"] = user.Email
+	defer func() { logAuditEvent(ctx, a.audit, event, err) }()
+
 	id, err := a.service.Read(ctx, user)
 	if err != nil {
-		return &authv1.SignInResponse{}, status.Error(codes.Internal, err.Error())
+		return &authv1.SignInResponse{}, authError(err)
 	}
-	tokens, err := createTokens(id.(int), &a.opts.Config.Token)
+	event.UserID = id.(string)
+
+	event.SessionID = uuid.NewString()
+	tokens, err := a.issuer.issue(ctx, id.(string), "", event.SessionID, time.Now())
 	if err != nil {
 		return &authv1.SignInResponse{}, status.Error(codes.Internal, err.Error())
 	}
@@ -94,28 +143,60 @@ func (a *Authorization) SignIn(ctx context.Context, req *authv1.SignInRequest) (
 	return &authv1.SignInResponse{AccessToken: tokens[1], RefreshToken: tokens[0]}, nil
 }
 
-func (a *Authorization) RefreshToken(ctx context.Context, req *authv1.RefreshTokenRequest) (*authv1.RefreshTokenResponse, error) {
-	claims, err := verifyJWT(req.RefreshToken, &a.opts.Config.Token)
+// SignOut ends the sign-in of the token, which may be its access or its
+// refresh token, so that neither stays valid until it expires. Tokens of
+// OAuth clients are revoked at /revoke instead.
+func (a *Authorization) SignOut(ctx context.Context, req *authv1.SignOutRequest) (_ *authv1.SignOutResponse, err error) {
+	event := newAuditEvent(ctx, models.AuditSignOut)
+	defer func() { logAuditEvent(ctx, a.audit, event, err) }()
+
+	introspection, err := a.tokens.RevokeSignIn(ctx, req.AccessToken)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
+	if !introspection.Active {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+	event.UserID, event.SessionID = introspection.Subject, introspection.SessionID
+
+	return &authv1.SignOutResponse{}, nil
+}
 
-	tokenType, ok := claims["type"].(string)
-	if !ok || tokenType != "refresh" {
-		return nil, status.Error(codes.Internal, "invalid refresh token")
+func (a *Authorization) RefreshToken(ctx context.Context, req *authv1.RefreshTokenRequest) (_ *authv1.RefreshTokenResponse, err error) {
+	event := newAuditEvent(ctx, models.AuditTokenRefreshed)
+	defer func() { logAuditEvent(ctx, a.audit, event, err) }()
+
+	// OAuth refresh tokens belong to a client and are exchanged at /token.
+	introspection, err := a.tokens.RotateRefreshToken(ctx, req.RefreshToken)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if !introspection.Active {
+		return nil, status.Error(codes.Unauthenticated, "invalid refresh token")
 	}
 
-	sub, ok := claims["sub"].(string)
-	if !ok {
-		return nil, status.Error(codes.Internal, "invalid subject")
+	if introspection.Subject == "" {
+		return nil, status.Error(codes.Unauthenticated, "invalid subject")
 	}
+	event.UserID, event.SessionID = introspection.Subject, introspection.SessionID
 
-	userID, err := strconv.Atoi(sub)
+	if err := a.service.CheckStatus(ctx, introspection.Subject); err != nil {
+		return nil, authError(err)
+	}
+
+	claims, err := services.VerifyJWT(req.RefreshToken, &a.opts.Config.Token)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, status.Error(codes.Unauthenticated, "invalid refresh token")
 	}
 
-	tokens, err := createTokens(userID, &a.opts.Config.Token)
+	var authTime time.Time
+	if value, ok := claims["auth_time"].(float64); ok {
+		authTime = time.Unix(int64(value), 0)
+	}
+
+	orgID, _ := claims["org_id"].(string)
+
+	tokens, err := a.issuer.issue(ctx, introspection.Subject, orgID, introspection.SessionID, authTime)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
@@ -123,43 +204,102 @@ func (a *Authorization) RefreshToken(ctx context.Context, req *authv1.RefreshTok
 	return &authv1.RefreshTokenResponse{AccessToken: tokens[1], RefreshToken: tokens[0]}, nil
 }
 
-func (a *Authorization) ValidateToken(_ context.Context, req *authv1.ValidateTokenRequest) (*authv1.ValidateTokenResponse, error) {
-	claims, err := verifyJWT(req.AccessToken, &a.opts.Config.Token)
+// ValidateToken reports invalid, expired and revoked tokens as Unauthenticated,
+// so that callers can tell them apart from failures of this service. Besides
+// access tokens it accepts API keys, which resolve to the user owning them.
+// Whether the subject is a user or a service account is returned in the
+// "principal-type" response header, as the response message has no field
+// for it; for exchanged tokens the "actor" header names who acts for the
+// subject. API keys and tokens of OAuth clients only act within their
+// scopes, which the space-separated "scope" header lists; backends must not
+// grant them more. Tokens of users who are not active fail like SignIn does.
+// Only failed validations are audited, as every request to a backend is
+// validated.
+func (a *Authorization) ValidateToken(ctx context.Context, req *authv1.ValidateTokenRequest) (_ *authv1.ValidateTokenResponse, err error) {
+	event := newAuditEvent(ctx, models.AuditTokenValidation)
+	defer func() {
+		if err != nil {
+			logAuditEvent(ctx, a.audit, event, err)
+		}
+	}()
+
+	if strings.HasPrefix(req.AccessToken, models.APIKeyPrefix) {
+		event.Metadata["credential"] = "api_key"
+
+		key, err := a.apiKeys.Authenticate(ctx, req.AccessToken)
+		if err != nil {
+			return nil, apiKeyError(err)
+		}
+		event.UserID = key.UserID
+		event.Metadata["key_id"] = key.ID
+
+		if err := a.service.CheckStatus(ctx, key.UserID); err != nil {
+			return nil, authError(err)
+		}
+
+		_ = grpc.SetHeader(ctx, metadata.Pairs(
+			principalTypeHeader, models.PrincipalTypeUser,
+			scopeHeader, models.JoinScope(key.Scopes),
+		))
+		return &authv1.ValidateTokenResponse{Subject: key.UserID}, nil
+	}
+
+	introspection, err := a.tokens.InspectToken(ctx, req.AccessToken, models.TokenTypeAccessToken)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
-	tokenType, ok := claims["type"].(string)
-	if !ok || tokenType != "access" {
-		return nil, status.Error(codes.Internal, "invalid token")
+	if !introspection.Active || introspection.TokenType != models.TokenTypeAccessToken {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
 	}
 
-	sub, ok := claims["sub"].(string)
-	if !ok {
-		return nil, status.Error(codes.Internal, "invalid subject")
+	if introspection.Subject == "" {
+		return nil, status.Error(codes.Unauthenticated, "invalid subject")
 	}
 
-	return &authv1.ValidateTokenResponse{Subject: sub}, nil
-}
+	event.SessionID = introspection.SessionID
+	if introspection.PrincipalType == models.PrincipalTypeUser {
+		event.UserID = introspection.Subject
+		if err := a.service.CheckStatus(ctx, introspection.Subject); err != nil {
+			return nil, authError(err)
+		}
+	}
 
-func createTokens(userID int, cfg *config.Token) ([]string, error) {
-	refreshCookie, err := createJWT(time.Hour*72, cfg, jwt.MapClaims{
-		"sub":  fmt.Sprint(userID),
-		"type": "refresh",
-		"aud":  "admin",
-	})
-	if err != nil {
-		return []string{}, err
+	header := metadata.Pairs(principalTypeHeader, introspection.PrincipalType)
+	if introspection.Actor != nil {
+		header.Set(actorHeader, introspection.Actor.Subject)
+	}
+	if introspection.ClientID != "" {
+		header.Set(scopeHeader, introspection.Scope)
 	}
+	_ = grpc.SetHeader(ctx, header)
 
-	accessToken, err := createJWT(time.Minute*15, cfg, jwt.MapClaims{
-		"sub":  fmt.Sprint(userID),
-		"type": "access",
-		"aud":  "admin",
-	})
-	if err != nil {
-		return []string{}, err
+	return &authv1.ValidateTokenResponse{Subject: introspection.Subject}, nil
+}
+
+// authError maps sign-in failures. Account status errors are
+// PermissionDenied with an ErrorInfo detail whose reason, such as
+// ACCOUNT_LOCKED, tells clients what happened to the account.
+func authError(err error) error {
+	for target, reason := range accountStatusReasons {
+		if errors.Is(err, target) {
+			st, detailErr := status.New(codes.PermissionDenied, err.Error()).WithDetails(&errdetails.ErrorInfo{
+				Reason: reason,
+				Domain: errorDomain,
+			})
+			if detailErr != nil {
+				return status.Error(codes.PermissionDenied, err.Error())
+			}
+			return st.Err()
+		}
 	}
 
-	return []string{refreshCookie, accessToken}, nil
+	switch {
+	case errors.Is(err, models.ErrUnauthorized):
+		return status.Error(codes.Unauthenticated, "invalid email or password")
+	case errors.Is(err, models.ErrNotFound):
+		return status.Error(codes.Unauthenticated, "unknown user")
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
 }
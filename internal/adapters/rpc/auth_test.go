@@ -0,0 +1,126 @@
+package rpc
+
+import (
+	"context"
+	authv1 "github.com/co1seam/ember-backend-api-contracts/gen/go/auth"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+// headerStream records the headers a method sets.
+type headerStream struct {
+	grpc.ServerTransportStream
+	header metadata.MD
+}
+
+func (s *headerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func TestValidateTokenScopes(t *testing.T) {
+	key := models.APIKeyPrefix + "key"
+	a := NewAuthorization(&fakeUsers{}, &fakeTokens{},
+		&fakeAPIKeys{keys: map[string]*models.APIKey{key: {ID: "key", UserID: "user", Scopes: []string{models.PermissionUsersRead, models.PermissionAuditRead}}}},
+		nil, nil, testOptions())
+
+	stream := &headerStream{}
+	resp, err := a.ValidateToken(grpc.NewContextWithServerTransportStream(context.Background(), stream), &authv1.ValidateTokenRequest{AccessToken: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Subject != "user" {
+		t.Fatalf("got subject %q, want the owner of the key", resp.Subject)
+	}
+
+	want := models.PermissionUsersRead + " " + models.PermissionAuditRead
+	if got := stream.header.Get(scopeHeader); len(got) != 1 || got[0] != want {
+		t.Fatalf("got scope header %q, want %q", got, want)
+	}
+}
+
+// fakeAuditLog keeps the events it is given.
+type fakeAuditLog struct {
+	ports.IAuditLog
+	events []*models.AuditEvent
+}
+
+func (f *fakeAuditLog) Log(_ context.Context, event *models.AuditEvent) {
+	f.events = append(f.events, event)
+}
+
+// fakeSignIns revokes sign-ins by token.
+type fakeSignIns struct {
+	fakeTokens
+	revoked []string
+}
+
+func (f *fakeSignIns) RevokeSignIn(_ context.Context, token string) (*models.Introspection, error) {
+	if f.fakeTokens.revoked[token] {
+		return &models.Introspection{Active: false}, nil
+	}
+	f.revoked = append(f.revoked, token)
+
+	return &models.Introspection{Active: true, Subject: "user", SessionID: "sign-in"}, nil
+}
+
+func TestSignOut(t *testing.T) {
+	tokens := &fakeSignIns{fakeTokens: fakeTokens{revoked: map[string]bool{"revoked": true}}}
+	audit := &fakeAuditLog{}
+	a := NewAuthorization(&fakeUsers{}, tokens, &fakeAPIKeys{}, audit, nil, testOptions())
+
+	if _, err := a.SignOut(context.Background(), &authv1.SignOutRequest{AccessToken: "token"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens.revoked) != 1 {
+		t.Fatal("the sign-in was not revoked")
+	}
+	if event := audit.events[0]; event.Type != models.AuditSignOut || event.UserID != "user" || event.SessionID != "sign-in" {
+		t.Fatalf("got audit event %+v, want the sign-out of the user", event)
+	}
+
+	if _, err := a.SignOut(context.Background(), &authv1.SignOutRequest{AccessToken: "revoked"}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("revoked token: got %v, want Unauthenticated", err)
+	}
+}
+
+// fakeSignUps creates users and records the OTPs it sends.
+type fakeSignUps struct {
+	ports.IAuthService
+	created []models.SignUpRequest
+	otps    []string
+}
+
+func (f *fakeSignUps) Create(_ context.Context, entity ...interface{}) (interface{}, error) {
+	f.created = append(f.created, entity[0].(models.SignUpRequest))
+	return "user", nil
+}
+
+func (f *fakeSignUps) SendOTP(_ context.Context, email string) error {
+	f.otps = append(f.otps, email)
+	return nil
+}
+
+func TestSignUpAwaitsVerification(t *testing.T) {
+	signUps := &fakeSignUps{}
+	a := NewAuthorization(signUps, &fakeTokens{}, &fakeAPIKeys{}, &fakeAuditLog{}, nil, testOptions())
+
+	resp, err := a.SignUp(context.Background(), &authv1.SignUpRequest{Username: "user", Email: "user@example.com", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.AccessToken != "" || resp.RefreshToken != "" {
+		t.Fatal("signed in an account whose email is not verified")
+	}
+	if len(signUps.created) != 1 || signUps.created[0].Status != models.UserStatusPending {
+		t.Fatalf("got sign-ups %+v, want one pending account", signUps.created)
+	}
+	if len(signUps.otps) != 1 || signUps.otps[0] != "user@example.com" {
+		t.Fatalf("got OTPs sent to %v, want one to the new address", signUps.otps)
+	}
+}
@@ -2,18 +2,56 @@ package rpc
 
 import (
 	authv1 "github.com/co1seam/ember-backend-api-contracts/gen/go/auth"
+	accountv1 "github.com/co1seam/ember-backend-auth/gen/go/account"
+	adminv1 "github.com/co1seam/ember-backend-auth/gen/go/admin"
+	apikeyv1 "github.com/co1seam/ember-backend-auth/gen/go/apikey"
+	auditv1 "github.com/co1seam/ember-backend-auth/gen/go/audit"
+	invitationv1 "github.com/co1seam/ember-backend-auth/gen/go/invitation"
+	organizationv1 "github.com/co1seam/ember-backend-auth/gen/go/organization"
+	rbacv1 "github.com/co1seam/ember-backend-auth/gen/go/rbac"
+	relationv1 "github.com/co1seam/ember-backend-auth/gen/go/relation"
+	serviceaccountv1 "github.com/co1seam/ember-backend-auth/gen/go/serviceaccount"
+	tokenv1 "github.com/co1seam/ember-backend-auth/gen/go/token"
+	webhookv1 "github.com/co1seam/ember-backend-auth/gen/go/webhook"
 	"github.com/co1seam/ember-backend-auth/internal/core/models"
 	"github.com/co1seam/ember-backend-auth/internal/core/services"
 )
 
 type Handler struct {
-	Authorization authv1.AuthServer
-	opts          *models.Options
+	Authorization  authv1.AuthServer
+	Account        accountv1.AccountServer
+	Token          tokenv1.TokenServer
+	RBAC           rbacv1.RBACServer
+	Relation       relationv1.RelationServer
+	Organization   organizationv1.OrganizationServer
+	Invitation     invitationv1.InvitationServer
+	APIKey         apikeyv1.APIKeyServer
+	ServiceAccount serviceaccountv1.ServiceAccountServer
+	Admin          adminv1.AdminAuthServer
+	Audit          auditv1.AuditServer
+	Webhooks       webhookv1.WebhooksServer
+	auth           *authenticator
+	opts           *models.Options
 }
 
 func NewHandler(service *services.Service, opts *models.Options) *Handler {
+	issuer := newTokenIssuer(service.RBAC, service.Organizations, opts)
+	organization := NewOrganization(service.Organizations, issuer, opts)
+
 	return &Handler{
-		Authorization: NewAuthorization(service.Authorization, opts),
-		opts:          opts,
+		Authorization:  NewAuthorization(service.Authorization, service.OAuth, service.APIKeys, service.AuditLog, issuer, opts),
+		Account:        NewAccount(service.Account, opts),
+		Token:          NewToken(service.OAuth, opts),
+		RBAC:           NewRBAC(service.RBAC, opts),
+		Relation:       NewRelation(service.Relations, service.RBAC, opts),
+		Organization:   organization,
+		Invitation:     NewInvitation(service.Invitations, organization, issuer, opts),
+		APIKey:         NewAPIKey(service.APIKeys, opts),
+		ServiceAccount: NewServiceAccount(service.ServiceAccounts, opts),
+		Admin:          NewAdmin(service.Admin, opts),
+		Audit:          NewAudit(service.Audit, opts),
+		Webhooks:       NewWebhooks(service.Webhooks, opts),
+		auth:           newAuthenticator(service.OAuth, service.Authorization, service.APIKeys, opts),
+		opts:           opts,
 	}
 }
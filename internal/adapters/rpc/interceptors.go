@@ -0,0 +1,346 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/config"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"net"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+const (
+	requestIDHeader = "x-request-id"
+
+	// maxRequestIDLength bounds request IDs taken from clients, which end up
+	// in logs and audit events.
+	maxRequestIDLength = 128
+)
+
+type requestIDKey struct{}
+
+type callKey struct{}
+
+type clientAddressKey struct{}
+
+// gatewayKey marks requests of the in-process HTTP gateway, which passes the
+// address of its client as x-forwarded-for.
+type gatewayKey struct{}
+
+// call is what the interceptors learn about a request while it is handled.
+// Handlers fill in the subject once they authenticate the caller.
+type call struct {
+	Subject string
+}
+
+// requestID returns the ID of the current request.
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// setSubject records the authenticated caller of the request for the access
+// log.
+func setSubject(ctx context.Context, subject string) {
+	if c, ok := ctx.Value(callKey{}).(*call); ok {
+		c.Subject = subject
+	}
+}
+
+// serverStream overrides the context of a stream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// requestIDUnaryInterceptor takes the request ID from the x-request-id
+// metadata, or generates one, and returns it in the response headers.
+func requestIDUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, id := withRequestID(ctx)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDHeader, id))
+
+		return handler(ctx, req)
+	}
+}
+
+func requestIDStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, id := withRequestID(ss.Context())
+		_ = ss.SetHeader(metadata.Pairs(requestIDHeader, id))
+
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// withRequestID stores the request ID in ctx and on the span of the
+// request. IDs from clients are only kept if they are short and printable.
+func withRequestID(ctx context.Context) (context.Context, string) {
+	var id string
+	if values := metadata.ValueFromIncomingContext(ctx, requestIDHeader); len(values) > 0 && validRequestID(values[0]) {
+		id = values[0]
+	} else {
+		id = uuid.NewString()
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("request.id", id))
+
+	return context.WithValue(ctx, requestIDKey{}, id), id
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r < '!' || r > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// clientAddressUnaryInterceptor resolves the address of the client once for
+// the logs and audit events of the request. The x-forwarded-for metadata is
+// anyone's to set, so it is only believed from the in-process gateway and
+// from trusted proxies; from those, the client is the last address that is
+// not itself a trusted proxy.
+func clientAddressUnaryInterceptor(proxies trustedProxies) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(context.WithValue(ctx, clientAddressKey{}, proxies.clientAddress(ctx)), req)
+	}
+}
+
+func clientAddressStreamInterceptor(proxies trustedProxies) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := context.WithValue(ss.Context(), clientAddressKey{}, proxies.clientAddress(ss.Context()))
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// trustedProxies are the networks whose x-forwarded-for metadata is
+// believed.
+type trustedProxies []*net.IPNet
+
+// newTrustedProxies parses the addresses and CIDR ranges of the
+// configuration.
+func newTrustedProxies(cfg *config.GRPC) (trustedProxies, error) {
+	proxies := make(trustedProxies, 0, len(cfg.TrustedProxies))
+	for _, entry := range cfg.TrustedProxies {
+		entry = strings.TrimSpace(entry)
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GRPC_TRUSTED_PROXIES entry %q", entry)
+		}
+		proxies = append(proxies, network)
+	}
+
+	return proxies, nil
+}
+
+func (p trustedProxies) contains(ip net.IP) bool {
+	for _, network := range p {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientAddress returns the address of the client of the request.
+func (p trustedProxies) clientAddress(ctx context.Context) string {
+	address := peerAddress(ctx)
+	gateway, _ := ctx.Value(gatewayKey{}).(bool)
+	if !gateway && (address == "" || !p.contains(net.ParseIP(address))) {
+		return address
+	}
+
+	var hops []string
+	for _, value := range metadata.ValueFromIncomingContext(ctx, "x-forwarded-for") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			return ""
+		}
+		if i == 0 || !p.contains(ip) {
+			return ip.String()
+		}
+	}
+
+	return address
+}
+
+// accessLogUnaryInterceptor logs every request once it is handled. Only the
+// method, outcome, timing and who made it are logged; request messages and
+// metadata are not, as they carry passwords and tokens.
+func accessLogUnaryInterceptor(opts *models.Options) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		c := &call{}
+		ctx = context.WithValue(ctx, callKey{}, c)
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logAccess(ctx, opts, info.FullMethod, c, start, err)
+
+		return resp, err
+	}
+}
+
+func accessLogStreamInterceptor(opts *models.Options) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		c := &call{}
+		ctx := context.WithValue(ss.Context(), callKey{}, c)
+
+		start := time.Now()
+		err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		logAccess(ctx, opts, info.FullMethod, c, start, err)
+
+		return err
+	}
+}
+
+func logAccess(ctx context.Context, opts *models.Options, method string, c *call, start time.Time, err error) {
+	code := status.Code(err)
+	ip, userAgent := clientInfo(ctx)
+
+	args := []any{
+		"method", method,
+		"code", code.String(),
+		"duration_ms", time.Since(start).Milliseconds(),
+		"peer", ip,
+		"user_agent", userAgent,
+		"request_id", requestID(ctx),
+	}
+	if c.Subject != "" {
+		args = append(args, "subject", c.Subject)
+	}
+	if identity, ok := peerIdentity(ctx); ok {
+		args = append(args, "client_identity", identity.ID())
+	}
+
+	switch code {
+	case codes.Unknown, codes.Internal, codes.DataLoss, codes.Unavailable, codes.DeadlineExceeded, codes.Unimplemented:
+		_ = opts.Logger.ErrorContext(ctx, "gRPC request", append(args, "error", status.Convert(err).Message())...)
+	default:
+		_ = opts.Logger.InfoContext(ctx, "gRPC request", args...)
+	}
+}
+
+// recoveryUnaryInterceptor turns a panic in a handler into an Internal
+// error, so that one bad request does not take the server down.
+func recoveryUnaryInterceptor(opts *models.Options) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (_ interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(ctx, opts, info.FullMethod, r)
+			}
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+func recoveryStreamInterceptor(opts *models.Options) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(ss.Context(), opts, info.FullMethod, r)
+			}
+		}()
+
+		return handler(srv, ss)
+	}
+}
+
+// recovered logs a recovered panic with its stack. The client only learns
+// that the request failed.
+func recovered(ctx context.Context, opts *models.Options, method string, r any) error {
+	_ = opts.Logger.ErrorContext(ctx, "panic in gRPC handler",
+		"method", method,
+		"request_id", requestID(ctx),
+		"panic", fmt.Sprint(r),
+		"stack", string(debug.Stack()),
+	)
+
+	return status.Error(codes.Internal, "internal error")
+}
+
+// deadlineUnaryInterceptor gives requests without a deadline the timeout of
+// their method. Streams are left alone, as some of them, such as health
+// watches, are meant to stay open.
+func deadlineUnaryInterceptor(timeouts *methodTimeouts) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			if timeout := timeouts.get(info.FullMethod); timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// methodTimeouts are the default deadlines of requests by full method name.
+type methodTimeouts struct {
+	fallback time.Duration
+	methods  map[string]time.Duration
+}
+
+// newMethodTimeouts parses the "/package.Service/Method=duration" entries
+// of the configuration. A zero duration leaves the method without a
+// deadline.
+func newMethodTimeouts(cfg *config.GRPC) (*methodTimeouts, error) {
+	t := &methodTimeouts{
+		fallback: cfg.DefaultTimeout,
+		methods:  make(map[string]time.Duration, len(cfg.MethodTimeouts)),
+	}
+
+	for _, entry := range cfg.MethodTimeouts {
+		method, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || method == "" {
+			return nil, fmt.Errorf("invalid GRPC_METHOD_TIMEOUTS entry %q", entry)
+		}
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout < 0 {
+			return nil, fmt.Errorf("invalid timeout of %s in GRPC_METHOD_TIMEOUTS", method)
+		}
+		t.methods["/"+strings.TrimPrefix(method, "/")] = timeout
+	}
+
+	return t, nil
+}
+
+func (t *methodTimeouts) get(method string) time.Duration {
+	if timeout, ok := t.methods[method]; ok {
+		return timeout
+	}
+
+	return t.fallback
+}
@@ -0,0 +1,59 @@
+package rpc
+
+import (
+	"context"
+	"github.com/co1seam/ember-backend-auth/config"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"net"
+	"testing"
+)
+
+func TestClientAddress(t *testing.T) {
+	proxies, err := newTrustedProxies(&config.GRPC{TrustedProxies: []string{"10.0.0.0/8", "192.0.2.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(peerIP, forwardedFor string, gateway bool) context.Context {
+		ctx := context.Background()
+		if peerIP != "" {
+			ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(peerIP), Port: 4242}})
+		}
+		if forwardedFor != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-forwarded-for", forwardedFor))
+		}
+		if gateway {
+			ctx = context.WithValue(ctx, gatewayKey{}, true)
+		}
+
+		return ctx
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{name: "direct client", ctx: request("203.0.113.7", "", false), want: "203.0.113.7"},
+		{name: "forged header", ctx: request("203.0.113.7", "198.51.100.1", false), want: "203.0.113.7"},
+		{name: "gateway", ctx: request("", "198.51.100.1", true), want: "198.51.100.1"},
+		{name: "trusted proxy", ctx: request("10.1.2.3", "198.51.100.1", false), want: "198.51.100.1"},
+		{name: "chain of trusted proxies", ctx: request("10.1.2.3", "198.51.100.1, 192.0.2.1", false), want: "198.51.100.1"},
+		{name: "forged entry before a trusted proxy", ctx: request("10.1.2.3", "192.0.2.99, 198.51.100.1", false), want: "198.51.100.1"},
+		{name: "trusted proxy without header", ctx: request("10.1.2.3", "", false), want: "10.1.2.3"},
+		{name: "unparsable address", ctx: request("10.1.2.3", "unknown", false), want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := proxies.clientAddress(tt.ctx); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := newTrustedProxies(&config.GRPC{TrustedProxies: []string{"10.0.0.0/33"}}); err == nil {
+		t.Fatal("accepted an invalid CIDR range")
+	}
+}
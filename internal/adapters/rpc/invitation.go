@@ -0,0 +1,151 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	invitationv1 "github.com/co1seam/ember-backend-auth/gen/go/invitation"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// Invitation manages organization invitations. Like Organization, requests
+// without an org_id act on the organization of the caller's access token.
+type Invitation struct {
+	invitationv1.UnimplementedInvitationServer
+	service ports.IInvitationService
+	orgs    *Organization
+	issuer  *tokenIssuer
+	opts    *models.Options
+}
+
+func NewInvitation(service ports.IInvitationService, orgs *Organization, issuer *tokenIssuer, opts *models.Options) *Invitation {
+	return &Invitation{
+		service: service,
+		orgs:    orgs,
+		issuer:  issuer,
+		opts:    opts,
+	}
+}
+
+func (i *Invitation) CreateInvitation(ctx context.Context, req *invitationv1.CreateInvitationRequest) (*invitationv1.CreateInvitationResponse, error) {
+	caller, orgID, err := i.orgs.caller(ctx, req.OrgId)
+	if err != nil {
+		return nil, err
+	}
+
+	invitation, err := i.service.CreateInvitation(ctx, caller.UserID, orgID, req.Email, req.Role, time.Duration(req.ExpiresIn)*time.Second)
+	if err != nil {
+		return nil, invitationError(err)
+	}
+
+	return &invitationv1.CreateInvitationResponse{Invitation: invitationInfo(invitation)}, nil
+}
+
+func (i *Invitation) ListInvitations(ctx context.Context, req *invitationv1.ListInvitationsRequest) (*invitationv1.ListInvitationsResponse, error) {
+	caller, orgID, err := i.orgs.caller(ctx, req.OrgId)
+	if err != nil {
+		return nil, err
+	}
+
+	invitations, err := i.service.ListInvitations(ctx, caller.UserID, orgID)
+	if err != nil {
+		return nil, invitationError(err)
+	}
+
+	response := &invitationv1.ListInvitationsResponse{}
+	for _, invitation := range invitations {
+		response.Invitations = append(response.Invitations, invitationInfo(&invitation))
+	}
+
+	return response, nil
+}
+
+func (i *Invitation) ResendInvitation(ctx context.Context, req *invitationv1.ResendInvitationRequest) (*invitationv1.ResendInvitationResponse, error) {
+	caller, orgID, err := i.orgs.caller(ctx, req.OrgId)
+	if err != nil {
+		return nil, err
+	}
+
+	invitation, err := i.service.ResendInvitation(ctx, caller.UserID, orgID, req.InvitationId, time.Duration(req.ExpiresIn)*time.Second)
+	if err != nil {
+		return nil, invitationError(err)
+	}
+
+	return &invitationv1.ResendInvitationResponse{Invitation: invitationInfo(invitation)}, nil
+}
+
+func (i *Invitation) RevokeInvitation(ctx context.Context, req *invitationv1.RevokeInvitationRequest) (*invitationv1.RevokeInvitationResponse, error) {
+	caller, orgID, err := i.orgs.caller(ctx, req.OrgId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := i.service.RevokeInvitation(ctx, caller.UserID, orgID, req.InvitationId); err != nil {
+		return nil, invitationError(err)
+	}
+
+	return &invitationv1.RevokeInvitationResponse{Success: true}, nil
+}
+
+// AcceptInvitation accepts an invitation and returns tokens scoped to the
+// organization. A bearer token, when sent, must be valid: the invitation is
+// then accepted by that account instead of creating a new one.
+func (i *Invitation) AcceptInvitation(ctx context.Context, req *invitationv1.AcceptInvitationRequest) (*invitationv1.AcceptInvitationResponse, error) {
+	var (
+		userID, sessionID string
+		authTime          = time.Now()
+	)
+	if caller, ok := principalFrom(ctx); ok {
+		userID, sessionID, authTime = caller.UserID, caller.SessionID, caller.AuthTime
+	}
+
+	invitation, err := i.service.AcceptInvitation(ctx, req.Token, userID, &models.SignUpRequest{
+		Name:     req.Username,
+		Password: req.Password,
+	})
+	if err != nil {
+		return nil, invitationError(err)
+	}
+
+	tokens, err := i.issuer.issue(ctx, invitation.AcceptedBy, invitation.OrgID, sessionID, authTime)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &invitationv1.AcceptInvitationResponse{
+		OrgId:        invitation.OrgID,
+		AccessToken:  tokens[1],
+		RefreshToken: tokens[0],
+	}, nil
+}
+
+func invitationInfo(invitation *models.Invitation) *invitationv1.InvitationInfo {
+	return &invitationv1.InvitationInfo{
+		InvitationId: invitation.ID,
+		OrgId:        invitation.OrgID,
+		Email:        invitation.Email,
+		Role:         invitation.Role,
+		InvitedBy:    invitation.InvitedBy,
+		Status:       invitation.Status(),
+		ExpiresAt:    invitation.ExpiresAt.Format(time.RFC3339),
+		CreatedAt:    invitation.CreateAt.Format(time.RFC3339),
+	}
+}
+
+func invitationError(err error) error {
+	switch {
+	case errors.Is(err, models.ErrInvitationInvalid):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, models.ErrInvitationExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, models.ErrInvitationEmailMismatch):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, models.ErrInvitationSignInNeeded):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return organizationError(err)
+	}
+}
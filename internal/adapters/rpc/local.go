@@ -0,0 +1,67 @@
+package rpc
+
+import (
+	"context"
+	authv1 "github.com/co1seam/ember-backend-api-contracts/gen/go/auth"
+	"google.golang.org/grpc"
+)
+
+// localAuth calls the Auth service in process, through the unary
+// interceptors of the server, so that requests of the HTTP gateway are
+// logged, counted, authorized and given deadlines as gRPC requests are.
+type localAuth struct {
+	authv1.UnimplementedAuthServer
+	auth         authv1.AuthServer
+	interceptors []grpc.UnaryServerInterceptor
+}
+
+// invoke runs call as the handler of method, inside the interceptors. The
+// request is marked as the gateway's, whose x-forwarded-for is believed.
+func invoke[Req, Resp any](ctx context.Context, l *localAuth, method string, req *Req, call func(context.Context, *Req) (*Resp, error)) (*Resp, error) {
+	ctx = context.WithValue(ctx, gatewayKey{}, true)
+	info := &grpc.UnaryServerInfo{Server: l.auth, FullMethod: method}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return call(ctx, req.(*Req))
+	}
+	for i := len(l.interceptors) - 1; i >= 0; i-- {
+		interceptor, next := l.interceptors[i], handler
+		handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+			return interceptor(ctx, req, info, next)
+		}
+	}
+
+	resp, err := handler(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.(*Resp), nil
+}
+
+func (l *localAuth) SendOTP(ctx context.Context, req *authv1.SendOTPRequest) (*authv1.SendOTPResponse, error) {
+	return invoke(ctx, l, authv1.Auth_SendOTP_FullMethodName, req, l.auth.SendOTP)
+}
+
+func (l *localAuth) VerifyOTP(ctx context.Context, req *authv1.VerifyOTPRequest) (*authv1.VerifyOTPResponse, error) {
+	return invoke(ctx, l, authv1.Auth_VerifyOTP_FullMethodName, req, l.auth.VerifyOTP)
+}
+
+func (l *localAuth) SignUp(ctx context.Context, req *authv1.SignUpRequest) (*authv1.SignUpResponse, error) {
+	return invoke(ctx, l, authv1.Auth_SignUp_FullMethodName, req, l.auth.SignUp)
+}
+
+func (l *localAuth) SignIn(ctx context.Context, req *authv1.SignInRequest) (*authv1.SignInResponse, error) {
+	return invoke(ctx, l, authv1.Auth_SignIn_FullMethodName, req, l.auth.SignIn)
+}
+
+func (l *localAuth) SignOut(ctx context.Context, req *authv1.SignOutRequest) (*authv1.SignOutResponse, error) {
+	return invoke(ctx, l, authv1.Auth_SignOut_FullMethodName, req, l.auth.SignOut)
+}
+
+func (l *localAuth) RefreshToken(ctx context.Context, req *authv1.RefreshTokenRequest) (*authv1.RefreshTokenResponse, error) {
+	return invoke(ctx, l, authv1.Auth_RefreshToken_FullMethodName, req, l.auth.RefreshToken)
+}
+
+func (l *localAuth) ValidateToken(ctx context.Context, req *authv1.ValidateTokenRequest) (*authv1.ValidateTokenResponse, error) {
+	return invoke(ctx, l, authv1.Auth_ValidateToken_FullMethodName, req, l.auth.ValidateToken)
+}
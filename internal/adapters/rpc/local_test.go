@@ -0,0 +1,63 @@
+package rpc
+
+import (
+	"context"
+	authv1 "github.com/co1seam/ember-backend-api-contracts/gen/go/auth"
+	"github.com/co1seam/ember-backend-auth/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"slices"
+	"testing"
+	"time"
+)
+
+// fakeAuth signs in whoever has a deadline.
+type fakeAuth struct {
+	authv1.UnimplementedAuthServer
+}
+
+func (f *fakeAuth) SignIn(ctx context.Context, req *authv1.SignInRequest) (*authv1.SignInResponse, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		return nil, status.Error(codes.Internal, "no deadline")
+	}
+
+	return &authv1.SignInResponse{AccessToken: req.Email}, nil
+}
+
+func TestLocalAuthInterceptors(t *testing.T) {
+	timeouts, err := newMethodTimeouts(&config.GRPC{DefaultTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls []string
+	record := func(name string) grpc.UnaryServerInterceptor {
+		return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			calls = append(calls, name+" "+info.FullMethod)
+			return handler(ctx, req)
+		}
+	}
+	l := &localAuth{auth: &fakeAuth{}, interceptors: []grpc.UnaryServerInterceptor{
+		record("outer"),
+		record("inner"),
+		deadlineUnaryInterceptor(timeouts),
+	}}
+
+	resp, err := l.SignIn(context.Background(), &authv1.SignInRequest{Email: "user@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.AccessToken != "user@example.com" {
+		t.Fatalf("got %q, want the response of the service", resp.AccessToken)
+	}
+
+	want := []string{"outer " + authv1.Auth_SignIn_FullMethodName, "inner " + authv1.Auth_SignIn_FullMethodName}
+	if !slices.Equal(calls, want) {
+		t.Fatalf("got interceptor calls %v, want %v", calls, want)
+	}
+
+	if _, err := l.SignUp(context.Background(), &authv1.SignUpRequest{}); status.Code(err) != codes.Unimplemented {
+		t.Fatalf("got %v, want the error of the service", err)
+	}
+}
@@ -0,0 +1,240 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	organizationv1 "github.com/co1seam/ember-backend-auth/gen/go/organization"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// Organization serves tenant management. Requests without an org_id act on
+// the organization the caller's access token is scoped to.
+type Organization struct {
+	organizationv1.UnimplementedOrganizationServer
+	service ports.IOrganizationService
+	issuer  *tokenIssuer
+	opts    *models.Options
+}
+
+func NewOrganization(service ports.IOrganizationService, issuer *tokenIssuer, opts *models.Options) *Organization {
+	return &Organization{
+		service: service,
+		issuer:  issuer,
+		opts:    opts,
+	}
+}
+
+func (o *Organization) CreateOrganization(ctx context.Context, req *organizationv1.CreateOrganizationRequest) (*organizationv1.CreateOrganizationResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	org, err := o.service.CreateOrganization(ctx, caller.UserID, req.Name, req.Slug)
+	if err != nil {
+		return nil, organizationError(err)
+	}
+
+	return &organizationv1.CreateOrganizationResponse{Organization: &organizationv1.OrganizationInfo{
+		OrgId:     org.ID,
+		Name:      org.Name,
+		Slug:      org.Slug,
+		Role:      models.OrgRoleOwner,
+		CreatedAt: org.CreateAt.Format(time.RFC3339),
+	}}, nil
+}
+
+func (o *Organization) ListOrganizations(ctx context.Context, _ *organizationv1.ListOrganizationsRequest) (*organizationv1.ListOrganizationsResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	memberships, err := o.service.ListOrganizations(ctx, caller.UserID)
+	if err != nil {
+		return nil, organizationError(err)
+	}
+
+	response := &organizationv1.ListOrganizationsResponse{}
+	for _, m := range memberships {
+		response.Organizations = append(response.Organizations, &organizationv1.OrganizationInfo{
+			OrgId:     m.OrgID,
+			Name:      m.OrgName,
+			Slug:      m.OrgSlug,
+			Role:      m.Role,
+			CreatedAt: m.CreateAt.Format(time.RFC3339),
+		})
+	}
+
+	return response, nil
+}
+
+// SwitchOrganization reissues the caller's tokens scoped to another
+// organization they are a member of.
+func (o *Organization) SwitchOrganization(ctx context.Context, req *organizationv1.SwitchOrganizationRequest) (*organizationv1.SwitchOrganizationResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := o.service.Membership(ctx, req.OrgId, caller.UserID); err != nil {
+		return nil, organizationError(err)
+	}
+
+	tokens, err := o.issuer.issue(ctx, caller.UserID, req.OrgId, caller.SessionID, caller.AuthTime)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &organizationv1.SwitchOrganizationResponse{AccessToken: tokens[1], RefreshToken: tokens[0]}, nil
+}
+
+func (o *Organization) ListMembers(ctx context.Context, req *organizationv1.ListMembersRequest) (*organizationv1.ListMembersResponse, error) {
+	caller, orgID, err := o.caller(ctx, req.OrgId)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := o.service.ListMembers(ctx, caller.UserID, orgID)
+	if err != nil {
+		return nil, organizationError(err)
+	}
+
+	response := &organizationv1.ListMembersResponse{}
+	for _, m := range members {
+		response.Members = append(response.Members, &organizationv1.Member{
+			UserId:    m.UserID,
+			Email:     m.Email,
+			Role:      m.Role,
+			CreatedAt: m.CreateAt.Format(time.RFC3339),
+		})
+	}
+
+	return response, nil
+}
+
+func (o *Organization) AddMember(ctx context.Context, req *organizationv1.AddMemberRequest) (*organizationv1.AddMemberResponse, error) {
+	caller, orgID, err := o.caller(ctx, req.OrgId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := o.service.AddMember(ctx, caller.UserID, orgID, req.UserId, req.Role); err != nil {
+		return nil, organizationError(err)
+	}
+
+	return &organizationv1.AddMemberResponse{Success: true}, nil
+}
+
+func (o *Organization) UpdateMember(ctx context.Context, req *organizationv1.UpdateMemberRequest) (*organizationv1.UpdateMemberResponse, error) {
+	caller, orgID, err := o.caller(ctx, req.OrgId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := o.service.UpdateMember(ctx, caller.UserID, orgID, req.UserId, req.Role); err != nil {
+		return nil, organizationError(err)
+	}
+
+	return &organizationv1.UpdateMemberResponse{Success: true}, nil
+}
+
+func (o *Organization) RemoveMember(ctx context.Context, req *organizationv1.RemoveMemberRequest) (*organizationv1.RemoveMemberResponse, error) {
+	caller, orgID, err := o.caller(ctx, req.OrgId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := o.service.RemoveMember(ctx, caller.UserID, orgID, req.UserId); err != nil {
+		return nil, organizationError(err)
+	}
+
+	return &organizationv1.RemoveMemberResponse{Success: true}, nil
+}
+
+func (o *Organization) AddDomain(ctx context.Context, req *organizationv1.AddDomainRequest) (*organizationv1.AddDomainResponse, error) {
+	caller, orgID, err := o.caller(ctx, req.OrgId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := o.service.AddDomain(ctx, caller.UserID, orgID, req.Domain, req.Role); err != nil {
+		return nil, organizationError(err)
+	}
+
+	return &organizationv1.AddDomainResponse{Success: true}, nil
+}
+
+func (o *Organization) ListDomains(ctx context.Context, req *organizationv1.ListDomainsRequest) (*organizationv1.ListDomainsResponse, error) {
+	caller, orgID, err := o.caller(ctx, req.OrgId)
+	if err != nil {
+		return nil, err
+	}
+
+	domains, err := o.service.ListDomains(ctx, caller.UserID, orgID)
+	if err != nil {
+		return nil, organizationError(err)
+	}
+
+	response := &organizationv1.ListDomainsResponse{}
+	for _, d := range domains {
+		response.Domains = append(response.Domains, &organizationv1.Domain{
+			Domain:    d.Domain,
+			Role:      d.Role,
+			CreatedAt: d.CreateAt.Format(time.RFC3339),
+		})
+	}
+
+	return response, nil
+}
+
+func (o *Organization) RemoveDomain(ctx context.Context, req *organizationv1.RemoveDomainRequest) (*organizationv1.RemoveDomainResponse, error) {
+	caller, orgID, err := o.caller(ctx, req.OrgId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := o.service.RemoveDomain(ctx, caller.UserID, orgID, req.Domain); err != nil {
+		return nil, organizationError(err)
+	}
+
+	return &organizationv1.RemoveDomainResponse{Success: true}, nil
+}
+
+// caller returns the caller of the request and the organization it targets.
+func (o *Organization) caller(ctx context.Context, orgID string) (*principal, string, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if orgID == "" {
+		orgID = caller.OrgID
+	}
+	if orgID == "" {
+		return nil, "", status.Error(codes.InvalidArgument, "org_id is required")
+	}
+
+	return caller, orgID, nil
+}
+
+func organizationError(err error) error {
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, models.ErrNotMember), errors.Is(err, models.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, models.ErrOrgSlugTaken), errors.Is(err, models.ErrDomainTaken):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, models.ErrLastOwner):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, models.ErrInvalidOrgRole), errors.Is(err, models.ErrInvalidOrgInput):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
@@ -0,0 +1,226 @@
+package rpc
+
+import (
+	"context"
+	authv1 "github.com/co1seam/ember-backend-api-contracts/gen/go/auth"
+	accountv1 "github.com/co1seam/ember-backend-auth/gen/go/account"
+	adminv1 "github.com/co1seam/ember-backend-auth/gen/go/admin"
+	apikeyv1 "github.com/co1seam/ember-backend-auth/gen/go/apikey"
+	auditv1 "github.com/co1seam/ember-backend-auth/gen/go/audit"
+	invitationv1 "github.com/co1seam/ember-backend-auth/gen/go/invitation"
+	organizationv1 "github.com/co1seam/ember-backend-auth/gen/go/organization"
+	rbacv1 "github.com/co1seam/ember-backend-auth/gen/go/rbac"
+	relationv1 "github.com/co1seam/ember-backend-auth/gen/go/relation"
+	serviceaccountv1 "github.com/co1seam/ember-backend-auth/gen/go/serviceaccount"
+	tokenv1 "github.com/co1seam/ember-backend-auth/gen/go/token"
+	webhookv1 "github.com/co1seam/ember-backend-auth/gen/go/webhook"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"strings"
+	"time"
+)
+
+type access int
+
+const (
+	// accessAuthenticated methods need a valid access token.
+	accessAuthenticated access = iota
+	// accessPublic methods take no access token, or check credentials of
+	// their own.
+	accessPublic
+	// accessOptional methods take an access token if one is sent, which
+	// must then be valid.
+	accessOptional
+)
+
+// policy is what a method requires of its caller.
+type policy struct {
+	Access access
+	// Scopes are required of tokens issued to OAuth clients and of API
+	// keys, which cannot call methods without any.
+	Scopes []string
+	// StepUp requires the caller to have authenticated within
+	// ACCOUNT_REAUTH_MAX_AGE.
+	StepUp bool
+	// MFALevel is the lowest MFA level the caller must have signed in with.
+	MFALevel int
+	// Direct rejects exchanged tokens, so that whoever acts for a user
+	// cannot mint credentials of their own for them or take over their
+	// account.
+	Direct bool
+}
+
+// servicePolicies apply to every method of a service without a policy of
+// its own in methodPolicies. Methods of other services need an access
+// token.
+var servicePolicies = map[string]policy{
+	authv1.Auth_ServiceDesc.ServiceName:        {Access: accessPublic},
+	tokenv1.Token_ServiceDesc.ServiceName:      {Access: accessPublic},
+	healthpb.Health_ServiceDesc.ServiceName:    {Access: accessPublic},
+	"grpc.reflection.v1.ServerReflection":      {Access: accessPublic},
+	"grpc.reflection.v1alpha.ServerReflection": {Access: accessPublic},
+}
+
+var methodPolicies = map[string]policy{
+	// An invitation is accepted by the account of the caller, or by a new
+	// one when there is no caller. Either way it returns tokens.
+	invitationv1.Invitation_AcceptInvitation_FullMethodName: {Access: accessOptional, Direct: true},
+	// Adding a way to sign in is sensitive.
+	accountv1.Account_LinkIdentity_FullMethodName:   {StepUp: true, Direct: true},
+	accountv1.Account_UnlinkIdentity_FullMethodName: {Direct: true},
+
+	// Methods minting credentials or tokens, or changing how an account
+	// signs in, are only for users acting for themselves.
+	apikeyv1.APIKey_CreateAPIKey_FullMethodName: {Direct: true},
+	apikeyv1.APIKey_RevokeAPIKey_FullMethodName: {Direct: true},
+
+	serviceaccountv1.ServiceAccount_CreateServiceAccount_FullMethodName: {Direct: true},
+	serviceaccountv1.ServiceAccount_RotateSecret_FullMethodName:         {Direct: true},
+	serviceaccountv1.ServiceAccount_AddKey_FullMethodName:               {Direct: true},
+	serviceaccountv1.ServiceAccount_RemoveKey_FullMethodName:            {Direct: true},
+
+	organizationv1.Organization_SwitchOrganization_FullMethodName: {Direct: true},
+
+	// OAuth clients and API keys may call the administrative methods below.
+	// Their scopes are the permissions the methods check, so that a client
+	// or key is granted a method by the scope of the same name as a user is
+	// by the permission. Methods for managing one's own account and
+	// credentials, such as APIKey and Account, are left to first-party
+	// tokens.
+	adminv1.AdminAuth_ListUsers_FullMethodName:   {Scopes: []string{models.PermissionUsersRead}},
+	adminv1.AdminAuth_GetUser_FullMethodName:     {Scopes: []string{models.PermissionUsersRead}},
+	adminv1.AdminAuth_CreateUser_FullMethodName:  {Scopes: []string{models.PermissionUsersManage}, Direct: true},
+	adminv1.AdminAuth_UpdateUser_FullMethodName:  {Scopes: []string{models.PermissionUsersManage}, Direct: true},
+	adminv1.AdminAuth_DisableUser_FullMethodName: {Scopes: []string{models.PermissionUsersManage}},
+	adminv1.AdminAuth_EnableUser_FullMethodName:  {Scopes: []string{models.PermissionUsersManage}},
+	adminv1.AdminAuth_LockUser_FullMethodName:    {Scopes: []string{models.PermissionUsersManage}},
+	adminv1.AdminAuth_DeleteUser_FullMethodName:  {Scopes: []string{models.PermissionUsersManage}, Direct: true},
+	adminv1.AdminAuth_ForceLogout_FullMethodName: {Scopes: []string{models.PermissionUsersManage}},
+	adminv1.AdminAuth_ResetMFA_FullMethodName:    {Scopes: []string{models.PermissionUsersManage}, Direct: true},
+	adminv1.AdminAuth_SetPassword_FullMethodName: {Scopes: []string{models.PermissionUsersManage}, Direct: true},
+
+	auditv1.Audit_QueryAuditEvents_FullMethodName: {Scopes: []string{models.PermissionAuditRead}},
+
+	rbacv1.RBAC_CheckPermission_FullMethodName: {Scopes: []string{models.PermissionRolesRead}},
+	rbacv1.RBAC_ListRoles_FullMethodName:       {Scopes: []string{models.PermissionRolesRead}},
+	rbacv1.RBAC_ListUserRoles_FullMethodName:   {Scopes: []string{models.PermissionRolesRead}},
+	rbacv1.RBAC_AssignRole_FullMethodName:      {Scopes: []string{models.PermissionRolesManage}},
+	rbacv1.RBAC_RevokeRole_FullMethodName:      {Scopes: []string{models.PermissionRolesManage}},
+
+	relationv1.Relation_Check_FullMethodName:       {Scopes: []string{models.PermissionRelationsRead}},
+	relationv1.Relation_Expand_FullMethodName:      {Scopes: []string{models.PermissionRelationsRead}},
+	relationv1.Relation_ListObjects_FullMethodName: {Scopes: []string{models.PermissionRelationsRead}},
+	relationv1.Relation_WriteTuples_FullMethodName: {Scopes: []string{models.PermissionRelationsWrite}},
+
+	organizationv1.Organization_AddDomain_FullMethodName:    {Scopes: []string{models.PermissionOrganizationDomains}},
+	organizationv1.Organization_ListDomains_FullMethodName:  {Scopes: []string{models.PermissionOrganizationDomains}},
+	organizationv1.Organization_RemoveDomain_FullMethodName: {Scopes: []string{models.PermissionOrganizationDomains}},
+
+	webhookv1.Webhooks_CreateWebhook_FullMethodName:         {Scopes: []string{models.PermissionWebhooksManage}},
+	webhookv1.Webhooks_ListWebhooks_FullMethodName:          {Scopes: []string{models.PermissionWebhooksManage}},
+	webhookv1.Webhooks_GetWebhook_FullMethodName:            {Scopes: []string{models.PermissionWebhooksManage}},
+	webhookv1.Webhooks_UpdateWebhook_FullMethodName:         {Scopes: []string{models.PermissionWebhooksManage}},
+	webhookv1.Webhooks_DeleteWebhook_FullMethodName:         {Scopes: []string{models.PermissionWebhooksManage}},
+	webhookv1.Webhooks_ListWebhookDeliveries_FullMethodName: {Scopes: []string{models.PermissionWebhooksManage}},
+	webhookv1.Webhooks_ListWebhookAttempts_FullMethodName:   {Scopes: []string{models.PermissionWebhooksManage}},
+	webhookv1.Webhooks_ReplayWebhook_FullMethodName:         {Scopes: []string{models.PermissionWebhooksManage}},
+}
+
+func policyOf(fullMethod string) policy {
+	if p, ok := methodPolicies[fullMethod]; ok {
+		return p
+	}
+
+	service, _, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	if p, ok := servicePolicies[service]; ok {
+		return p
+	}
+
+	return policy{Access: accessAuthenticated}
+}
+
+// authUnaryInterceptor verifies the access token of a request against the
+// policy of its method, and stores the caller in the context.
+func authUnaryInterceptor(auth *authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authorize(ctx, auth, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func authStreamInterceptor(auth *authenticator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authorize(ss.Context(), auth, info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func authorize(ctx context.Context, auth *authenticator, fullMethod string) (context.Context, error) {
+	p := policyOf(fullMethod)
+	if p.Access == accessPublic {
+		return ctx, nil
+	}
+
+	token, sent, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !sent {
+		if p.Access == accessOptional {
+			return ctx, nil
+		}
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+
+	caller, err := auth.authenticate(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	setSubject(ctx, caller.UserID)
+
+	if p.Direct && caller.Actor != nil {
+		return nil, policyError(codes.PermissionDenied, "exchanged tokens cannot call this method", "DELEGATED_TOKEN", nil)
+	}
+	if !caller.hasScopes(p.Scopes) {
+		if len(p.Scopes) == 0 {
+			return nil, policyError(codes.PermissionDenied, "method is not available to OAuth clients and API keys", "INSUFFICIENT_SCOPE", nil)
+		}
+		return nil, policyError(codes.PermissionDenied, "token lacks the required scopes", "INSUFFICIENT_SCOPE",
+			map[string]string{"scope": models.JoinScope(p.Scopes)})
+	}
+	if p.StepUp && (caller.AuthTime.IsZero() || time.Since(caller.AuthTime) > auth.opts.Config.Account.ReauthMaxAge) {
+		return nil, policyError(codes.Unauthenticated, models.ErrReauthenticationRequired.Error(), "REAUTHENTICATION_REQUIRED", nil)
+	}
+	if caller.MFALevel < p.MFALevel {
+		return nil, policyError(codes.Unauthenticated, "multi-factor authentication is required", "MFA_REQUIRED", nil)
+	}
+
+	return context.WithValue(ctx, principalKey{}, caller), nil
+}
+
+// policyError tells the client which requirement of the method it did not
+// meet, so that it knows whether to sign in again or ask for more scopes.
+func policyError(code codes.Code, message, reason string, metadata map[string]string) error {
+	st, err := status.New(code, message).WithDetails(&errdetails.ErrorInfo{
+		Reason:   reason,
+		Domain:   errorDomain,
+		Metadata: metadata,
+	})
+	if err != nil {
+		return status.Error(code, message)
+	}
+
+	return st.Err()
+}
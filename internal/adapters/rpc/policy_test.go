@@ -0,0 +1,343 @@
+package rpc
+
+import (
+	"context"
+	authv1 "github.com/co1seam/ember-backend-api-contracts/gen/go/auth"
+	"github.com/co1seam/ember-backend-auth/config"
+	accountv1 "github.com/co1seam/ember-backend-auth/gen/go/account"
+	adminv1 "github.com/co1seam/ember-backend-auth/gen/go/admin"
+	apikeyv1 "github.com/co1seam/ember-backend-auth/gen/go/apikey"
+	auditv1 "github.com/co1seam/ember-backend-auth/gen/go/audit"
+	invitationv1 "github.com/co1seam/ember-backend-auth/gen/go/invitation"
+	organizationv1 "github.com/co1seam/ember-backend-auth/gen/go/organization"
+	rbacv1 "github.com/co1seam/ember-backend-auth/gen/go/rbac"
+	relationv1 "github.com/co1seam/ember-backend-auth/gen/go/relation"
+	serviceaccountv1 "github.com/co1seam/ember-backend-auth/gen/go/serviceaccount"
+	tokenv1 "github.com/co1seam/ember-backend-auth/gen/go/token"
+	webhookv1 "github.com/co1seam/ember-backend-auth/gen/go/webhook"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/core/services"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+// fakeTokens reports every token as active unless it is revoked.
+type fakeTokens struct {
+	ports.IOAuthService
+	revoked map[string]bool
+}
+
+func (f *fakeTokens) InspectToken(_ context.Context, token, _ string) (*models.Introspection, error) {
+	if f.revoked[token] {
+		return &models.Introspection{Active: false}, nil
+	}
+
+	return &models.Introspection{Active: true, TokenType: models.TokenTypeAccessToken}, nil
+}
+
+// fakeUsers returns the status errors of users by ID.
+type fakeUsers struct {
+	ports.IAuthService
+	statuses map[string]error
+}
+
+func (f *fakeUsers) CheckStatus(_ context.Context, userID string) error {
+	return f.statuses[userID]
+}
+
+// fakeAPIKeys knows the keys of keys.
+type fakeAPIKeys struct {
+	ports.IAPIKeyService
+	keys map[string]*models.APIKey
+}
+
+func (f *fakeAPIKeys) Authenticate(_ context.Context, key string) (*models.APIKey, error) {
+	apiKey, ok := f.keys[key]
+	if !ok {
+		return nil, models.ErrInvalidAPIKey
+	}
+
+	return apiKey, nil
+}
+
+func testOptions() *models.Options {
+	cfg := &config.Config{}
+	cfg.Token = config.Token{Secret: "secret", AccessTokenTTL: time.Minute, Issuer: "https://auth.example.com"}
+	cfg.Account.ReauthMaxAge = 5 * time.Minute
+
+	return &models.Options{Config: cfg}
+}
+
+func testToken(t *testing.T, opts *models.Options, claims jwt.MapClaims) string {
+	t.Helper()
+
+	base := jwt.MapClaims{"sub": "user", "type": "access", "jti": "jti", "principal_type": models.PrincipalTypeUser}
+	for key, value := range claims {
+		base[key] = value
+	}
+
+	token, err := services.CreateJWT(time.Minute, &opts.Config.Token, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+func withToken(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+}
+
+func TestAuthorize(t *testing.T) {
+	opts := testOptions()
+
+	firstParty := testToken(t, opts, nil)
+	revoked := testToken(t, opts, jwt.MapClaims{"jti": "revoked"})
+	disabled := testToken(t, opts, jwt.MapClaims{"sub": "disabled"})
+	refresh := testToken(t, opts, jwt.MapClaims{"type": "refresh"})
+	clientToken := testToken(t, opts, jwt.MapClaims{"client_id": "client", "scope": models.PermissionUsersRead})
+	exchanged := testToken(t, opts, jwt.MapClaims{"client_id": "client", "scope": models.PermissionUsersManage, "act": map[string]interface{}{"sub": "admin"}})
+	recent := testToken(t, opts, jwt.MapClaims{"auth_time": time.Now().Unix()})
+	stale := testToken(t, opts, jwt.MapClaims{"auth_time": time.Now().Add(-time.Hour).Unix()})
+
+	scopedKey := models.APIKeyPrefix + "scoped"
+	unscopedKey := models.APIKeyPrefix + "unscoped"
+	disabledKey := models.APIKeyPrefix + "disabled"
+
+	auth := newAuthenticator(
+		&fakeTokens{revoked: map[string]bool{revoked: true}},
+		&fakeUsers{statuses: map[string]error{"disabled": models.ErrAccountDisabled}},
+		&fakeAPIKeys{keys: map[string]*models.APIKey{
+			scopedKey:   {ID: "scoped", UserID: "user", Scopes: []string{models.PermissionUsersRead}},
+			unscopedKey: {ID: "unscoped", UserID: "user", Scopes: []string{}},
+			disabledKey: {ID: "disabled", UserID: "disabled", Scopes: []string{models.PermissionUsersRead}},
+		}},
+		opts,
+	)
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		method    string
+		code      codes.Code
+		reason    string
+		principal bool
+	}{
+		{name: "public without token", ctx: context.Background(), method: tokenv1.Token_Introspect_FullMethodName},
+		{name: "public ignores token", ctx: withToken("garbage"), method: tokenv1.Token_Introspect_FullMethodName},
+		{name: "missing token", ctx: context.Background(), method: apikeyv1.APIKey_ListAPIKeys_FullMethodName, code: codes.Unauthenticated},
+		{name: "malformed header", ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Basic abc")), method: apikeyv1.APIKey_ListAPIKeys_FullMethodName, code: codes.Unauthenticated},
+		{name: "invalid token", ctx: withToken("garbage"), method: apikeyv1.APIKey_ListAPIKeys_FullMethodName, code: codes.Unauthenticated},
+		{name: "refresh token", ctx: withToken(refresh), method: apikeyv1.APIKey_ListAPIKeys_FullMethodName, code: codes.Unauthenticated},
+		{name: "first-party token", ctx: withToken(firstParty), method: apikeyv1.APIKey_ListAPIKeys_FullMethodName, principal: true},
+		{name: "revoked token", ctx: withToken(revoked), method: apikeyv1.APIKey_ListAPIKeys_FullMethodName, code: codes.Unauthenticated},
+		{name: "disabled user", ctx: withToken(disabled), method: apikeyv1.APIKey_ListAPIKeys_FullMethodName, code: codes.PermissionDenied, reason: "ACCOUNT_DISABLED"},
+		{name: "optional without token", ctx: context.Background(), method: invitationv1.Invitation_AcceptInvitation_FullMethodName},
+		{name: "optional with token", ctx: withToken(firstParty), method: invitationv1.Invitation_AcceptInvitation_FullMethodName, principal: true},
+		{name: "optional with revoked token", ctx: withToken(revoked), method: invitationv1.Invitation_AcceptInvitation_FullMethodName, code: codes.Unauthenticated},
+		{name: "client with scope", ctx: withToken(clientToken), method: adminv1.AdminAuth_ListUsers_FullMethodName, principal: true},
+		{name: "client without scope", ctx: withToken(clientToken), method: adminv1.AdminAuth_DeleteUser_FullMethodName, code: codes.PermissionDenied, reason: "INSUFFICIENT_SCOPE"},
+		{name: "client on first-party method", ctx: withToken(clientToken), method: apikeyv1.APIKey_CreateAPIKey_FullMethodName, code: codes.PermissionDenied, reason: "INSUFFICIENT_SCOPE"},
+		{name: "exchanged token", ctx: withToken(exchanged), method: adminv1.AdminAuth_DisableUser_FullMethodName, principal: true},
+		{name: "exchanged token minting credentials", ctx: withToken(exchanged), method: adminv1.AdminAuth_SetPassword_FullMethodName, code: codes.PermissionDenied, reason: "DELEGATED_TOKEN"},
+		{name: "exchanged token creating API key", ctx: withToken(exchanged), method: apikeyv1.APIKey_CreateAPIKey_FullMethodName, code: codes.PermissionDenied, reason: "DELEGATED_TOKEN"},
+		{name: "API key with scope", ctx: withToken(scopedKey), method: adminv1.AdminAuth_ListUsers_FullMethodName, principal: true},
+		{name: "API key without scope", ctx: withToken(scopedKey), method: adminv1.AdminAuth_DisableUser_FullMethodName, code: codes.PermissionDenied, reason: "INSUFFICIENT_SCOPE"},
+		{name: "API key without scopes", ctx: withToken(unscopedKey), method: adminv1.AdminAuth_ListUsers_FullMethodName, code: codes.PermissionDenied, reason: "INSUFFICIENT_SCOPE"},
+		{name: "API key creating API key", ctx: withToken(scopedKey), method: apikeyv1.APIKey_CreateAPIKey_FullMethodName, code: codes.PermissionDenied, reason: "INSUFFICIENT_SCOPE"},
+		{name: "unknown API key", ctx: withToken(models.APIKeyPrefix + "unknown"), method: adminv1.AdminAuth_ListUsers_FullMethodName, code: codes.Unauthenticated},
+		{name: "API key of disabled user", ctx: withToken(disabledKey), method: adminv1.AdminAuth_ListUsers_FullMethodName, code: codes.PermissionDenied, reason: "ACCOUNT_DISABLED"},
+		{name: "step-up after recent sign-in", ctx: withToken(recent), method: accountv1.Account_LinkIdentity_FullMethodName, principal: true},
+		{name: "step-up after stale sign-in", ctx: withToken(stale), method: accountv1.Account_LinkIdentity_FullMethodName, code: codes.Unauthenticated, reason: "REAUTHENTICATION_REQUIRED"},
+		{name: "step-up without auth time", ctx: withToken(firstParty), method: accountv1.Account_LinkIdentity_FullMethodName, code: codes.Unauthenticated, reason: "REAUTHENTICATION_REQUIRED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, err := authorize(tt.ctx, auth, tt.method)
+			if status.Code(err) != tt.code {
+				t.Fatalf("got %v, want %s", err, tt.code)
+			}
+			if tt.reason != "" && errorReason(err) != tt.reason {
+				t.Fatalf("got reason %q, want %q", errorReason(err), tt.reason)
+			}
+			if err != nil {
+				return
+			}
+			if _, ok := principalFrom(ctx); ok != tt.principal {
+				t.Fatalf("principal set: %v, want %v", ok, tt.principal)
+			}
+		})
+	}
+}
+
+func TestPolicyOf(t *testing.T) {
+	tests := []struct {
+		method string
+		access access
+	}{
+		{method: tokenv1.Token_Revoke_FullMethodName, access: accessPublic},
+		{method: "/grpc.health.v1.Health/Check", access: accessPublic},
+		{method: invitationv1.Invitation_AcceptInvitation_FullMethodName, access: accessOptional},
+		{method: invitationv1.Invitation_CreateInvitation_FullMethodName, access: accessAuthenticated},
+		{method: "/unknown.v1.Service/Method", access: accessAuthenticated},
+	}
+
+	for _, tt := range tests {
+		if got := policyOf(tt.method).Access; got != tt.access {
+			t.Errorf("policyOf(%s) = %v, want %v", tt.method, got, tt.access)
+		}
+	}
+}
+
+// testStream is a server stream with a context.
+type testStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestAuthInterceptors(t *testing.T) {
+	opts := testOptions()
+	auth := newAuthenticator(&fakeTokens{}, &fakeUsers{}, &fakeAPIKeys{}, opts)
+	token := testToken(t, opts, nil)
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		method string
+		code   codes.Code
+	}{
+		{name: "authenticated", ctx: withToken(token), method: apikeyv1.APIKey_ListAPIKeys_FullMethodName},
+		{name: "missing token", ctx: context.Background(), method: apikeyv1.APIKey_ListAPIKeys_FullMethodName, code: codes.Unauthenticated},
+		{name: "public", ctx: context.Background(), method: tokenv1.Token_Introspect_FullMethodName},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Rejected calls never reach the method, and accepted ones see
+			// the caller the policy requires.
+			check := func(ctx context.Context) error {
+				if _, ok := principalFrom(ctx); ok != (policyOf(tt.method).Access != accessPublic) {
+					t.Errorf("principal set: %v, for access %v", ok, policyOf(tt.method).Access)
+				}
+				return nil
+			}
+
+			called := false
+			_, err := authUnaryInterceptor(auth)(tt.ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, func(ctx context.Context, _ interface{}) (interface{}, error) {
+				called = true
+				return nil, check(ctx)
+			})
+			if status.Code(err) != tt.code || called != (tt.code == codes.OK) {
+				t.Fatalf("unary: got %v with the method called: %v, want %s", err, called, tt.code)
+			}
+
+			called = false
+			err = authStreamInterceptor(auth)(nil, &testStream{ctx: tt.ctx}, &grpc.StreamServerInfo{FullMethod: tt.method}, func(_ interface{}, stream grpc.ServerStream) error {
+				called = true
+				return check(stream.Context())
+			})
+			if status.Code(err) != tt.code || called != (tt.code == codes.OK) {
+				t.Fatalf("stream: got %v with the method called: %v, want %s", err, called, tt.code)
+			}
+		})
+	}
+}
+
+func TestMFALevel(t *testing.T) {
+	opts := testOptions()
+	password := testToken(t, opts, nil)
+	otp := testToken(t, opts, jwt.MapClaims{"amr": []string{"otp"}})
+	mfa := testToken(t, opts, jwt.MapClaims{"amr": []string{"pwd", "otp", "mfa"}})
+
+	const method = "/test.v1.Test/Sensitive"
+	methodPolicies[method] = policy{MFALevel: mfaMultiFactor}
+	t.Cleanup(func() { delete(methodPolicies, method) })
+	auth := newAuthenticator(&fakeTokens{}, &fakeUsers{}, &fakeAPIKeys{}, opts)
+
+	tests := []struct {
+		name  string
+		token string
+		level int
+		code  codes.Code
+	}{
+		{name: "password", token: password, level: mfaSingleFactor, code: codes.Unauthenticated},
+		{name: "one-time code", token: otp, level: mfaSingleFactor, code: codes.Unauthenticated},
+		{name: "multiple factors", token: mfa, level: mfaMultiFactor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := verifyAccessToken(tt.token, &opts.Config.Token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.MFALevel != tt.level {
+				t.Fatalf("got MFA level %d, want %d", p.MFALevel, tt.level)
+			}
+
+			_, err = authorize(withToken(tt.token), auth, method)
+			if status.Code(err) != tt.code {
+				t.Fatalf("got %v, want %s", err, tt.code)
+			}
+			if err != nil && errorReason(err) != "MFA_REQUIRED" {
+				t.Fatalf("got reason %q, want MFA_REQUIRED", errorReason(err))
+			}
+		})
+	}
+}
+
+// TestMethodPoliciesExist keeps methodPolicies in line with the services the
+// server registers: a policy left behind by a renamed method would silently
+// fall back to the default.
+func TestMethodPoliciesExist(t *testing.T) {
+	methods := map[string]bool{}
+	for _, desc := range []grpc.ServiceDesc{
+		authv1.Auth_ServiceDesc,
+		accountv1.Account_ServiceDesc,
+		tokenv1.Token_ServiceDesc,
+		rbacv1.RBAC_ServiceDesc,
+		relationv1.Relation_ServiceDesc,
+		organizationv1.Organization_ServiceDesc,
+		invitationv1.Invitation_ServiceDesc,
+		apikeyv1.APIKey_ServiceDesc,
+		serviceaccountv1.ServiceAccount_ServiceDesc,
+		adminv1.AdminAuth_ServiceDesc,
+		auditv1.Audit_ServiceDesc,
+		webhookv1.Webhooks_ServiceDesc,
+	} {
+		for _, method := range desc.Methods {
+			methods["/"+desc.ServiceName+"/"+method.MethodName] = true
+		}
+		for _, stream := range desc.Streams {
+			methods["/"+desc.ServiceName+"/"+stream.StreamName] = true
+		}
+	}
+
+	for method := range methodPolicies {
+		if !methods[method] {
+			t.Errorf("policy for unknown method %s", method)
+		}
+	}
+}
+
+func errorReason(err error) string {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.Reason
+		}
+	}
+
+	return ""
+}
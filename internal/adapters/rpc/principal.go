@@ -0,0 +1,243 @@
+package rpc
+
+import (
+	"context"
+	"github.com/co1seam/ember-backend-auth/config"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/core/services"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MFA levels of a principal, from the amr claim of its token. Tokens without
+// one were issued for a password or a one-time code.
+const (
+	mfaNone         = 0
+	mfaSingleFactor = 1
+	mfaMultiFactor  = 2
+)
+
+// principal is the caller of a request, as its access token describes it.
+type principal struct {
+	UserID string
+	// Type is models.PrincipalTypeUser or models.PrincipalTypeService.
+	Type      string
+	OrgID     string
+	SessionID string
+	// ClientID is set for tokens issued to an OAuth client and APIKeyID for
+	// API keys, which both only act within their Scopes. First-party tokens
+	// have neither.
+	ClientID    string
+	APIKeyID    string
+	Scopes      []string
+	Roles       []string
+	Permissions []string
+	AuthTime    time.Time
+	// MFALevel is how many factors the caller signed in with; API keys
+	// have none.
+	MFALevel int
+	// Actor is set for exchanged tokens, whose actor acts for the subject.
+	Actor *models.Actor
+}
+
+type principalKey struct{}
+
+// principalFrom returns the caller the auth interceptor resolved, if the
+// request carried a valid access token.
+func principalFrom(ctx context.Context) (*principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*principal)
+	return p, ok
+}
+
+// authenticated returns the caller of a method that requires one.
+func authenticated(ctx context.Context) (*principal, error) {
+	p, ok := principalFrom(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+
+	return p, nil
+}
+
+// bearerToken returns the token of the "authorization: Bearer <token>"
+// metadata, and whether the request sent an authorization header at all.
+func bearerToken(ctx context.Context) (string, bool, error) {
+	values := metadata.ValueFromIncomingContext(ctx, "authorization")
+	if len(values) == 0 {
+		return "", false, nil
+	}
+	if !strings.HasPrefix(values[0], "Bearer ") {
+		return "", true, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+
+	return strings.TrimPrefix(values[0], "Bearer "), true, nil
+}
+
+// authenticator resolves the callers of requests from their access tokens
+// and API keys.
+type authenticator struct {
+	tokens  ports.IOAuthService
+	users   ports.IAuthService
+	apiKeys ports.IAPIKeyService
+	opts    *models.Options
+}
+
+func newAuthenticator(tokens ports.IOAuthService, users ports.IAuthService, apiKeys ports.IAPIKeyService, opts *models.Options) *authenticator {
+	return &authenticator{tokens: tokens, users: users, apiKeys: apiKeys, opts: opts}
+}
+
+// authenticate resolves the caller from an access token or an API key.
+// Tokens are held to the same checks as in ValidateToken: revoked tokens,
+// tokens issued before the user was signed out everywhere, tokens of revoked
+// OAuth sessions and tokens of users who may not sign in are all rejected.
+func (a *authenticator) authenticate(ctx context.Context, token string) (*principal, error) {
+	if strings.HasPrefix(token, models.APIKeyPrefix) {
+		return a.authenticateAPIKey(ctx, token)
+	}
+
+	p, err := verifyAccessToken(token, &a.opts.Config.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	introspection, err := a.tokens.InspectToken(ctx, token, models.TokenTypeAccessToken)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if !introspection.Active {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	if p.Type == models.PrincipalTypeUser {
+		if err := a.users.CheckStatus(ctx, p.UserID); err != nil {
+			return nil, authError(err)
+		}
+	}
+
+	return p, nil
+}
+
+// authenticateAPIKey resolves the owner of an API key, who acts within the
+// scopes of the key.
+func (a *authenticator) authenticateAPIKey(ctx context.Context, token string) (*principal, error) {
+	key, err := a.apiKeys.Authenticate(ctx, token)
+	if err != nil {
+		return nil, apiKeyError(err)
+	}
+
+	if err := a.users.CheckStatus(ctx, key.UserID); err != nil {
+		return nil, authError(err)
+	}
+
+	return &principal{
+		UserID:   key.UserID,
+		Type:     models.PrincipalTypeUser,
+		APIKeyID: key.ID,
+		Scopes:   key.Scopes,
+		MFALevel: mfaNone,
+	}, nil
+}
+
+// verifyAccessToken reads the caller from the claims of an access token,
+// after checking its signature and expiry.
+func verifyAccessToken(token string, cfg *config.Token) (*principal, error) {
+	claims, err := services.VerifyJWT(token, cfg)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	if tokenType, _ := claims["type"].(string); tokenType != "access" {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	sub, err := claims.GetSubject()
+	if err != nil || sub == "" {
+		return nil, status.Error(codes.Unauthenticated, "invalid subject")
+	}
+
+	p := &principal{
+		UserID:      sub,
+		Type:        models.PrincipalTypeUser,
+		Roles:       stringsClaim(claims["roles"]),
+		Permissions: stringsClaim(claims["permissions"]),
+		MFALevel:    mfaSingleFactor,
+	}
+	if principalType, _ := claims["principal_type"].(string); principalType != "" {
+		p.Type = principalType
+	}
+	p.OrgID, _ = claims["org_id"].(string)
+	p.SessionID, _ = claims["sid"].(string)
+	p.ClientID, _ = claims["client_id"].(string)
+	if scope, _ := claims["scope"].(string); scope != "" {
+		p.Scopes = models.ParseScope(scope)
+	}
+	p.Actor = models.ParseActor(claims["act"])
+	if authTime, ok := claims["auth_time"].(float64); ok {
+		p.AuthTime = time.Unix(int64(authTime), 0)
+	}
+	// RFC 8176 names "mfa" for authentication with more than one factor.
+	if slices.Contains(stringsClaim(claims["amr"]), "mfa") {
+		p.MFALevel = mfaMultiFactor
+	}
+
+	return p, nil
+}
+
+// hasScopes reports whether the caller may call a method requiring the
+// scopes. First-party tokens act with the full authority of their subject.
+// Tokens of OAuth clients and API keys only reach methods that declare
+// scopes, and must hold all of them.
+func (p *principal) hasScopes(scopes []string) bool {
+	if p.ClientID == "" && p.APIKeyID == "" {
+		return true
+	}
+	if len(scopes) == 0 {
+		return false
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(p.Scopes, scope) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// mayRead checks that the caller may ask about the user userID. Users may
+// ask about themselves and need permission for anyone else. Service accounts
+// hold no roles; the methods calling this require permission as a scope, and
+// their scope only names permissions delegated to them.
+func (p *principal) mayRead(ctx context.Context, rbac ports.IRBACService, userID, permission string) error {
+	if p.Type == models.PrincipalTypeService || userID == p.UserID {
+		return nil
+	}
+
+	allowed, err := rbac.CheckPermission(ctx, p.UserID, permission)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return models.ErrPermissionDenied
+	}
+
+	return nil
+}
+
+// stringsClaim reads a claim holding a list of strings.
+func stringsClaim(claim interface{}) []string {
+	values, _ := claim.([]interface{})
+
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			result = append(result, s)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,126 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	rbacv1 "github.com/co1seam/ember-backend-auth/gen/go/rbac"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type RBAC struct {
+	rbacv1.UnimplementedRBACServer
+	service ports.IRBACService
+	opts    *models.Options
+}
+
+func NewRBAC(service ports.IRBACService, opts *models.Options) *RBAC {
+	return &RBAC{
+		service: service,
+		opts:    opts,
+	}
+}
+
+// CheckPermission lets other services ask whether a user, usually the subject
+// of a token they validated, holds a permission. Users may check their own
+// permissions; checking anyone else's takes roles:read.
+func (r *RBAC) CheckPermission(ctx context.Context, req *rbacv1.CheckPermissionRequest) (*rbacv1.CheckPermissionResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.UserId == "" || req.Permission == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id and permission are required")
+	}
+	if err := caller.mayRead(ctx, r.service, req.UserId, models.PermissionRolesRead); err != nil {
+		return nil, rbacError(err)
+	}
+
+	allowed, err := r.service.CheckPermission(ctx, req.UserId, req.Permission)
+	if err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &rbacv1.CheckPermissionResponse{Allowed: allowed}, nil
+}
+
+func (r *RBAC) ListRoles(ctx context.Context, _ *rbacv1.ListRolesRequest) (*rbacv1.ListRolesResponse, error) {
+	if _, err := authenticated(ctx); err != nil {
+		return nil, err
+	}
+
+	roles, err := r.service.ListRoles(ctx)
+	if err != nil {
+		return nil, rbacError(err)
+	}
+
+	response := &rbacv1.ListRolesResponse{}
+	for _, role := range roles {
+		response.Roles = append(response.Roles, &rbacv1.Role{
+			Name:        role.Name,
+			Description: role.Description,
+			Permissions: role.Permissions,
+		})
+	}
+
+	return response, nil
+}
+
+func (r *RBAC) ListUserRoles(ctx context.Context, req *rbacv1.ListUserRolesRequest) (*rbacv1.ListUserRolesResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	userID := req.UserId
+	if userID == "" {
+		userID = caller.UserID
+	}
+
+	grants, err := r.service.UserGrants(ctx, caller.UserID, userID)
+	if err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &rbacv1.ListUserRolesResponse{Roles: grants.Roles, Permissions: grants.Permissions}, nil
+}
+
+func (r *RBAC) AssignRole(ctx context.Context, req *rbacv1.AssignRoleRequest) (*rbacv1.AssignRoleResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.service.AssignRole(ctx, caller.UserID, req.UserId, req.Role); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &rbacv1.AssignRoleResponse{Success: true}, nil
+}
+
+func (r *RBAC) RevokeRole(ctx context.Context, req *rbacv1.RevokeRoleRequest) (*rbacv1.RevokeRoleResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.service.RevokeRole(ctx, caller.UserID, req.UserId, req.Role); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &rbacv1.RevokeRoleResponse{Success: true}, nil
+}
+
+func rbacError(err error) error {
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, models.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
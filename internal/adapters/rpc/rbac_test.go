@@ -0,0 +1,146 @@
+package rpc
+
+import (
+	"context"
+	rbacv1 "github.com/co1seam/ember-backend-auth/gen/go/rbac"
+	relationv1 "github.com/co1seam/ember-backend-auth/gen/go/relation"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"slices"
+	"testing"
+)
+
+// fakeRBAC grants fixed permissions by user ID.
+type fakeRBAC struct {
+	ports.IRBACService
+	permissions map[string][]string
+}
+
+func (f *fakeRBAC) CheckPermission(_ context.Context, userID, permission string) (bool, error) {
+	return slices.Contains(f.permissions[userID], permission), nil
+}
+
+// fakeRelations allows every check.
+type fakeRelations struct {
+	ports.IRelationService
+}
+
+func (f *fakeRelations) Check(context.Context, models.RelationTuple, string) (bool, string, error) {
+	return true, "1", nil
+}
+
+func (f *fakeRelations) Expand(_ context.Context, object models.ObjectRef, relation, _ string) (*models.UsersetTree, string, error) {
+	return &models.UsersetTree{Operation: models.UsersetLeaf, Object: object, Relation: relation}, "1", nil
+}
+
+func (f *fakeRelations) ListObjects(context.Context, string, string, models.SubjectRef, string, string, int) (*models.ObjectPage, string, error) {
+	return &models.ObjectPage{ObjectIDs: []string{"readme"}}, "1", nil
+}
+
+func withPrincipal(p *principal) context.Context {
+	return context.WithValue(context.Background(), principalKey{}, p)
+}
+
+var (
+	reader  = &principal{UserID: "reader", Type: models.PrincipalTypeUser}
+	member  = &principal{UserID: "member", Type: models.PrincipalTypeUser}
+	service = &principal{UserID: "service", Type: models.PrincipalTypeService, ClientID: "service"}
+)
+
+func testRBAC() *fakeRBAC {
+	return &fakeRBAC{permissions: map[string][]string{
+		"reader": {models.PermissionRolesRead, models.PermissionRelationsRead},
+	}}
+}
+
+func TestCheckPermissionCallers(t *testing.T) {
+	r := NewRBAC(testRBAC(), testOptions())
+
+	tests := []struct {
+		name   string
+		caller *principal
+		userID string
+		code   codes.Code
+	}{
+		{name: "own permissions", caller: member, userID: "member"},
+		{name: "other user without roles:read", caller: member, userID: "reader", code: codes.PermissionDenied},
+		{name: "other user with roles:read", caller: reader, userID: "member"},
+		{name: "service account", caller: service, userID: "member"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := r.CheckPermission(withPrincipal(tt.caller), &rbacv1.CheckPermissionRequest{UserId: tt.userID, Permission: models.PermissionUsersRead})
+			if status.Code(err) != tt.code {
+				t.Fatalf("got %v, want %s", err, tt.code)
+			}
+		})
+	}
+
+	if _, err := r.CheckPermission(context.Background(), &rbacv1.CheckPermissionRequest{UserId: "member", Permission: models.PermissionUsersRead}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("anonymous caller: got %v, want Unauthenticated", err)
+	}
+}
+
+func TestRelationCallers(t *testing.T) {
+	r := NewRelation(&fakeRelations{}, testRBAC(), testOptions())
+	document := &relationv1.Object{Namespace: "document", ObjectId: "readme"}
+	user := func(id string) *relationv1.Subject {
+		return &relationv1.Subject{Namespace: models.RelationUserNamespace, ObjectId: id}
+	}
+	group := &relationv1.Subject{Namespace: "group", ObjectId: "eng", Relation: "member"}
+
+	tests := []struct {
+		name   string
+		caller *principal
+		call   func(ctx context.Context) error
+		code   codes.Code
+	}{
+		{name: "check self", caller: member, call: func(ctx context.Context) error {
+			_, err := r.Check(ctx, &relationv1.CheckRequest{Object: document, Relation: "viewer", Subject: user("member")})
+			return err
+		}},
+		{name: "check other user", caller: member, code: codes.PermissionDenied, call: func(ctx context.Context) error {
+			_, err := r.Check(ctx, &relationv1.CheckRequest{Object: document, Relation: "viewer", Subject: user("reader")})
+			return err
+		}},
+		{name: "check userset", caller: member, code: codes.PermissionDenied, call: func(ctx context.Context) error {
+			_, err := r.Check(ctx, &relationv1.CheckRequest{Object: document, Relation: "viewer", Subject: group})
+			return err
+		}},
+		{name: "check other user with relations:read", caller: reader, call: func(ctx context.Context) error {
+			_, err := r.Check(ctx, &relationv1.CheckRequest{Object: document, Relation: "viewer", Subject: user("member")})
+			return err
+		}},
+		{name: "list own objects", caller: member, call: func(ctx context.Context) error {
+			_, err := r.ListObjects(ctx, &relationv1.ListObjectsRequest{Namespace: "document", Relation: "viewer", Subject: user("member")})
+			return err
+		}},
+		{name: "list objects of other user", caller: member, code: codes.PermissionDenied, call: func(ctx context.Context) error {
+			_, err := r.ListObjects(ctx, &relationv1.ListObjectsRequest{Namespace: "document", Relation: "viewer", Subject: user("reader")})
+			return err
+		}},
+		{name: "expand", caller: member, code: codes.PermissionDenied, call: func(ctx context.Context) error {
+			_, err := r.Expand(ctx, &relationv1.ExpandRequest{Object: document, Relation: "viewer"})
+			return err
+		}},
+		{name: "expand with relations:read", caller: reader, call: func(ctx context.Context) error {
+			_, err := r.Expand(ctx, &relationv1.ExpandRequest{Object: document, Relation: "viewer"})
+			return err
+		}},
+		{name: "service account", caller: service, call: func(ctx context.Context) error {
+			_, err := r.Check(ctx, &relationv1.CheckRequest{Object: document, Relation: "viewer", Subject: user("member")})
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(withPrincipal(tt.caller)); status.Code(err) != tt.code {
+				t.Fatalf("got %v, want %s", err, tt.code)
+			}
+		})
+	}
+}
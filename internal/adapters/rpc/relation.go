@@ -0,0 +1,171 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	relationv1 "github.com/co1seam/ember-backend-auth/gen/go/relation"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Relation serves relationship-based authorization. Users may check and list
+// what they themselves are related to; asking about other subjects, and
+// expanding who is related to an object, takes relations:read.
+type Relation struct {
+	relationv1.UnimplementedRelationServer
+	service ports.IRelationService
+	rbac    ports.IRBACService
+	opts    *models.Options
+}
+
+func NewRelation(service ports.IRelationService, rbac ports.IRBACService, opts *models.Options) *Relation {
+	return &Relation{
+		service: service,
+		rbac:    rbac,
+		opts:    opts,
+	}
+}
+
+func (r *Relation) WriteTuples(ctx context.Context, req *relationv1.WriteTuplesRequest) (*relationv1.WriteTuplesResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := r.service.WriteTuples(ctx, caller.UserID, fromProtoTuples(req.Writes), fromProtoTuples(req.Deletes))
+	if err != nil {
+		return nil, relationError(err)
+	}
+
+	return &relationv1.WriteTuplesResponse{ConsistencyToken: token}, nil
+}
+
+func (r *Relation) Check(ctx context.Context, req *relationv1.CheckRequest) (*relationv1.CheckResponse, error) {
+	tuple := models.RelationTuple{
+		Object:   fromProtoObject(req.Object),
+		Relation: req.Relation,
+		Subject:  fromProtoSubject(req.Subject),
+	}
+	if err := r.mayRead(ctx, tuple.Subject); err != nil {
+		return nil, err
+	}
+
+	allowed, token, err := r.service.Check(ctx, tuple, req.ConsistencyToken)
+	if err != nil {
+		return nil, relationError(err)
+	}
+
+	return &relationv1.CheckResponse{Allowed: allowed, ConsistencyToken: token}, nil
+}
+
+func (r *Relation) Expand(ctx context.Context, req *relationv1.ExpandRequest) (*relationv1.ExpandResponse, error) {
+	if err := r.mayRead(ctx, models.SubjectRef{}); err != nil {
+		return nil, err
+	}
+
+	tree, token, err := r.service.Expand(ctx, fromProtoObject(req.Object), req.Relation, req.ConsistencyToken)
+	if err != nil {
+		return nil, relationError(err)
+	}
+
+	return &relationv1.ExpandResponse{Tree: toProtoTree(tree), ConsistencyToken: token}, nil
+}
+
+func (r *Relation) ListObjects(ctx context.Context, req *relationv1.ListObjectsRequest) (*relationv1.ListObjectsResponse, error) {
+	subject := fromProtoSubject(req.Subject)
+	if err := r.mayRead(ctx, subject); err != nil {
+		return nil, err
+	}
+
+	page, token, err := r.service.ListObjects(ctx, req.Namespace, req.Relation, subject, req.ConsistencyToken, req.Cursor, int(req.PageSize))
+	if err != nil {
+		return nil, relationError(err)
+	}
+
+	return &relationv1.ListObjectsResponse{ObjectIds: page.ObjectIDs, ConsistencyToken: token, NextCursor: page.NextCursor}, nil
+}
+
+// mayRead checks that the caller may ask about subject, which only needs no
+// permission when it is the caller.
+func (r *Relation) mayRead(ctx context.Context, subject models.SubjectRef) error {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return err
+	}
+
+	var userID string
+	if subject.Namespace == models.RelationUserNamespace && subject.Relation == "" {
+		userID = subject.ID
+	}
+	if err := caller.mayRead(ctx, r.rbac, userID, models.PermissionRelationsRead); err != nil {
+		return relationError(err)
+	}
+
+	return nil
+}
+
+func fromProtoObject(object *relationv1.Object) models.ObjectRef {
+	return models.ObjectRef{
+		Namespace: object.GetNamespace(),
+		ID:        object.GetObjectId(),
+	}
+}
+
+func fromProtoSubject(subject *relationv1.Subject) models.SubjectRef {
+	return models.SubjectRef{
+		Namespace: subject.GetNamespace(),
+		ID:        subject.GetObjectId(),
+		Relation:  subject.GetRelation(),
+	}
+}
+
+func fromProtoTuples(tuples []*relationv1.RelationTuple) []models.RelationTuple {
+	result := make([]models.RelationTuple, 0, len(tuples))
+	for _, tuple := range tuples {
+		result = append(result, models.RelationTuple{
+			Object:   fromProtoObject(tuple.GetObject()),
+			Relation: tuple.GetRelation(),
+			Subject:  fromProtoSubject(tuple.GetSubject()),
+		})
+	}
+
+	return result
+}
+
+func toProtoTree(tree *models.UsersetTree) *relationv1.UsersetTree {
+	node := &relationv1.UsersetTree{
+		Operation: tree.Operation,
+		Object:    &relationv1.Object{Namespace: tree.Object.Namespace, ObjectId: tree.Object.ID},
+		Relation:  tree.Relation,
+	}
+	for _, subject := range tree.Subjects {
+		node.Subjects = append(node.Subjects, &relationv1.Subject{
+			Namespace: subject.Namespace,
+			ObjectId:  subject.ID,
+			Relation:  subject.Relation,
+		})
+	}
+	for _, child := range tree.Children {
+		node.Children = append(node.Children, toProtoTree(child))
+	}
+
+	return node
+}
+
+func relationError(err error) error {
+	switch {
+	case errors.Is(err, models.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, models.ErrInvalidRelationTuple),
+		errors.Is(err, models.ErrUnknownNamespace),
+		errors.Is(err, models.ErrUnknownRelation),
+		errors.Is(err, models.ErrInvalidConsistency):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, models.ErrRelationDepthExceeded):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
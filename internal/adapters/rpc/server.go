@@ -5,7 +5,24 @@ import (
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/lipgloss/table"
 	authv1 "github.com/co1seam/ember-backend-api-contracts/gen/go/auth"
+	accountv1 "github.com/co1seam/ember-backend-auth/gen/go/account"
+	adminv1 "github.com/co1seam/ember-backend-auth/gen/go/admin"
+	apikeyv1 "github.com/co1seam/ember-backend-auth/gen/go/apikey"
+	auditv1 "github.com/co1seam/ember-backend-auth/gen/go/audit"
+	invitationv1 "github.com/co1seam/ember-backend-auth/gen/go/invitation"
+	organizationv1 "github.com/co1seam/ember-backend-auth/gen/go/organization"
+	rbacv1 "github.com/co1seam/ember-backend-auth/gen/go/rbac"
+	relationv1 "github.com/co1seam/ember-backend-auth/gen/go/relation"
+	serviceaccountv1 "github.com/co1seam/ember-backend-auth/gen/go/serviceaccount"
+	tokenv1 "github.com/co1seam/ember-backend-auth/gen/go/token"
+	webhookv1 "github.com/co1seam/ember-backend-auth/gen/go/webhook"
+	"github.com/co1seam/ember-backend-auth/internal/adapters/health"
+	"github.com/co1seam/ember-backend-auth/internal/adapters/metrics"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 	"net"
 	"os"
@@ -27,20 +44,105 @@ var (
 )
 
 type Server struct {
-	grpc *grpc.Server
+	grpc    *grpc.Server
+	handler *Handler
+	health  *health.Checker
+	certs   *certReloader
+	addr    string
+	unary   []grpc.UnaryServerInterceptor
 }
 
-func NewServer() *Server {
-	return &Server{grpc: grpc.NewServer()}
+// NewServer creates the gRPC server of the handler, serving TLS if a
+// certificate is configured.
+func NewServer(checker *health.Checker, handler *Handler, opts *models.Options) (*Server, error) {
+	s := &Server{
+		handler: handler,
+		health:  checker,
+		addr:    net.JoinHostPort(opts.Config.App.Host, opts.Config.App.Port),
+	}
+
+	timeouts, err := newMethodTimeouts(&opts.Config.GRPC)
+	if err != nil {
+		return nil, err
+	}
+	proxies, err := newTrustedProxies(&opts.Config.GRPC)
+	if err != nil {
+		return nil, err
+	}
+
+	// Recovery runs inside the access log and metrics, so that they see a
+	// panic as the Internal error the client gets.
+	s.unary = []grpc.UnaryServerInterceptor{
+		clientAddressUnaryInterceptor(proxies),
+		requestIDUnaryInterceptor(),
+		accessLogUnaryInterceptor(opts),
+		metrics.UnaryServerInterceptor(),
+		recoveryUnaryInterceptor(opts),
+		authUnaryInterceptor(handler.auth),
+		deadlineUnaryInterceptor(timeouts),
+	}
+	serverOpts := []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(s.unary...),
+		grpc.ChainStreamInterceptor(
+			clientAddressStreamInterceptor(proxies),
+			requestIDStreamInterceptor(),
+			accessLogStreamInterceptor(opts),
+			metrics.StreamServerInterceptor(),
+			recoveryStreamInterceptor(opts),
+			authStreamInterceptor(handler.auth),
+		),
+	}
+	if opts.Config.TLS.CertFile != "" {
+		certs, err := newCertReloader(&opts.Config.TLS, opts)
+		if err != nil {
+			return nil, err
+		}
+		s.certs = certs
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(certs.config())))
+	}
+	s.grpc = grpc.NewServer(serverOpts...)
+
+	return s, nil
+}
+
+// LocalAuth returns the Auth service for callers in the same process, such
+// as the HTTP gateway. Its calls pass through the unary interceptors of the
+// server.
+func (s *Server) LocalAuth() authv1.AuthServer {
+	return &localAuth{auth: s.handler.Authorization, interceptors: s.unary}
 }
 
-func (s *Server) Run(handler *Handler) error {
-	conn, err := net.Listen("tcp", ":50051")
+func (s *Server) Run() error {
+	if s.certs != nil {
+		defer s.certs.Close()
+	}
+
+	conn, err := net.Listen("tcp", s.addr)
 	if err != nil {
 		return err
 	}
 
+	handler := s.handler
 	authv1.RegisterAuthServer(s.grpc, handler.Authorization)
+	accountv1.RegisterAccountServer(s.grpc, handler.Account)
+	tokenv1.RegisterTokenServer(s.grpc, handler.Token)
+	rbacv1.RegisterRBACServer(s.grpc, handler.RBAC)
+	relationv1.RegisterRelationServer(s.grpc, handler.Relation)
+	organizationv1.RegisterOrganizationServer(s.grpc, handler.Organization)
+	invitationv1.RegisterInvitationServer(s.grpc, handler.Invitation)
+	apikeyv1.RegisterAPIKeyServer(s.grpc, handler.APIKey)
+	serviceaccountv1.RegisterServiceAccountServer(s.grpc, handler.ServiceAccount)
+	adminv1.RegisterAdminAuthServer(s.grpc, handler.Admin)
+	auditv1.RegisterAuditServer(s.grpc, handler.Audit)
+	webhookv1.RegisterWebhooksServer(s.grpc, handler.Webhooks)
+
+	services := make([]string, 0, len(s.grpc.GetServiceInfo()))
+	for name := range s.grpc.GetServiceInfo() {
+		services = append(services, name)
+	}
+	s.health.SetServices(services)
+	healthpb.RegisterHealthServer(s.grpc, s.health.Server())
 
 	reflection.Register(s.grpc)
 
@@ -51,6 +153,7 @@ func (s *Server) Run(handler *Handler) error {
 
 	go func() {
 		<-quit
+		s.health.Shutdown()
 		s.grpc.GracefulStop()
 	}()
 
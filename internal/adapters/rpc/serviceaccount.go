@@ -0,0 +1,165 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	serviceaccountv1 "github.com/co1seam/ember-backend-auth/gen/go/serviceaccount"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+type ServiceAccount struct {
+	serviceaccountv1.UnimplementedServiceAccountServer
+	service ports.IServiceAccountService
+	opts    *models.Options
+}
+
+func NewServiceAccount(service ports.IServiceAccountService, opts *models.Options) *ServiceAccount {
+	return &ServiceAccount{
+		service: service,
+		opts:    opts,
+	}
+}
+
+func (s *ServiceAccount) CreateServiceAccount(ctx context.Context, req *serviceaccountv1.CreateServiceAccountRequest) (*serviceaccountv1.CreateServiceAccountResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	account, secret, err := s.service.CreateServiceAccount(ctx, caller.UserID, req.Name, req.Description, req.Permissions)
+	if err != nil {
+		return nil, serviceAccountError(err)
+	}
+
+	return &serviceaccountv1.CreateServiceAccountResponse{
+		ServiceAccount: serviceAccountInfo(account),
+		ClientSecret:   secret,
+	}, nil
+}
+
+func (s *ServiceAccount) ListServiceAccounts(ctx context.Context, _ *serviceaccountv1.ListServiceAccountsRequest) (*serviceaccountv1.ListServiceAccountsResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts, err := s.service.ListServiceAccounts(ctx, caller.UserID)
+	if err != nil {
+		return nil, serviceAccountError(err)
+	}
+
+	response := &serviceaccountv1.ListServiceAccountsResponse{}
+	for _, account := range accounts {
+		response.ServiceAccounts = append(response.ServiceAccounts, serviceAccountInfo(&account))
+	}
+
+	return response, nil
+}
+
+func (s *ServiceAccount) DeleteServiceAccount(ctx context.Context, req *serviceaccountv1.DeleteServiceAccountRequest) (*serviceaccountv1.DeleteServiceAccountResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.service.DeleteServiceAccount(ctx, caller.UserID, req.ServiceAccountId); err != nil {
+		return nil, serviceAccountError(err)
+	}
+
+	return &serviceaccountv1.DeleteServiceAccountResponse{Success: true}, nil
+}
+
+func (s *ServiceAccount) RotateSecret(ctx context.Context, req *serviceaccountv1.RotateSecretRequest) (*serviceaccountv1.RotateSecretResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := s.service.RotateSecret(ctx, caller.UserID, req.ServiceAccountId)
+	if err != nil {
+		return nil, serviceAccountError(err)
+	}
+
+	return &serviceaccountv1.RotateSecretResponse{ClientSecret: secret}, nil
+}
+
+func (s *ServiceAccount) ListKeys(ctx context.Context, req *serviceaccountv1.ListKeysRequest) (*serviceaccountv1.ListKeysResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := s.service.ListKeys(ctx, caller.UserID, req.ServiceAccountId)
+	if err != nil {
+		return nil, serviceAccountError(err)
+	}
+
+	response := &serviceaccountv1.ListKeysResponse{}
+	for _, key := range keys {
+		response.Keys = append(response.Keys, &serviceaccountv1.Key{
+			KeyId:     key.ID,
+			PublicKey: key.PublicKey,
+			CreatedAt: key.CreateAt.Format(time.RFC3339),
+		})
+	}
+
+	return response, nil
+}
+
+func (s *ServiceAccount) AddKey(ctx context.Context, req *serviceaccountv1.AddKeyRequest) (*serviceaccountv1.AddKeyResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := s.service.AddKey(ctx, caller.UserID, req.ServiceAccountId, req.PublicKey)
+	if err != nil {
+		return nil, serviceAccountError(err)
+	}
+
+	return &serviceaccountv1.AddKeyResponse{Key: &serviceaccountv1.Key{
+		KeyId:     key.ID,
+		PublicKey: key.PublicKey,
+	}}, nil
+}
+
+func (s *ServiceAccount) RemoveKey(ctx context.Context, req *serviceaccountv1.RemoveKeyRequest) (*serviceaccountv1.RemoveKeyResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.service.RemoveKey(ctx, caller.UserID, req.ServiceAccountId, req.KeyId); err != nil {
+		return nil, serviceAccountError(err)
+	}
+
+	return &serviceaccountv1.RemoveKeyResponse{Success: true}, nil
+}
+
+func serviceAccountInfo(account *models.ServiceAccount) *serviceaccountv1.ServiceAccountInfo {
+	return &serviceaccountv1.ServiceAccountInfo{
+		ServiceAccountId: account.ID,
+		Name:             account.Name,
+		Description:      account.Description,
+		Permissions:      account.Permissions,
+		CreatedBy:        account.CreatedBy,
+		CreatedAt:        account.CreateAt.Format(time.RFC3339),
+	}
+}
+
+func serviceAccountError(err error) error {
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, models.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, models.ErrInvalidServiceAccountInput):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
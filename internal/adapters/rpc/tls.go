@@ -0,0 +1,203 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/config"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloader keeps the server certificate and client CAs current, reading
+// the files again whenever their contents change. Handshakes always use the
+// last files that loaded successfully.
+type certReloader struct {
+	cfg  *config.TLS
+	opts *models.Options
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	contents  [][]byte
+
+	stop chan struct{}
+	once sync.Once
+}
+
+func newCertReloader(cfg *config.TLS, opts *models.Options) (*certReloader, error) {
+	if cfg.KeyFile == "" {
+		return nil, errors.New("GRPC_TLS_KEY_FILE is required with GRPC_TLS_CERT_FILE")
+	}
+	if cfg.RequireClientCert && cfg.ClientCAFile == "" {
+		return nil, errors.New("GRPC_TLS_CLIENT_CA_FILE is required to require client certificates")
+	}
+
+	r := &certReloader{cfg: cfg, opts: opts, stop: make(chan struct{})}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	go r.watch()
+
+	return r, nil
+}
+
+// config returns the TLS configuration of the server. grpc-go requires
+// clients to negotiate HTTP/2 through ALPN, so "h2" is the only protocol
+// offered.
+func (r *certReloader) config() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2"},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				NextProtos:   []string{"h2"},
+				Certificates: []tls.Certificate{*r.cert},
+			}
+			if r.clientCAs != nil {
+				cfg.ClientCAs = r.clientCAs
+				cfg.ClientAuth = tls.VerifyClientCertIfGiven
+				if r.cfg.RequireClientCert {
+					cfg.ClientAuth = tls.RequireAndVerifyClientCert
+				}
+			}
+
+			return cfg, nil
+		},
+	}
+}
+
+func (r *certReloader) Close() {
+	r.once.Do(func() { close(r.stop) })
+}
+
+func (r *certReloader) watch() {
+	ticker := time.NewTicker(r.cfg.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := r.reload()
+		if err != nil {
+			_ = r.opts.Logger.Error("failed to reload TLS files, keeping the current ones", "error", err)
+			continue
+		}
+		if reloaded {
+			_ = r.opts.Logger.Info("reloaded TLS files", "cert_file", r.cfg.CertFile)
+		}
+	}
+}
+
+// reload reads the files and, if any changed, replaces the certificate and
+// client CAs. Contents rather than modification times are compared, as
+// mounted secrets are swapped through symlinks.
+func (r *certReloader) reload() (bool, error) {
+	files := []string{r.cfg.CertFile, r.cfg.KeyFile}
+	if r.cfg.ClientCAFile != "" {
+		files = append(files, r.cfg.ClientCAFile)
+	}
+
+	contents := make([][]byte, len(files))
+	for i, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return false, err
+		}
+		contents[i] = data
+	}
+
+	r.mu.RLock()
+	unchanged := len(r.contents) == len(contents)
+	for i := 0; unchanged && i < len(contents); i++ {
+		unchanged = bytes.Equal(r.contents[i], contents[i])
+	}
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.X509KeyPair(contents[0], contents[1])
+	if err != nil {
+		return false, fmt.Errorf("loading %s: %w", r.cfg.CertFile, err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.cfg.ClientCAFile != "" {
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(contents[2]) {
+			return false, fmt.Errorf("loading %s: no certificates found", r.cfg.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert, r.clientCAs, r.contents = &cert, clientCAs, contents
+	r.mu.Unlock()
+
+	return true, nil
+}
+
+// clientIdentity is who the verified client certificate of a connection
+// names in its subject alternative names.
+type clientIdentity struct {
+	URIs       []string
+	DNSNames   []string
+	Emails     []string
+	CommonName string
+}
+
+// ID is the most specific name of the client: a URI SAN such as a SPIFFE
+// ID, else a DNS name, an email address, or the subject common name.
+func (c *clientIdentity) ID() string {
+	switch {
+	case len(c.URIs) > 0:
+		return c.URIs[0]
+	case len(c.DNSNames) > 0:
+		return c.DNSNames[0]
+	case len(c.Emails) > 0:
+		return c.Emails[0]
+	default:
+		return c.CommonName
+	}
+}
+
+// peerIdentity returns the identity of the client certificate of the
+// request, if the client presented one that verified.
+func peerIdentity(ctx context.Context) (*clientIdentity, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+
+	cert := info.State.VerifiedChains[0][0]
+	identity := &clientIdentity{
+		DNSNames:   cert.DNSNames,
+		Emails:     cert.EmailAddresses,
+		CommonName: cert.Subject.CommonName,
+	}
+	for _, uri := range cert.URIs {
+		identity.URIs = append(identity.URIs, uri.String())
+	}
+
+	return identity, true
+}
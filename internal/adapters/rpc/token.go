@@ -0,0 +1,108 @@
+package rpc
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	tokenv1 "github.com/co1seam/ember-backend-auth/gen/go/token"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"net/url"
+	"strings"
+)
+
+// Token exposes RFC 7662 introspection and RFC 7009 revocation over gRPC.
+// Callers authenticate as OAuth clients with "authorization: Basic" metadata.
+type Token struct {
+	tokenv1.UnimplementedTokenServer
+	service ports.IOAuthService
+	opts    *models.Options
+}
+
+func NewToken(service ports.IOAuthService, opts *models.Options) *Token {
+	return &Token{
+		service: service,
+		opts:    opts,
+	}
+}
+
+func (t *Token) Introspect(ctx context.Context, req *tokenv1.IntrospectRequest) (*tokenv1.IntrospectResponse, error) {
+	clientID, clientSecret := clientCredentials(ctx)
+
+	introspection, err := t.service.Introspect(ctx, req.Token, req.TokenTypeHint, clientID, clientSecret)
+	if err != nil {
+		return nil, tokenError(err)
+	}
+
+	response := &tokenv1.IntrospectResponse{
+		Active:        introspection.Active,
+		Scope:         introspection.Scope,
+		ClientId:      introspection.ClientID,
+		Sub:           introspection.Subject,
+		Aud:           introspection.Audience,
+		Iss:           introspection.Issuer,
+		TokenType:     introspection.TokenType,
+		Jti:           introspection.TokenID,
+		Sid:           introspection.SessionID,
+		Exp:           introspection.ExpiresAt,
+		Iat:           introspection.IssuedAt,
+		OrgId:         introspection.OrgID,
+		PrincipalType: introspection.PrincipalType,
+	}
+	if introspection.Actor != nil {
+		response.Actor = introspection.Actor.Subject
+	}
+
+	return response, nil
+}
+
+func (t *Token) Revoke(ctx context.Context, req *tokenv1.RevokeRequest) (*tokenv1.RevokeResponse, error) {
+	clientID, clientSecret := clientCredentials(ctx)
+
+	if err := t.service.Revoke(ctx, req.Token, req.TokenTypeHint, clientID, clientSecret); err != nil {
+		return nil, tokenError(err)
+	}
+
+	return &tokenv1.RevokeResponse{Success: true}, nil
+}
+
+func clientCredentials(ctx context.Context) (string, string) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", ""
+	}
+
+	values := md.Get("authorization")
+	if len(values) == 0 || !strings.HasPrefix(values[0], "Basic ") {
+		return "", ""
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(values[0], "Basic "))
+	if err != nil {
+		return "", ""
+	}
+
+	id, secret, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return "", ""
+	}
+	id, _ = url.QueryUnescape(id)
+	secret, _ = url.QueryUnescape(secret)
+
+	return id, secret
+}
+
+func tokenError(err error) error {
+	var oauthErr *models.OAuthError
+	if !errors.As(err, &oauthErr) {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	if oauthErr.Code == "invalid_client" {
+		return status.Error(codes.Unauthenticated, oauthErr.Error())
+	}
+	return status.Error(codes.InvalidArgument, oauthErr.Error())
+}
@@ -0,0 +1,98 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/core/services"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"time"
+)
+
+// tokenIssuer issues first-party token pairs for the Auth and Organization
+// services.
+type tokenIssuer struct {
+	rbac ports.IRBACService
+	orgs ports.IOrganizationService
+	opts *models.Options
+}
+
+func newTokenIssuer(rbac ports.IRBACService, orgs ports.IOrganizationService, opts *models.Options) *tokenIssuer {
+	return &tokenIssuer{rbac: rbac, orgs: orgs, opts: opts}
+}
+
+// issue creates a refresh and an access token, in that order. The user's
+// current roles and permissions are embedded in the access token, so a refresh
+// picks up changes. Both tokens are scoped to orgID; when it is empty, or the
+// user has since left that organization, the oldest membership is used.
+// sessionID, the sid claim, identifies the sign-in the tokens descend from;
+// an empty sessionID starts a new one.
+func (t *tokenIssuer) issue(ctx context.Context, userID, orgID, sessionID string, authTime time.Time) ([]string, error) {
+	grants, err := t.rbac.Grants(ctx, userID)
+	if err != nil {
+		return []string{}, err
+	}
+
+	membership, err := t.membership(ctx, userID, orgID)
+	if err != nil {
+		return []string{}, err
+	}
+
+	if sessionID == "" {
+		sessionID = uuid.NewString()
+	}
+
+	claims := func(tokenType string) jwt.MapClaims {
+		claims := jwt.MapClaims{
+			"sub":            userID,
+			"type":           tokenType,
+			"jti":            uuid.NewString(),
+			"sid":            sessionID,
+			"principal_type": models.PrincipalTypeUser,
+		}
+		if !authTime.IsZero() {
+			claims["auth_time"] = authTime.Unix()
+		}
+		if membership != nil {
+			claims["org_id"] = membership.OrgID
+		}
+		return claims
+	}
+
+	cfg := &t.opts.Config.Token
+
+	refreshCookie, err := services.CreateJWT(cfg.RefreshTokenTTL, cfg, claims("refresh"))
+	if err != nil {
+		return []string{}, err
+	}
+
+	accessClaims := claims("access")
+	accessClaims["roles"] = grants.Roles
+	accessClaims["permissions"] = grants.Permissions
+	if membership != nil {
+		accessClaims["org_role"] = membership.Role
+	}
+
+	accessToken, err := services.CreateJWT(cfg.AccessTokenTTL, cfg, accessClaims)
+	if err != nil {
+		return []string{}, err
+	}
+
+	return []string{refreshCookie, accessToken}, nil
+}
+
+func (t *tokenIssuer) membership(ctx context.Context, userID, orgID string) (*models.Membership, error) {
+	if orgID != "" {
+		membership, err := t.orgs.Membership(ctx, orgID, userID)
+		if err == nil {
+			return membership, nil
+		}
+		if !errors.Is(err, models.ErrNotMember) {
+			return nil, err
+		}
+	}
+
+	return t.orgs.DefaultMembership(ctx, userID)
+}
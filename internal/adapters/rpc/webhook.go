@@ -0,0 +1,227 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	webhookv1 "github.com/co1seam/ember-backend-auth/gen/go/webhook"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+type Webhooks struct {
+	webhookv1.UnimplementedWebhooksServer
+	service ports.IWebhookService
+	opts    *models.Options
+}
+
+func NewWebhooks(service ports.IWebhookService, opts *models.Options) *Webhooks {
+	return &Webhooks{
+		service: service,
+		opts:    opts,
+	}
+}
+
+func (w *Webhooks) CreateWebhook(ctx context.Context, req *webhookv1.CreateWebhookRequest) (*webhookv1.CreateWebhookResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	subscription, err := w.service.CreateWebhook(ctx, caller.UserID, &models.WebhookSubscription{
+		URL:         req.Url,
+		EventTypes:  req.EventTypes,
+		Description: req.Description,
+	})
+	if err != nil {
+		return nil, webhookError(err)
+	}
+
+	return &webhookv1.CreateWebhookResponse{
+		Webhook: webhookInfo(subscription),
+		Secret:  subscription.Secret,
+	}, nil
+}
+
+func (w *Webhooks) ListWebhooks(ctx context.Context, _ *webhookv1.ListWebhooksRequest) (*webhookv1.ListWebhooksResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions, err := w.service.ListWebhooks(ctx, caller.UserID)
+	if err != nil {
+		return nil, webhookError(err)
+	}
+
+	response := &webhookv1.ListWebhooksResponse{}
+	for _, subscription := range subscriptions {
+		response.Webhooks = append(response.Webhooks, webhookInfo(&subscription))
+	}
+
+	return response, nil
+}
+
+func (w *Webhooks) GetWebhook(ctx context.Context, req *webhookv1.GetWebhookRequest) (*webhookv1.GetWebhookResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	subscription, err := w.service.GetWebhook(ctx, caller.UserID, req.WebhookId)
+	if err != nil {
+		return nil, webhookError(err)
+	}
+
+	return &webhookv1.GetWebhookResponse{Webhook: webhookInfo(subscription)}, nil
+}
+
+func (w *Webhooks) UpdateWebhook(ctx context.Context, req *webhookv1.UpdateWebhookRequest) (*webhookv1.UpdateWebhookResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	update := models.UpdateWebhookRequest{
+		URL:         req.Url,
+		Description: req.Description,
+		Active:      req.Active,
+	}
+	if len(req.EventTypes) > 0 {
+		update.EventTypes = req.EventTypes
+	}
+
+	subscription, err := w.service.UpdateWebhook(ctx, caller.UserID, req.WebhookId, update)
+	if err != nil {
+		return nil, webhookError(err)
+	}
+
+	return &webhookv1.UpdateWebhookResponse{Webhook: webhookInfo(subscription)}, nil
+}
+
+func (w *Webhooks) DeleteWebhook(ctx context.Context, req *webhookv1.DeleteWebhookRequest) (*webhookv1.DeleteWebhookResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.service.DeleteWebhook(ctx, caller.UserID, req.WebhookId); err != nil {
+		return nil, webhookError(err)
+	}
+
+	return &webhookv1.DeleteWebhookResponse{}, nil
+}
+
+func (w *Webhooks) ListWebhookDeliveries(ctx context.Context, req *webhookv1.ListWebhookDeliveriesRequest) (*webhookv1.ListWebhookDeliveriesResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := w.service.ListDeliveries(ctx, caller.UserID, models.WebhookDeliveryFilter{
+		SubscriptionID: req.WebhookId,
+		Status:         req.Status,
+		Before:         req.Cursor,
+		Limit:          int(req.PageSize),
+	})
+	if err != nil {
+		return nil, webhookError(err)
+	}
+
+	response := &webhookv1.ListWebhookDeliveriesResponse{NextCursor: page.NextCursor}
+	for _, delivery := range page.Deliveries {
+		info := &webhookv1.Delivery{
+			DeliveryId:     delivery.ID,
+			WebhookId:      delivery.SubscriptionID,
+			EventId:        delivery.EventID,
+			EventType:      delivery.EventType,
+			Status:         delivery.Status,
+			Attempts:       int32(delivery.Attempts),
+			LastStatusCode: int32(delivery.LastStatusCode),
+			LastError:      delivery.LastError,
+			CreatedAt:      delivery.CreateAt.Format(time.RFC3339),
+			Payload:        string(delivery.Payload),
+		}
+		if delivery.Status == models.WebhookDeliveryPending {
+			info.NextAttemptAt = delivery.NextAttemptAt.Format(time.RFC3339)
+		}
+		if delivery.DeliveredAt != nil {
+			info.DeliveredAt = delivery.DeliveredAt.Format(time.RFC3339)
+		}
+		response.Deliveries = append(response.Deliveries, info)
+	}
+
+	return response, nil
+}
+
+func (w *Webhooks) ListWebhookAttempts(ctx context.Context, req *webhookv1.ListWebhookAttemptsRequest) (*webhookv1.ListWebhookAttemptsResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts, err := w.service.ListAttempts(ctx, caller.UserID, req.DeliveryId)
+	if err != nil {
+		return nil, webhookError(err)
+	}
+
+	response := &webhookv1.ListWebhookAttemptsResponse{}
+	for _, attempt := range attempts {
+		response.Attempts = append(response.Attempts, &webhookv1.Attempt{
+			StatusCode:  int32(attempt.StatusCode),
+			Error:       attempt.Error,
+			DurationMs:  attempt.Duration.Milliseconds(),
+			AttemptedAt: attempt.AttemptAt.Format(time.RFC3339),
+		})
+	}
+
+	return response, nil
+}
+
+func (w *Webhooks) ReplayWebhook(ctx context.Context, req *webhookv1.ReplayWebhookRequest) (*webhookv1.ReplayWebhookResponse, error) {
+	caller, err := authenticated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.service.ReplayDelivery(ctx, caller.UserID, req.DeliveryId); err != nil {
+		return nil, webhookError(err)
+	}
+
+	return &webhookv1.ReplayWebhookResponse{}, nil
+}
+
+func webhookInfo(subscription *models.WebhookSubscription) *webhookv1.Webhook {
+	info := &webhookv1.Webhook{
+		WebhookId:           subscription.ID,
+		Url:                 subscription.URL,
+		EventTypes:          subscription.EventTypes,
+		Description:         subscription.Description,
+		Active:              subscription.Active,
+		ConsecutiveFailures: int32(subscription.ConsecutiveFailures),
+		DisabledReason:      subscription.DisabledReason,
+		CreatedBy:           subscription.CreatedBy,
+		CreatedAt:           subscription.CreateAt.Format(time.RFC3339),
+		UpdatedAt:           subscription.UpdateAt.Format(time.RFC3339),
+	}
+	if subscription.DisabledAt != nil {
+		info.DisabledAt = subscription.DisabledAt.Format(time.RFC3339)
+	}
+
+	return info
+}
+
+func webhookError(err error) error {
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, models.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, models.ErrInvalidWebhookInput), errors.Is(err, models.ErrInvalidCursor):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
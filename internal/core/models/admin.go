@@ -0,0 +1,76 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	PermissionUsersRead   = "users:read"
+	PermissionUsersManage = "users:manage"
+
+	DefaultUserPageSize = 50
+	MaxUserPageSize     = 200
+)
+
+var (
+	ErrInvalidUserInput = errors.New("invalid user")
+	ErrInvalidCursor    = errors.New("invalid page cursor")
+)
+
+// UserFilter selects a page of users for administrators. Users are listed
+// oldest first; After is the cursor of the last user of the previous page.
+type UserFilter struct {
+	Email         string
+	Status        string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	After         *UserCursor
+	Limit         int
+}
+
+type UserPage struct {
+	Users      []User `json:"users"`
+	NextCursor string `json:"next_cursor"`
+}
+
+// UpdateUserRequest changes the fields that are set; nil fields are kept.
+type UpdateUserRequest struct {
+	Name  *string `json:"name"`
+	Email *string `json:"email"`
+}
+
+// UserCursor is a position in the user listing. It is opaque to clients.
+type UserCursor struct {
+	CreateAt time.Time
+	UserID   string
+}
+
+func NewUserCursor(user *User) *UserCursor {
+	return &UserCursor{CreateAt: user.CreateAt, UserID: user.ID}
+}
+
+func (c *UserCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.CreateAt.UTC().Format(time.RFC3339Nano) + "|" + c.UserID))
+}
+
+func ParseUserCursor(cursor string) (*UserCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	createAt, userID, ok := strings.Cut(string(raw), "|")
+	if !ok || userID == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	c := &UserCursor{UserID: userID}
+	if c.CreateAt, err = time.Parse(time.RFC3339Nano, createAt); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return c, nil
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// APIKeyPrefix marks personal access tokens, so that they are recognizable
+// in logs and by secret scanners, and can be told apart from JWTs.
+const APIKeyPrefix = "ember_pat_"
+
+var (
+	ErrInvalidAPIKey      = errors.New("invalid API key")
+	ErrInvalidAPIKeyInput = errors.New("invalid API key request")
+)
+
+type APIKey struct {
+	ID         string     `json:"key_id"`
+	UserID     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreateAt   time.Time  `json:"create_at"`
+}
+
+// Active reports whether the key may still be used.
+func (k APIKey) Active() bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || k.ExpiresAt.After(time.Now()))
+}
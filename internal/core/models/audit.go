@@ -0,0 +1,98 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	AuditIdentityLinked                   = "identity.linked"
+	AuditIdentityUnlinked                 = "identity.unlinked"
+	AuditRoleAssigned                     = "role.assigned"
+	AuditRoleRevoked                      = "role.revoked"
+	AuditMemberAdded                      = "organization.member_added"
+	AuditMemberUpdated                    = "organization.member_updated"
+	AuditMemberRemoved                    = "organization.member_removed"
+	AuditInvitationSent                   = "organization.invitation_sent"
+	AuditInvitationRevoked                = "organization.invitation_revoked"
+	AuditInvitationAccepted               = "organization.invitation_accepted"
+	AuditAPIKeyCreated                    = "api_key.created"
+	AuditAPIKeyRevoked                    = "api_key.revoked"
+	AuditServiceAccountCreated            = "service_account.created"
+	AuditServiceAccountDeleted            = "service_account.deleted"
+	AuditServiceAccountCredentialsChanged = "service_account.credentials_changed"
+	AuditTokenExchanged                   = "token.exchanged"
+	AuditTokenImpersonated                = "token.impersonated"
+	AuditTokenReused                      = "token.refresh_reused"
+	AuditUserCreated                      = "user.created"
+	AuditUserUpdated                      = "user.updated"
+	AuditUserStatusChanged                = "user.status_changed"
+	AuditUserLoggedOut                    = "user.logged_out"
+	AuditUserPasswordSet                  = "user.password_set"
+	AuditWebhookCreated                   = "webhook.created"
+	AuditWebhookUpdated                   = "webhook.updated"
+	AuditWebhookDeleted                   = "webhook.deleted"
+	AuditWebhookReplayed                  = "webhook.replayed"
+
+	AuditOTPSent         = "auth.otp_sent"
+	AuditOTPVerified     = "auth.otp_verified"
+	AuditSignUp          = "auth.sign_up"
+	AuditSignIn          = "auth.sign_in"
+	AuditSignOut         = "auth.sign_out"
+	AuditTokenRefreshed  = "auth.token_refreshed"
+	AuditTokenValidation = "auth.token_validation"
+
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+var ErrInvalidAuditFilter = errors.New("invalid audit event filter")
+
+const (
+	PermissionAuditRead = "audit:read"
+
+	DefaultAuditPageSize = 50
+	MaxAuditPageSize     = 500
+)
+
+// AuditEvent is an entry of the audit log. OrgID selects the hash chain the
+// event is appended to; Seq, PrevHash and Hash are set when it is written.
+type AuditEvent struct {
+	ID        int64             `json:"id"`
+	Type      string            `json:"event_type"`
+	UserID    string            `json:"user_id"`
+	OrgID     string            `json:"org_id,omitempty"`
+	SessionID string            `json:"session_id,omitempty"`
+	IP        string            `json:"ip,omitempty"`
+	UserAgent string            `json:"user_agent,omitempty"`
+	Outcome   string            `json:"outcome"`
+	Reason    string            `json:"reason,omitempty"`
+	Metadata  map[string]string `json:"metadata"`
+	CreateAt  time.Time         `json:"create_at"`
+	Seq       int64             `json:"chain_seq,omitempty"`
+	PrevHash  string            `json:"prev_hash,omitempty"`
+	Hash      string            `json:"event_hash,omitempty"`
+}
+
+// AuditFilter selects audit events, newest first. BeforeID is the ID of the
+// last event of the previous page.
+type AuditFilter struct {
+	UserID   string
+	OrgID    string
+	Types    []string
+	Outcome  string
+	Since    time.Time
+	Until    time.Time
+	BeforeID int64
+	Limit    int
+
+	// Ascending returns the oldest events first, after the event AfterID.
+	Ascending bool
+	AfterID   int64
+}
+
+// AuditPage is a page of audit events. NextCursor is empty on the last page.
+type AuditPage struct {
+	Events     []AuditEvent
+	NextCursor string
+}
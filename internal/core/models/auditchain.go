@@ -0,0 +1,128 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// GlobalAuditChain is the chain of events that belong to no organization.
+const GlobalAuditChain = ""
+
+const (
+	AuditExportJSONLines = "jsonl"
+	AuditExportCEF       = "cef"
+)
+
+var ErrUnknownExportFormat = errors.New("unknown audit export format")
+
+// Kinds of problems found when verifying an audit chain.
+const (
+	AuditChainGap                = "gap"
+	AuditChainHashMismatch       = "hash_mismatch"
+	AuditChainLinkMismatch       = "link_mismatch"
+	AuditChainHeadMismatch       = "head_mismatch"
+	AuditChainCheckpointMismatch = "checkpoint_mismatch"
+	AuditChainBadSignature       = "bad_signature"
+	AuditChainPurgeMismatch      = "purge_mismatch"
+)
+
+// AuditChainHead is the last event appended to a chain.
+type AuditChainHead struct {
+	ChainID  string
+	LastSeq  int64
+	LastHash string
+	UpdateAt time.Time
+}
+
+// AuditCheckpoint vouches for a chain up to Seq. Signature is a JWS over the
+// chain, sequence number and hash, signed with the service's signing key.
+type AuditCheckpoint struct {
+	ID        int64
+	ChainID   string
+	Seq       int64
+	Hash      string
+	Signature string
+	CreateAt  time.Time
+}
+
+// AuditPurgeWatermark records that the retention purge removed a chain up
+// to and including Seq, the event whose hash was Hash. Signature is a JWS
+// over the chain, sequence number and hash, like that of a checkpoint.
+type AuditPurgeWatermark struct {
+	ChainID   string
+	Seq       int64
+	Hash      string
+	Signature string
+	UpdateAt  time.Time
+}
+
+// AuditPurgedRange is the part of a chain that a retention purge deleted:
+// events FirstSeq to LastSeq, the last of which had the hash LastHash.
+type AuditPurgedRange struct {
+	ChainID  string
+	FirstSeq int64
+	LastSeq  int64
+	LastHash string
+	Events   int64
+}
+
+type AuditChainProblem struct {
+	Seq    int64  `json:"seq"`
+	Kind   string `json:"kind"`
+	Detail string `json:"detail"`
+}
+
+// AuditChainReport is the result of verifying a chain. Events up to
+// PurgedSeq were purged by the retention policy, as its signed watermark
+// attests.
+type AuditChainReport struct {
+	ChainID     string              `json:"chain_id"`
+	PurgedSeq   int64               `json:"purged_seq,omitempty"`
+	FirstSeq    int64               `json:"first_seq"`
+	LastSeq     int64               `json:"last_seq"`
+	Events      int64               `json:"events"`
+	Checkpoints int                 `json:"checkpoints"`
+	Problems    []AuditChainProblem `json:"problems,omitempty"`
+}
+
+func (r *AuditChainReport) Valid() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *AuditChainReport) Problem(seq int64, kind, detail string) {
+	r.Problems = append(r.Problems, AuditChainProblem{Seq: seq, Kind: kind, Detail: detail})
+}
+
+// ChainHash computes the hash linking the event to its predecessor. It
+// covers every recorded field but the database ID, which is assigned after
+// hashing. CreateAt must already be rounded to microseconds, the precision
+// the database stores.
+func (e *AuditEvent) ChainHash() string {
+	metadata := e.Metadata
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+
+	// Encoding the fields as a JSON array keeps them unambiguous; map keys
+	// are encoded in sorted order.
+	fields, _ := json.Marshal([]interface{}{
+		e.PrevHash,
+		e.Seq,
+		e.OrgID,
+		e.Type,
+		e.UserID,
+		e.SessionID,
+		e.IP,
+		e.UserAgent,
+		e.Outcome,
+		e.Reason,
+		metadata,
+		e.CreateAt.UTC().Format(time.RFC3339Nano),
+	})
+	sum := sha256.Sum256(fields)
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,8 @@
+package models
+
+import "errors"
+
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrUnauthorized = errors.New("unauthorized")
+)
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Domain events published to other services. The payload of each type is
+// described by Version; fields are only ever added within a version, and a
+// change that breaks consumers gets a new version.
+const (
+	EventUserSignedUp        = "user.signed_up"
+	EventUserEmailVerified   = "user.email_verified"
+	EventUserPasswordChanged = "user.password_changed"
+	EventUserDeleted         = "user.deleted"
+
+	UserEventVersion = 1
+)
+
+const (
+	EventSinkRedis   = "redis"
+	EventSinkWebhook = "webhook"
+)
+
+// DomainEvent is the envelope every sink receives. ID is unique per event,
+// so consumers can drop the duplicates that at-least-once delivery implies.
+type DomainEvent struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Version    int             `json:"version"`
+	Subject    string          `json:"subject"`
+	Data       json.RawMessage `json:"data"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Attempts   int             `json:"-"`
+}
+
+// UserEventData is the version 1 payload of user events. Subject is the
+// user ID.
+type UserEventData struct {
+	UserID  string `json:"user_id"`
+	Email   string `json:"email,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Status  string `json:"status,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	ActorID string `json:"actor_id,omitempty"`
+}
+
+// NewUserEvent builds a user event to be written to the outbox.
+func NewUserEvent(eventType string, data UserEventData) (*DomainEvent, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DomainEvent{
+		Type:    eventType,
+		Version: UserEventVersion,
+		Subject: data.UserID,
+		Data:    payload,
+	}, nil
+}
@@ -0,0 +1,43 @@
+package models
+
+const (
+	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	// TokenTypeURNAccessToken is the only token type accepted and issued by
+	// token exchange (RFC 8693 section 3).
+	TokenTypeURNAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+
+	PermissionUsersImpersonate = "users:impersonate"
+)
+
+// Actor is the act claim of an exchanged token (RFC 8693 section 4.1): the
+// party acting on behalf of the subject. A token exchanged more than once
+// nests the previous actors.
+type Actor struct {
+	Subject string `json:"sub"`
+	Actor   *Actor `json:"act,omitempty"`
+}
+
+// Claim converts the actor to its JWT claim representation.
+func (a *Actor) Claim() map[string]interface{} {
+	claim := map[string]interface{}{"sub": a.Subject}
+	if a.Actor != nil {
+		claim["act"] = a.Actor.Claim()
+	}
+	return claim
+}
+
+// ParseActor reads an act claim. It returns nil when there is none.
+func ParseActor(claim interface{}) *Actor {
+	values, ok := claim.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	subject, _ := values["sub"].(string)
+	if subject == "" {
+		return nil
+	}
+
+	return &Actor{Subject: subject, Actor: ParseActor(values["act"])}
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrIdentityConflict = errors.New("an account with this email already exists")
+
+type LinkedIdentity struct {
+	Provider    string    `json:"provider"`
+	Subject     string    `json:"subject"`
+	UserID      string    `json:"user_id"`
+	Email       string    `json:"email"`
+	CreateAt    time.Time `json:"create_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+// ExternalIdentity is what an upstream identity provider asserted about the
+// end-user after a successful login.
+type ExternalIdentity struct {
+	Provider      string `json:"provider"`
+	Subject       string `json:"subject"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+type FederationState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	ReturnTo     string `json:"return_to"`
+	LinkUserID   string `json:"link_user_id"`
+	// BindingHash is the hash of the pre-auth cookie of the user agent that
+	// started the login, which must come back with the callback.
+	BindingHash string `json:"binding_hash"`
+}
+
+// FederationLinkTicket is a pending identity link, waiting for the user
+// agent of the user to continue it.
+type FederationLinkTicket struct {
+	Provider string `json:"provider"`
+	ReturnTo string `json:"return_to"`
+	UserID   string `json:"user_id"`
+}
+
+type FederatedLogin struct {
+	UserID   string    `json:"user_id"`
+	ReturnTo string    `json:"return_to"`
+	AuthTime time.Time `json:"auth_time"`
+	Linked   bool      `json:"linked"`
+}
+
+var (
+	ErrLastLoginMethod          = errors.New("cannot remove the last login method")
+	ErrReauthenticationRequired = errors.New("recent authentication is required")
+)
+
+const (
+	LoginMethodPassword = "password"
+	LoginMethodIdentity = "identity"
+)
+
+type LoginMethod struct {
+	Type       string    `json:"type"`
+	Provider   string    `json:"provider"`
+	Subject    string    `json:"subject"`
+	Email      string    `json:"email"`
+	CreateAt   time.Time `json:"create_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	InvitationStatusPending  = "pending"
+	InvitationStatusExpired  = "expired"
+	InvitationStatusAccepted = "accepted"
+	InvitationStatusRevoked  = "revoked"
+)
+
+var (
+	ErrInvitationInvalid       = errors.New("invitation is invalid or has expired")
+	ErrInvitationExists        = errors.New("an invitation for this email is already pending")
+	ErrInvitationEmailMismatch = errors.New("invitation was sent to a different email address")
+	ErrInvitationSignInNeeded  = errors.New("an account with this email already exists, sign in to accept the invitation")
+)
+
+type Invitation struct {
+	ID         string     `json:"invitation_id"`
+	OrgID      string     `json:"org_id"`
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	InvitedBy  string     `json:"invited_by,omitempty"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	AcceptedBy string     `json:"accepted_by,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreateAt   time.Time  `json:"create_at"`
+	UpdateAt   time.Time  `json:"update_at"`
+}
+
+func (i Invitation) Status() string {
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationStatusAccepted
+	case i.RevokedAt != nil:
+		return InvitationStatusRevoked
+	case !i.ExpiresAt.After(time.Now()):
+		return InvitationStatusExpired
+	default:
+		return InvitationStatusPending
+	}
+}
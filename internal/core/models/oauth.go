@@ -0,0 +1,208 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	ClientTypePublic       = "public"
+	ClientTypeConfidential = "confidential"
+
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeRefreshToken      = "refresh_token"
+
+	CodeChallengeMethodS256 = "S256"
+
+	TokenTypeBearer = "Bearer"
+
+	// Token type identifiers used by token_type_hint (RFC 7009) and in
+	// introspection responses.
+	TokenTypeAccessToken  = "access_token"
+	TokenTypeRefreshToken = "refresh_token"
+)
+
+type Client struct {
+	ID           string    `json:"client_id"`
+	SecretHash   string    `json:"-"`
+	Name         string    `json:"client_name"`
+	Type         string    `json:"client_type"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	GrantTypes   []string  `json:"grant_types"`
+	Scopes       []string  `json:"scopes"`
+	FirstParty   bool      `json:"first_party"`
+	CreateAt     time.Time `json:"create_at"`
+	UpdateAt     time.Time `json:"update_at"`
+}
+
+func (c *Client) IsConfidential() bool {
+	return c.Type == ClientTypeConfidential
+}
+
+func (c *Client) AllowsGrant(grantType string) bool {
+	return contains(c.GrantTypes, grantType)
+}
+
+func (c *Client) AllowsRedirectURI(uri string) bool {
+	return contains(c.RedirectURIs, uri)
+}
+
+func (c *Client) AllowsScopes(scopes []string) bool {
+	for _, scope := range scopes {
+		if !contains(c.Scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+type Session struct {
+	ID               string     `json:"session_id"`
+	UserID           string     `json:"user_id"`
+	ClientID         string     `json:"client_id"`
+	Scope            string     `json:"scope"`
+	RefreshTokenHash string     `json:"-"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	AuthTime         time.Time  `json:"auth_time"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+	CreateAt         time.Time  `json:"create_at"`
+	UpdateAt         time.Time  `json:"update_at"`
+}
+
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+type Consent struct {
+	UserID    string     `json:"user_id"`
+	ClientID  string     `json:"client_id"`
+	Scopes    []string   `json:"scopes"`
+	GrantedAt time.Time  `json:"granted_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+func (c *Consent) Covers(scopes []string) bool {
+	if c.RevokedAt != nil {
+		return false
+	}
+	for _, scope := range scopes {
+		if !contains(c.Scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+type AuthorizationCode struct {
+	ClientID            string    `json:"client_id"`
+	UserID              string    `json:"user_id"`
+	RedirectURI         string    `json:"redirect_uri"`
+	Scope               string    `json:"scope"`
+	CodeChallenge       string    `json:"code_challenge"`
+	CodeChallengeMethod string    `json:"code_challenge_method"`
+	Nonce               string    `json:"nonce"`
+	AuthTime            time.Time `json:"auth_time"`
+}
+
+type AuthorizeRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Nonce               string `json:"nonce"`
+	Prompt              string `json:"prompt"`
+	MaxAge              string `json:"max_age"`
+}
+
+type TokenRequest struct {
+	GrantType    string `json:"grant_type"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	Code         string `json:"code"`
+	RedirectURI  string `json:"redirect_uri"`
+	CodeVerifier string `json:"code_verifier"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+
+	// ClientAssertionType and ClientAssertion carry a private_key_jwt
+	// client authentication (RFC 7523) instead of a client secret.
+	ClientAssertionType string `json:"client_assertion_type"`
+	ClientAssertion     string `json:"client_assertion"`
+
+	// Token exchange parameters (RFC 8693 section 2.1). RequestedSubject and
+	// Reason are used for impersonation, where the actor has no token of the
+	// subject.
+	SubjectToken       string   `json:"subject_token"`
+	SubjectTokenType   string   `json:"subject_token_type"`
+	ActorToken         string   `json:"actor_token"`
+	ActorTokenType     string   `json:"actor_token_type"`
+	RequestedTokenType string   `json:"requested_token_type"`
+	Audience           []string `json:"audience"`
+	RequestedSubject   string   `json:"requested_subject"`
+	Reason             string   `json:"reason"`
+}
+
+type TokenResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int64  `json:"expires_in"`
+	RefreshToken    string `json:"refresh_token,omitempty"`
+	IDToken         string `json:"id_token,omitempty"`
+	Scope           string `json:"scope,omitempty"`
+}
+
+type Introspection struct {
+	Active        bool     `json:"active"`
+	Scope         string   `json:"scope,omitempty"`
+	ClientID      string   `json:"client_id,omitempty"`
+	Subject       string   `json:"sub,omitempty"`
+	Audience      []string `json:"aud,omitempty"`
+	Issuer        string   `json:"iss,omitempty"`
+	TokenType     string   `json:"token_type,omitempty"`
+	TokenID       string   `json:"jti,omitempty"`
+	SessionID     string   `json:"sid,omitempty"`
+	OrgID         string   `json:"org_id,omitempty"`
+	PrincipalType string   `json:"principal_type,omitempty"`
+	Actor         *Actor   `json:"act,omitempty"`
+	ExpiresAt     int64    `json:"exp,omitempty"`
+	IssuedAt      int64    `json:"iat,omitempty"`
+}
+
+// OAuthError is an error response as defined in RFC 6749 section 5.2.
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+func NewOAuthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+func ParseScope(scope string) []string {
+	return strings.Fields(scope)
+}
+
+func JoinScope(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+
+	PermissionOrganizationDomains = "organizations:domains"
+)
+
+var (
+	ErrNotMember       = errors.New("not a member of the organization")
+	ErrOrgSlugTaken    = errors.New("organization slug is already taken")
+	ErrDomainTaken     = errors.New("email domain already belongs to an organization")
+	ErrLastOwner       = errors.New("an organization must keep at least one owner")
+	ErrInvalidOrgRole  = errors.New("invalid organization role")
+	ErrInvalidOrgInput = errors.New("invalid organization")
+)
+
+type Organization struct {
+	ID       string    `json:"org_id"`
+	Name     string    `json:"org_name"`
+	Slug     string    `json:"org_slug"`
+	CreateAt time.Time `json:"create_at"`
+	UpdateAt time.Time `json:"update_at"`
+}
+
+// Membership is a user's role within an organization. OrgName and OrgSlug
+// are filled when listing the organizations of a user.
+type Membership struct {
+	OrgID    string    `json:"org_id"`
+	OrgName  string    `json:"org_name,omitempty"`
+	OrgSlug  string    `json:"org_slug,omitempty"`
+	UserID   string    `json:"user_id"`
+	Email    string    `json:"email,omitempty"`
+	Role     string    `json:"role"`
+	CreateAt time.Time `json:"create_at"`
+}
+
+// CanManage reports whether the member may administer the organization.
+func (m Membership) CanManage() bool {
+	return m.Role == OrgRoleOwner || m.Role == OrgRoleAdmin
+}
+
+type OrganizationDomain struct {
+	Domain   string    `json:"domain"`
+	OrgID    string    `json:"org_id"`
+	Role     string    `json:"role"`
+	CreateAt time.Time `json:"create_at"`
+}
+
+func ValidOrgRole(role string) bool {
+	return role == OrgRoleOwner || role == OrgRoleAdmin || role == OrgRoleMember
+}
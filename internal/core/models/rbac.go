@@ -0,0 +1,32 @@
+package models
+
+import "errors"
+
+const (
+	PermissionRolesRead   = "roles:read"
+	PermissionRolesManage = "roles:manage"
+)
+
+var ErrPermissionDenied = errors.New("permission denied")
+
+type Role struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// Grants holds the roles of a user and the permissions they add up to, as
+// embedded in access tokens.
+type Grants struct {
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+}
+
+func (g Grants) Has(permission string) bool {
+	for _, p := range g.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package models
+
+import "errors"
+
+const (
+	UsersetLeaf         = "leaf"
+	UsersetUnion        = "union"
+	UsersetIntersection = "intersection"
+
+	PermissionRelationsWrite = "relations:write"
+	PermissionRelationsRead  = "relations:read"
+
+	// RelationUserNamespace is the namespace of users, whose object IDs are
+	// user IDs.
+	RelationUserNamespace = "user"
+
+	DefaultObjectPageSize = 100
+	MaxObjectPageSize     = 1000
+	// ObjectPageCandidates is how many candidate objects a page of
+	// ListObjects checks at most, each check being a graph walk of its own.
+	ObjectPageCandidates = 5000
+)
+
+var (
+	ErrInvalidRelationTuple  = errors.New("invalid relation tuple")
+	ErrUnknownNamespace      = errors.New("unknown namespace")
+	ErrUnknownRelation       = errors.New("unknown relation")
+	ErrRelationDepthExceeded = errors.New("relation check exceeded the maximum depth")
+	ErrInvalidConsistency    = errors.New("invalid consistency token")
+)
+
+// ObjectRef identifies an object, e.g. document:readme.
+type ObjectRef struct {
+	Namespace string `json:"namespace"`
+	ID        string `json:"object_id"`
+}
+
+func (o ObjectRef) String() string {
+	return o.Namespace + ":" + o.ID
+}
+
+// SubjectRef is either a concrete object such as user:alice or, when Relation
+// is set, the userset of everything holding that relation, e.g.
+// group:eng#member.
+type SubjectRef struct {
+	Namespace string `json:"namespace"`
+	ID        string `json:"object_id"`
+	Relation  string `json:"relation,omitempty"`
+}
+
+func (s SubjectRef) Object() ObjectRef {
+	return ObjectRef{Namespace: s.Namespace, ID: s.ID}
+}
+
+func (s SubjectRef) String() string {
+	if s.Relation == "" {
+		return s.Namespace + ":" + s.ID
+	}
+	return s.Namespace + ":" + s.ID + "#" + s.Relation
+}
+
+// RelationTuple states that Subject has Relation to Object, written as
+// object#relation@subject.
+type RelationTuple struct {
+	Object   ObjectRef  `json:"object"`
+	Relation string     `json:"relation"`
+	Subject  SubjectRef `json:"subject"`
+}
+
+func (t RelationTuple) String() string {
+	return t.Object.String() + "#" + t.Relation + "@" + t.Subject.String()
+}
+
+// ObjectPage is a page of object IDs. NextCursor is empty on the last page.
+type ObjectPage struct {
+	ObjectIDs  []string
+	NextCursor string
+}
+
+// UsersetTree is the result of expanding object#relation: leaves list the
+// subjects stored directly, inner nodes combine their children.
+type UsersetTree struct {
+	Operation string         `json:"operation"`
+	Object    ObjectRef      `json:"object"`
+	Relation  string         `json:"relation"`
+	Subjects  []SubjectRef   `json:"subjects,omitempty"`
+	Children  []*UsersetTree `json:"children,omitempty"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	// Values of the principal_type claim, telling humans and machines apart.
+	PrincipalTypeUser    = "user"
+	PrincipalTypeService = "service"
+
+	ClientAssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+	PermissionServiceAccountsManage = "service_accounts:manage"
+)
+
+var ErrInvalidServiceAccountInput = errors.New("invalid service account")
+
+// ServiceAccount is a non-human principal. Its ID is the client_id it
+// authenticates with, and its permissions are the scopes it may request.
+type ServiceAccount struct {
+	ID          string    `json:"service_account_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions"`
+	CreatedBy   string    `json:"created_by,omitempty"`
+	CreateAt    time.Time `json:"create_at"`
+}
+
+// ClientKey is a public key a client signs its private_key_jwt assertions
+// with. PublicKey is PEM encoded.
+type ClientKey struct {
+	ID        string    `json:"key_id"`
+	ClientID  string    `json:"client_id"`
+	PublicKey string    `json:"public_key"`
+	CreateAt  time.Time `json:"create_at"`
+}
@@ -0,0 +1,70 @@
+package models
+
+import "errors"
+
+// Account statuses. Only active users may sign in or use their tokens.
+const (
+	UserStatusPending  = "pending"
+	UserStatusActive   = "active"
+	UserStatusLocked   = "locked"
+	UserStatusDisabled = "disabled"
+	UserStatusDeleted  = "deleted"
+)
+
+var (
+	ErrAccountPending          = errors.New("account is pending activation")
+	ErrAccountLocked           = errors.New("account is locked")
+	ErrAccountDisabled         = errors.New("account is disabled")
+	ErrAccountDeleted          = errors.New("account has been deleted")
+	ErrInvalidStatusTransition = errors.New("invalid account status transition")
+)
+
+// userTransitions is the account status state machine: the statuses each
+// status may change to. Deleted is final.
+var userTransitions = map[string][]string{
+	UserStatusPending:  {UserStatusActive, UserStatusDisabled, UserStatusDeleted},
+	UserStatusActive:   {UserStatusLocked, UserStatusDisabled, UserStatusDeleted},
+	UserStatusLocked:   {UserStatusActive, UserStatusDisabled, UserStatusDeleted},
+	UserStatusDisabled: {UserStatusActive, UserStatusDeleted},
+}
+
+// StatusChange moves a user to a new status. ActorID is empty when the user
+// changed it themselves.
+type StatusChange struct {
+	From    string
+	To      string
+	Reason  string
+	ActorID string
+}
+
+func ValidUserStatus(status string) bool {
+	_, ok := userTransitions[status]
+	return ok || status == UserStatusDeleted
+}
+
+func CanTransition(from, to string) bool {
+	return contains(userTransitions[from], to)
+}
+
+// IsAccountStatusError reports whether err is why a user may not sign in.
+func IsAccountStatusError(err error) bool {
+	return errors.Is(err, ErrAccountPending) || errors.Is(err, ErrAccountLocked) ||
+		errors.Is(err, ErrAccountDisabled) || errors.Is(err, ErrAccountDeleted)
+}
+
+// StatusError tells why the user may not sign in, or returns nil for active
+// users.
+func (u *User) StatusError() error {
+	switch u.Status {
+	case UserStatusActive:
+		return nil
+	case UserStatusPending:
+		return ErrAccountPending
+	case UserStatusLocked:
+		return ErrAccountLocked
+	case UserStatusDeleted:
+		return ErrAccountDeleted
+	default:
+		return ErrAccountDisabled
+	}
+}
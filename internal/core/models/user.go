@@ -3,12 +3,17 @@ package models
 import "time"
 
 type User struct {
-	ID       string    `json:"-"`
-	Name     string    `json:"name"`
-	Email    string    `json:"email"`
-	Password string    `json:"password"`
-	CreateAt time.Time `json:"create_at"`
-	UpdateAt time.Time `json:"update_at"`
+	ID              string     `json:"-"`
+	Name            string     `json:"name"`
+	Email           string     `json:"email"`
+	Password        string     `json:"password"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	Status          string     `json:"status"`
+	StatusReason    string     `json:"status_reason,omitempty"`
+	StatusChangedAt *time.Time `json:"status_changed_at,omitempty"`
+	StatusChangedBy string     `json:"status_changed_by,omitempty"`
+	CreateAt        time.Time  `json:"create_at"`
+	UpdateAt        time.Time  `json:"update_at"`
 }
 
 type SendOtpRequest struct {
@@ -23,6 +28,9 @@ type SignUpRequest struct {
 	Name     string `json:"name"`
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	// Status is the initial status of the account, pending until the email
+	// address is verified if empty.
+	Status string `json:"-"`
 }
 
 type SignInRequest struct {
@@ -30,6 +38,11 @@ type SignInRequest struct {
 	Password string `json:"password"`
 }
 
+type SetPasswordRequest struct {
+	UserID   string `json:"user_id"`
+	Password string `json:"password"`
+}
+
 type Cookie struct {
 	Name     string    `json:"name"`
 	Value    string    `json:"value"`
@@ -38,4 +51,5 @@ type Cookie struct {
 	Expires  time.Time `json:"expires"`
 	Secure   bool      `json:"secure"`
 	HTTPOnly bool      `json:"http_only"`
+	SameSite string    `json:"same_site"`
 }
@@ -11,5 +11,38 @@ type Options struct {
 }
 
 const (
-	UserTable = "users"
+	UserTable     = "users"
+	ClientTable   = "oauth_clients"
+	SessionTable  = "sessions"
+	ConsentTable  = "oauth_consents"
+	IdentityTable = "linked_identities"
+	AuditTable    = "audit_events"
+
+	AuditChainTable      = "audit_chains"
+	AuditCheckpointTable = "audit_checkpoints"
+	AuditWatermarkTable  = "audit_purge_watermarks"
+
+	RoleTable           = "roles"
+	PermissionTable     = "permissions"
+	RolePermissionTable = "role_permissions"
+	UserRoleTable       = "user_roles"
+
+	RelationTupleTable    = "relation_tuples"
+	RelationRevisionTable = "relation_revision"
+
+	OrganizationTable       = "organizations"
+	OrganizationMemberTable = "organization_members"
+	OrganizationDomainTable = "organization_domains"
+	InvitationTable         = "invitations"
+
+	APIKeyTable = "api_keys"
+
+	ServiceAccountTable = "service_accounts"
+	ClientKeyTable      = "oauth_client_keys"
+
+	OutboxTable = "outbox_events"
+
+	WebhookSubscriptionTable = "webhook_subscriptions"
+	WebhookDeliveryTable     = "webhook_deliveries"
+	WebhookAttemptTable      = "webhook_attempts"
 )
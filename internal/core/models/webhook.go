@@ -0,0 +1,122 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	PermissionWebhooksManage = "webhooks:manage"
+
+	DefaultWebhookPageSize = 50
+	MaxWebhookPageSize     = 200
+)
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// Headers of webhook requests. The signature header has the form
+// "t=<unix time>,v1=<hex HMAC-SHA256>", the HMAC being computed with the
+// subscription secret over "<unix time>.<body>".
+const (
+	WebhookSignatureHeader = "Ember-Webhook-Signature"
+	WebhookDeliveryHeader  = "Ember-Webhook-Id"
+	WebhookEventTypeHeader = "Ember-Event-Type"
+)
+
+var ErrInvalidWebhookInput = errors.New("invalid webhook")
+
+type WebhookSubscription struct {
+	ID                  string     `json:"id"`
+	URL                 string     `json:"url"`
+	EventTypes          []string   `json:"event_types"`
+	Secret              string     `json:"-"`
+	Description         string     `json:"description"`
+	Active              bool       `json:"active"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason      string     `json:"disabled_reason,omitempty"`
+	CreatedBy           string     `json:"created_by"`
+	CreateAt            time.Time  `json:"create_at"`
+	UpdateAt            time.Time  `json:"update_at"`
+}
+
+// Matches reports whether the subscription wants events of the type. Event
+// types are matched exactly, by a prefix ending in ".*", or by "*".
+func (s *WebhookSubscription) Matches(eventType string) bool {
+	for _, pattern := range s.EventTypes {
+		switch {
+		case pattern == "*", pattern == eventType:
+			return true
+		case strings.HasSuffix(pattern, ".*") && strings.HasPrefix(eventType, strings.TrimSuffix(pattern, "*")):
+			return true
+		}
+	}
+
+	return false
+}
+
+// UpdateWebhookRequest changes the fields that are set. Activating a
+// disabled subscription resets its failures.
+type UpdateWebhookRequest struct {
+	URL         *string
+	EventTypes  []string
+	Description *string
+	Active      *bool
+}
+
+// WebhookEvent is the body of a webhook request.
+type WebhookEvent struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type WebhookDelivery struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscription_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode int             `json:"last_status_code"`
+	LastError      string          `json:"last_error"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	CreateAt       time.Time       `json:"create_at"`
+}
+
+// WebhookAttempt is the outcome of one request of a delivery. StatusCode is
+// zero when no response was received.
+type WebhookAttempt struct {
+	DeliveryID string        `json:"delivery_id"`
+	StatusCode int           `json:"status_code"`
+	Error      string        `json:"error"`
+	Duration   time.Duration `json:"duration"`
+	AttemptAt  time.Time     `json:"attempt_at"`
+}
+
+func (a *WebhookAttempt) Succeeded() bool {
+	return a.StatusCode >= 200 && a.StatusCode < 300
+}
+
+// WebhookDeliveryFilter selects deliveries, newest first. Before is the ID
+// of the last delivery of the previous page.
+type WebhookDeliveryFilter struct {
+	SubscriptionID string
+	Status         string
+	Before         string
+	Limit          int
+}
+
+type WebhookDeliveryPage struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	NextCursor string            `json:"next_cursor"`
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"time"
+)
+
+type Account struct {
+	users      ports.IUserRepo
+	identities ports.IIdentityRepo
+	federation ports.IFederationService
+	notifier   *securityNotifier
+	opts       *models.Options
+}
+
+func NewAccount(users ports.IUserRepo, identities ports.IIdentityRepo, federation ports.IFederationService, notifier *securityNotifier, opts *models.Options) *Account {
+	return &Account{users: users, identities: identities, federation: federation, notifier: notifier, opts: opts}
+}
+
+func (a *Account) ListLoginMethods(ctx context.Context, userID string) ([]models.LoginMethod, error) {
+	user, err := a.users.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	hasPassword, err := a.users.HasPassword(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var methods []models.LoginMethod
+	if hasPassword {
+		methods = append(methods, models.LoginMethod{
+			Type:     models.LoginMethodPassword,
+			Email:    user.Email,
+			CreateAt: user.CreateAt,
+		})
+	}
+
+	identities, err := a.identities.ListIdentities(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, identity := range identities {
+		methods = append(methods, models.LoginMethod{
+			Type:       models.LoginMethodIdentity,
+			Provider:   identity.Provider,
+			Subject:    identity.Subject,
+			Email:      identity.Email,
+			CreateAt:   identity.CreateAt,
+			LastUsedAt: identity.LastLoginAt,
+		})
+	}
+
+	return methods, nil
+}
+
+// LinkIdentity starts linking an external identity and returns the URL to
+// send the user agent to, which continues the link with the provider.
+// Adding a way to sign in is sensitive, so the caller must have
+// authenticated recently.
+func (a *Account) LinkIdentity(ctx context.Context, userID string, authTime time.Time, provider, returnTo string) (string, error) {
+	if authTime.IsZero() || time.Since(authTime) > a.opts.Config.Account.ReauthMaxAge {
+		return "", models.ErrReauthenticationRequired
+	}
+
+	return a.federation.BeginLink(ctx, provider, returnTo, userID)
+}
+
+func (a *Account) UnlinkIdentity(ctx context.Context, userID, provider, subject string) error {
+	identity, err := a.identities.GetIdentity(ctx, provider, subject)
+	if err != nil {
+		return err
+	}
+	if identity.UserID != userID {
+		return models.ErrNotFound
+	}
+
+	if err := a.identities.DeleteIdentity(ctx, userID, provider, subject); err != nil {
+		return err
+	}
+
+	return a.notifier.identityChanged(ctx, models.AuditIdentityUnlinked, userID, provider)
+}
@@ -0,0 +1,339 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"github.com/google/uuid"
+	"net/mail"
+	"strings"
+)
+
+// minPasswordLength applies to passwords set by administrators.
+const minPasswordLength = 8
+
+// Admin lets administrators manage user accounts. Reading requires
+// users:read, every change users:manage, and every change is audited.
+type Admin struct {
+	users  ports.IUserRepo
+	auth   ports.IAuthService
+	tokens ports.IOAuthService
+	rbac   ports.IRBACService
+	audit  ports.IAuditRepo
+	opts   *models.Options
+}
+
+func NewAdmin(users ports.IUserRepo, auth ports.IAuthService, tokens ports.IOAuthService, rbac ports.IRBACService, audit ports.IAuditRepo, opts *models.Options) *Admin {
+	return &Admin{users: users, auth: auth, tokens: tokens, rbac: rbac, audit: audit, opts: opts}
+}
+
+func (a *Admin) ListUsers(ctx context.Context, actorID string, filter models.UserFilter) (*models.UserPage, error) {
+	if err := a.require(ctx, actorID, models.PermissionUsersRead); err != nil {
+		return nil, err
+	}
+
+	if filter.Status != "" && !models.ValidUserStatus(filter.Status) {
+		return nil, fmt.Errorf("%w: unknown status %q", models.ErrInvalidUserInput, filter.Status)
+	}
+	if filter.After != nil {
+		if _, err := uuid.Parse(filter.After.UserID); err != nil {
+			return nil, models.ErrInvalidCursor
+		}
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = models.DefaultUserPageSize
+	}
+	filter.Limit = min(filter.Limit, models.MaxUserPageSize)
+
+	// One user more than requested tells whether there is a next page.
+	limit := filter.Limit
+	filter.Limit++
+	users, err := a.users.ListUsers(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.UserPage{Users: users}
+	if len(users) > limit {
+		page.Users = users[:limit]
+		page.NextCursor = models.NewUserCursor(&page.Users[limit-1]).String()
+	}
+
+	return page, nil
+}
+
+func (a *Admin) GetUser(ctx context.Context, actorID, userID string) (*models.User, error) {
+	if err := a.require(ctx, actorID, models.PermissionUsersRead); err != nil {
+		return nil, err
+	}
+
+	return a.getUser(ctx, userID)
+}
+
+// CreateUser creates a user with a password, who gets the default role like
+// any user signing up. Unless their email is known to be verified, the user
+// is pending until they verify it or an administrator enables them.
+func (a *Admin) CreateUser(ctx context.Context, actorID string, user models.SignUpRequest, emailVerified bool) (*models.User, error) {
+	if err := a.require(ctx, actorID, models.PermissionUsersManage); err != nil {
+		return nil, err
+	}
+
+	user.Name = strings.TrimSpace(user.Name)
+	user.Email = strings.TrimSpace(user.Email)
+	if err := validateEmail(user.Email); err != nil {
+		return nil, err
+	}
+	if err := validatePassword(user.Password); err != nil {
+		return nil, err
+	}
+
+	if _, err := a.users.GetUserByEmail(ctx, user.Email); err == nil {
+		return nil, models.ErrIdentityConflict
+	}
+
+	user.Status = models.UserStatusActive
+	if !emailVerified {
+		user.Status = models.UserStatusPending
+	}
+
+	id, err := a.auth.Create(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	userID := id.(string)
+
+	if emailVerified {
+		if err := a.users.VerifyEmail(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	created, err := a.users.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return created, a.record(ctx, models.AuditUserCreated, actorID, userID, nil)
+}
+
+func (a *Admin) UpdateUser(ctx context.Context, actorID, userID string, update models.UpdateUserRequest) (*models.User, error) {
+	if err := a.require(ctx, actorID, models.PermissionUsersManage); err != nil {
+		return nil, err
+	}
+
+	metadata := map[string]string{}
+	if update.Name != nil {
+		name := strings.TrimSpace(*update.Name)
+		update.Name = &name
+		metadata["name"] = name
+	}
+	if update.Email != nil {
+		email := strings.TrimSpace(*update.Email)
+		if err := validateEmail(email); err != nil {
+			return nil, err
+		}
+		update.Email = &email
+		metadata["email"] = email
+	}
+
+	if err := a.requireNotDeleted(ctx, userID); err != nil {
+		return nil, err
+	}
+	// Whoever controls the email address can reset the password.
+	if update.Email != nil {
+		if err := a.requireOutranks(ctx, actorID, userID); err != nil {
+			return nil, err
+		}
+	}
+	if err := a.users.UpdateUser(ctx, userID, update); err != nil {
+		return nil, err
+	}
+
+	user, err := a.users.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, a.record(ctx, models.AuditUserUpdated, actorID, userID, metadata)
+}
+
+// DisableUser stops the user from signing in and signs them out
+// everywhere, until an administrator enables them again.
+func (a *Admin) DisableUser(ctx context.Context, actorID, userID, reason string) error {
+	return a.changeStatus(ctx, actorID, userID, models.UserStatusDisabled, reason)
+}
+
+// EnableUser activates a pending, locked or disabled user.
+func (a *Admin) EnableUser(ctx context.Context, actorID, userID, reason string) error {
+	return a.changeStatus(ctx, actorID, userID, models.UserStatusActive, reason)
+}
+
+// LockUser suspends an active user, for example while their account is
+// investigated, and signs them out everywhere.
+func (a *Admin) LockUser(ctx context.Context, actorID, userID, reason string) error {
+	return a.changeStatus(ctx, actorID, userID, models.UserStatusLocked, reason)
+}
+
+// DeleteUser deletes the account for good. The user row is kept for the
+// audit trail and the email address stays taken.
+func (a *Admin) DeleteUser(ctx context.Context, actorID, userID, reason string) error {
+	return a.changeStatus(ctx, actorID, userID, models.UserStatusDeleted, reason)
+}
+
+// ForceLogout revokes every session, token and API key of the user.
+func (a *Admin) ForceLogout(ctx context.Context, actorID, userID string) error {
+	if err := a.require(ctx, actorID, models.PermissionUsersManage); err != nil {
+		return err
+	}
+
+	if _, err := a.getUser(ctx, userID); err != nil {
+		return err
+	}
+	if err := a.tokens.RevokeUserTokens(ctx, userID); err != nil {
+		return err
+	}
+
+	return a.record(ctx, models.AuditUserLoggedOut, actorID, userID, nil)
+}
+
+// SetPassword replaces the user's password and signs them out everywhere,
+// so that sessions and API keys created with the old password end.
+func (a *Admin) SetPassword(ctx context.Context, actorID, userID, password string) error {
+	if err := a.require(ctx, actorID, models.PermissionUsersManage); err != nil {
+		return err
+	}
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+
+	if err := a.requireNotDeleted(ctx, userID); err != nil {
+		return err
+	}
+	if err := a.requireOutranks(ctx, actorID, userID); err != nil {
+		return err
+	}
+	if _, err := a.auth.Update(ctx, models.SetPasswordRequest{UserID: userID, Password: password}); err != nil {
+		return err
+	}
+	if err := a.tokens.RevokeUserTokens(ctx, userID); err != nil {
+		return err
+	}
+
+	return a.record(ctx, models.AuditUserPasswordSet, actorID, userID, nil)
+}
+
+// changeStatus applies an administrative status change. Administrators
+// cannot change their own status, and every status but active ends the
+// user's sessions and revokes their API keys.
+func (a *Admin) changeStatus(ctx context.Context, actorID, userID, status, reason string) error {
+	if err := a.require(ctx, actorID, models.PermissionUsersManage); err != nil {
+		return err
+	}
+	if actorID == userID {
+		return fmt.Errorf("%w: you cannot change the status of your own account", models.ErrInvalidUserInput)
+	}
+
+	user, err := a.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := a.requireOutranks(ctx, actorID, userID); err != nil {
+		return err
+	}
+
+	if err := changeUserStatus(ctx, a.users, a.audit, user, status, strings.TrimSpace(reason), actorID); err != nil {
+		return err
+	}
+	if status == models.UserStatusActive {
+		return nil
+	}
+
+	return a.tokens.RevokeUserTokens(ctx, userID)
+}
+
+func (a *Admin) require(ctx context.Context, actorID, permission string) error {
+	allowed, err := a.rbac.CheckPermission(ctx, actorID, permission)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return models.ErrPermissionDenied
+	}
+
+	return nil
+}
+
+// requireOutranks checks that the actor holds every permission of the
+// user, so that administrators cannot take over or lock out accounts with
+// more privileges than their own.
+func (a *Admin) requireOutranks(ctx context.Context, actorID, userID string) error {
+	actor, err := a.rbac.Grants(ctx, actorID)
+	if err != nil {
+		return err
+	}
+	target, err := a.rbac.Grants(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, permission := range target.Permissions {
+		if !actor.Has(permission) {
+			return fmt.Errorf("%w: the user holds permissions you do not have", models.ErrPermissionDenied)
+		}
+	}
+
+	return nil
+}
+
+// getUser looks a user up by an ID from the request, which need not be a
+// valid UUID.
+func (a *Admin) getUser(ctx context.Context, userID string) (*models.User, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, models.ErrNotFound
+	}
+
+	return a.users.GetUser(ctx, userID)
+}
+
+// requireNotDeleted checks that the user exists and was not deleted, as
+// deleted accounts cannot be changed any more.
+func (a *Admin) requireNotDeleted(ctx context.Context, userID string) error {
+	user, err := a.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.Status == models.UserStatusDeleted {
+		return models.ErrAccountDeleted
+	}
+
+	return nil
+}
+
+func (a *Admin) record(ctx context.Context, eventType, actorID, userID string, metadata map[string]string) error {
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	metadata["actor_id"] = actorID
+
+	return a.audit.Record(ctx, &models.AuditEvent{
+		Type:     eventType,
+		UserID:   userID,
+		Outcome:  models.AuditOutcomeSuccess,
+		Metadata: metadata,
+	})
+}
+
+func validateEmail(email string) error {
+	if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+		return fmt.Errorf("%w: invalid email address", models.ErrInvalidUserInput)
+	}
+	return nil
+}
+
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("%w: the password must have at least %d characters", models.ErrInvalidUserInput, minPasswordLength)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"slices"
+	"testing"
+)
+
+// fakeUsers keeps users in memory.
+type fakeUsers struct {
+	ports.IUserRepo
+	users map[string]*models.User
+}
+
+func (f *fakeUsers) GetUser(_ context.Context, userID string) (*models.User, error) {
+	user, ok := f.users[userID]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+
+	return user, nil
+}
+
+func (f *fakeUsers) UpdateUser(_ context.Context, userID string, update models.UpdateUserRequest) error {
+	if update.Email != nil {
+		f.users[userID].Email = *update.Email
+	}
+
+	return nil
+}
+
+func (f *fakeUsers) ChangeUserStatus(_ context.Context, userID string, change models.StatusChange) error {
+	f.users[userID].Status = change.To
+	return nil
+}
+
+// fakeRBAC grants fixed permissions by user ID.
+type fakeRBAC struct {
+	ports.IRBACService
+	permissions map[string][]string
+}
+
+func (f *fakeRBAC) Grants(_ context.Context, userID string) (*models.Grants, error) {
+	return &models.Grants{Permissions: f.permissions[userID]}, nil
+}
+
+func (f *fakeRBAC) CheckPermission(_ context.Context, userID, permission string) (bool, error) {
+	return slices.Contains(f.permissions[userID], permission), nil
+}
+
+// fakeAudit records events in memory.
+type fakeAudit struct {
+	ports.IAuditRepo
+	events []*models.AuditEvent
+}
+
+func (f *fakeAudit) Record(_ context.Context, event *models.AuditEvent) error {
+	f.events = append(f.events, event)
+	return nil
+}
+
+// fakePasswords records password changes.
+type fakePasswords struct {
+	ports.IAuthService
+	changed []string
+}
+
+func (f *fakePasswords) Update(_ context.Context, entity ...interface{}) (interface{}, error) {
+	f.changed = append(f.changed, entity[0].(models.SetPasswordRequest).UserID)
+	return nil, nil
+}
+
+// fakeRevocations records users signed out everywhere.
+type fakeRevocations struct {
+	ports.IOAuthService
+	revoked []string
+}
+
+func (f *fakeRevocations) RevokeUserTokens(_ context.Context, userID string) error {
+	f.revoked = append(f.revoked, userID)
+	return nil
+}
+
+const (
+	adminID      = "00000000-0000-0000-0000-000000000001"
+	superAdminID = "00000000-0000-0000-0000-000000000002"
+	memberID     = "00000000-0000-0000-0000-000000000003"
+)
+
+func newTestAdmin() (*Admin, *fakePasswords, *fakeRevocations) {
+	users := &fakeUsers{users: map[string]*models.User{}}
+	for _, id := range []string{adminID, superAdminID, memberID} {
+		users.users[id] = &models.User{ID: id, Email: id + "@example.com", Status: models.UserStatusActive}
+	}
+
+	rbac := &fakeRBAC{permissions: map[string][]string{
+		adminID:      {models.PermissionUsersRead, models.PermissionUsersManage},
+		superAdminID: {models.PermissionUsersRead, models.PermissionUsersManage, models.PermissionRolesManage},
+		memberID:     {models.PermissionUsersRead},
+	}}
+	passwords := &fakePasswords{}
+	revocations := &fakeRevocations{}
+
+	return NewAdmin(users, passwords, revocations, rbac, &fakeAudit{}, &models.Options{}), passwords, revocations
+}
+
+func TestAdminRequiresOutranking(t *testing.T) {
+	email := "taken-over@example.com"
+
+	tests := []struct {
+		name string
+		call func(ctx context.Context, a *Admin, targetID string) error
+	}{
+		{name: "set password", call: func(ctx context.Context, a *Admin, targetID string) error {
+			return a.SetPassword(ctx, adminID, targetID, "new password")
+		}},
+		{name: "change email", call: func(ctx context.Context, a *Admin, targetID string) error {
+			_, err := a.UpdateUser(ctx, adminID, targetID, models.UpdateUserRequest{Email: &email})
+			return err
+		}},
+		{name: "disable", call: func(ctx context.Context, a *Admin, targetID string) error {
+			return a.DisableUser(ctx, adminID, targetID, "")
+		}},
+		{name: "lock", call: func(ctx context.Context, a *Admin, targetID string) error {
+			return a.LockUser(ctx, adminID, targetID, "")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _, _ := newTestAdmin()
+
+			if err := tt.call(context.Background(), a, superAdminID); !errors.Is(err, models.ErrPermissionDenied) {
+				t.Fatalf("acting on a user with more permissions: got %v, want ErrPermissionDenied", err)
+			}
+			if err := tt.call(context.Background(), a, memberID); err != nil {
+				t.Fatalf("acting on a user with fewer permissions: %v", err)
+			}
+		})
+	}
+}
+
+func TestAdminRenameDoesNotRequireOutranking(t *testing.T) {
+	a, _, _ := newTestAdmin()
+	name := "Renamed"
+
+	if _, err := a.UpdateUser(context.Background(), adminID, superAdminID, models.UpdateUserRequest{Name: &name}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAdminSetPasswordSignsOut(t *testing.T) {
+	a, passwords, revocations := newTestAdmin()
+
+	if err := a.SetPassword(context.Background(), adminID, memberID, "new password"); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(passwords.changed, []string{memberID}) || !slices.Equal(revocations.revoked, []string{memberID}) {
+		t.Fatalf("password changed for %v and tokens revoked for %v", passwords.changed, revocations.revoked)
+	}
+}
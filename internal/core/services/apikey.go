@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"strings"
+	"time"
+)
+
+// apiKeyDisplayLength is how much of a key, prefix included, is kept in
+// clear to identify it in listings.
+const apiKeyDisplayLength = len(models.APIKeyPrefix) + 6
+
+// APIKeys manages personal access tokens: long-lived credentials for CLI
+// tools and CI jobs. Keys are random strings; only their SHA-256 is stored.
+type APIKeys struct {
+	repo  ports.IAPIKeyRepo
+	rbac  ports.IRBACService
+	audit ports.IAuditRepo
+	opts  *models.Options
+}
+
+func NewAPIKeys(repo ports.IAPIKeyRepo, rbac ports.IRBACService, audit ports.IAuditRepo, opts *models.Options) *APIKeys {
+	return &APIKeys{repo: repo, rbac: rbac, audit: audit, opts: opts}
+}
+
+// CreateAPIKey creates a key and returns it together with its secret, which
+// is not retrievable afterwards. Scopes are permissions and may only name
+// permissions the user holds. A zero ttl creates a key that does not expire.
+func (a *APIKeys) CreateAPIKey(ctx context.Context, userID, name string, scopes []string, ttl time.Duration) (*models.APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return nil, "", fmt.Errorf("%w: a name of at most 100 characters is required", models.ErrInvalidAPIKeyInput)
+	}
+	if ttl < 0 {
+		return nil, "", fmt.Errorf("%w: expiry must be in the future", models.ErrInvalidAPIKeyInput)
+	}
+
+	grants, err := a.rbac.Grants(ctx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, scope := range scopes {
+		if !grants.Has(scope) {
+			return nil, "", fmt.Errorf("%w: scope %q is not granted to the user", models.ErrPermissionDenied, scope)
+		}
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	secret = models.APIKeyPrefix + secret
+
+	key := &models.APIKey{
+		UserID: userID,
+		Name:   name,
+		Prefix: secret[:apiKeyDisplayLength],
+		Scopes: scopes,
+	}
+	if key.Scopes == nil {
+		key.Scopes = []string{}
+	}
+	if ttl > 0 {
+		expiresAt := time.Now().Add(ttl)
+		key.ExpiresAt = &expiresAt
+	}
+
+	key.ID, err = a.repo.CreateAPIKey(ctx, key, hashToken(secret))
+	if err != nil {
+		return nil, "", err
+	}
+	key.CreateAt = time.Now()
+
+	return key, secret, a.record(ctx, models.AuditAPIKeyCreated, key)
+}
+
+func (a *APIKeys) ListAPIKeys(ctx context.Context, userID string) ([]models.APIKey, error) {
+	return a.repo.ListAPIKeys(ctx, userID)
+}
+
+func (a *APIKeys) RevokeAPIKey(ctx context.Context, userID, keyID string) error {
+	if err := a.repo.RevokeAPIKey(ctx, userID, keyID); err != nil {
+		return err
+	}
+
+	return a.record(ctx, models.AuditAPIKeyRevoked, &models.APIKey{ID: keyID, UserID: userID})
+}
+
+// Authenticate resolves an API key to its stored record. Unknown, revoked
+// and expired keys yield models.ErrInvalidAPIKey.
+func (a *APIKeys) Authenticate(ctx context.Context, key string) (*models.APIKey, error) {
+	if !strings.HasPrefix(key, models.APIKeyPrefix) {
+		return nil, models.ErrInvalidAPIKey
+	}
+
+	apiKey, err := a.repo.GetAPIKeyByHash(ctx, hashToken(key))
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, models.ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+	if !apiKey.Active() {
+		return nil, models.ErrInvalidAPIKey
+	}
+
+	if err := a.repo.TouchAPIKey(ctx, apiKey.ID); err != nil {
+		_ = a.opts.Logger.ErrorContext(ctx, "failed to record API key use", "key_id", apiKey.ID, "error", err)
+	}
+
+	return apiKey, nil
+}
+
+func (a *APIKeys) record(ctx context.Context, eventType string, key *models.APIKey) error {
+	metadata := map[string]string{"key_id": key.ID}
+	if key.Name != "" {
+		metadata["name"] = key.Name
+	}
+
+	return a.audit.Record(ctx, &models.AuditEvent{
+		Type:     eventType,
+		UserID:   key.UserID,
+		Outcome:  models.AuditOutcomeSuccess,
+		Metadata: metadata,
+	})
+}
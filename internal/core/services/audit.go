@@ -0,0 +1,298 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"github.com/google/uuid"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// auditWriteTimeout bounds a single batch write or retention purge.
+	auditWriteTimeout = 30 * time.Second
+
+	// auditMaxBackoff bounds the wait between attempts to write a batch,
+	// which doubles from the flush interval with every failure.
+	auditMaxBackoff = time.Minute
+
+	// auditWriteAttempts is how often a batch is tried before its events
+	// are dropped, so that one the database keeps rejecting does not stall
+	// the log for good.
+	auditWriteAttempts = 10
+)
+
+// AuditLog writes audit events in the background, in batches, purges
+// events older than the retention period and checkpoints the audit chains.
+// Written events are handed to the webhook subscriptions. Events that cannot
+// be queued are written by the caller, so a burst slows
+// requests down rather than losing events. Failed writes are retried with
+// a backoff, so that an outage of the database is not hammered.
+type AuditLog struct {
+	repo     ports.IAuditRepo
+	chain    ports.IAuditChainService
+	webhooks ports.IWebhookDispatcher
+	events   chan *models.AuditEvent
+	stop     chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.RWMutex
+	closed   bool
+	opts     *models.Options
+}
+
+func NewAuditLog(repo ports.IAuditRepo, chain ports.IAuditChainService, webhooks ports.IWebhookDispatcher, opts *models.Options) *AuditLog {
+	l := &AuditLog{
+		repo:     repo,
+		chain:    chain,
+		webhooks: webhooks,
+		events:   make(chan *models.AuditEvent, opts.Config.Audit.BufferSize),
+		stop:     make(chan struct{}),
+		opts:     opts,
+	}
+
+	l.wg.Add(2)
+	go l.write()
+	go l.purge()
+	if opts.Config.Audit.CheckpointInterval > 0 {
+		l.wg.Add(1)
+		go l.checkpoint()
+	}
+
+	return l
+}
+
+func (l *AuditLog) Log(ctx context.Context, event *models.AuditEvent) {
+	if event.CreateAt.IsZero() {
+		event.CreateAt = time.Now()
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if !l.closed {
+		select {
+		case l.events <- event:
+			return
+		default:
+		}
+	}
+
+	if err := l.repo.Record(ctx, event); err != nil {
+		_ = l.opts.Logger.ErrorContext(ctx, "failed to write audit event", "event_type", event.Type, "error", err)
+		return
+	}
+	l.dispatch(ctx, event)
+}
+
+// Close writes the queued events and stops the background work. Events
+// logged afterwards are written directly.
+func (l *AuditLog) Close(ctx context.Context) error {
+	l.mu.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.events)
+		close(l.stop)
+	}
+	l.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *AuditLog) write() {
+	defer l.wg.Done()
+
+	cfg := &l.opts.Config.Audit
+	ticker := time.NewTicker(cfg.FlushInterval)
+	defer ticker.Stop()
+
+	var (
+		batch    = make([]*models.AuditEvent, 0, cfg.BatchSize)
+		failures int
+		retryAt  time.Time
+	)
+	// flush writes the batch, unless a failed write is backing off and
+	// the log is not closing.
+	flush := func(closing bool) {
+		if len(batch) == 0 || (!closing && time.Now().Before(retryAt)) {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), auditWriteTimeout)
+		defer cancel()
+
+		if err := l.repo.RecordBatch(ctx, batch); err != nil {
+			failures++
+			if failures < auditWriteAttempts && !closing {
+				backoff := min(cfg.FlushInterval<<min(failures-1, 30), auditMaxBackoff)
+				retryAt = time.Now().Add(backoff)
+				_ = l.opts.Logger.Error("failed to write audit events, retrying", "count", len(batch), "attempts", failures, "backoff", backoff, "error", err)
+				return
+			}
+			_ = l.opts.Logger.Error("failed to write audit events, dropping them", "count", len(batch), "attempts", failures, "error", err)
+		} else {
+			l.dispatch(ctx, batch...)
+		}
+		batch, failures, retryAt = batch[:0], 0, time.Time{}
+	}
+
+	for {
+		// A backlog as large as the buffer is not added to while its
+		// write backs off. The queue fills up instead and callers write
+		// their events themselves, so memory stays bounded.
+		events := l.events
+		if len(batch) >= cfg.BufferSize {
+			events = nil
+		}
+
+		select {
+		case event, ok := <-events:
+			if !ok {
+				flush(true)
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= cfg.BatchSize {
+				flush(false)
+			}
+		case <-ticker.C:
+			flush(false)
+		case <-l.stop:
+			// Close closes the queue before stop, so this drains it.
+			for event := range l.events {
+				batch = append(batch, event)
+			}
+			flush(true)
+			return
+		}
+	}
+}
+
+// dispatch queues webhook deliveries for written events. A failure only
+// costs the notifications; the events themselves are stored.
+func (l *AuditLog) dispatch(ctx context.Context, events ...*models.AuditEvent) {
+	for _, event := range events {
+		webhookEvent, err := auditWebhookEvent(event)
+		if err == nil {
+			err = l.webhooks.Dispatch(ctx, webhookEvent)
+		}
+		if err != nil {
+			_ = l.opts.Logger.Error("failed to dispatch audit event to webhooks", "event_type", event.Type, "error", err)
+		}
+	}
+}
+
+func (l *AuditLog) purge() {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(l.opts.Config.Audit.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), auditWriteTimeout)
+			if _, err := l.chain.Purge(ctx, time.Now().Add(-l.opts.Config.Audit.Retention)); err != nil {
+				_ = l.opts.Logger.Error("failed to purge audit events", "error", err)
+			}
+			cancel()
+		}
+	}
+}
+
+func (l *AuditLog) checkpoint() {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(l.opts.Config.Audit.CheckpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), auditWriteTimeout)
+			if err := l.chain.Checkpoint(ctx); err != nil {
+				_ = l.opts.Logger.Error("failed to checkpoint audit chains", "error", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// Audit answers queries of the audit log. Users may read their own events;
+// reading anyone else's requires audit:read.
+type Audit struct {
+	repo ports.IAuditRepo
+	rbac ports.IRBACService
+	opts *models.Options
+}
+
+func NewAudit(repo ports.IAuditRepo, rbac ports.IRBACService, opts *models.Options) *Audit {
+	return &Audit{repo: repo, rbac: rbac, opts: opts}
+}
+
+// QueryEvents returns a page of events, newest first. Without a user filter
+// it returns the whole log to auditors and the actor's own events to
+// everyone else.
+func (a *Audit) QueryEvents(ctx context.Context, actorID string, filter models.AuditFilter) (*models.AuditPage, error) {
+	if filter.UserID != "" {
+		if _, err := uuid.Parse(filter.UserID); err != nil {
+			return nil, fmt.Errorf("%w: invalid user_id", models.ErrInvalidAuditFilter)
+		}
+	}
+	switch filter.Outcome {
+	case "", models.AuditOutcomeSuccess, models.AuditOutcomeFailure:
+	default:
+		return nil, fmt.Errorf("%w: unknown outcome %q", models.ErrInvalidAuditFilter, filter.Outcome)
+	}
+
+	if filter.UserID != actorID {
+		allowed, err := a.rbac.CheckPermission(ctx, actorID, models.PermissionAuditRead)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			if filter.UserID != "" {
+				return nil, models.ErrPermissionDenied
+			}
+			filter.UserID = actorID
+		}
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = models.DefaultAuditPageSize
+	}
+	filter.Limit = min(filter.Limit, models.MaxAuditPageSize)
+
+	// One event more than requested tells whether there is a next page.
+	limit := filter.Limit
+	filter.Limit++
+	events, err := a.repo.QueryAuditEvents(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.AuditPage{Events: events}
+	if len(events) > limit {
+		page.Events = events[:limit]
+		page.NextCursor = strconv.FormatInt(page.Events[limit-1].ID, 10)
+	}
+
+	return page, nil
+}
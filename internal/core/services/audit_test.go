@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/co1seam/ember-backend-auth/config"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"github.com/co1seam/ember-backend-auth/pkg/logger"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// failingAudit fails batch writes while down is set.
+type failingAudit struct {
+	ports.IAuditRepo
+	mu       sync.Mutex
+	down     bool
+	attempts int
+	written  int
+}
+
+func (f *failingAudit) RecordBatch(_ context.Context, events []*models.AuditEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.attempts++
+	if f.down {
+		return errors.New("database is down")
+	}
+	f.written += len(events)
+
+	return nil
+}
+
+func (f *failingAudit) setDown(down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down = down
+}
+
+// nopDispatcher drops webhook events.
+type nopDispatcher struct{}
+
+func (nopDispatcher) Dispatch(context.Context, *models.WebhookEvent) error {
+	return nil
+}
+
+func TestAuditLogBacksOff(t *testing.T) {
+	repo := &failingAudit{down: true}
+	cfg := &config.Config{}
+	cfg.Audit = config.Audit{BufferSize: 100, BatchSize: 1, FlushInterval: 10 * time.Millisecond, PurgeInterval: time.Hour}
+	l := NewAuditLog(repo, nil, nopDispatcher{}, &models.Options{
+		Config: cfg,
+		Logger: logger.New(context.Background(), logger.Options{Output: io.Discard}),
+	})
+
+	// Every event fills a batch, which would be written right away.
+	for i := 0; i < 20; i++ {
+		l.Log(context.Background(), &models.AuditEvent{Type: models.AuditSignIn})
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 200ms of retries doubling from 10ms make at most five attempts.
+	repo.mu.Lock()
+	attempts := repo.attempts
+	repo.mu.Unlock()
+	if attempts > 5 {
+		t.Fatalf("tried to write %d times while the database was down, want at most 5", attempts)
+	}
+
+	repo.setDown(false)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := l.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if repo.written != 20 {
+		t.Fatalf("wrote %d events, want all 20", repo.written)
+	}
+}
@@ -0,0 +1,391 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"github.com/golang-jwt/jwt/v5"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// auditChainPageSize is how many events are read at a time when
+	// verifying or exporting.
+	auditChainPageSize = 1000
+
+	auditCheckpointSubject = "audit-checkpoint"
+	auditWatermarkSubject  = "audit-purge-watermark"
+)
+
+// AuditChain signs checkpoints of the audit chains, verifies them and
+// exports the audit log.
+type AuditChain struct {
+	repo ports.IAuditRepo
+	keys *KeySet
+	opts *models.Options
+}
+
+func NewAuditChain(repo ports.IAuditRepo, keys *KeySet, opts *models.Options) *AuditChain {
+	return &AuditChain{repo: repo, keys: keys, opts: opts}
+}
+
+// Checkpoint signs the head of every chain that grew since its last
+// checkpoint.
+func (c *AuditChain) Checkpoint(ctx context.Context) error {
+	heads, err := c.repo.UncheckpointedChains(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, head := range heads {
+		signature, err := c.sign(auditCheckpointSubject, head.ChainID, head.LastSeq, head.LastHash)
+		if err != nil {
+			return err
+		}
+
+		err = c.repo.RecordCheckpoint(ctx, &models.AuditCheckpoint{
+			ChainID:   head.ChainID,
+			Seq:       head.LastSeq,
+			Hash:      head.LastHash,
+			Signature: signature,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Purge deletes the events created before the given time, as the retention
+// policy asks, and signs a watermark of how far every chain was purged. A
+// watermark only ever covers events that were deleted, and only when they
+// continue from the previous one: a chain whose purged range starts past its
+// watermark lost events some other way, and Verify has to report that
+// rather than a new watermark cover it up.
+func (c *AuditChain) Purge(ctx context.Context, before time.Time) (int64, error) {
+	ranges, err := c.repo.PurgeAuditEvents(ctx, before)
+
+	var purged int64
+	for _, r := range ranges {
+		purged += r.Events
+	}
+	if err != nil {
+		return purged, err
+	}
+
+	var errs []error
+	for _, r := range ranges {
+		var prevSeq int64
+		prev, err := c.repo.AuditPurgeWatermark(ctx, r.ChainID)
+		switch {
+		case err == nil:
+			prevSeq = prev.Seq
+		case !errors.Is(err, models.ErrNotFound):
+			return purged, err
+		}
+		if r.FirstSeq != prevSeq+1 {
+			errs = append(errs, fmt.Errorf("audit chain %q was purged from event %d, but its watermark is at %d", r.ChainID, r.FirstSeq, prevSeq))
+			continue
+		}
+
+		watermark := &models.AuditPurgeWatermark{ChainID: r.ChainID, Seq: r.LastSeq, Hash: r.LastHash}
+		watermark.Signature, err = c.sign(auditWatermarkSubject, watermark.ChainID, watermark.Seq, watermark.Hash)
+		if err != nil {
+			return purged, err
+		}
+		if err := c.repo.RecordPurgeWatermark(ctx, watermark); err != nil {
+			return purged, err
+		}
+	}
+
+	return purged, errors.Join(errs...)
+}
+
+// sign vouches for a chain up to the event at seq, whose hash is hash.
+func (c *AuditChain) sign(subject, chainID string, seq int64, hash string) (string, error) {
+	return c.keys.Sign(jwt.MapClaims{
+		"iss":      c.opts.Config.OAuth.Issuer,
+		"sub":      subject,
+		"chain_id": chainID,
+		"seq":      seq,
+		"hash":     hash,
+		"iat":      time.Now().Unix(),
+	})
+}
+
+func (c *AuditChain) VerifyAll(ctx context.Context) ([]models.AuditChainReport, error) {
+	heads, err := c.repo.AuditChains(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([]models.AuditChainReport, 0, len(heads))
+	for _, head := range heads {
+		report, err := c.verify(ctx, &head)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, *report)
+	}
+
+	return reports, nil
+}
+
+func (c *AuditChain) Verify(ctx context.Context, chainID string) (*models.AuditChainReport, error) {
+	head, err := c.repo.AuditChain(ctx, chainID)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.verify(ctx, head)
+}
+
+// verify walks the chain from its oldest event that was not purged. Every
+// event must hash to its stored hash and link to its predecessor, the last
+// one must be the chain head, and every checkpoint must be validly signed
+// and match the event at its position. The oldest event must follow the
+// signed purge watermark, so that the beginning of the chain was only
+// removed by the retention purge.
+func (c *AuditChain) verify(ctx context.Context, head *models.AuditChainHead) (*models.AuditChainReport, error) {
+	report := &models.AuditChainReport{ChainID: head.ChainID}
+
+	watermark, err := c.repo.AuditPurgeWatermark(ctx, head.ChainID)
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		return nil, err
+	}
+	var purgedHash string
+	if watermark != nil {
+		if err := c.verifySignature(watermark.Signature, auditWatermarkSubject, watermark.ChainID, watermark.Seq, watermark.Hash); err != nil {
+			report.Problem(watermark.Seq, models.AuditChainBadSignature, err.Error())
+		} else {
+			report.PurgedSeq, purgedHash = watermark.Seq, watermark.Hash
+		}
+	}
+
+	checkpoints, err := c.repo.AuditCheckpoints(ctx, head.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	report.Checkpoints = len(checkpoints)
+
+	signed := make(map[int64]string, len(checkpoints))
+	for _, checkpoint := range checkpoints {
+		if err := c.verifyCheckpoint(&checkpoint); err != nil {
+			report.Problem(checkpoint.Seq, models.AuditChainBadSignature, err.Error())
+			continue
+		}
+		signed[checkpoint.Seq] = checkpoint.Hash
+	}
+
+	var last *models.AuditEvent
+	for {
+		var after int64
+		if last != nil {
+			after = last.Seq
+		}
+
+		events, err := c.repo.ChainEvents(ctx, head.ChainID, after, auditChainPageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range events {
+			event := &events[i]
+			report.Events++
+
+			switch {
+			case last == nil:
+				report.FirstSeq = event.Seq
+				if event.Seq > report.PurgedSeq+1 {
+					report.Problem(event.Seq, models.AuditChainPurgeMismatch, fmt.Sprintf("events %d to %d are missing and were not purged", report.PurgedSeq+1, event.Seq-1))
+				} else if event.Seq == report.PurgedSeq+1 && report.PurgedSeq > 0 && event.PrevHash != purgedHash {
+					report.Problem(event.Seq, models.AuditChainPurgeMismatch, "the event does not link to the purge watermark")
+				}
+			case event.Seq != last.Seq+1:
+				report.Problem(event.Seq, models.AuditChainGap, fmt.Sprintf("events %d to %d are missing", last.Seq+1, event.Seq-1))
+			case event.PrevHash != last.Hash:
+				report.Problem(event.Seq, models.AuditChainLinkMismatch, "the event does not link to the preceding event")
+			}
+
+			if event.ChainHash() != event.Hash {
+				report.Problem(event.Seq, models.AuditChainHashMismatch, fmt.Sprintf("event %d was modified", event.ID))
+			}
+			if hash, ok := signed[event.Seq]; ok && hash != event.Hash {
+				report.Problem(event.Seq, models.AuditChainCheckpointMismatch, "the event differs from the signed checkpoint")
+			}
+
+			last = event
+		}
+
+		if len(events) < auditChainPageSize {
+			break
+		}
+	}
+
+	if last != nil {
+		report.LastSeq = last.Seq
+		if last.Seq != head.LastSeq || last.Hash != head.LastHash {
+			report.Problem(last.Seq, models.AuditChainHeadMismatch, fmt.Sprintf("the chain head is at %d, but the last event is %d", head.LastSeq, last.Seq))
+		}
+	} else if head.LastSeq > report.PurgedSeq {
+		report.Problem(head.LastSeq, models.AuditChainPurgeMismatch, fmt.Sprintf("events %d to %d are missing and were not purged", report.PurgedSeq+1, head.LastSeq))
+	}
+
+	// A checkpoint past the last event shows that events were removed from
+	// the end of the chain, even if the head was rewritten as well. Those of
+	// a chain purged entirely are covered by its watermark.
+	for _, checkpoint := range checkpoints {
+		if _, ok := signed[checkpoint.Seq]; ok && checkpoint.Seq > max(report.LastSeq, report.PurgedSeq) {
+			report.Problem(checkpoint.Seq, models.AuditChainCheckpointMismatch, fmt.Sprintf("the checkpoint at %d is past the last event", checkpoint.Seq))
+		}
+	}
+
+	return report, nil
+}
+
+func (c *AuditChain) verifyCheckpoint(checkpoint *models.AuditCheckpoint) error {
+	return c.verifySignature(checkpoint.Signature, auditCheckpointSubject, checkpoint.ChainID, checkpoint.Seq, checkpoint.Hash)
+}
+
+// verifySignature checks a signature made by sign.
+func (c *AuditChain) verifySignature(signature, subject, chainID string, seq int64, hash string) error {
+	claims, err := c.keys.Verify(signature)
+	if err != nil {
+		// Signatures made with a previous key cannot be verified, which
+		// happens when no signing key file is configured and the key is
+		// generated at every start.
+		if token, _, parseErr := jwt.NewParser().ParseUnverified(signature, jwt.MapClaims{}); parseErr == nil {
+			if kid, _ := token.Header["kid"].(string); kid != c.keys.kid {
+				return fmt.Errorf("signed with key %q, which is not the current signing key", kid)
+			}
+		}
+		return err
+	}
+
+	signedChainID, _ := claims["chain_id"].(string)
+	signedHash, _ := claims["hash"].(string)
+	signedSeq, _ := claims["seq"].(float64)
+	signedSubject, _ := claims["sub"].(string)
+	if signedSubject != subject || signedChainID != chainID || int64(signedSeq) != seq || signedHash != hash {
+		return errors.New("the signature was made for another position of the chain")
+	}
+
+	return nil
+}
+
+// Export writes the events selected by the filter, oldest first, as JSON
+// Lines or as CEF for a SIEM, and returns how many it wrote.
+func (c *AuditChain) Export(ctx context.Context, filter models.AuditFilter, format string, w io.Writer) (int, error) {
+	var write func(event *models.AuditEvent) error
+	switch format {
+	case models.AuditExportJSONLines:
+		encoder := json.NewEncoder(w)
+		write = func(event *models.AuditEvent) error {
+			return encoder.Encode(event)
+		}
+	case models.AuditExportCEF:
+		write = func(event *models.AuditEvent) error {
+			_, err := io.WriteString(w, cefRecord(event)+"\n")
+			return err
+		}
+	default:
+		return 0, fmt.Errorf("%w: %q", models.ErrUnknownExportFormat, format)
+	}
+
+	filter.Ascending, filter.BeforeID = true, 0
+	filter.Limit = auditChainPageSize
+
+	var count int
+	for {
+		events, err := c.repo.QueryAuditEvents(ctx, filter)
+		if err != nil {
+			return count, err
+		}
+
+		for i := range events {
+			if err := write(&events[i]); err != nil {
+				return count, err
+			}
+			count++
+		}
+
+		if len(events) < filter.Limit {
+			return count, nil
+		}
+		filter.AfterID = events[len(events)-1].ID
+	}
+}
+
+// cefRecord formats the event in ArcSight Common Event Format.
+func cefRecord(event *models.AuditEvent) string {
+	severity := "3"
+	if event.Outcome == models.AuditOutcomeFailure {
+		severity = "6"
+	}
+
+	header := []string{
+		"CEF:0",
+		"Ember",
+		"ember-backend-auth",
+		"1.0",
+		cefHeader(event.Type),
+		cefHeader(event.Type),
+		severity,
+	}
+
+	extension := []string{
+		"rt=" + strconv.FormatInt(event.CreateAt.UnixMilli(), 10),
+		"externalId=" + strconv.FormatInt(event.ID, 10),
+		"outcome=" + cefValue(event.Outcome),
+	}
+	add := func(key, value string) {
+		if value != "" {
+			extension = append(extension, key+"="+cefValue(value))
+		}
+	}
+	add("suid", event.UserID)
+	add("src", event.IP)
+	add("requestClientApplication", event.UserAgent)
+	add("reason", event.Reason)
+	if event.OrgID != "" {
+		add("cs1Label", "orgId")
+		add("cs1", event.OrgID)
+	}
+	if event.SessionID != "" {
+		add("cs2Label", "sessionId")
+		add("cs2", event.SessionID)
+	}
+	if event.Hash != "" {
+		add("cs3Label", "eventHash")
+		add("cs3", event.Hash)
+		add("cn1Label", "chainSeq")
+		add("cn1", strconv.FormatInt(event.Seq, 10))
+	}
+	if len(event.Metadata) > 0 {
+		metadata, _ := json.Marshal(event.Metadata)
+		add("cs4Label", "metadata")
+		add("cs4", string(metadata))
+	}
+
+	return strings.Join(header, "|") + "|" + strings.Join(extension, " ")
+}
+
+var (
+	cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	cefValueEscaper  = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+)
+
+func cefHeader(value string) string {
+	return cefHeaderEscaper.Replace(value)
+}
+
+func cefValue(value string) string {
+	return cefValueEscaper.Replace(value)
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"github.com/co1seam/ember-backend-auth/config"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"testing"
+	"time"
+)
+
+// fakeChain keeps one audit chain in memory.
+type fakeChain struct {
+	ports.IAuditRepo
+	events      []models.AuditEvent
+	head        models.AuditChainHead
+	checkpoints []models.AuditCheckpoint
+	watermark   *models.AuditPurgeWatermark
+	watermarks  int
+}
+
+func newFakeChain(n int) *fakeChain {
+	f := &fakeChain{}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 1; i <= n; i++ {
+		event := models.AuditEvent{ID: int64(i), Type: models.AuditSignIn, Outcome: models.AuditOutcomeSuccess,
+			Seq: int64(i), PrevHash: f.head.LastHash, CreateAt: start.Add(time.Duration(i) * time.Hour)}
+		event.Hash = event.ChainHash()
+		f.events = append(f.events, event)
+		f.head.LastSeq, f.head.LastHash = event.Seq, event.Hash
+	}
+
+	return f
+}
+
+func (f *fakeChain) PurgeAuditEvents(_ context.Context, before time.Time) ([]models.AuditPurgedRange, error) {
+	var r *models.AuditPurgedRange
+	for len(f.events) > 0 && f.events[0].CreateAt.Before(before) {
+		if r == nil {
+			r = &models.AuditPurgedRange{FirstSeq: f.events[0].Seq}
+		}
+		r.LastSeq, r.LastHash = f.events[0].Seq, f.events[0].Hash
+		r.Events++
+		f.events = f.events[1:]
+	}
+	if r == nil {
+		return nil, nil
+	}
+
+	return []models.AuditPurgedRange{*r}, nil
+}
+
+func (f *fakeChain) AuditChains(context.Context) ([]models.AuditChainHead, error) {
+	return []models.AuditChainHead{f.head}, nil
+}
+
+func (f *fakeChain) AuditChain(context.Context, string) (*models.AuditChainHead, error) {
+	return &f.head, nil
+}
+
+func (f *fakeChain) ChainEvents(_ context.Context, _ string, afterSeq int64, limit int) ([]models.AuditEvent, error) {
+	var events []models.AuditEvent
+	for _, event := range f.events {
+		if event.Seq > afterSeq && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+
+	return events, nil
+}
+
+func (f *fakeChain) AuditCheckpoints(context.Context, string) ([]models.AuditCheckpoint, error) {
+	return f.checkpoints, nil
+}
+
+func (f *fakeChain) RecordCheckpoint(_ context.Context, checkpoint *models.AuditCheckpoint) error {
+	f.checkpoints = append(f.checkpoints, *checkpoint)
+	return nil
+}
+
+func (f *fakeChain) UncheckpointedChains(context.Context) ([]models.AuditChainHead, error) {
+	return []models.AuditChainHead{f.head}, nil
+}
+
+func (f *fakeChain) RecordPurgeWatermark(_ context.Context, watermark *models.AuditPurgeWatermark) error {
+	f.watermarks++
+	if f.watermark == nil || f.watermark.Seq < watermark.Seq {
+		f.watermark = watermark
+	}
+	return nil
+}
+
+func (f *fakeChain) AuditPurgeWatermark(context.Context, string) (*models.AuditPurgeWatermark, error) {
+	if f.watermark == nil {
+		return nil, models.ErrNotFound
+	}
+	return f.watermark, nil
+}
+
+func newTestAuditChain(t *testing.T, repo *fakeChain) *AuditChain {
+	t.Helper()
+
+	keys, err := NewKeySet(&config.OIDC{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewAuditChain(repo, keys, &models.Options{Config: &config.Config{}})
+}
+
+func problemKinds(report *models.AuditChainReport) []string {
+	kinds := make([]string, 0, len(report.Problems))
+	for _, problem := range report.Problems {
+		kinds = append(kinds, problem.Kind)
+	}
+	return kinds
+}
+
+func TestAuditChainPurge(t *testing.T) {
+	repo := newFakeChain(10)
+	c := newTestAuditChain(t, repo)
+	ctx := context.Background()
+
+	// Events 1 to 4 are older than the retention.
+	purged, err := c.Purge(ctx, repo.events[4].CreateAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 4 || repo.watermark == nil || repo.watermark.Seq != 4 {
+		t.Fatalf("purged %d events with watermark %+v, want 4 up to event 4", purged, repo.watermark)
+	}
+
+	report, err := c.Verify(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid() || report.PurgedSeq != 4 || report.FirstSeq != 5 {
+		t.Fatalf("got %+v, want a valid chain purged up to 4", report)
+	}
+
+	// Nothing more is old enough, so the watermark is left alone.
+	if purged, err := c.Purge(ctx, repo.events[0].CreateAt); err != nil || purged != 0 || repo.watermarks != 1 {
+		t.Fatalf("purged %d events with %d watermarks written (%v), want nothing", purged, repo.watermarks, err)
+	}
+}
+
+func TestAuditChainPurgeGap(t *testing.T) {
+	repo := newFakeChain(10)
+	c := newTestAuditChain(t, repo)
+	ctx := context.Background()
+
+	if _, err := c.Purge(ctx, repo.events[2].CreateAt); err != nil {
+		t.Fatal(err)
+	}
+
+	// Events 3 and 4 disappear without a purge; the next purge must not
+	// sign over them.
+	repo.events = repo.events[2:]
+	if _, err := c.Purge(ctx, repo.events[2].CreateAt); err == nil {
+		t.Fatal("purged past a gap without an error")
+	}
+	if repo.watermark.Seq != 2 {
+		t.Fatalf("got watermark at %d, want it left at 2", repo.watermark.Seq)
+	}
+
+	report, err := c.Verify(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Valid() {
+		t.Fatalf("got a valid chain, want the missing events reported")
+	}
+}
+
+func TestAuditChainVerifyPurge(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(t *testing.T, repo *fakeChain, c *AuditChain)
+		wantOK bool
+	}{
+		{name: "never purged", setup: func(*testing.T, *fakeChain, *AuditChain) {}, wantOK: true},
+		{name: "beginning removed without a purge", setup: func(_ *testing.T, repo *fakeChain, _ *AuditChain) {
+			repo.events = repo.events[3:]
+		}},
+		{name: "more removed after a purge", setup: func(t *testing.T, repo *fakeChain, c *AuditChain) {
+			if _, err := c.Purge(context.Background(), repo.events[2].CreateAt); err != nil {
+				t.Fatal(err)
+			}
+			repo.events = repo.events[2:]
+		}},
+		{name: "forged watermark", setup: func(_ *testing.T, repo *fakeChain, _ *AuditChain) {
+			repo.events = repo.events[3:]
+			repo.watermark = &models.AuditPurgeWatermark{Seq: 3, Hash: repo.events[0].PrevHash, Signature: "forged"}
+		}},
+		{name: "purged entirely", setup: func(t *testing.T, repo *fakeChain, c *AuditChain) {
+			if err := c.Checkpoint(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.Purge(context.Background(), time.Now()); err != nil {
+				t.Fatal(err)
+			}
+		}, wantOK: true},
+		{name: "removed entirely without a purge", setup: func(_ *testing.T, repo *fakeChain, _ *AuditChain) {
+			repo.events = nil
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeChain(10)
+			c := newTestAuditChain(t, repo)
+			tt.setup(t, repo, c)
+
+			report, err := c.Verify(context.Background(), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Valid() != tt.wantOK {
+				t.Fatalf("got problems %v, want valid %v", problemKinds(report), tt.wantOK)
+			}
+		})
+	}
+}
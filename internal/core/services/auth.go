@@ -4,25 +4,31 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/sha1"
+	"errors"
 	"fmt"
+	"github.com/co1seam/ember-backend-auth/internal/adapters/metrics"
 	"github.com/co1seam/ember-backend-auth/internal/adapters/repository"
 	"github.com/co1seam/ember-backend-auth/internal/core/models"
 	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"github.com/go-redis/redis/v8"
 	"math/big"
-	"net/smtp"
 	"time"
 )
 
 const salt = "4d665e8dbe585764403bdc28bf9848ca"
 
 type Authorization struct {
-	repo  ports.IAuthRepo
-	cache *repository.Redis
-	opts  *models.Options
+	repo   ports.IAuthRepo
+	users  ports.IUserRepo
+	orgs   ports.IOrganizationService
+	audit  ports.IAuditRepo
+	cache  *repository.Redis
+	mailer ports.IMailer
+	opts   *models.Options
 }
 
-func NewAuthorization(repo ports.IAuthRepo, cache *repository.Redis, opts *models.Options) *Authorization {
-	return &Authorization{repo: repo, cache: cache, opts: opts}
+func NewAuthorization(repo ports.IAuthRepo, users ports.IUserRepo, orgs ports.IOrganizationService, audit ports.IAuditRepo, cache *repository.Redis, mailer ports.IMailer, opts *models.Options) *Authorization {
+	return &Authorization{repo: repo, users: users, orgs: orgs, audit: audit, cache: cache, mailer: mailer, opts: opts}
 }
 
 func (a *Authorization) Create(ctx context.Context, entity ...interface{}) (interface{}, error) {
@@ -41,23 +47,69 @@ func (a *Authorization) Read(ctx context.Context, entity ...interface{}) (interf
 		return nil, err
 	}
 
+	// The status is only revealed to someone who knows the password.
+	if err := a.CheckStatus(ctx, id.(string)); err != nil {
+		return nil, err
+	}
+
 	return id, nil
 }
 
 func (a *Authorization) Update(ctx context.Context, entity ...interface{}) (interface{}, error) {
-	return nil, nil
+	request := entity[0].(models.SetPasswordRequest)
+	request.Password = a.generateHash(request.Password)
+
+	return a.repo.Update(ctx, request)
 }
 
 func (a *Authorization) Delete(ctx context.Context, filter ...interface{}) (interface{}, error) {
 	return nil, nil
 }
 
+// CheckStatus returns the status error of the user, such as
+// models.ErrAccountLocked, or nil if they are active.
+func (a *Authorization) CheckStatus(ctx context.Context, userID string) error {
+	user, err := a.users.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return user.StatusError()
+}
+
+// VerifyOTP returns the email address the OTP was sent to. A pending account
+// with that address is activated, as its owner has now proven it, and joins
+// the organization that registered the domain of the address.
 func (a *Authorization) VerifyOTP(ctx context.Context, otp string) (string, error) {
 	key, err := a.cache.Redis.Get(ctx, otp).Result()
 	if err != nil {
+		// Redis forgets codes when they expire, so unknown codes are
+		// counted as expired too.
+		if errors.Is(err, redis.Nil) {
+			metrics.OTPs.WithLabelValues("expired").Inc()
+		}
 		return "", err
 	}
 
+	user, err := a.users.GetUserByEmail(ctx, key)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return key, nil
+		}
+		return "", err
+	}
+	if user.Status == models.UserStatusPending {
+		if err := a.users.VerifyEmail(ctx, user.ID); err != nil {
+			return "", err
+		}
+		if err := changeUserStatus(ctx, a.users, a.audit, user, models.UserStatusActive, "email verified", ""); err != nil {
+			return "", err
+		}
+		if _, err := a.orgs.AutoJoin(ctx, user.ID, key); err != nil {
+			return "", err
+		}
+	}
+
 	return key, nil
 }
 
@@ -66,25 +118,7 @@ func (a *Authorization) SendOTP(ctx context.Context, email string) error {
 	if err != nil {
 		return err
 	}
-	subject := "OTP"
-	body := fmt.Sprintf("Вы запросили одноразовый OTP код для регистрации.\nВаш OTP код: %s", otp)
-	to := []string{
-		email,
-	}
-
-	message := []byte(
-		fmt.Sprintf("From: %s\r\n"+
-			"To: %s\r\n"+
-			"Subject: %s\r\n"+
-			"\r\n"+
-			"%s\r\n",
-			a.opts.Config.SMTP.From,
-			email,
-			subject,
-			body),
-	)
-
-	if err := smtp.SendMail(a.opts.Config.SMTP.Host+":"+a.opts.Config.SMTP.Port, nil, a.opts.Config.SMTP.From, to, message); err != nil {
+	if err := a.mailer.SendTemplate(ctx, email, "otp", struct{ Code string }{otp}); err != nil {
 		return err
 	}
 
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"slices"
+	"testing"
+	"time"
+)
+
+func (f *fakeUsers) VerifyEmail(_ context.Context, userID string) error {
+	now := time.Now()
+	f.users[userID].EmailVerifiedAt = &now
+	return nil
+}
+
+func TestVerifyOTPActivatesAndJoins(t *testing.T) {
+	users := &fakeUsers{users: map[string]*models.User{
+		"new":    {ID: "new", Email: "new@corp.example.com", Status: models.UserStatusPending},
+		memberID: {ID: memberID, Email: "member@corp.example.com", Status: models.UserStatusActive},
+	}}
+	orgs := &fakeAutoJoin{}
+	o := newTestOAuth(&fakeRBAC{})
+	withTestRedis(t, o)
+	a := NewAuthorization(nil, users, orgs, &fakeAudit{}, o.cache, nil, o.opts)
+	ctx := context.Background()
+
+	for otp, email := range map[string]string{"111111": "new@corp.example.com", "222222": "member@corp.example.com", "333333": "unknown@corp.example.com"} {
+		if err := o.cache.Redis.Set(ctx, otp, email, time.Minute).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, otp := range []string{"111111", "222222", "333333"} {
+		if _, err := a.VerifyOTP(ctx, otp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the pending account whose address the OTP verified joins by
+	// domain.
+	if user := users.users["new"]; user.Status != models.UserStatusActive || user.EmailVerifiedAt == nil {
+		t.Fatalf("got %+v, want an active user with a verified email", user)
+	}
+	if !slices.Equal(orgs.joined, []string{"new"}) {
+		t.Fatalf("got users %v joined by domain, want the verified one", orgs.joined)
+	}
+}
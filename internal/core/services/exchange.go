@@ -0,0 +1,339 @@
+package services
+
+import (
+	"context"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/golang-jwt/jwt/v5"
+	"slices"
+	"strings"
+	"time"
+)
+
+// tokenExchange is a validated token exchange request: whom the new token is
+// for, who acts for them and what it may be used for.
+type tokenExchange struct {
+	subject       string
+	principalType string
+	orgID         string
+	actor         *models.Actor
+	scopes        []string
+	permissions   []string
+	audience      []string
+	reason        string
+	ttl           time.Duration
+}
+
+// exchangeToken implements the token exchange grant (RFC 8693). With a
+// subject_token it delegates: the new token is for the same subject, acted on
+// by the actor_token's subject or else the client, with narrowed audience
+// and scope. Without one it impersonates requested_subject on behalf of the
+// actor_token's subject, subject to the impersonation policy. Actor tokens
+// must have been issued to the client. Either way the token carries an act
+// claim, and every attempt is audited; a token is only
+// returned once its audit record is written.
+func (o *OAuth) exchangeToken(ctx context.Context, client *models.Client, req models.TokenRequest) (*models.TokenResponse, error) {
+	eventType := models.AuditTokenExchanged
+	if req.SubjectToken == "" {
+		eventType = models.AuditTokenImpersonated
+	}
+
+	exchange, err := o.validateExchange(ctx, client, req)
+	if err != nil {
+		failure := &tokenExchange{subject: req.RequestedSubject, reason: req.Reason, audience: req.Audience}
+		if auditErr := o.recordExchange(ctx, eventType, client, failure, err); auditErr != nil {
+			return nil, auditErr
+		}
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{
+		"sub":            exchange.subject,
+		"type":           "access",
+		"client_id":      client.ID,
+		"scope":          models.JoinScope(exchange.scopes),
+		"principal_type": exchange.principalType,
+		"act":            exchange.actor.Claim(),
+	}
+	claims["jti"], err = randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	if len(exchange.audience) > 0 {
+		claims["aud"] = exchange.audience
+	}
+	if exchange.orgID != "" {
+		claims["org_id"] = exchange.orgID
+	}
+	if exchange.permissions != nil {
+		claims["permissions"] = exchange.permissions
+	}
+
+	accessToken, err := CreateJWT(exchange.ttl, &o.opts.Config.Token, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := o.recordExchange(ctx, eventType, client, exchange, nil); err != nil {
+		return nil, err
+	}
+
+	return &models.TokenResponse{
+		AccessToken:     accessToken,
+		IssuedTokenType: models.TokenTypeURNAccessToken,
+		TokenType:       models.TokenTypeBearer,
+		ExpiresIn:       int64(exchange.ttl.Seconds()),
+		Scope:           models.JoinScope(exchange.scopes),
+	}, nil
+}
+
+func (o *OAuth) validateExchange(ctx context.Context, client *models.Client, req models.TokenRequest) (*tokenExchange, error) {
+	if !client.IsConfidential() {
+		return nil, models.NewOAuthError("unauthorized_client", "public clients cannot exchange tokens")
+	}
+	if req.RequestedTokenType != "" && req.RequestedTokenType != models.TokenTypeURNAccessToken {
+		return nil, models.NewOAuthError("invalid_request", "only access tokens can be requested")
+	}
+
+	for _, audience := range req.Audience {
+		if !slices.Contains(o.opts.Config.TokenExchange.Audiences, audience) {
+			return nil, models.NewOAuthError("invalid_target", "unknown audience "+audience)
+		}
+	}
+
+	var (
+		exchange *tokenExchange
+		err      error
+	)
+	if req.SubjectToken != "" {
+		exchange, err = o.delegate(ctx, client, req)
+	} else {
+		exchange, err = o.impersonate(ctx, client, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	requested := models.ParseScope(req.Scope)
+	if len(requested) == 0 {
+		requested = exchange.scopes
+	}
+	for _, scope := range requested {
+		if !slices.Contains(exchange.scopes, scope) {
+			return nil, models.NewOAuthError("invalid_scope", "requested scope exceeds the subject token")
+		}
+	}
+	exchange.scopes = requested
+
+	if exchange.permissions != nil {
+		permissions := []string{}
+		for _, permission := range exchange.permissions {
+			if slices.Contains(requested, permission) {
+				permissions = append(permissions, permission)
+			}
+		}
+		exchange.permissions = permissions
+	}
+
+	return exchange, nil
+}
+
+func (o *OAuth) delegate(ctx context.Context, client *models.Client, req models.TokenRequest) (*tokenExchange, error) {
+	subject, subjectClaims, err := o.exchangeInput(ctx, req.SubjectToken, req.SubjectTokenType, "subject_token")
+	if err != nil {
+		return nil, err
+	}
+
+	exchange := &tokenExchange{
+		subject:       subject.Subject,
+		principalType: subject.PrincipalType,
+		orgID:         subject.OrgID,
+		actor:         &models.Actor{Subject: client.ID, Actor: models.ParseActor(subjectClaims["act"])},
+		audience:      req.Audience,
+		reason:        req.Reason,
+		ttl:           min(o.opts.Config.Token.AccessTokenTTL, time.Until(time.Unix(subject.ExpiresAt, 0))),
+	}
+
+	if len(subject.Audience) > 0 {
+		for _, audience := range req.Audience {
+			if !slices.Contains(subject.Audience, audience) {
+				return nil, models.NewOAuthError("invalid_target", "audience exceeds the subject token")
+			}
+		}
+	}
+
+	// First-party tokens carry permissions rather than an OAuth scope; those
+	// permissions are what an exchanged token may be narrowed to.
+	exchange.scopes = models.ParseScope(subject.Scope)
+	if permissions, ok := stringsClaim(subjectClaims["permissions"]); ok {
+		exchange.permissions = permissions
+		if len(exchange.scopes) == 0 {
+			exchange.scopes = permissions
+		}
+	}
+
+	if req.ActorToken != "" {
+		actor, _, err := o.exchangeInput(ctx, req.ActorToken, req.ActorTokenType, "actor_token")
+		if err != nil {
+			return nil, err
+		}
+		if err := requireActorClient(client, actor); err != nil {
+			return nil, err
+		}
+		exchange.actor.Subject = actor.Subject
+	}
+
+	return exchange, nil
+}
+
+func (o *OAuth) impersonate(ctx context.Context, client *models.Client, req models.TokenRequest) (*tokenExchange, error) {
+	if req.RequestedSubject == "" || req.ActorToken == "" {
+		return nil, models.NewOAuthError("invalid_request", "subject_token, or actor_token and requested_subject, are required")
+	}
+	if strings.TrimSpace(req.Reason) == "" {
+		return nil, models.NewOAuthError("invalid_request", "impersonation requires a reason")
+	}
+
+	actor, actorClaims, err := o.exchangeInput(ctx, req.ActorToken, req.ActorTokenType, "actor_token")
+	if err != nil {
+		return nil, err
+	}
+	if actor.PrincipalType != models.PrincipalTypeUser || actorClaims["act"] != nil {
+		return nil, models.NewOAuthError("invalid_grant", "only users acting for themselves may impersonate")
+	}
+	if err := requireActorClient(client, actor); err != nil {
+		return nil, err
+	}
+
+	permissions, err := o.authorizeImpersonation(ctx, actor.Subject, req.RequestedSubject)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenExchange{
+		subject:       req.RequestedSubject,
+		principalType: models.PrincipalTypeUser,
+		actor:         &models.Actor{Subject: actor.Subject},
+		scopes:        permissions,
+		permissions:   permissions,
+		audience:      req.Audience,
+		reason:        req.Reason,
+		ttl:           o.opts.Config.TokenExchange.ImpersonationTTL,
+	}, nil
+}
+
+// authorizeImpersonation is the impersonation policy: the actor needs the
+// users:impersonate permission, and may only impersonate users whose
+// permissions they hold themselves, so impersonation never escalates
+// privileges. It returns the target's permissions.
+func (o *OAuth) authorizeImpersonation(ctx context.Context, actorID, targetID string) ([]string, error) {
+	denied := models.NewOAuthError("invalid_grant", "impersonation is not permitted")
+
+	if actorID == targetID {
+		return nil, denied
+	}
+
+	actor, err := o.rbac.Grants(ctx, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if !actor.Has(models.PermissionUsersImpersonate) {
+		return nil, denied
+	}
+
+	if err := o.requireActive(ctx, targetID); err != nil {
+		return nil, err
+	}
+
+	target, err := o.rbac.Grants(ctx, targetID)
+	if err != nil {
+		return nil, err
+	}
+	for _, permission := range target.Permissions {
+		if !actor.Has(permission) {
+			return nil, denied
+		}
+	}
+
+	return target.Permissions, nil
+}
+
+// requireActorClient rejects actor tokens that were not issued to the client
+// authenticating the exchange, so that a client cannot act as whoever's
+// token it got hold of. First-party tokens belong to no client and cannot
+// be actor tokens; an impersonating administrator signs in to the client
+// first.
+func requireActorClient(client *models.Client, actor *models.Introspection) error {
+	if actor.ClientID != client.ID {
+		return models.NewOAuthError("invalid_grant", "actor_token was issued to another client")
+	}
+
+	return nil
+}
+
+// exchangeInput validates a subject or actor token: an active access token
+// issued by this server.
+func (o *OAuth) exchangeInput(ctx context.Context, token, tokenType, name string) (*models.Introspection, jwt.MapClaims, error) {
+	if tokenType != models.TokenTypeURNAccessToken {
+		return nil, nil, models.NewOAuthError("invalid_request", name+"_type must be "+models.TokenTypeURNAccessToken)
+	}
+
+	introspection, err := o.InspectToken(ctx, token, models.TokenTypeAccessToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !introspection.Active || introspection.TokenType != models.TokenTypeAccessToken || introspection.Subject == "" {
+		return nil, nil, models.NewOAuthError("invalid_grant", name+" is invalid")
+	}
+
+	claims, err := VerifyJWT(token, &o.opts.Config.Token)
+	if err != nil {
+		return nil, nil, models.NewOAuthError("invalid_grant", name+" is invalid")
+	}
+
+	return introspection, claims, nil
+}
+
+func (o *OAuth) recordExchange(ctx context.Context, eventType string, client *models.Client, exchange *tokenExchange, failure error) error {
+	event := &models.AuditEvent{
+		Type:    eventType,
+		Outcome: models.AuditOutcomeSuccess,
+		Metadata: map[string]string{
+			"client_id": client.ID,
+			"subject":   exchange.subject,
+			"audience":  strings.Join(exchange.audience, " "),
+			"scope":     models.JoinScope(exchange.scopes),
+		},
+	}
+	// Only users have rows the audit log can point to; service accounts are
+	// named in the metadata.
+	if exchange.principalType == models.PrincipalTypeUser {
+		event.UserID = exchange.subject
+	}
+	if exchange.actor != nil {
+		event.Metadata["actor"] = exchange.actor.Subject
+	}
+	if exchange.reason != "" {
+		event.Metadata["reason"] = exchange.reason
+	}
+	if failure != nil {
+		event.Outcome = models.AuditOutcomeFailure
+		event.Metadata["error"] = failure.Error()
+	}
+
+	return o.audit.Record(ctx, event)
+}
+
+func stringsClaim(claim interface{}) ([]string, bool) {
+	values, ok := claim.([]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result, true
+}
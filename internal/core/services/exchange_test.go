@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newTestExchange returns an OAuth server with confidential clients "client"
+// and "other" that may exchange tokens, and a public client "app".
+func newTestExchange(t *testing.T) (*OAuth, *fakeAudit) {
+	t.Helper()
+
+	o := newTestOAuth(&fakeRBAC{permissions: map[string][]string{
+		adminID:  {models.PermissionUsersImpersonate, models.PermissionUsersRead, models.PermissionUsersManage},
+		memberID: {models.PermissionUsersRead},
+		"owner":  {models.PermissionRolesManage},
+	}})
+	o.opts.Config.TokenExchange.Audiences = []string{"https://api.example.com"}
+	o.opts.Config.TokenExchange.ImpersonationTTL = 15 * time.Minute
+
+	audit := &fakeAudit{}
+	o.audit = audit
+	o.users = &fakeUsers{users: map[string]*models.User{
+		adminID:  {ID: adminID, Status: models.UserStatusActive},
+		memberID: {ID: memberID, Status: models.UserStatusActive},
+		"owner":  {ID: "owner", Status: models.UserStatusActive},
+	}}
+	confidential := func(id string) *models.Client {
+		return &models.Client{ID: id, Type: models.ClientTypeConfidential, SecretHash: hashToken("secret"), GrantTypes: []string{models.GrantTypeTokenExchange}}
+	}
+	o.repo = &fakeClients{clients: map[string]*models.Client{
+		"client": confidential("client"),
+		"other":  confidential("other"),
+		"app":    {ID: "app", Type: models.ClientTypePublic, GrantTypes: []string{models.GrantTypeTokenExchange}},
+	}}
+	withTestRedis(t, o)
+
+	return o, audit
+}
+
+func exchangeTestToken(t *testing.T, o *OAuth, subject, clientID, scope string) string {
+	t.Helper()
+
+	token, err := o.createAccessToken(context.Background(), subject, clientID, scope, "", models.PrincipalTypeUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+func TestTokenExchangeDelegation(t *testing.T) {
+	o, audit := newTestExchange(t)
+	ctx := context.Background()
+
+	subject := exchangeTestToken(t, o, memberID, "client", "profile "+models.PermissionUsersRead)
+	actor := exchangeTestToken(t, o, adminID, "client", "profile")
+	foreignActor := exchangeTestToken(t, o, adminID, "other", "profile")
+	revoked := exchangeTestToken(t, o, memberID, "client", "profile")
+	claims, err := VerifyJWT(revoked, &o.opts.Config.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.revokeJWT(ctx, claims); err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(modify func(req *models.TokenRequest)) models.TokenRequest {
+		req := models.TokenRequest{
+			GrantType:        models.GrantTypeTokenExchange,
+			ClientID:         "client",
+			ClientSecret:     "secret",
+			SubjectToken:     subject,
+			SubjectTokenType: models.TokenTypeURNAccessToken,
+		}
+		if modify != nil {
+			modify(&req)
+		}
+
+		return req
+	}
+
+	tests := []struct {
+		name        string
+		req         models.TokenRequest
+		code        string
+		scope       string
+		actor       string
+		permissions []string
+	}{
+		{name: "scope of the subject token", req: request(nil), scope: "profile " + models.PermissionUsersRead, actor: "client", permissions: []string{models.PermissionUsersRead}},
+		{name: "narrowed scope", req: request(func(req *models.TokenRequest) { req.Scope = "profile" }), scope: "profile", actor: "client", permissions: []string{}},
+		{name: "audience", req: request(func(req *models.TokenRequest) { req.Audience = []string{"https://api.example.com"} }), scope: "profile " + models.PermissionUsersRead, actor: "client", permissions: []string{models.PermissionUsersRead}},
+		{name: "actor token", req: request(func(req *models.TokenRequest) {
+			req.ActorToken, req.ActorTokenType = actor, models.TokenTypeURNAccessToken
+		}), scope: "profile " + models.PermissionUsersRead, actor: adminID, permissions: []string{models.PermissionUsersRead}},
+		{name: "scope beyond the subject token", req: request(func(req *models.TokenRequest) { req.Scope = models.PermissionUsersManage }), code: "invalid_scope"},
+		{name: "unknown audience", req: request(func(req *models.TokenRequest) { req.Audience = []string{"https://evil.example.com"} }), code: "invalid_target"},
+		{name: "revoked subject token", req: request(func(req *models.TokenRequest) { req.SubjectToken = revoked }), code: "invalid_grant"},
+		{name: "wrong subject token type", req: request(func(req *models.TokenRequest) { req.SubjectTokenType = models.TokenTypeRefreshToken }), code: "invalid_request"},
+		{name: "actor token of another client", req: request(func(req *models.TokenRequest) {
+			req.ActorToken, req.ActorTokenType = foreignActor, models.TokenTypeURNAccessToken
+		}), code: "invalid_grant"},
+		{name: "public client", req: request(func(req *models.TokenRequest) { req.ClientID, req.ClientSecret = "app", "" }), code: "unauthorized_client"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			audit.events = nil
+
+			response, err := o.Token(ctx, tt.req)
+			if oauthErrorCode(err) != tt.code {
+				t.Fatalf("got %v, want %q", err, tt.code)
+			}
+
+			// Every attempt is audited, refused ones too.
+			want := models.AuditOutcomeSuccess
+			if err != nil {
+				want = models.AuditOutcomeFailure
+			}
+			if len(audit.events) != 1 || audit.events[0].Type != models.AuditTokenExchanged || audit.events[0].Outcome != want {
+				t.Fatalf("got audit events %+v, want one exchange with outcome %s", audit.events, want)
+			}
+			if err != nil {
+				return
+			}
+
+			claims, err := VerifyJWT(response.AccessToken, &o.opts.Config.Token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			act, _ := claims["act"].(map[string]interface{})
+			permissions, _ := stringsClaim(claims["permissions"])
+			if claims["sub"] != memberID || claims["scope"] != tt.scope || act["sub"] != tt.actor || !slices.Equal(permissions, tt.permissions) {
+				t.Fatalf("got claims %v, want the member with scope %q acted on by %s", claims, tt.scope, tt.actor)
+			}
+			if response.IssuedTokenType != models.TokenTypeURNAccessToken {
+				t.Fatalf("got issued token type %q", response.IssuedTokenType)
+			}
+		})
+	}
+}
+
+func TestTokenExchangeImpersonation(t *testing.T) {
+	o, audit := newTestExchange(t)
+	ctx := context.Background()
+
+	admin := exchangeTestToken(t, o, adminID, "client", "profile")
+	member := exchangeTestToken(t, o, memberID, "client", "profile")
+	foreignAdmin := exchangeTestToken(t, o, adminID, "other", "profile")
+
+	request := func(actor, subject, reason string) models.TokenRequest {
+		return models.TokenRequest{
+			GrantType:        models.GrantTypeTokenExchange,
+			ClientID:         "client",
+			ClientSecret:     "secret",
+			ActorToken:       actor,
+			ActorTokenType:   models.TokenTypeURNAccessToken,
+			RequestedSubject: subject,
+			Reason:           reason,
+		}
+	}
+
+	tests := []struct {
+		name string
+		req  models.TokenRequest
+		code string
+	}{
+		{name: "impersonation", req: request(admin, memberID, "support ticket 42")},
+		{name: "without reason", req: request(admin, memberID, " "), code: "invalid_request"},
+		{name: "without users:impersonate", req: request(member, adminID, "support ticket 42"), code: "invalid_grant"},
+		{name: "user with permissions the actor lacks", req: request(admin, "owner", "support ticket 42"), code: "invalid_grant"},
+		{name: "self", req: request(admin, adminID, "support ticket 42"), code: "invalid_grant"},
+		{name: "unknown user", req: request(admin, "unknown", "support ticket 42"), code: "invalid_grant"},
+		{name: "actor token of another client", req: request(foreignAdmin, memberID, "support ticket 42"), code: "invalid_grant"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			audit.events = nil
+
+			response, err := o.Token(ctx, tt.req)
+			if oauthErrorCode(err) != tt.code {
+				t.Fatalf("got %v, want %q", err, tt.code)
+			}
+			if len(audit.events) != 1 || audit.events[0].Type != models.AuditTokenImpersonated {
+				t.Fatalf("got audit events %+v, want one impersonation", audit.events)
+			}
+			if err != nil {
+				if audit.events[0].Outcome != models.AuditOutcomeFailure {
+					t.Fatalf("a refused impersonation was audited as %s", audit.events[0].Outcome)
+				}
+				return
+			}
+
+			event := audit.events[0]
+			if event.Outcome != models.AuditOutcomeSuccess || event.UserID != memberID || event.Metadata["actor"] != adminID || event.Metadata["reason"] != tt.req.Reason {
+				t.Fatalf("got audit event %+v, want the admin impersonating the member", event)
+			}
+
+			claims, err := VerifyJWT(response.AccessToken, &o.opts.Config.Token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			act, _ := claims["act"].(map[string]interface{})
+			permissions, _ := stringsClaim(claims["permissions"])
+			if claims["sub"] != memberID || act["sub"] != adminID || !slices.Equal(permissions, []string{models.PermissionUsersRead}) {
+				t.Fatalf("got claims %v, want the member with their permissions, acted on by the admin", claims)
+			}
+			if response.ExpiresIn != int64(o.opts.Config.TokenExchange.ImpersonationTTL.Seconds()) {
+				t.Fatalf("expires in %ds, want the impersonation TTL", response.ExpiresIn)
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/internal/adapters/repository"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"github.com/go-redis/redis/v8"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	federationStatePrefix = "federation:state:"
+	federationLinkPrefix  = "federation:link:"
+	federationStateTTL    = 10 * time.Minute
+)
+
+type Federation struct {
+	providers  map[string]ports.IIdentityProvider
+	identities ports.IIdentityRepo
+	users      ports.IUserRepo
+	orgs       ports.IOrganizationService
+	cache      *repository.Redis
+	notifier   *securityNotifier
+	opts       *models.Options
+}
+
+func NewFederation(providers map[string]ports.IIdentityProvider, identities ports.IIdentityRepo, users ports.IUserRepo, orgs ports.IOrganizationService, cache *repository.Redis, notifier *securityNotifier, opts *models.Options) *Federation {
+	return &Federation{providers: providers, identities: identities, users: users, orgs: orgs, cache: cache, notifier: notifier, opts: opts}
+}
+
+func (f *Federation) Providers() []string {
+	names := make([]string, 0, len(f.providers))
+	for name := range f.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Begin starts a login with an upstream provider and returns the URL the user
+// agent has to be sent to, and a binding the caller keeps in a pre-auth
+// cookie of that user agent. State, nonce, the PKCE verifier and the hash of
+// the binding are kept in Redis until the provider redirects back, so that a
+// callback only completes in the browser that started the login. When
+// linkUserID is set the identity is linked to that user instead of signing
+// in.
+func (f *Federation) Begin(ctx context.Context, provider, returnTo, linkUserID string) (string, string, error) {
+	p, ok := f.providers[provider]
+	if !ok {
+		return "", "", models.ErrNotFound
+	}
+
+	state, err := randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomToken(48)
+	if err != nil {
+		return "", "", err
+	}
+	binding, err := randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	payload, err := json.Marshal(models.FederationState{
+		Provider:     provider,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ReturnTo:     safeReturnTo(returnTo),
+		LinkUserID:   linkUserID,
+		BindingHash:  hashToken(binding),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := f.cache.Redis.Set(ctx, federationStatePrefix+state, payload, federationStateTTL).Err(); err != nil {
+		return "", "", err
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+
+	target, err := p.AuthCodeURL(ctx, state, nonce, base64.RawURLEncoding.EncodeToString(sum[:]))
+	if err != nil {
+		return "", "", err
+	}
+
+	return target, binding, nil
+}
+
+// BeginLink records a link of an identity to userID and returns the local URL
+// that continues it. Links are requested over gRPC, where no cookie can be
+// set, so the user agent has to pass through ContinueLink first.
+func (f *Federation) BeginLink(ctx context.Context, provider, returnTo, userID string) (string, error) {
+	if _, ok := f.providers[provider]; !ok {
+		return "", models.ErrNotFound
+	}
+
+	ticket, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(models.FederationLinkTicket{Provider: provider, ReturnTo: returnTo, UserID: userID})
+	if err != nil {
+		return "", err
+	}
+	if err := f.cache.Redis.Set(ctx, federationLinkPrefix+ticket, payload, federationStateTTL).Err(); err != nil {
+		return "", err
+	}
+
+	query := url.Values{"ticket": {ticket}}
+	return strings.TrimSuffix(f.opts.Config.OAuth.Issuer, "/") + "/federation/" + url.PathEscape(provider) + "/link?" + query.Encode(), nil
+}
+
+// ContinueLink redeems a link ticket in the user agent of the user it was
+// issued to, signed in there as userID, and begins the login with the
+// provider. Otherwise a link started by one user could be completed in the
+// browser of another, linking the identity of the victim to the account of
+// the attacker.
+func (f *Federation) ContinueLink(ctx context.Context, provider, ticket, userID string) (string, string, error) {
+	payload, err := f.cache.Redis.GetDel(ctx, federationLinkPrefix+ticket).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", "", models.ErrUnauthorized
+		}
+		return "", "", err
+	}
+
+	var saved models.FederationLinkTicket
+	if err := json.Unmarshal(payload, &saved); err != nil {
+		return "", "", err
+	}
+	if saved.Provider != provider || userID == "" || saved.UserID != userID {
+		return "", "", models.ErrUnauthorized
+	}
+
+	return f.Begin(ctx, provider, saved.ReturnTo, saved.UserID)
+}
+
+// Complete finishes a login when the provider redirects back. binding is the
+// pre-auth cookie of the user agent, which must be the one Begin gave out.
+func (f *Federation) Complete(ctx context.Context, provider, code, state, binding string) (*models.FederatedLogin, error) {
+	p, ok := f.providers[provider]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+
+	payload, err := f.cache.Redis.GetDel(ctx, federationStatePrefix+state).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, models.ErrUnauthorized
+		}
+		return nil, err
+	}
+
+	var saved models.FederationState
+	if err := json.Unmarshal(payload, &saved); err != nil {
+		return nil, err
+	}
+	if saved.Provider != provider {
+		return nil, models.ErrUnauthorized
+	}
+	if binding == "" || subtle.ConstantTimeCompare([]byte(hashToken(binding)), []byte(saved.BindingHash)) != 1 {
+		return nil, models.ErrUnauthorized
+	}
+
+	identity, err := p.Exchange(ctx, code, saved.CodeVerifier, saved.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	if saved.LinkUserID != "" {
+		if err := f.link(ctx, saved.LinkUserID, identity); err != nil {
+			return nil, err
+		}
+		return &models.FederatedLogin{UserID: saved.LinkUserID, ReturnTo: saved.ReturnTo, Linked: true}, nil
+	}
+
+	userID, err := f.resolve(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := f.users.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := user.StatusError(); err != nil {
+		return nil, err
+	}
+
+	return &models.FederatedLogin{UserID: userID, ReturnTo: saved.ReturnTo, AuthTime: time.Now()}, nil
+}
+
+// resolve maps an external identity to a local user. Known identities sign in
+// directly; otherwise an account with the same email is linked only when both
+// the provider and the account verified that email, and a new account is
+// created when there is none. An unverified account may have been registered
+// by someone else, whose password would then open the merged account; its
+// owner has to sign in and link the identity instead.
+func (f *Federation) resolve(ctx context.Context, identity *models.ExternalIdentity) (string, error) {
+	linked, err := f.identities.GetIdentity(ctx, identity.Provider, identity.Subject)
+	if err == nil {
+		if err := f.identities.TouchIdentity(ctx, identity.Provider, identity.Subject); err != nil {
+			return "", err
+		}
+		return linked.UserID, nil
+	}
+	if !errors.Is(err, models.ErrNotFound) {
+		return "", err
+	}
+
+	if identity.Email == "" {
+		return "", fmt.Errorf("%s did not return an email address", identity.Provider)
+	}
+
+	link := &models.LinkedIdentity{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}
+
+	user, err := f.users.GetUserByEmail(ctx, identity.Email)
+	if err == nil {
+		if !identity.EmailVerified || user.EmailVerifiedAt == nil {
+			return "", models.ErrIdentityConflict
+		}
+
+		link.UserID = user.ID
+		if err := f.identities.CreateIdentity(ctx, link); err != nil {
+			return "", err
+		}
+		return user.ID, nil
+	}
+	if !errors.Is(err, models.ErrNotFound) {
+		return "", err
+	}
+
+	userID, err := f.identities.CreateUserWithIdentity(ctx, &models.User{Name: identity.Name, Email: identity.Email}, link)
+	if err != nil {
+		return "", err
+	}
+
+	if identity.EmailVerified {
+		if _, err := f.orgs.AutoJoin(ctx, userID, identity.Email); err != nil {
+			return "", err
+		}
+	}
+
+	return userID, nil
+}
+
+func (f *Federation) link(ctx context.Context, userID string, identity *models.ExternalIdentity) error {
+	linked, err := f.identities.GetIdentity(ctx, identity.Provider, identity.Subject)
+	if err == nil {
+		if linked.UserID != userID {
+			return models.ErrIdentityConflict
+		}
+		return nil
+	}
+	if !errors.Is(err, models.ErrNotFound) {
+		return err
+	}
+
+	if err := f.identities.CreateIdentity(ctx, &models.LinkedIdentity{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		UserID:   userID,
+		Email:    identity.Email,
+	}); err != nil {
+		return err
+	}
+
+	return f.notifier.identityChanged(ctx, models.AuditIdentityLinked, userID, identity.Provider)
+}
+
+// safeReturnTo only allows local paths so the login cannot be used as an open
+// redirect.
+func safeReturnTo(returnTo string) string {
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") || strings.HasPrefix(returnTo, "/\\") {
+		return "/"
+	}
+	return returnTo
+}
@@ -0,0 +1,315 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// fakeProvider redirects to its own URL and returns identity for any code
+// redeemed with the verifier of the last challenge.
+type fakeProvider struct {
+	name      string
+	challenge string
+	nonce     string
+	identity  models.ExternalIdentity
+}
+
+func (f *fakeProvider) Name() string {
+	return f.name
+}
+
+func (f *fakeProvider) AuthCodeURL(_ context.Context, state, nonce, codeChallenge string) (string, error) {
+	f.challenge, f.nonce = codeChallenge, nonce
+
+	return "https://" + f.name + ".example.com/authorize?" + url.Values{"state": {state}}.Encode(), nil
+}
+
+func (f *fakeProvider) Exchange(_ context.Context, _, codeVerifier, nonce string) (*models.ExternalIdentity, error) {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != f.challenge || nonce != f.nonce {
+		return nil, errors.New("verifier or nonce of another login")
+	}
+	identity := f.identity
+
+	return &identity, nil
+}
+
+// fakeIdentities keeps linked identities in memory and creates users in
+// users.
+type fakeIdentities struct {
+	ports.IIdentityRepo
+	identities []models.LinkedIdentity
+	users      *fakeUsers
+}
+
+func (f *fakeIdentities) GetIdentity(_ context.Context, provider, subject string) (*models.LinkedIdentity, error) {
+	for _, identity := range f.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+
+	return nil, models.ErrNotFound
+}
+
+func (f *fakeIdentities) TouchIdentity(context.Context, string, string) error {
+	return nil
+}
+
+func (f *fakeIdentities) CreateIdentity(_ context.Context, identity *models.LinkedIdentity) error {
+	f.identities = append(f.identities, *identity)
+	return nil
+}
+
+func (f *fakeIdentities) CreateUserWithIdentity(_ context.Context, user *models.User, identity *models.LinkedIdentity) (string, error) {
+	user.ID, user.Status = "new", models.UserStatusActive
+	f.users.users[user.ID] = user
+	identity.UserID = user.ID
+
+	return user.ID, f.CreateIdentity(context.Background(), identity)
+}
+
+func (f *fakeUsers) GetUserByEmail(_ context.Context, email string) (*models.User, error) {
+	for _, user := range f.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+
+	return nil, models.ErrNotFound
+}
+
+// fakeAutoJoin records the users joined to organizations by email domain.
+type fakeAutoJoin struct {
+	ports.IOrganizationService
+	joined []string
+}
+
+func (f *fakeAutoJoin) AutoJoin(_ context.Context, userID, _ string) (string, error) {
+	f.joined = append(f.joined, userID)
+	return "", nil
+}
+
+// fakeMailer records the recipients of plain emails.
+type fakeMailer struct {
+	ports.IMailer
+	sent []string
+}
+
+func (f *fakeMailer) Send(_ context.Context, to, _, _ string) error {
+	f.sent = append(f.sent, to)
+	return nil
+}
+
+type testFederation struct {
+	*Federation
+	provider   *fakeProvider
+	identities *fakeIdentities
+	orgs       *fakeAutoJoin
+	mailer     *fakeMailer
+}
+
+func newTestFederation(t *testing.T) *testFederation {
+	t.Helper()
+
+	verifiedAt := time.Now()
+	users := &fakeUsers{users: map[string]*models.User{
+		memberID: {ID: memberID, Email: "member@example.com", Status: models.UserStatusActive},
+		adminID:  {ID: adminID, Email: "admin@example.com", Status: models.UserStatusActive, EmailVerifiedAt: &verifiedAt},
+	}}
+	o := newTestOAuth(&fakeRBAC{})
+	withTestRedis(t, o)
+
+	f := &testFederation{
+		provider:   &fakeProvider{name: "google"},
+		identities: &fakeIdentities{users: users},
+		orgs:       &fakeAutoJoin{},
+		mailer:     &fakeMailer{},
+	}
+	providers := map[string]ports.IIdentityProvider{"google": f.provider, "github": &fakeProvider{name: "github"}}
+	notifier := &securityNotifier{users: users, audit: &fakeAudit{}, mailer: f.mailer, opts: o.opts}
+	f.Federation = NewFederation(providers, f.identities, users, f.orgs, o.cache, notifier, o.opts)
+
+	return f
+}
+
+// begin starts a login with google and returns its state and binding.
+func (f *testFederation) begin(t *testing.T, returnTo, linkUserID string) (string, string) {
+	t.Helper()
+
+	target, binding, err := f.Begin(context.Background(), "google", returnTo, linkUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return stateOf(t, target), binding
+}
+
+func stateOf(t *testing.T, target string) string {
+	t.Helper()
+
+	u, err := url.Parse(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return u.Query().Get("state")
+}
+
+func TestFederationBindsLoginToUserAgent(t *testing.T) {
+	f := newTestFederation(t)
+	f.identities.identities = []models.LinkedIdentity{{Provider: "google", Subject: "google-member", UserID: memberID}}
+	f.provider.identity = models.ExternalIdentity{Provider: "google", Subject: "google-member"}
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		provider string
+		binding  func(binding string) string
+	}{
+		{name: "other user agent", provider: "google", binding: func(string) string { return "other" }},
+		{name: "no binding", provider: "google", binding: func(string) string { return "" }},
+		{name: "other provider", provider: "github", binding: func(binding string) string { return binding }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, binding := f.begin(t, "/", "")
+
+			if _, err := f.Complete(ctx, tt.provider, "code", state, tt.binding(binding)); !errors.Is(err, models.ErrUnauthorized) {
+				t.Fatalf("got %v, want ErrUnauthorized", err)
+			}
+			// The state is spent, so the login cannot be retried with the
+			// right binding either.
+			if _, err := f.Complete(ctx, "google", "code", state, binding); !errors.Is(err, models.ErrUnauthorized) {
+				t.Fatalf("completed a login after a failed attempt: %v", err)
+			}
+		})
+	}
+
+	state, binding := f.begin(t, "/settings", "")
+	login, err := f.Complete(ctx, "google", "code", state, binding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if login.UserID != memberID || login.ReturnTo != "/settings" || login.Linked {
+		t.Fatalf("got %+v, want a sign-in of the member", login)
+	}
+	if _, err := f.Complete(ctx, "google", "code", state, binding); !errors.Is(err, models.ErrUnauthorized) {
+		t.Fatalf("completed a login twice: %v", err)
+	}
+}
+
+func TestFederationResolve(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity models.ExternalIdentity
+		userID   string
+		err      error
+		joined   bool
+	}{
+		{name: "linked identity", identity: models.ExternalIdentity{Subject: "google-member", Email: "someone@example.com"}, userID: memberID},
+		{name: "verified email of an account", identity: models.ExternalIdentity{Subject: "google-admin", Email: "admin@example.com", EmailVerified: true}, userID: adminID},
+		{name: "unverified email of an account", identity: models.ExternalIdentity{Subject: "google-admin", Email: "admin@example.com"}, err: models.ErrIdentityConflict},
+		{name: "verified email of an unverified account", identity: models.ExternalIdentity{Subject: "google-other", Email: "member@example.com", EmailVerified: true}, err: models.ErrIdentityConflict},
+		{name: "new user with verified email", identity: models.ExternalIdentity{Subject: "google-new", Email: "new@example.com", EmailVerified: true}, userID: "new", joined: true},
+		{name: "new user with unverified email", identity: models.ExternalIdentity{Subject: "google-new", Email: "new@example.com"}, userID: "new"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTestFederation(t)
+			f.identities.identities = []models.LinkedIdentity{{Provider: "google", Subject: "google-member", UserID: memberID}}
+			tt.identity.Provider = "google"
+			f.provider.identity = tt.identity
+
+			state, binding := f.begin(t, "https://evil.example.com", "")
+			login, err := f.Complete(context.Background(), "google", "code", state, binding)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+
+			if login.UserID != tt.userID || login.ReturnTo != "/" {
+				t.Fatalf("got %+v, want a sign-in of %s returning to /", login, tt.userID)
+			}
+			if linked, err := f.identities.GetIdentity(context.Background(), "google", tt.identity.Subject); err != nil || linked.UserID != tt.userID {
+				t.Fatalf("got linked identity %+v, %v, want one of %s", linked, err, tt.userID)
+			}
+			if joined := len(f.orgs.joined) > 0; joined != tt.joined {
+				t.Fatalf("joined organizations: %v, want %v", joined, tt.joined)
+			}
+		})
+	}
+}
+
+func TestFederationLink(t *testing.T) {
+	f := newTestFederation(t)
+	f.identities.identities = []models.LinkedIdentity{{Provider: "google", Subject: "google-admin", UserID: adminID}}
+	ctx := context.Background()
+
+	continueURL, err := f.BeginLink(ctx, "google", "/settings", memberID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(continueURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticket := u.Query().Get("ticket")
+
+	// A ticket is redeemed once, and only by the user it was issued to.
+	if _, _, err := f.ContinueLink(ctx, "google", ticket, adminID); !errors.Is(err, models.ErrUnauthorized) {
+		t.Fatalf("another user: got %v, want ErrUnauthorized", err)
+	}
+	if _, _, err := f.ContinueLink(ctx, "google", ticket, memberID); !errors.Is(err, models.ErrUnauthorized) {
+		t.Fatalf("spent ticket: got %v, want ErrUnauthorized", err)
+	}
+
+	link := func(t *testing.T, subject string) (*models.FederatedLogin, error) {
+		t.Helper()
+
+		continueURL, err := f.BeginLink(ctx, "google", "/settings", memberID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := url.Parse(continueURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		target, binding, err := f.ContinueLink(ctx, "google", u.Query().Get("ticket"), memberID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f.provider.identity = models.ExternalIdentity{Provider: "google", Subject: subject, Email: "member@gmail.com"}
+		return f.Complete(ctx, "google", "code", stateOf(t, target), binding)
+	}
+
+	if _, err := link(t, "google-admin"); !errors.Is(err, models.ErrIdentityConflict) {
+		t.Fatalf("identity of another user: got %v, want ErrIdentityConflict", err)
+	}
+
+	login, err := link(t, "google-member")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if login.UserID != memberID || !login.Linked || login.ReturnTo != "/settings" {
+		t.Fatalf("got %+v, want a link for the member", login)
+	}
+	if linked, err := f.identities.GetIdentity(ctx, "google", "google-member"); err != nil || linked.UserID != memberID {
+		t.Fatalf("got linked identity %+v, %v, want one of the member", linked, err)
+	}
+	if len(f.mailer.sent) != 1 || f.mailer.sent[0] != "member@example.com" {
+		t.Fatalf("got notifications to %v, want one to the member", f.mailer.sent)
+	}
+}
@@ -0,0 +1,322 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const invitationTokenType = "invitation"
+
+// Invitations invites people to organizations by email. The emailed link
+// carries a signed token; only its hash is stored, so resending an
+// invitation invalidates the previous link.
+type Invitations struct {
+	repo   ports.IInvitationRepo
+	orgs   ports.IOrganizationRepo
+	users  ports.IUserRepo
+	auth   ports.IAuthService
+	mailer ports.IMailer
+	audit  ports.IAuditRepo
+	opts   *models.Options
+}
+
+func NewInvitations(repo ports.IInvitationRepo, orgs ports.IOrganizationRepo, users ports.IUserRepo, auth ports.IAuthService, mailer ports.IMailer, audit ports.IAuditRepo, opts *models.Options) *Invitations {
+	return &Invitations{repo: repo, orgs: orgs, users: users, auth: auth, mailer: mailer, audit: audit, opts: opts}
+}
+
+// CreateInvitation invites email to the organization with the given role. A
+// zero ttl uses the configured default. Only owners may invite owners.
+func (i *Invitations) CreateInvitation(ctx context.Context, actorID, orgID, email, role string, ttl time.Duration) (*models.Invitation, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if local, domain, ok := strings.Cut(email, "@"); !ok || local == "" || !strings.Contains(domain, ".") {
+		return nil, fmt.Errorf("%w: invalid email address %q", models.ErrInvalidOrgInput, email)
+	}
+	if role == "" {
+		role = models.OrgRoleMember
+	}
+
+	ttl, err := i.ttl(ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := i.authorize(ctx, actorID, orgID, role); err != nil {
+		return nil, err
+	}
+
+	invitation := &models.Invitation{
+		OrgID:     orgID,
+		Email:     email,
+		Role:      role,
+		InvitedBy: actorID,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+
+	token, tokenHash, err := i.token(invitation, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := i.repo.CreateInvitation(ctx, invitation, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := i.send(ctx, invitation, token); err != nil {
+		// Nobody can accept an invitation that was not sent, and while
+		// open it would keep the address from being invited again.
+		if deleteErr := i.repo.DeleteInvitation(ctx, orgID, id); deleteErr != nil {
+			_ = i.opts.Logger.ErrorContext(ctx, "failed to delete unsent invitation", "invitation_id", id, "error", deleteErr)
+		}
+		return nil, err
+	}
+
+	invitation, err = i.repo.GetInvitation(ctx, orgID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return invitation, i.record(ctx, models.AuditInvitationSent, actorID, invitation)
+}
+
+// ListInvitations returns the invitations that were neither accepted nor
+// revoked, including expired ones that can still be resent.
+func (i *Invitations) ListInvitations(ctx context.Context, actorID, orgID string) ([]models.Invitation, error) {
+	if err := i.authorize(ctx, actorID, orgID, ""); err != nil {
+		return nil, err
+	}
+
+	return i.repo.ListInvitations(ctx, orgID)
+}
+
+// ResendInvitation emails a new link for an open invitation and restarts its
+// expiry.
+func (i *Invitations) ResendInvitation(ctx context.Context, actorID, orgID, invitationID string, ttl time.Duration) (*models.Invitation, error) {
+	ttl, err := i.ttl(ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	invitation, err := i.repo.GetInvitation(ctx, orgID, invitationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := i.authorize(ctx, actorID, orgID, invitation.Role); err != nil {
+		return nil, err
+	}
+
+	invitation.ExpiresAt = time.Now().Add(ttl)
+
+	token, tokenHash, err := i.token(invitation, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := i.repo.RenewInvitation(ctx, orgID, invitationID, tokenHash, invitation.ExpiresAt); err != nil {
+		return nil, err
+	}
+
+	if err := i.send(ctx, invitation, token); err != nil {
+		return nil, err
+	}
+
+	return invitation, i.record(ctx, models.AuditInvitationSent, actorID, invitation)
+}
+
+func (i *Invitations) RevokeInvitation(ctx context.Context, actorID, orgID, invitationID string) error {
+	invitation, err := i.repo.GetInvitation(ctx, orgID, invitationID)
+	if err != nil {
+		return err
+	}
+
+	if err := i.authorize(ctx, actorID, orgID, invitation.Role); err != nil {
+		return err
+	}
+
+	if err := i.repo.RevokeInvitation(ctx, orgID, invitationID); err != nil {
+		return err
+	}
+
+	return i.record(ctx, models.AuditInvitationRevoked, actorID, invitation)
+}
+
+// AcceptInvitation redeems an invitation token. A signed-in user (userID set)
+// must own the invited address. Otherwise an account is created from signUp
+// with the invited address, which the email link has just verified; if that
+// address already has an account, its owner has to sign in first.
+func (i *Invitations) AcceptInvitation(ctx context.Context, token, userID string, signUp *models.SignUpRequest) (*models.Invitation, error) {
+	claims, err := VerifyJWT(token, &i.opts.Config.Token)
+	if err != nil {
+		return nil, models.ErrInvitationInvalid
+	}
+	if tokenType, _ := claims["type"].(string); tokenType != invitationTokenType {
+		return nil, models.ErrInvitationInvalid
+	}
+
+	invitation, err := i.repo.GetInvitationByTokenHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, models.ErrInvitationInvalid
+		}
+		return nil, err
+	}
+	if invitation.Status() != models.InvitationStatusPending {
+		return nil, models.ErrInvitationInvalid
+	}
+
+	if userID != "" {
+		user, err := i.users.GetUser(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.EqualFold(user.Email, invitation.Email) {
+			return nil, models.ErrInvitationEmailMismatch
+		}
+	} else {
+		userID, err = i.signUp(ctx, invitation.Email, signUp)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := i.repo.AcceptInvitation(ctx, invitation.ID, userID); err != nil {
+		return nil, err
+	}
+
+	invitation.AcceptedBy = userID
+	now := time.Now()
+	invitation.AcceptedAt = &now
+
+	return invitation, i.record(ctx, models.AuditInvitationAccepted, userID, invitation)
+}
+
+func (i *Invitations) signUp(ctx context.Context, email string, signUp *models.SignUpRequest) (string, error) {
+	if signUp == nil || strings.TrimSpace(signUp.Name) == "" || signUp.Password == "" {
+		return "", fmt.Errorf("%w: a name and a password are required to create an account", models.ErrInvalidOrgInput)
+	}
+
+	_, err := i.users.GetUserByEmail(ctx, email)
+	switch {
+	case err == nil:
+		return "", models.ErrInvitationSignInNeeded
+	case !errors.Is(err, models.ErrNotFound):
+		return "", err
+	}
+
+	// The invitation was sent to email, so following its link proves the
+	// address; AcceptInvitation marks it verified.
+	id, err := i.auth.Create(ctx, models.SignUpRequest{
+		Name:     strings.TrimSpace(signUp.Name),
+		Email:    email,
+		Password: signUp.Password,
+		Status:   models.UserStatusActive,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return id.(string), nil
+}
+
+// authorize checks that the actor manages the organization and, for
+// invitations granting ownership, owns it.
+func (i *Invitations) authorize(ctx context.Context, actorID, orgID, role string) error {
+	if role != "" && !models.ValidOrgRole(role) {
+		return models.ErrInvalidOrgRole
+	}
+
+	actor, err := i.orgs.GetMembership(ctx, orgID, actorID)
+	if err != nil {
+		return err
+	}
+
+	if !actor.CanManage() || (role == models.OrgRoleOwner && actor.Role != models.OrgRoleOwner) {
+		return models.ErrPermissionDenied
+	}
+
+	return nil
+}
+
+func (i *Invitations) ttl(ttl time.Duration) (time.Duration, error) {
+	cfg := &i.opts.Config.Invitation
+
+	switch {
+	case ttl == 0:
+		return cfg.TTL, nil
+	case ttl < 0 || ttl > cfg.MaxTTL:
+		return 0, fmt.Errorf("%w: invitations may be valid for at most %s", models.ErrInvalidOrgInput, cfg.MaxTTL)
+	default:
+		return ttl, nil
+	}
+}
+
+// token signs a new invitation token and returns it with the hash to store.
+func (i *Invitations) token(invitation *models.Invitation, ttl time.Duration) (string, string, error) {
+	token, err := CreateJWT(ttl, &i.opts.Config.Token, jwt.MapClaims{
+		"type":   invitationTokenType,
+		"jti":    uuid.NewString(),
+		"org_id": invitation.OrgID,
+		"email":  invitation.Email,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return token, hashToken(token), nil
+}
+
+func (i *Invitations) send(ctx context.Context, invitation *models.Invitation, token string) error {
+	org, err := i.orgs.GetOrganization(ctx, invitation.OrgID)
+	if err != nil {
+		return err
+	}
+
+	var inviter string
+	if invitation.InvitedBy != "" {
+		if user, err := i.users.GetUser(ctx, invitation.InvitedBy); err == nil {
+			inviter = user.Name
+			if inviter == "" {
+				inviter = user.Email
+			}
+		}
+	}
+
+	link, err := url.Parse(i.opts.Config.Invitation.AcceptURL)
+	if err != nil {
+		return fmt.Errorf("invalid invitation accept URL: %w", err)
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	return i.mailer.SendTemplate(ctx, invitation.Email, "invitation", struct {
+		Organization string
+		Inviter      string
+		URL          string
+		ExpiresAt    time.Time
+	}{org.Name, inviter, link.String(), invitation.ExpiresAt})
+}
+
+func (i *Invitations) record(ctx context.Context, eventType, actorID string, invitation *models.Invitation) error {
+	return i.audit.Record(ctx, &models.AuditEvent{
+		Type:    eventType,
+		UserID:  actorID,
+		OrgID:   invitation.OrgID,
+		Outcome: models.AuditOutcomeSuccess,
+		Metadata: map[string]string{
+			"org_id":        invitation.OrgID,
+			"invitation_id": invitation.ID,
+			"email":         invitation.Email,
+			"role":          invitation.Role,
+		},
+	})
+}
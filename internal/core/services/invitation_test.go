@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/co1seam/ember-backend-auth/config"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"github.com/co1seam/ember-backend-auth/pkg/logger"
+	"io"
+	"testing"
+	"time"
+)
+
+// fakeInvitations keeps open invitations in memory.
+type fakeInvitations struct {
+	ports.IInvitationRepo
+	invitations map[string]*models.Invitation
+}
+
+func (f *fakeInvitations) CreateInvitation(_ context.Context, invitation *models.Invitation, _ string) (string, error) {
+	id := "invitation"
+	f.invitations[id] = invitation
+
+	return id, nil
+}
+
+func (f *fakeInvitations) DeleteInvitation(_ context.Context, _, invitationID string) error {
+	delete(f.invitations, invitationID)
+	return nil
+}
+
+// fakeOrgs has one organization, administered by adminID.
+type fakeOrgs struct {
+	ports.IOrganizationRepo
+}
+
+func (f *fakeOrgs) GetOrganization(_ context.Context, orgID string) (*models.Organization, error) {
+	return &models.Organization{ID: orgID, Name: "Example"}, nil
+}
+
+func (f *fakeOrgs) GetMembership(_ context.Context, orgID, userID string) (*models.Membership, error) {
+	if userID != adminID {
+		return nil, models.ErrNotFound
+	}
+
+	return &models.Membership{OrgID: orgID, UserID: userID, Role: models.OrgRoleAdmin}, nil
+}
+
+// failingMailer fails every send.
+type failingMailer struct {
+	ports.IMailer
+}
+
+func (f *failingMailer) SendTemplate(context.Context, string, string, any) error {
+	return errors.New("mail server unavailable")
+}
+
+func TestCreateInvitationDeletesUnsent(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Token = config.Token{Secret: "secret", Issuer: "https://auth.example.com"}
+	cfg.Invitation = config.Invitation{AcceptURL: "https://app.example.com/invitations/accept", TTL: time.Hour, MaxTTL: 24 * time.Hour}
+	log := logger.New(context.Background(), logger.Options{Output: io.Discard})
+
+	repo := &fakeInvitations{invitations: map[string]*models.Invitation{}}
+	i := NewInvitations(repo, &fakeOrgs{}, &fakeUsers{}, nil, &failingMailer{}, &fakeAudit{}, &models.Options{Config: cfg, Logger: log})
+
+	if _, err := i.CreateInvitation(context.Background(), adminID, "org", "new@example.com", "", 0); err == nil {
+		t.Fatal("an invitation that could not be sent was created")
+	}
+	if len(repo.invitations) != 0 {
+		t.Fatalf("got open invitations %v, want the unsent one deleted", repo.invitations)
+	}
+}
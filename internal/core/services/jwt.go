@@ -1,4 +1,4 @@
-package rpc
+package services
 
 import (
 	"fmt"
@@ -7,12 +7,12 @@ import (
 	"time"
 )
 
-func createJWT(ttl time.Duration, cfg *config.Token, extraClaims jwt.MapClaims) (string, error) {
+func CreateJWT(ttl time.Duration, cfg *config.Token, extraClaims jwt.MapClaims) (string, error) {
 	now := time.Now()
 	baseClaims := jwt.MapClaims{
 		"iat": jwt.NewNumericDate(now),
 		"exp": jwt.NewNumericDate(now.Add(ttl)),
-		"iss": "ember.com",
+		"iss": cfg.Issuer,
 	}
 
 	for k, v := range extraClaims {
@@ -30,7 +30,7 @@ func createJWT(ttl time.Duration, cfg *config.Token, extraClaims jwt.MapClaims)
 	return jwtToken, nil
 }
 
-func verifyJWT(tokenString string, cfg *config.Token) (jwt.MapClaims, error) {
+func VerifyJWT(tokenString string, cfg *config.Token) (jwt.MapClaims, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
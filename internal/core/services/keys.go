@@ -0,0 +1,161 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/config"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"os"
+)
+
+// KeySet holds the asymmetric key used for tokens that third parties verify
+// on their own, such as OIDC ID tokens.
+type KeySet struct {
+	key *rsa.PrivateKey
+	kid string
+}
+
+// NewKeySet loads the key of OIDC_SIGNING_KEY_FILE. Without one a key is
+// generated, which only suits development: nothing signed with it can be
+// verified after a restart.
+func NewKeySet(cfg *config.OIDC) (*KeySet, error) {
+	var (
+		key *rsa.PrivateKey
+		err error
+	)
+
+	if cfg.SigningKeyFile != "" {
+		key, err = readPrivateKey(cfg.SigningKeyFile)
+	} else {
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading signing key: %w", err)
+	}
+
+	return &KeySet{key: key, kid: thumbprint(&key.PublicKey)}, nil
+}
+
+func (k *KeySet) Sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = k.kid
+
+	signed, err := token.SignedString(k.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign JWT token: %v", err)
+	}
+	return signed, nil
+}
+
+func (k *KeySet) Verify(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return &k.key.PublicKey, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing token: %v", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+	return claims, nil
+}
+
+func (k *KeySet) JWKS() models.JSONWebKeySet {
+	return models.JSONWebKeySet{Keys: []models.JSONWebKey{{
+		KeyType:   "RSA",
+		Use:       "sig",
+		Algorithm: jwt.SigningMethodRS256.Alg(),
+		KeyID:     k.kid,
+		Modulus:   base64.RawURLEncoding.EncodeToString(k.key.PublicKey.N.Bytes()),
+		Exponent:  base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.key.PublicKey.E)).Bytes()),
+	}}}
+}
+
+func readPrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", path)
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key in %s is not an RSA key", path)
+	}
+	return key, nil
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint used as the key ID.
+func thumbprint(key *rsa.PublicKey) string {
+	e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+	n := base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+	sum := sha256.Sum256([]byte(`{"e":"` + e + `","kty":"RSA","n":"` + n + `"}`))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// parsePublicKey reads a PEM encoded RSA or P-256 public key, as registered
+// by clients for private_key_jwt, and returns it with its key ID.
+func parsePublicKey(data string) (crypto.PublicKey, string, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, "", fmt.Errorf("no PEM data in public key")
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < 2048 {
+			return nil, "", fmt.Errorf("RSA keys must have at least 2048 bits")
+		}
+		return key, thumbprint(key), nil
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() {
+			return nil, "", fmt.Errorf("only P-256 EC keys are supported")
+		}
+		return key, ecThumbprint(key), nil
+	default:
+		return nil, "", fmt.Errorf("unsupported public key type %T", parsed)
+	}
+}
+
+// ecThumbprint is the RFC 7638 thumbprint of a P-256 key.
+func ecThumbprint(key *ecdsa.PublicKey) string {
+	x := base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32)))
+	y := base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32)))
+	sum := sha256.Sum256([]byte(`{"crv":"P-256","kty":"EC","x":"` + x + `","y":"` + y + `"}`))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
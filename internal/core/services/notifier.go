@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+)
+
+// securityNotifier records security relevant account changes in the audit
+// log and tells the account owner about them by email.
+type securityNotifier struct {
+	users  ports.IUserRepo
+	audit  ports.IAuditRepo
+	mailer ports.IMailer
+	opts   *models.Options
+}
+
+func (n *securityNotifier) identityChanged(ctx context.Context, eventType, userID, provider string) error {
+	if err := n.audit.Record(ctx, &models.AuditEvent{
+		Type:     eventType,
+		UserID:   userID,
+		Outcome:  models.AuditOutcomeSuccess,
+		Metadata: map[string]string{"provider": provider},
+	}); err != nil {
+		return err
+	}
+
+	user, err := n.users.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	var body string
+	switch eventType {
+	case models.AuditIdentityLinked:
+		body = fmt.Sprintf("Вход через %s был привязан к вашему аккаунту Ember.\nЕсли это были не вы, немедленно смените пароль.", provider)
+	case models.AuditIdentityUnlinked:
+		body = fmt.Sprintf("Вход через %s был отвязан от вашего аккаунта Ember.\nЕсли это были не вы, немедленно смените пароль.", provider)
+	default:
+		return nil
+	}
+
+	// The change already happened, a failed notification must not undo it.
+	if err := n.mailer.Send(ctx, user.Email, "Изменение способов входа", body); err != nil {
+		_ = n.opts.Logger.ErrorContext(ctx, "security notification failed", "user_id", userID, "error", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,992 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/internal/adapters/metrics"
+	"github.com/co1seam/ember-backend-auth/internal/adapters/repository"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v5"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	authorizationCodePrefix = "oauth:code:"
+	revokedTokenPrefix      = "oauth:revoked:"
+	clientAssertionPrefix   = "oauth:assertion:"
+	userLogoutPrefix        = "oauth:logout:"
+	rotatedTokenPrefix      = "oauth:rotated:"
+	revokedSessionPrefix    = "oauth:revoked-session:"
+
+	// maxAssertionLifetime bounds how long a client assertion may be valid,
+	// and so how long its jti has to be remembered.
+	maxAssertionLifetime = 10 * time.Minute
+)
+
+type OAuth struct {
+	repo     ports.IOAuthRepo
+	sessions ports.ISessionRepo
+	users    ports.IUserRepo
+	apiKeys  ports.IAPIKeyRepo
+	rbac     ports.IRBACService
+	audit    ports.IAuditRepo
+	cache    *repository.Redis
+	keys     *KeySet
+	opts     *models.Options
+}
+
+func NewOAuth(repo ports.IOAuthRepo, sessions ports.ISessionRepo, users ports.IUserRepo, apiKeys ports.IAPIKeyRepo, rbac ports.IRBACService, audit ports.IAuditRepo, cache *repository.Redis, keys *KeySet, opts *models.Options) *OAuth {
+	return &OAuth{repo: repo, sessions: sessions, users: users, apiKeys: apiKeys, rbac: rbac, audit: audit, cache: cache, keys: keys, opts: opts}
+}
+
+// LookupClient resolves the client of an authorization request. Errors returned
+// here must be shown to the user agent and never redirected, because the
+// redirect URI cannot be trusted yet.
+func (o *OAuth) LookupClient(ctx context.Context, clientID, redirectURI string) (*models.Client, error) {
+	client, err := o.repo.GetClient(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, models.NewOAuthError("invalid_client", "unknown client")
+		}
+		return nil, err
+	}
+
+	if redirectURI == "" || !client.AllowsRedirectURI(redirectURI) {
+		return nil, models.NewOAuthError("invalid_request", "redirect_uri is not registered for this client")
+	}
+
+	return client, nil
+}
+
+func (o *OAuth) ValidateAuthorizeRequest(client *models.Client, req models.AuthorizeRequest) error {
+	if req.ResponseType != "code" {
+		return models.NewOAuthError("unsupported_response_type", "only the code response type is supported")
+	}
+
+	if !client.AllowsGrant(models.GrantTypeAuthorizationCode) {
+		return models.NewOAuthError("unauthorized_client", "client may not use the authorization code grant")
+	}
+
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != models.CodeChallengeMethodS256 {
+		return models.NewOAuthError("invalid_request", "PKCE with the S256 method is required")
+	}
+
+	if !client.AllowsScopes(models.ParseScope(req.Scope)) {
+		return models.NewOAuthError("invalid_scope", "requested scope exceeds the client registration")
+	}
+
+	prompts := models.ParseScope(req.Prompt)
+	if len(prompts) > 1 && models.HasScope(req.Prompt, models.PromptNone) {
+		return models.NewOAuthError("invalid_request", "prompt=none cannot be combined with other values")
+	}
+
+	if req.MaxAge != "" {
+		if maxAge, err := strconv.Atoi(req.MaxAge); err != nil || maxAge < 0 {
+			return models.NewOAuthError("invalid_request", "max_age must be a non-negative integer")
+		}
+	}
+
+	return nil
+}
+
+// RequiresLogin reports whether the end-user has to authenticate again
+// before the request can be answered, according to prompt and max_age.
+func (o *OAuth) RequiresLogin(req models.AuthorizeRequest, authTime time.Time) bool {
+	if models.HasScope(req.Prompt, models.PromptLogin) {
+		return true
+	}
+
+	if req.MaxAge != "" {
+		maxAge, err := strconv.Atoi(req.MaxAge)
+		if err != nil {
+			return true
+		}
+		return time.Since(authTime) > time.Duration(maxAge)*time.Second
+	}
+
+	return false
+}
+
+func (o *OAuth) NeedsConsent(ctx context.Context, client *models.Client, userID, scope string) (bool, error) {
+	if client.FirstParty {
+		return false, nil
+	}
+
+	consent, err := o.repo.GetConsent(ctx, userID, client.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	return !consent.Covers(models.ParseScope(scope)), nil
+}
+
+func (o *OAuth) GrantConsent(ctx context.Context, userID, clientID, scope string) error {
+	scopes := models.ParseScope(scope)
+
+	consent, err := o.repo.GetConsent(ctx, userID, clientID)
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		return err
+	}
+	if consent != nil && consent.RevokedAt == nil {
+		requested := &models.Consent{Scopes: scopes}
+		for _, granted := range consent.Scopes {
+			if !requested.Covers([]string{granted}) {
+				scopes = append(scopes, granted)
+			}
+		}
+	}
+
+	return o.repo.SaveConsent(ctx, &models.Consent{UserID: userID, ClientID: clientID, Scopes: scopes})
+}
+
+func (o *OAuth) Authorize(ctx context.Context, req models.AuthorizeRequest, userID string, authTime time.Time) (string, error) {
+	code, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(models.AuthorizationCode{
+		ClientID:            req.ClientID,
+		UserID:              userID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               req.Scope,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		Nonce:               req.Nonce,
+		AuthTime:            authTime,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := o.cache.Redis.Set(ctx, authorizationCodePrefix+hashToken(code), payload, o.opts.Config.OAuth.CodeTTL).Err(); err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+func (o *OAuth) Token(ctx context.Context, req models.TokenRequest) (*models.TokenResponse, error) {
+	var (
+		client *models.Client
+		err    error
+	)
+	if req.ClientAssertionType != "" || req.ClientAssertion != "" {
+		client, err = o.authenticateAssertion(ctx, req.ClientID, req.ClientAssertionType, req.ClientAssertion)
+	} else {
+		client, err = o.authenticateClient(ctx, req.ClientID, req.ClientSecret)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !client.AllowsGrant(req.GrantType) {
+		return nil, models.NewOAuthError("unauthorized_client", "client may not use this grant type")
+	}
+
+	switch req.GrantType {
+	case models.GrantTypeAuthorizationCode:
+		return o.exchangeAuthorizationCode(ctx, client, req)
+	case models.GrantTypeClientCredentials:
+		return o.exchangeClientCredentials(ctx, client, req)
+	case models.GrantTypeRefreshToken:
+		return o.exchangeRefreshToken(ctx, client, req)
+	case models.GrantTypeTokenExchange:
+		return o.exchangeToken(ctx, client, req)
+	default:
+		return nil, models.NewOAuthError("unsupported_grant_type", "")
+	}
+}
+
+// Revoke implements RFC 7009. Unknown or foreign tokens are ignored so that
+// callers cannot probe for token validity. First-party clients may also
+// revoke the tokens issued by the Auth RPCs, which carry no client_id.
+func (o *OAuth) Revoke(ctx context.Context, token, hint, clientID, clientSecret string) error {
+	client, err := o.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return err
+	}
+
+	if hint != "" && hint != models.TokenTypeAccessToken && hint != models.TokenTypeRefreshToken {
+		return models.NewOAuthError("unsupported_token_type", "")
+	}
+
+	session, err := o.sessions.GetSessionByRefreshToken(ctx, hashToken(token))
+	if err == nil {
+		if session.ClientID != client.ID {
+			return nil
+		}
+		return o.sessions.RevokeSession(ctx, session.ID)
+	}
+	if !errors.Is(err, models.ErrNotFound) {
+		return err
+	}
+
+	claims, err := VerifyJWT(token, &o.opts.Config.Token)
+	if err != nil {
+		return nil
+	}
+
+	owner, _ := claims["client_id"].(string)
+	if owner != client.ID && !(owner == "" && client.FirstParty) {
+		return nil
+	}
+
+	return o.revokeJWT(ctx, claims)
+}
+
+// Introspect implements RFC 7662. Only confidential clients, such as API
+// gateways and resource servers, may introspect tokens.
+func (o *OAuth) Introspect(ctx context.Context, token, hint, clientID, clientSecret string) (*models.Introspection, error) {
+	client, err := o.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if !client.IsConfidential() {
+		return nil, models.NewOAuthError("invalid_client", "introspection requires client authentication")
+	}
+
+	return o.InspectToken(ctx, token, hint)
+}
+
+// InspectToken reports the state of any token issued by this service, be it
+// an access or refresh JWT or an opaque OAuth refresh token. Invalid, expired
+// and revoked tokens are reported as inactive rather than as errors.
+func (o *OAuth) InspectToken(ctx context.Context, token, hint string) (*models.Introspection, error) {
+	if hint == models.TokenTypeRefreshToken {
+		introspection, err := o.introspectRefreshToken(ctx, token)
+		if err != nil || introspection.Active {
+			return introspection, err
+		}
+	}
+
+	if claims, err := VerifyJWT(token, &o.opts.Config.Token); err == nil {
+		return o.introspectJWT(ctx, claims)
+	}
+
+	if hint == models.TokenTypeRefreshToken {
+		return &models.Introspection{Active: false}, nil
+	}
+
+	return o.introspectRefreshToken(ctx, token)
+}
+
+// RevokeUserTokens signs the user out everywhere: their OAuth sessions and
+// API keys are revoked and every JWT issued to them until now stops being
+// active.
+func (o *OAuth) RevokeUserTokens(ctx context.Context, userID string) error {
+	if err := o.sessions.RevokeUserSessions(ctx, userID); err != nil {
+		return err
+	}
+	if err := o.apiKeys.RevokeUserAPIKeys(ctx, userID); err != nil {
+		return err
+	}
+
+	// No token issued before now outlives the longest token lifetime, so the
+	// marker can expire after it.
+	ttl := max(o.opts.Config.Token.AccessTokenTTL, o.opts.Config.Token.RefreshTokenTTL, o.opts.Config.TokenExchange.ImpersonationTTL)
+
+	return o.cache.Redis.Set(ctx, userLogoutPrefix+userID, time.Now().Unix(), ttl).Err()
+}
+
+func (o *OAuth) exchangeAuthorizationCode(ctx context.Context, client *models.Client, req models.TokenRequest) (*models.TokenResponse, error) {
+	payload, err := o.cache.Redis.GetDel(ctx, authorizationCodePrefix+hashToken(req.Code)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, models.NewOAuthError("invalid_grant", "authorization code is invalid or expired")
+		}
+		return nil, err
+	}
+
+	var code models.AuthorizationCode
+	if err := json.Unmarshal(payload, &code); err != nil {
+		return nil, err
+	}
+
+	if code.ClientID != client.ID || code.RedirectURI != req.RedirectURI {
+		return nil, models.NewOAuthError("invalid_grant", "authorization code was issued to another client or redirect_uri")
+	}
+
+	if !verifyCodeChallenge(code.CodeChallenge, req.CodeVerifier) {
+		return nil, models.NewOAuthError("invalid_grant", "code_verifier does not match the code challenge")
+	}
+
+	if err := o.requireActive(ctx, code.UserID); err != nil {
+		return nil, err
+	}
+
+	return o.issueTokens(ctx, client, code.UserID, code.Scope, code.AuthTime, code.Nonce)
+}
+
+func (o *OAuth) exchangeClientCredentials(ctx context.Context, client *models.Client, req models.TokenRequest) (*models.TokenResponse, error) {
+	if !client.IsConfidential() {
+		return nil, models.NewOAuthError("unauthorized_client", "public clients cannot use client credentials")
+	}
+
+	scope := req.Scope
+	if scope == "" {
+		scope = models.JoinScope(client.Scopes)
+	}
+	if !client.AllowsScopes(models.ParseScope(scope)) {
+		return nil, models.NewOAuthError("invalid_scope", "requested scope exceeds the client registration")
+	}
+
+	accessToken, err := o.createAccessToken(ctx, client.ID, client.ID, scope, "", models.PrincipalTypeService)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   models.TokenTypeBearer,
+		ExpiresIn:   int64(o.opts.Config.Token.AccessTokenTTL.Seconds()),
+		Scope:       scope,
+	}, nil
+}
+
+func (o *OAuth) exchangeRefreshToken(ctx context.Context, client *models.Client, req models.TokenRequest) (*models.TokenResponse, error) {
+	oldHash := hashToken(req.RefreshToken)
+
+	session, err := o.sessions.GetSessionByRefreshToken(ctx, oldHash)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			if err := o.checkRotatedRefreshToken(ctx, oldHash, client.ID); err != nil {
+				return nil, err
+			}
+			return nil, models.NewOAuthError("invalid_grant", "refresh token is invalid")
+		}
+		return nil, err
+	}
+
+	if session.ClientID != client.ID || !session.Active(time.Now()) {
+		return nil, models.NewOAuthError("invalid_grant", "refresh token is invalid")
+	}
+	if err := o.requireActive(ctx, session.UserID); err != nil {
+		return nil, err
+	}
+
+	scope := session.Scope
+	if req.Scope != "" {
+		granted := &models.Consent{Scopes: models.ParseScope(session.Scope)}
+		if !granted.Covers(models.ParseScope(req.Scope)) {
+			return nil, models.NewOAuthError("invalid_scope", "requested scope exceeds the original grant")
+		}
+		scope = req.Scope
+	}
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(o.opts.Config.Token.RefreshTokenTTL)
+	if err := o.sessions.RotateRefreshToken(ctx, session.ID, oldHash, hashToken(refreshToken), expiresAt); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			// The token was valid a moment ago, so it was just rotated by
+			// another request presenting it.
+			if err := o.refreshTokenReused(ctx, session.UserID, session.ID, client.ID); err != nil {
+				return nil, err
+			}
+			return nil, models.NewOAuthError("invalid_grant", "refresh token is invalid")
+		}
+		return nil, err
+	}
+	metrics.RefreshRotations.WithLabelValues("oauth").Inc()
+
+	// Remember the rotated token for as long as it could have been used, so
+	// that presenting it again is told apart from an unknown token.
+	if err := o.cache.Redis.Set(ctx, rotatedTokenPrefix+oldHash, session.ID, o.opts.Config.Token.RefreshTokenTTL).Err(); err != nil {
+		_ = o.opts.Logger.ErrorContext(ctx, "failed to record rotated refresh token", "session_id", session.ID, "error", err)
+	}
+
+	accessToken, err := o.createAccessToken(ctx, session.UserID, client.ID, scope, session.ID, models.PrincipalTypeUser)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.TokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    models.TokenTypeBearer,
+		ExpiresIn:    int64(o.opts.Config.Token.AccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        scope,
+	}
+
+	if models.HasScope(scope, models.ScopeOpenID) {
+		response.IDToken, err = o.createIDToken(client.ID, session.UserID, session.AuthTime, "", accessToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return response, nil
+}
+
+// checkRotatedRefreshToken handles an OAuth refresh token that matches no
+// session. If it was rotated before, its session is revoked.
+func (o *OAuth) checkRotatedRefreshToken(ctx context.Context, tokenHash, clientID string) error {
+	sessionID, err := o.cache.Redis.Get(ctx, rotatedTokenPrefix+tokenHash).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var userID string
+	session, err := o.sessions.GetSession(ctx, sessionID)
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		return err
+	}
+	if session != nil {
+		userID = session.UserID
+	}
+
+	return o.refreshTokenReused(ctx, userID, sessionID, clientID)
+}
+
+// RotateRefreshToken spends a first-party refresh token: it is inspected
+// like InspectToken does and, if active, can not be exchanged again. A
+// token presented after it was spent revokes every token of its sign-in,
+// as either it leaked or whoever holds its successor is not the user.
+func (o *OAuth) RotateRefreshToken(ctx context.Context, token string) (*models.Introspection, error) {
+	claims, err := VerifyJWT(token, &o.opts.Config.Token)
+	if err != nil {
+		return &models.Introspection{Active: false}, nil
+	}
+
+	tokenType, _ := claims["type"].(string)
+	clientID, _ := claims["client_id"].(string)
+	jti, _ := claims["jti"].(string)
+	if tokenType != "refresh" || clientID != "" || jti == "" {
+		return &models.Introspection{Active: false}, nil
+	}
+
+	introspection, err := o.introspectJWT(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	var spent bool
+	if introspection.Active {
+		var ttl time.Duration
+		if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+			ttl = time.Until(exp.Time)
+		}
+		fresh, err := o.cache.Redis.SetNX(ctx, rotatedTokenPrefix+jti, introspection.SessionID, max(ttl, time.Second)).Result()
+		if err != nil {
+			return nil, err
+		}
+		spent = !fresh
+	} else {
+		// Inactive for another reason, such as a logout, is not reuse.
+		n, err := o.cache.Redis.Exists(ctx, rotatedTokenPrefix+jti).Result()
+		if err != nil {
+			return nil, err
+		}
+		spent = n > 0
+	}
+
+	if spent {
+		subject, _ := claims.GetSubject()
+		sessionID, _ := claims["sid"].(string)
+		if err := o.refreshTokenReused(ctx, subject, sessionID, ""); err != nil {
+			return nil, err
+		}
+		return &models.Introspection{Active: false}, nil
+	}
+	return introspection, nil
+}
+
+// refreshTokenReused revokes the session of a refresh token presented after
+// it was rotated. OAuth sessions are revoked in the database; the tokens of
+// a first-party sign-in share its sid and are denied by it.
+func (o *OAuth) refreshTokenReused(ctx context.Context, userID, sessionID, clientID string) error {
+	metrics.RefreshTokenReuses.Inc()
+
+	if sessionID != "" {
+		var err error
+		if clientID != "" {
+			err = o.sessions.RevokeSession(ctx, sessionID)
+		} else {
+			err = o.revokeSignIn(ctx, sessionID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	event := &models.AuditEvent{
+		Type:      models.AuditTokenReused,
+		UserID:    userID,
+		SessionID: sessionID,
+		Outcome:   models.AuditOutcomeFailure,
+		Reason:    "refresh token reused",
+		Metadata:  map[string]string{},
+	}
+	if clientID != "" {
+		event.Metadata["client_id"] = clientID
+	}
+	if err := o.audit.Record(ctx, event); err != nil {
+		_ = o.opts.Logger.ErrorContext(ctx, "failed to audit refresh token reuse", "session_id", sessionID, "error", err)
+	}
+
+	return nil
+}
+
+// RevokeSignIn ends the first-party sign-in a token belongs to, which may be
+// its access or its refresh token: every token of the sign-in stops being
+// active. The returned introspection is of the token before it was revoked;
+// tokens that were not active are left alone.
+func (o *OAuth) RevokeSignIn(ctx context.Context, token string) (*models.Introspection, error) {
+	claims, err := VerifyJWT(token, &o.opts.Config.Token)
+	if err != nil {
+		return &models.Introspection{Active: false}, nil
+	}
+
+	introspection, err := o.introspectJWT(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if !introspection.Active || introspection.ClientID != "" {
+		return &models.Introspection{Active: false}, nil
+	}
+
+	// Tokens issued before sid grouped a sign-in only revoke themselves.
+	if introspection.SessionID == "" {
+		return introspection, o.revokeJWT(ctx, claims)
+	}
+
+	return introspection, o.revokeSignIn(ctx, introspection.SessionID)
+}
+
+// revokeSignIn denies the tokens of a first-party sign-in by their sid, for
+// as long as any of them could be valid.
+func (o *OAuth) revokeSignIn(ctx context.Context, sessionID string) error {
+	ttl := max(o.opts.Config.Token.AccessTokenTTL, o.opts.Config.Token.RefreshTokenTTL)
+	return o.cache.Redis.Set(ctx, revokedSessionPrefix+sessionID, 1, ttl).Err()
+}
+
+func (o *OAuth) issueTokens(ctx context.Context, client *models.Client, userID, scope string, authTime time.Time, nonce string) (*models.TokenResponse, error) {
+	response := &models.TokenResponse{
+		TokenType: models.TokenTypeBearer,
+		ExpiresIn: int64(o.opts.Config.Token.AccessTokenTTL.Seconds()),
+		Scope:     scope,
+	}
+
+	var sessionID string
+	if client.AllowsGrant(models.GrantTypeRefreshToken) {
+		refreshToken, err := randomToken(32)
+		if err != nil {
+			return nil, err
+		}
+
+		sessionID, err = o.sessions.CreateSession(ctx, &models.Session{
+			UserID:           userID,
+			ClientID:         client.ID,
+			Scope:            scope,
+			RefreshTokenHash: hashToken(refreshToken),
+			ExpiresAt:        time.Now().Add(o.opts.Config.Token.RefreshTokenTTL),
+			AuthTime:         authTime,
+		})
+		if err != nil {
+			return nil, err
+		}
+		response.RefreshToken = refreshToken
+	}
+
+	accessToken, err := o.createAccessToken(ctx, userID, client.ID, scope, sessionID, models.PrincipalTypeUser)
+	if err != nil {
+		return nil, err
+	}
+	response.AccessToken = accessToken
+
+	if models.HasScope(scope, models.ScopeOpenID) {
+		response.IDToken, err = o.createIDToken(client.ID, userID, authTime, nonce, accessToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return response, nil
+}
+
+// createAccessToken issues an access token for a user, or for the client
+// itself when principalType is models.PrincipalTypeService. As a client acts
+// within its scope, the permissions claim only holds the permissions the
+// scope names: those of the user the scope names, and for service accounts
+// the scope itself. Roles are left out, as a backend granting by role would
+// give the client more than its scope.
+func (o *OAuth) createAccessToken(ctx context.Context, subject, clientID, scope, sessionID, principalType string) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{
+		"sub":            subject,
+		"type":           "access",
+		"jti":            jti,
+		"client_id":      clientID,
+		"scope":          scope,
+		"principal_type": principalType,
+	}
+	if sessionID != "" {
+		claims["sid"] = sessionID
+	}
+
+	permissions := models.ParseScope(scope)
+	if principalType == models.PrincipalTypeUser {
+		grants, err := o.rbac.Grants(ctx, subject)
+		if err != nil {
+			return "", err
+		}
+		permissions = slices.DeleteFunc(permissions, func(permission string) bool {
+			return !grants.Has(permission)
+		})
+	}
+	claims["permissions"] = permissions
+
+	return CreateJWT(o.opts.Config.Token.AccessTokenTTL, &o.opts.Config.Token, claims)
+}
+
+func (o *OAuth) createIDToken(clientID, userID string, authTime time.Time, nonce, accessToken string) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":       o.opts.Config.OAuth.Issuer,
+		"sub":       userID,
+		"aud":       clientID,
+		"azp":       clientID,
+		"iat":       jwt.NewNumericDate(now),
+		"exp":       jwt.NewNumericDate(now.Add(o.opts.Config.OIDC.IDTokenTTL)),
+		"auth_time": authTime.Unix(),
+		"at_hash":   accessTokenHash(accessToken),
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+
+	return o.keys.Sign(claims)
+}
+
+func (o *OAuth) introspectJWT(ctx context.Context, claims jwt.MapClaims) (*models.Introspection, error) {
+	introspection := &models.Introspection{Active: true}
+	switch tokenType, _ := claims["type"].(string); tokenType {
+	case "access":
+		introspection.TokenType = models.TokenTypeAccessToken
+	case "refresh":
+		introspection.TokenType = models.TokenTypeRefreshToken
+	default:
+		return &models.Introspection{Active: false}, nil
+	}
+
+	// Spent refresh tokens are inactive, and so are all tokens of a
+	// first-party sign-in whose refresh token was reused.
+	introspection.TokenID, _ = claims["jti"].(string)
+	introspection.SessionID, _ = claims["sid"].(string)
+	clientID, _ := claims["client_id"].(string)
+	var keys []string
+	if introspection.TokenID != "" {
+		keys = append(keys, revokedTokenPrefix+introspection.TokenID, rotatedTokenPrefix+introspection.TokenID)
+	}
+	if introspection.SessionID != "" && clientID == "" {
+		keys = append(keys, revokedSessionPrefix+introspection.SessionID)
+	}
+	if len(keys) > 0 {
+		revoked, err := o.cache.Redis.Exists(ctx, keys...).Result()
+		if err != nil {
+			return nil, err
+		}
+		if revoked > 0 {
+			return &models.Introspection{Active: false}, nil
+		}
+	}
+
+	if sub, _ := claims.GetSubject(); sub != "" {
+		loggedOut, err := o.loggedOutAt(ctx, sub)
+		if err != nil {
+			return nil, err
+		}
+		// iat has a resolution of seconds, so tokens issued in the second of
+		// the logout are revoked too.
+		if iat, err := claims.GetIssuedAt(); loggedOut > 0 && (err != nil || iat == nil || iat.Unix() <= loggedOut) {
+			return &models.Introspection{Active: false}, nil
+		}
+	}
+
+	// OAuth tokens name the session of their refresh token. First-party
+	// tokens have no client and their sid merely groups a sign-in's tokens.
+	if introspection.SessionID != "" && clientID != "" {
+		session, err := o.sessions.GetSession(ctx, introspection.SessionID)
+		if err != nil && !errors.Is(err, models.ErrNotFound) {
+			return nil, err
+		}
+		if session == nil || !session.Active(time.Now()) {
+			return &models.Introspection{Active: false}, nil
+		}
+	}
+
+	introspection.Subject, _ = claims.GetSubject()
+	introspection.Issuer, _ = claims.GetIssuer()
+	introspection.Audience, _ = claims.GetAudience()
+	introspection.Scope, _ = claims["scope"].(string)
+	introspection.ClientID, _ = claims["client_id"].(string)
+	introspection.OrgID, _ = claims["org_id"].(string)
+	introspection.Actor = models.ParseActor(claims["act"])
+	introspection.PrincipalType, _ = claims["principal_type"].(string)
+	if introspection.PrincipalType == "" {
+		// Tokens issued before the claim existed: client credentials tokens
+		// are the only ones whose subject is the client.
+		introspection.PrincipalType = models.PrincipalTypeUser
+		if introspection.ClientID != "" && introspection.Subject == introspection.ClientID {
+			introspection.PrincipalType = models.PrincipalTypeService
+		}
+	}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		introspection.ExpiresAt = exp.Unix()
+	}
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		introspection.IssuedAt = iat.Unix()
+	}
+
+	return introspection, nil
+}
+
+func (o *OAuth) introspectRefreshToken(ctx context.Context, token string) (*models.Introspection, error) {
+	session, err := o.sessions.GetSessionByRefreshToken(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return &models.Introspection{Active: false}, nil
+		}
+		return nil, err
+	}
+
+	if !session.Active(time.Now()) {
+		return &models.Introspection{Active: false}, nil
+	}
+
+	return &models.Introspection{
+		Active:        true,
+		Scope:         session.Scope,
+		ClientID:      session.ClientID,
+		Subject:       session.UserID,
+		TokenType:     models.TokenTypeRefreshToken,
+		PrincipalType: models.PrincipalTypeUser,
+		SessionID:     session.ID,
+		ExpiresAt:     session.ExpiresAt.Unix(),
+		IssuedAt:      session.UpdateAt.Unix(),
+	}, nil
+}
+
+// requireActive rejects grants for users who may not sign in, telling the
+// client why.
+func (o *OAuth) requireActive(ctx context.Context, userID string) error {
+	user, err := o.users.GetUser(ctx, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return models.NewOAuthError("invalid_grant", "unknown user")
+		}
+		return err
+	}
+	if err := user.StatusError(); err != nil {
+		return models.NewOAuthError("invalid_grant", err.Error())
+	}
+
+	return nil
+}
+
+// loggedOutAt returns when the user was last signed out everywhere, as a
+// Unix time, or 0.
+func (o *OAuth) loggedOutAt(ctx context.Context, userID string) (int64, error) {
+	value, err := o.cache.Redis.Get(ctx, userLogoutPrefix+userID).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+
+	return value, err
+}
+
+// revokeJWT denylists the token's jti until the token would have expired
+// anyway. Tokens without a jti cannot be revoked individually.
+func (o *OAuth) revokeJWT(ctx context.Context, claims jwt.MapClaims) error {
+	jti, _ := claims["jti"].(string)
+	exp, err := claims.GetExpirationTime()
+	if jti == "" || err != nil || exp == nil {
+		return nil
+	}
+
+	ttl := time.Until(exp.Time)
+	if ttl <= 0 {
+		return nil
+	}
+
+	return o.cache.Redis.Set(ctx, revokedTokenPrefix+jti, 1, ttl).Err()
+}
+
+func (o *OAuth) authenticateClient(ctx context.Context, clientID, clientSecret string) (*models.Client, error) {
+	if clientID == "" {
+		return nil, models.NewOAuthError("invalid_client", "client authentication failed")
+	}
+
+	client, err := o.repo.GetClient(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, models.NewOAuthError("invalid_client", "client authentication failed")
+		}
+		return nil, err
+	}
+
+	if !client.IsConfidential() {
+		if clientSecret != "" {
+			return nil, models.NewOAuthError("invalid_client", "public clients must not send a secret")
+		}
+		return client, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(client.SecretHash), []byte(hashToken(clientSecret))) != 1 {
+		return nil, models.NewOAuthError("invalid_client", "client authentication failed")
+	}
+
+	return client, nil
+}
+
+// authenticateAssertion authenticates a client with a JWT signed by one of
+// its registered keys (private_key_jwt, RFC 7523 section 2.2). The client_id
+// parameter is optional; the assertion's subject names the client. Each
+// assertion is accepted once.
+func (o *OAuth) authenticateAssertion(ctx context.Context, clientID, assertionType, assertion string) (*models.Client, error) {
+	invalid := models.NewOAuthError("invalid_client", "client authentication failed")
+
+	if assertionType != models.ClientAssertionTypeJWTBearer || assertion == "" {
+		return nil, models.NewOAuthError("invalid_client", "unsupported client assertion type")
+	}
+
+	if clientID == "" {
+		unverified, _, err := jwt.NewParser().ParseUnverified(assertion, jwt.MapClaims{})
+		if err != nil {
+			return nil, invalid
+		}
+		clientID, _ = unverified.Claims.GetSubject()
+		if clientID == "" {
+			return nil, invalid
+		}
+	}
+
+	client, err := o.repo.GetClient(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, invalid
+		}
+		return nil, err
+	}
+	if !client.IsConfidential() {
+		return nil, invalid
+	}
+
+	keys, err := o.repo.ListClientKeys(ctx, client.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := jwt.Parse(assertion, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		for _, key := range keys {
+			if kid != "" && kid != key.ID {
+				continue
+			}
+			if kid == "" && len(keys) > 1 {
+				return nil, fmt.Errorf("assertion must name its key")
+			}
+			publicKey, _, err := parsePublicKey(key.PublicKey)
+			return publicKey, err
+		}
+		return nil, fmt.Errorf("unknown key %q", kid)
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg()}),
+		jwt.WithIssuer(client.ID),
+		jwt.WithSubject(client.ID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, invalid
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, invalid
+	}
+
+	audience, _ := claims.GetAudience()
+	tokenEndpoint := o.opts.Config.OAuth.Issuer + "/token"
+	if !slices.Contains(audience, o.opts.Config.OAuth.Issuer) && !slices.Contains(audience, tokenEndpoint) {
+		return nil, models.NewOAuthError("invalid_client", "assertion audience must be the token endpoint")
+	}
+
+	exp, _ := claims.GetExpirationTime()
+	ttl := time.Until(exp.Time)
+	if ttl > maxAssertionLifetime {
+		return nil, models.NewOAuthError("invalid_client", "assertion lifetime is too long")
+	}
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil, models.NewOAuthError("invalid_client", "assertion must have a jti")
+	}
+	fresh, err := o.cache.Redis.SetNX(ctx, clientAssertionPrefix+client.ID+":"+jti, 1, ttl).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		return nil, models.NewOAuthError("invalid_client", "assertion was already used")
+	}
+
+	return client, nil
+}
+
+// accessTokenHash computes the at_hash claim: the left half of the SHA-256
+// digest of the access token, as required for RS256 ID tokens.
+func accessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
+
+func verifyCodeChallenge(challenge, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("token generate error: %v", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
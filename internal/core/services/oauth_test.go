@@ -0,0 +1,435 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/co1seam/ember-backend-auth/config"
+	"github.com/co1seam/ember-backend-auth/internal/adapters/metrics"
+	"github.com/co1seam/ember-backend-auth/internal/adapters/repository"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestOAuth(rbac *fakeRBAC) *OAuth {
+	cfg := &config.Config{}
+	cfg.Token = config.Token{Secret: "secret", AccessTokenTTL: time.Minute, RefreshTokenTTL: time.Hour, Issuer: "https://auth.example.com"}
+
+	return &OAuth{rbac: rbac, opts: &models.Options{Config: cfg}}
+}
+
+func TestCreateAccessTokenPermissions(t *testing.T) {
+	o := newTestOAuth(&fakeRBAC{permissions: map[string][]string{
+		adminID: {models.PermissionUsersRead, models.PermissionUsersManage},
+	}})
+
+	tests := []struct {
+		name          string
+		subject       string
+		scope         string
+		principalType string
+		want          []string
+	}{
+		{name: "user", subject: adminID, scope: "openid users:read", principalType: models.PrincipalTypeUser, want: []string{models.PermissionUsersRead}},
+		{name: "user without the scoped permission", subject: adminID, scope: "roles:manage", principalType: models.PrincipalTypeUser, want: []string{}},
+		{name: "user without permissions in scope", subject: memberID, scope: "openid profile", principalType: models.PrincipalTypeUser, want: []string{}},
+		{name: "service account", subject: "client", scope: "users:read audit:read", principalType: models.PrincipalTypeService, want: []string{models.PermissionUsersRead, models.PermissionAuditRead}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := o.createAccessToken(context.Background(), tt.subject, "client", tt.scope, "", tt.principalType)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claims, err := VerifyJWT(token, &o.opts.Config.Token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := claims["roles"]; ok {
+				t.Error("the token carries roles")
+			}
+
+			permissions, _ := stringsClaim(claims["permissions"])
+			if !slices.Equal(permissions, tt.want) {
+				t.Fatalf("got permissions %v, want %v", permissions, tt.want)
+			}
+		})
+	}
+}
+
+// fakeSessions keeps OAuth sessions in memory.
+type fakeSessions struct {
+	ports.ISessionRepo
+	sessions map[string]*models.Session
+}
+
+func (f *fakeSessions) GetSession(_ context.Context, sessionID string) (*models.Session, error) {
+	session, ok := f.sessions[sessionID]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+
+	return session, nil
+}
+
+func (f *fakeSessions) GetSessionByRefreshToken(_ context.Context, refreshTokenHash string) (*models.Session, error) {
+	for _, session := range f.sessions {
+		if session.RefreshTokenHash == refreshTokenHash {
+			return session, nil
+		}
+	}
+
+	return nil, models.ErrNotFound
+}
+
+func (f *fakeSessions) RotateRefreshToken(_ context.Context, sessionID, oldHash, newHash string, expiresAt time.Time) error {
+	session, ok := f.sessions[sessionID]
+	if !ok || session.RefreshTokenHash != oldHash {
+		return models.ErrNotFound
+	}
+	session.RefreshTokenHash, session.ExpiresAt = newHash, expiresAt
+
+	return nil
+}
+
+func (f *fakeSessions) RevokeSession(_ context.Context, sessionID string) error {
+	now := time.Now()
+	f.sessions[sessionID].RevokedAt = &now
+	return nil
+}
+
+// withTestRedis backs the cache of o with an in-memory Redis.
+func withTestRedis(t *testing.T, o *OAuth) *miniredis.Miniredis {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	o.cache = &repository.Redis{Redis: redis.NewClient(&redis.Options{Addr: server.Addr()})}
+	t.Cleanup(func() { _ = o.cache.Redis.Close() })
+
+	return server
+}
+
+func firstPartyTokens(t *testing.T, o *OAuth, sessionID string) (refresh, access string) {
+	t.Helper()
+
+	cfg := &o.opts.Config.Token
+	claims := func(tokenType string) jwt.MapClaims {
+		return jwt.MapClaims{"sub": memberID, "type": tokenType, "jti": uuid.NewString(), "sid": sessionID}
+	}
+	refresh, err := CreateJWT(cfg.RefreshTokenTTL, cfg, claims("refresh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	access, err = CreateJWT(cfg.AccessTokenTTL, cfg, claims("access"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return refresh, access
+}
+
+func TestRotateRefreshTokenReuse(t *testing.T) {
+	o := newTestOAuth(&fakeRBAC{})
+	audit := &fakeAudit{}
+	o.audit, o.sessions = audit, &fakeSessions{}
+	withTestRedis(t, o)
+	ctx := context.Background()
+
+	refresh, access := firstPartyTokens(t, o, "sign-in")
+	otherRefresh, _ := firstPartyTokens(t, o, "other sign-in")
+	reuses := testutil.ToFloat64(metrics.RefreshTokenReuses)
+
+	introspection, err := o.RotateRefreshToken(ctx, refresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !introspection.Active || introspection.Subject != memberID {
+		t.Fatalf("first use: got %+v, want an active token of the member", introspection)
+	}
+	if introspection, _ := o.InspectToken(ctx, refresh, models.TokenTypeRefreshToken); introspection.Active {
+		t.Fatal("a spent refresh token is still active")
+	}
+	if introspection, _ := o.InspectToken(ctx, access, models.TokenTypeAccessToken); !introspection.Active {
+		t.Fatal("rotating revoked the access token of the sign-in")
+	}
+
+	introspection, err = o.RotateRefreshToken(ctx, refresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if introspection.Active {
+		t.Fatal("a reused refresh token was accepted")
+	}
+	if got := testutil.ToFloat64(metrics.RefreshTokenReuses) - reuses; got != 1 {
+		t.Fatalf("counted %v reuses, want 1", got)
+	}
+	if len(audit.events) != 1 || audit.events[0].Type != models.AuditTokenReused || audit.events[0].SessionID != "sign-in" {
+		t.Fatalf("got audit events %+v, want one reuse of the sign-in", audit.events)
+	}
+
+	// The reuse revoked the whole sign-in, but no other.
+	if introspection, _ := o.InspectToken(ctx, access, models.TokenTypeAccessToken); introspection.Active {
+		t.Fatal("the access token of the sign-in is still active")
+	}
+	if introspection, _ := o.RotateRefreshToken(ctx, otherRefresh); !introspection.Active {
+		t.Fatal("the reuse revoked another sign-in")
+	}
+}
+
+func TestExchangeRefreshTokenReuse(t *testing.T) {
+	o := newTestOAuth(&fakeRBAC{})
+	audit := &fakeAudit{}
+	sessions := &fakeSessions{sessions: map[string]*models.Session{
+		"session": {ID: "session", UserID: memberID, ClientID: "client", Scope: "profile", RefreshTokenHash: hashToken("first"), ExpiresAt: time.Now().Add(time.Hour)},
+	}}
+	o.audit, o.sessions = audit, sessions
+	o.users = &fakeUsers{users: map[string]*models.User{memberID: {ID: memberID, Status: models.UserStatusActive}}}
+	withTestRedis(t, o)
+	ctx := context.Background()
+	client := &models.Client{ID: "client"}
+	reuses := testutil.ToFloat64(metrics.RefreshTokenReuses)
+
+	response, err := o.exchangeRefreshToken(ctx, client, models.TokenRequest{RefreshToken: "first"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An unknown token is not reuse.
+	if _, err := o.exchangeRefreshToken(ctx, client, models.TokenRequest{RefreshToken: "unknown"}); err == nil {
+		t.Fatal("an unknown refresh token was accepted")
+	}
+	if sessions.sessions["session"].RevokedAt != nil {
+		t.Fatal("an unknown refresh token revoked the session")
+	}
+
+	if _, err := o.exchangeRefreshToken(ctx, client, models.TokenRequest{RefreshToken: "first"}); err == nil {
+		t.Fatal("a reused refresh token was accepted")
+	}
+	if sessions.sessions["session"].RevokedAt == nil {
+		t.Fatal("the reuse did not revoke the session")
+	}
+	if got := testutil.ToFloat64(metrics.RefreshTokenReuses) - reuses; got != 1 {
+		t.Fatalf("counted %v reuses, want 1", got)
+	}
+	if len(audit.events) != 1 || audit.events[0].UserID != memberID || audit.events[0].Metadata["client_id"] != "client" {
+		t.Fatalf("got audit events %+v, want one reuse by the member", audit.events)
+	}
+
+	// The successor of the reused token was revoked with its session.
+	if _, err := o.exchangeRefreshToken(ctx, client, models.TokenRequest{RefreshToken: response.RefreshToken}); err == nil {
+		t.Fatal("the successor of a reused refresh token was accepted")
+	}
+}
+
+func TestRevokeSignIn(t *testing.T) {
+	o := newTestOAuth(&fakeRBAC{})
+	o.sessions = &fakeSessions{}
+	withTestRedis(t, o)
+	ctx := context.Background()
+
+	refresh, access := firstPartyTokens(t, o, "sign-in")
+	otherRefresh, otherAccess := firstPartyTokens(t, o, "other sign-in")
+
+	introspection, err := o.RevokeSignIn(ctx, refresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !introspection.Active || introspection.SessionID != "sign-in" {
+		t.Fatalf("got %+v, want the sign-in of the token", introspection)
+	}
+
+	for name, token := range map[string]string{"refresh": refresh, "access": access} {
+		if introspection, _ := o.InspectToken(ctx, token, ""); introspection.Active {
+			t.Errorf("the %s token of the sign-in is still active", name)
+		}
+	}
+	for name, token := range map[string]string{"refresh": otherRefresh, "access": otherAccess} {
+		if introspection, _ := o.InspectToken(ctx, token, ""); !introspection.Active {
+			t.Errorf("the %s token of another sign-in was revoked", name)
+		}
+	}
+
+	// Signing out again finds nothing to revoke.
+	if introspection, _ := o.RevokeSignIn(ctx, access); introspection.Active {
+		t.Fatal("a revoked sign-in was signed out of again")
+	}
+}
+
+func (f *fakeSessions) CreateSession(_ context.Context, session *models.Session) (string, error) {
+	session.ID = fmt.Sprintf("session-%d", len(f.sessions)+1)
+	f.sessions[session.ID] = session
+
+	return session.ID, nil
+}
+
+// fakeClients knows the OAuth clients of clients.
+type fakeClients struct {
+	ports.IOAuthRepo
+	clients map[string]*models.Client
+}
+
+func (f *fakeClients) GetClient(_ context.Context, clientID string) (*models.Client, error) {
+	client, ok := f.clients[clientID]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+
+	return client, nil
+}
+
+func oauthErrorCode(err error) string {
+	var oauthErr *models.OAuthError
+	if errors.As(err, &oauthErr) {
+		return oauthErr.Code
+	}
+
+	return ""
+}
+
+const testRedirectURI = "https://app.example.com/callback"
+
+func TestAuthorizationCodeGrant(t *testing.T) {
+	o := newTestOAuth(&fakeRBAC{})
+	o.opts.Config.OAuth.CodeTTL = time.Minute
+	sessions := &fakeSessions{sessions: map[string]*models.Session{}}
+	o.sessions = sessions
+	o.users = &fakeUsers{users: map[string]*models.User{memberID: {ID: memberID, Status: models.UserStatusActive}}}
+	public := func(id string) *models.Client {
+		return &models.Client{ID: id, Type: models.ClientTypePublic, RedirectURIs: []string{testRedirectURI}, GrantTypes: []string{models.GrantTypeAuthorizationCode, models.GrantTypeRefreshToken}}
+	}
+	o.repo = &fakeClients{clients: map[string]*models.Client{"app": public("app"), "other": public("other")}}
+	withTestRedis(t, o)
+	ctx := context.Background()
+
+	verifier := strings.Repeat("v", 43)
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	authorize := func(t *testing.T) string {
+		t.Helper()
+
+		code, err := o.Authorize(ctx, models.AuthorizeRequest{ClientID: "app", RedirectURI: testRedirectURI, Scope: "profile", CodeChallenge: challenge, CodeChallengeMethod: "S256"}, memberID, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return code
+	}
+	request := func(code string) models.TokenRequest {
+		return models.TokenRequest{GrantType: models.GrantTypeAuthorizationCode, ClientID: "app", Code: code, RedirectURI: testRedirectURI, CodeVerifier: verifier}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(req *models.TokenRequest)
+		code   string
+	}{
+		{name: "wrong verifier", modify: func(req *models.TokenRequest) { req.CodeVerifier = strings.Repeat("w", 43) }, code: "invalid_grant"},
+		{name: "short verifier", modify: func(req *models.TokenRequest) { req.CodeVerifier = "v" }, code: "invalid_grant"},
+		{name: "no verifier", modify: func(req *models.TokenRequest) { req.CodeVerifier = "" }, code: "invalid_grant"},
+		{name: "other redirect URI", modify: func(req *models.TokenRequest) { req.RedirectURI = "https://evil.example.com/callback" }, code: "invalid_grant"},
+		{name: "other client", modify: func(req *models.TokenRequest) { req.ClientID = "other" }, code: "invalid_grant"},
+		{name: "public client with a secret", modify: func(req *models.TokenRequest) { req.ClientSecret = "secret" }, code: "invalid_client"},
+		{name: "unknown code", modify: func(req *models.TokenRequest) { req.Code = "unknown" }, code: "invalid_grant"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := authorize(t)
+			req := request(code)
+			tt.modify(&req)
+
+			if _, err := o.Token(ctx, req); oauthErrorCode(err) != tt.code {
+				t.Fatalf("got %v, want %s", err, tt.code)
+			}
+			// A code is spent by any attempt to redeem it, so that a
+			// verifier cannot be guessed.
+			if req.ClientSecret == "" && req.Code == code {
+				if _, err := o.Token(ctx, request(code)); oauthErrorCode(err) != "invalid_grant" {
+					t.Fatalf("redeemed a code after a failed attempt: %v", err)
+				}
+			}
+		})
+	}
+
+	code := authorize(t)
+	response, err := o.Token(ctx, request(code))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.RefreshToken == "" || response.IDToken != "" {
+		t.Fatalf("got %+v, want a refresh token and no ID token", response)
+	}
+
+	claims, err := VerifyJWT(response.AccessToken, &o.opts.Config.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := sessions.sessions[claims["sid"].(string)]
+	if claims["sub"] != memberID || claims["client_id"] != "app" || session == nil || session.RefreshTokenHash != hashToken(response.RefreshToken) {
+		t.Fatalf("got claims %v, want an access token of the member bound to the session of the refresh token", claims)
+	}
+
+	if _, err := o.Token(ctx, request(code)); oauthErrorCode(err) != "invalid_grant" {
+		t.Fatalf("redeemed a code twice: %v", err)
+	}
+}
+
+func TestClientCredentialsGrant(t *testing.T) {
+	o := newTestOAuth(&fakeRBAC{})
+	o.repo = &fakeClients{clients: map[string]*models.Client{
+		"service": {ID: "service", Type: models.ClientTypeConfidential, SecretHash: hashToken("secret"), GrantTypes: []string{models.GrantTypeClientCredentials}, Scopes: []string{models.PermissionUsersRead, models.PermissionAuditRead}},
+		"public":  {ID: "public", Type: models.ClientTypePublic, GrantTypes: []string{models.GrantTypeClientCredentials}},
+		"web":     {ID: "web", Type: models.ClientTypeConfidential, SecretHash: hashToken("secret"), GrantTypes: []string{models.GrantTypeAuthorizationCode}},
+	}}
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		req   models.TokenRequest
+		code  string
+		scope string
+	}{
+		{name: "default scope", req: models.TokenRequest{ClientID: "service", ClientSecret: "secret"}, scope: models.PermissionUsersRead + " " + models.PermissionAuditRead},
+		{name: "narrowed scope", req: models.TokenRequest{ClientID: "service", ClientSecret: "secret", Scope: models.PermissionAuditRead}, scope: models.PermissionAuditRead},
+		{name: "scope beyond registration", req: models.TokenRequest{ClientID: "service", ClientSecret: "secret", Scope: models.PermissionUsersManage}, code: "invalid_scope"},
+		{name: "wrong secret", req: models.TokenRequest{ClientID: "service", ClientSecret: "wrong"}, code: "invalid_client"},
+		{name: "unknown client", req: models.TokenRequest{ClientID: "unknown", ClientSecret: "secret"}, code: "invalid_client"},
+		{name: "public client", req: models.TokenRequest{ClientID: "public"}, code: "unauthorized_client"},
+		{name: "grant not registered", req: models.TokenRequest{ClientID: "web", ClientSecret: "secret"}, code: "unauthorized_client"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.GrantType = models.GrantTypeClientCredentials
+			response, err := o.Token(ctx, tt.req)
+			if oauthErrorCode(err) != tt.code {
+				t.Fatalf("got %v, want %q", err, tt.code)
+			}
+			if err != nil {
+				return
+			}
+
+			claims, err := VerifyJWT(response.AccessToken, &o.opts.Config.Token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims["sub"] != tt.req.ClientID || claims["principal_type"] != models.PrincipalTypeService || claims["scope"] != tt.scope || response.RefreshToken != "" {
+				t.Fatalf("got claims %v, want a service token with scope %q", claims, tt.scope)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+)
+
+type OIDC struct {
+	oauth *OAuth
+	users ports.IUserRepo
+	keys  *KeySet
+	opts  *models.Options
+}
+
+func NewOIDC(oauth *OAuth, users ports.IUserRepo, keys *KeySet, opts *models.Options) *OIDC {
+	return &OIDC{oauth: oauth, users: users, keys: keys, opts: opts}
+}
+
+func (o *OIDC) Discovery() *models.DiscoveryDocument {
+	issuer := o.opts.Config.OAuth.Issuer
+
+	return &models.DiscoveryDocument{
+		Issuer:                 issuer,
+		AuthorizationEndpoint:  issuer + "/authorize",
+		TokenEndpoint:          issuer + "/token",
+		UserInfoEndpoint:       issuer + "/userinfo",
+		JWKSURI:                issuer + "/.well-known/jwks.json",
+		RevocationEndpoint:     issuer + "/revoke",
+		IntrospectionEndpoint:  issuer + "/introspect",
+		ScopesSupported:        []string{models.ScopeOpenID, models.ScopeProfile, models.ScopeEmail},
+		ResponseTypesSupported: []string{"code"},
+		GrantTypesSupported: []string{
+			models.GrantTypeAuthorizationCode,
+			models.GrantTypeClientCredentials,
+			models.GrantTypeRefreshToken,
+			models.GrantTypeTokenExchange,
+		},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "private_key_jwt", "none"},
+		CodeChallengeMethodsSupported:     []string{models.CodeChallengeMethodS256},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "at_hash", "name", "email", "updated_at"},
+		PromptValuesSupported:             []string{models.PromptNone, models.PromptLogin, models.PromptConsent},
+	}
+}
+
+func (o *OIDC) JWKS() models.JSONWebKeySet {
+	return o.keys.JWKS()
+}
+
+// UserInfo returns the claims about the end-user that the scopes granted to
+// the access token allow to release.
+func (o *OIDC) UserInfo(ctx context.Context, accessToken string) (*models.UserInfo, error) {
+	introspection, err := o.oauth.InspectToken(ctx, accessToken, models.TokenTypeAccessToken)
+	if err != nil {
+		return nil, err
+	}
+	if !introspection.Active || introspection.TokenType != models.TokenTypeAccessToken {
+		return nil, models.NewOAuthError("invalid_token", "access token is invalid or expired")
+	}
+
+	if !models.HasScope(introspection.Scope, models.ScopeOpenID) {
+		return nil, models.NewOAuthError("insufficient_scope", "the openid scope is required")
+	}
+
+	user, err := o.users.GetUser(ctx, introspection.Subject)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, models.NewOAuthError("invalid_token", "the end-user no longer exists")
+		}
+		return nil, err
+	}
+
+	info := &models.UserInfo{Subject: user.ID}
+	if models.HasScope(introspection.Scope, models.ScopeProfile) {
+		info.Name = user.Name
+		info.UpdatedAt = user.UpdateAt.Unix()
+	}
+	if models.HasScope(introspection.Scope, models.ScopeEmail) {
+		info.Email = user.Email
+	}
+
+	return info, nil
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"regexp"
+	"strings"
+)
+
+var orgSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,62}[a-z0-9]$`)
+
+type Organizations struct {
+	repo  ports.IOrganizationRepo
+	rbac  ports.IRBACService
+	audit ports.IAuditRepo
+	opts  *models.Options
+}
+
+func NewOrganizations(repo ports.IOrganizationRepo, rbac ports.IRBACService, audit ports.IAuditRepo, opts *models.Options) *Organizations {
+	return &Organizations{repo: repo, rbac: rbac, audit: audit, opts: opts}
+}
+
+func (o *Organizations) CreateOrganization(ctx context.Context, actorID, name, slug string) (*models.Organization, error) {
+	name = strings.TrimSpace(name)
+	slug = strings.ToLower(strings.TrimSpace(slug))
+	if name == "" || !orgSlugPattern.MatchString(slug) {
+		return nil, fmt.Errorf("%w: a name and a slug of 3-64 lowercase letters, digits or dashes are required", models.ErrInvalidOrgInput)
+	}
+
+	org := &models.Organization{Name: name, Slug: slug}
+	id, err := o.repo.CreateOrganization(ctx, org, actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	return o.repo.GetOrganization(ctx, id)
+}
+
+func (o *Organizations) ListOrganizations(ctx context.Context, userID string) ([]models.Membership, error) {
+	return o.repo.ListMemberships(ctx, userID)
+}
+
+func (o *Organizations) Membership(ctx context.Context, orgID, userID string) (*models.Membership, error) {
+	return o.repo.GetMembership(ctx, orgID, userID)
+}
+
+// DefaultMembership picks the organization a new token is scoped to when the
+// client did not ask for one: the oldest membership. It returns nil for users
+// without organizations.
+func (o *Organizations) DefaultMembership(ctx context.Context, userID string) (*models.Membership, error) {
+	memberships, err := o.repo.ListMemberships(ctx, userID)
+	if err != nil || len(memberships) == 0 {
+		return nil, err
+	}
+
+	return &memberships[0], nil
+}
+
+func (o *Organizations) ListMembers(ctx context.Context, actorID, orgID string) ([]models.Membership, error) {
+	if _, err := o.repo.GetMembership(ctx, orgID, actorID); err != nil {
+		return nil, err
+	}
+
+	return o.repo.ListMembers(ctx, orgID)
+}
+
+func (o *Organizations) AddMember(ctx context.Context, actorID, orgID, userID, role string) error {
+	if err := o.authorizeRoleChange(ctx, actorID, orgID, "", role); err != nil {
+		return err
+	}
+
+	if err := o.repo.AddMember(ctx, orgID, userID, role); err != nil {
+		return err
+	}
+
+	return o.record(ctx, models.AuditMemberAdded, actorID, orgID, userID, role)
+}
+
+func (o *Organizations) UpdateMember(ctx context.Context, actorID, orgID, userID, role string) error {
+	member, err := o.repo.GetMembership(ctx, orgID, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := o.authorizeRoleChange(ctx, actorID, orgID, member.Role, role); err != nil {
+		return err
+	}
+
+	if err := o.repo.UpdateMemberRole(ctx, orgID, userID, role); err != nil {
+		return err
+	}
+
+	return o.record(ctx, models.AuditMemberUpdated, actorID, orgID, userID, role)
+}
+
+// RemoveMember removes a member. Anyone may leave an organization; removing
+// others takes the same rights as changing their role.
+func (o *Organizations) RemoveMember(ctx context.Context, actorID, orgID, userID string) error {
+	member, err := o.repo.GetMembership(ctx, orgID, userID)
+	if err != nil {
+		return err
+	}
+
+	if actorID != userID {
+		if err := o.authorizeRoleChange(ctx, actorID, orgID, member.Role, models.OrgRoleMember); err != nil {
+			return err
+		}
+	}
+
+	if err := o.repo.RemoveMember(ctx, orgID, userID); err != nil {
+		return err
+	}
+
+	return o.record(ctx, models.AuditMemberRemoved, actorID, orgID, userID, member.Role)
+}
+
+// AddDomain registers an email domain for auto-join. Claiming a domain lets
+// an organization absorb every new account from it, so besides managing the
+// organization this requires the global organizations:domains permission.
+func (o *Organizations) AddDomain(ctx context.Context, actorID, orgID, domain, role string) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if domain == "" || strings.ContainsAny(domain, "@ ") || !strings.Contains(domain, ".") {
+		return fmt.Errorf("%w: invalid email domain %q", models.ErrInvalidOrgInput, domain)
+	}
+	if role == "" {
+		role = models.OrgRoleMember
+	}
+	if role == models.OrgRoleOwner || !models.ValidOrgRole(role) {
+		return models.ErrInvalidOrgRole
+	}
+
+	if err := o.requireManager(ctx, actorID, orgID); err != nil {
+		return err
+	}
+
+	allowed, err := o.rbac.CheckPermission(ctx, actorID, models.PermissionOrganizationDomains)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return models.ErrPermissionDenied
+	}
+
+	return o.repo.AddDomain(ctx, orgID, domain, role)
+}
+
+func (o *Organizations) ListDomains(ctx context.Context, actorID, orgID string) ([]models.OrganizationDomain, error) {
+	if err := o.requireManager(ctx, actorID, orgID); err != nil {
+		return nil, err
+	}
+
+	return o.repo.ListDomains(ctx, orgID)
+}
+
+func (o *Organizations) RemoveDomain(ctx context.Context, actorID, orgID, domain string) error {
+	if err := o.requireManager(ctx, actorID, orgID); err != nil {
+		return err
+	}
+
+	return o.repo.RemoveDomain(ctx, orgID, strings.ToLower(strings.TrimSpace(domain)))
+}
+
+// AutoJoin adds a new user to the organization that registered the domain of
+// their email address. Callers must only pass verified addresses. It returns
+// the joined organization's ID, or "" when there is none.
+func (o *Organizations) AutoJoin(ctx context.Context, userID, email string) (string, error) {
+	_, domain, ok := strings.Cut(strings.ToLower(email), "@")
+	if !ok || domain == "" {
+		return "", nil
+	}
+
+	orgID, err := o.repo.JoinByDomain(ctx, userID, domain)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return orgID, o.record(ctx, models.AuditMemberAdded, "", orgID, userID, "domain:"+domain)
+}
+
+// authorizeRoleChange checks that the actor may move a member from one role
+// to another: owners may do anything, admins may not touch owners.
+func (o *Organizations) authorizeRoleChange(ctx context.Context, actorID, orgID, from, to string) error {
+	if !models.ValidOrgRole(to) {
+		return models.ErrInvalidOrgRole
+	}
+
+	actor, err := o.repo.GetMembership(ctx, orgID, actorID)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case actor.Role == models.OrgRoleOwner:
+		return nil
+	case actor.Role == models.OrgRoleAdmin && from != models.OrgRoleOwner && to != models.OrgRoleOwner:
+		return nil
+	default:
+		return models.ErrPermissionDenied
+	}
+}
+
+func (o *Organizations) requireManager(ctx context.Context, actorID, orgID string) error {
+	actor, err := o.repo.GetMembership(ctx, orgID, actorID)
+	if err != nil {
+		return err
+	}
+	if !actor.CanManage() {
+		return models.ErrPermissionDenied
+	}
+
+	return nil
+}
+
+func (o *Organizations) record(ctx context.Context, eventType, actorID, orgID, userID, role string) error {
+	metadata := map[string]string{"org_id": orgID, "role": role}
+	if actorID != "" {
+		metadata["actor_id"] = actorID
+	}
+
+	return o.audit.Record(ctx, &models.AuditEvent{
+		Type:     eventType,
+		UserID:   userID,
+		OrgID:    orgID,
+		Outcome:  models.AuditOutcomeSuccess,
+		Metadata: metadata,
+	})
+}
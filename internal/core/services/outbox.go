@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"sync"
+	"time"
+)
+
+const (
+	// outboxTimeout bounds publishing a batch or purging.
+	outboxTimeout = 30 * time.Second
+
+	// outboxLease is how long a batch stays claimed by the relay publishing
+	// it. It outlasts outboxTimeout, so that a batch is only relayed again
+	// once its first relay gave up.
+	outboxLease = 2 * outboxTimeout
+
+	// outboxPurgeInterval is how often published events are purged.
+	outboxPurgeInterval = time.Hour
+)
+
+// EventRelay publishes the domain events of the outbox to every sink. An
+// event is marked published once all sinks accepted it; until then it is
+// retried, so sinks that already had it get it again.
+type EventRelay struct {
+	repo       ports.IOutboxRepo
+	publishers []ports.IEventPublisher
+	stop       chan struct{}
+	wg         sync.WaitGroup
+	once       sync.Once
+	opts       *models.Options
+}
+
+// NewEventRelay starts relaying. Without sinks, events accumulate in the
+// outbox until one is configured; webhook subscriptions always count as one.
+func NewEventRelay(repo ports.IOutboxRepo, publishers []ports.IEventPublisher, opts *models.Options) *EventRelay {
+	r := &EventRelay{
+		repo:       repo,
+		publishers: publishers,
+		stop:       make(chan struct{}),
+		opts:       opts,
+	}
+
+	if len(publishers) > 0 {
+		r.wg.Add(1)
+		go r.run()
+	}
+
+	return r
+}
+
+// Close stops relaying after the batch in progress.
+func (r *EventRelay) Close(ctx context.Context) error {
+	r.once.Do(func() { close(r.stop) })
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *EventRelay) run() {
+	defer r.wg.Done()
+
+	cfg := &r.opts.Config.Events
+	ticker := time.NewTicker(cfg.RelayInterval)
+	defer ticker.Stop()
+
+	lastPurge := time.Now()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+
+		// A full batch suggests more events are due, so the next one
+		// follows right away.
+		for {
+			count, err := r.relay(cfg.BatchSize)
+			if err != nil {
+				_ = r.opts.Logger.Error("failed to relay domain events", "error", err)
+			}
+			if err != nil || count < cfg.BatchSize {
+				break
+			}
+
+			select {
+			case <-r.stop:
+				return
+			default:
+			}
+		}
+
+		if time.Since(lastPurge) >= outboxPurgeInterval {
+			lastPurge = time.Now()
+			r.purge()
+		}
+	}
+}
+
+// relay publishes one batch and returns how many events it handled.
+func (r *EventRelay) relay(limit int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), outboxTimeout)
+	defer cancel()
+
+	handled := 0
+	_, err := r.repo.PublishOutboxEvents(ctx, limit, outboxLease, r.opts.Config.Events.MaxBackoff, func(event *models.DomainEvent) error {
+		handled++
+		for _, publisher := range r.publishers {
+			if err := publisher.Publish(ctx, event); err != nil {
+				_ = r.opts.Logger.Error("failed to publish domain event", "sink", publisher.Name(), "event_id", event.ID,
+					"event_type", event.Type, "attempts", event.Attempts+1, "error", err)
+				return fmt.Errorf("%s: %w", publisher.Name(), err)
+			}
+		}
+		return nil
+	})
+
+	return handled, err
+}
+
+func (r *EventRelay) purge() {
+	ctx, cancel := context.WithTimeout(context.Background(), outboxTimeout)
+	defer cancel()
+
+	if _, err := r.repo.PurgeOutboxEvents(ctx, time.Now().Add(-r.opts.Config.Events.Retention)); err != nil {
+		_ = r.opts.Logger.Error("failed to purge domain events", "error", err)
+	}
+}
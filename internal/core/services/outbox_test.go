@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/co1seam/ember-backend-auth/config"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"github.com/co1seam/ember-backend-auth/pkg/logger"
+	"io"
+	"testing"
+	"time"
+)
+
+// fakeOutbox hands its events to publish and records the outcomes.
+type fakeOutbox struct {
+	ports.IOutboxRepo
+	events    []models.DomainEvent
+	lease     time.Duration
+	published []string
+	failed    []string
+}
+
+func (f *fakeOutbox) PublishOutboxEvents(_ context.Context, limit int, lease, _ time.Duration, publish func(event *models.DomainEvent) error) (int, error) {
+	f.lease = lease
+	for i := range f.events[:min(limit, len(f.events))] {
+		if err := publish(&f.events[i]); err != nil {
+			f.failed = append(f.failed, f.events[i].ID)
+			continue
+		}
+		f.published = append(f.published, f.events[i].ID)
+	}
+
+	return len(f.published), nil
+}
+
+// fakeSink accepts events unless they are rejected.
+type fakeSink struct {
+	reject   map[string]bool
+	received []string
+}
+
+func (f *fakeSink) Name() string {
+	return "fake"
+}
+
+func (f *fakeSink) Publish(_ context.Context, event *models.DomainEvent) error {
+	if f.reject[event.ID] {
+		return errors.New("rejected")
+	}
+	f.received = append(f.received, event.ID)
+	return nil
+}
+
+func TestEventRelay(t *testing.T) {
+	repo := &fakeOutbox{events: []models.DomainEvent{{ID: "a"}, {ID: "b"}, {ID: "c"}}}
+	first := &fakeSink{reject: map[string]bool{"b": true}}
+	second := &fakeSink{}
+	r := &EventRelay{repo: repo, publishers: []ports.IEventPublisher{first, second}, opts: &models.Options{
+		Config: &config.Config{},
+		Logger: logger.New(context.Background(), logger.Options{Output: io.Discard}),
+	}}
+
+	handled, err := r.relay(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if handled != 3 {
+		t.Fatalf("handled %d events, want 3", handled)
+	}
+
+	// A claim must outlast the batch, or another relay publishes it again.
+	if repo.lease <= outboxTimeout {
+		t.Fatalf("events are claimed for %s, not longer than a batch may take", repo.lease)
+	}
+	if len(repo.failed) != 1 || repo.failed[0] != "b" {
+		t.Fatalf("got failed events %v, want b", repo.failed)
+	}
+	// An event rejected by one sink is not handed to the next.
+	if len(second.received) != 2 {
+		t.Fatalf("the second sink received %v, want a and c", second.received)
+	}
+}
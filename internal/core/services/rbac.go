@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+)
+
+type RBAC struct {
+	repo  ports.IRBACRepo
+	audit ports.IAuditRepo
+	opts  *models.Options
+}
+
+func NewRBAC(repo ports.IRBACRepo, audit ports.IAuditRepo, opts *models.Options) *RBAC {
+	return &RBAC{repo: repo, audit: audit, opts: opts}
+}
+
+func (r *RBAC) Grants(ctx context.Context, userID string) (*models.Grants, error) {
+	return r.repo.GetGrants(ctx, userID)
+}
+
+// CheckPermission answers from the database rather than from token claims, so
+// revoked roles take effect before the caller's access token expires.
+func (r *RBAC) CheckPermission(ctx context.Context, userID, permission string) (bool, error) {
+	grants, err := r.repo.GetGrants(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return grants.Has(permission), nil
+}
+
+func (r *RBAC) ListRoles(ctx context.Context) ([]models.Role, error) {
+	return r.repo.ListRoles(ctx)
+}
+
+func (r *RBAC) UserGrants(ctx context.Context, actorID, userID string) (*models.Grants, error) {
+	if actorID != userID {
+		if err := r.require(ctx, actorID, models.PermissionRolesRead); err != nil {
+			return nil, err
+		}
+	}
+
+	return r.repo.GetGrants(ctx, userID)
+}
+
+func (r *RBAC) AssignRole(ctx context.Context, actorID, userID, role string) error {
+	if err := r.require(ctx, actorID, models.PermissionRolesManage); err != nil {
+		return err
+	}
+
+	if err := r.repo.AssignRole(ctx, userID, role, actorID); err != nil {
+		return err
+	}
+
+	return r.record(ctx, models.AuditRoleAssigned, actorID, userID, role)
+}
+
+func (r *RBAC) RevokeRole(ctx context.Context, actorID, userID, role string) error {
+	if err := r.require(ctx, actorID, models.PermissionRolesManage); err != nil {
+		return err
+	}
+
+	if err := r.repo.RevokeRole(ctx, userID, role); err != nil {
+		return err
+	}
+
+	return r.record(ctx, models.AuditRoleRevoked, actorID, userID, role)
+}
+
+func (r *RBAC) require(ctx context.Context, actorID, permission string) error {
+	allowed, err := r.CheckPermission(ctx, actorID, permission)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return models.ErrPermissionDenied
+	}
+
+	return nil
+}
+
+func (r *RBAC) record(ctx context.Context, eventType, actorID, userID, role string) error {
+	return r.audit.Record(ctx, &models.AuditEvent{
+		Type:     eventType,
+		UserID:   userID,
+		Outcome:  models.AuditOutcomeSuccess,
+		Metadata: map[string]string{"role": role, "actor_id": actorID},
+	})
+}
@@ -0,0 +1,443 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/internal/adapters/repository"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"github.com/go-redis/redis/v8"
+	"strconv"
+	"strings"
+)
+
+const relationCheckPrefix = "rebac:check:"
+
+// Relations is a Zanzibar-style authorization service over relation tuples
+// stored in Postgres. Consistency tokens are tuple store revisions: a check
+// result cached at revision N answers any request whose token is at most N,
+// newer tokens force an evaluation against the database.
+type Relations struct {
+	repo   ports.IRelationRepo
+	rbac   ports.IRBACService
+	cache  *repository.Redis
+	schema *relationSchema
+	opts   *models.Options
+}
+
+func NewRelations(repo ports.IRelationRepo, rbac ports.IRBACService, cache *repository.Redis, opts *models.Options) (*Relations, error) {
+	schema, err := loadRelationSchema(opts.Config.Relations.SchemaFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Relations{repo: repo, rbac: rbac, cache: cache, schema: schema, opts: opts}, nil
+}
+
+func (r *Relations) WriteTuples(ctx context.Context, actorID string, writes, deletes []models.RelationTuple) (string, error) {
+	allowed, err := r.rbac.CheckPermission(ctx, actorID, models.PermissionRelationsWrite)
+	if err != nil {
+		return "", err
+	}
+	if !allowed {
+		return "", models.ErrPermissionDenied
+	}
+
+	if len(writes) == 0 && len(deletes) == 0 {
+		return "", fmt.Errorf("%w: nothing to write", models.ErrInvalidRelationTuple)
+	}
+
+	for _, tuple := range append(append([]models.RelationTuple{}, writes...), deletes...) {
+		if err := r.validateTuple(tuple); err != nil {
+			return "", err
+		}
+	}
+
+	revision, err := r.repo.WriteTuples(ctx, writes, deletes)
+	if err != nil {
+		return "", err
+	}
+
+	return formatRevision(revision), nil
+}
+
+func (r *Relations) Check(ctx context.Context, tuple models.RelationTuple, consistency string) (bool, string, error) {
+	if err := r.validateTuple(tuple); err != nil {
+		return false, "", err
+	}
+
+	minRevision, err := parseRevision(consistency)
+	if err != nil {
+		return false, "", err
+	}
+
+	key := relationCheckPrefix + tuple.String()
+	if allowed, revision, ok := r.cached(ctx, key); ok && revision >= minRevision {
+		return allowed, formatRevision(revision), nil
+	}
+
+	revision, err := r.repo.Revision(ctx)
+	if err != nil {
+		return false, "", err
+	}
+
+	allowed, err := r.newChecker().check(ctx, tuple.Object, tuple.Relation, tuple.Subject, 0)
+	if err != nil {
+		return false, "", err
+	}
+
+	value := fmt.Sprintf("%t:%d", allowed, revision)
+	if err := r.cache.Redis.Set(ctx, key, value, r.opts.Config.Relations.CacheTTL).Err(); err != nil {
+		_ = r.opts.Logger.ErrorContext(ctx, "relation cache write failed", "key", key, "error", err)
+	}
+
+	return allowed, formatRevision(revision), nil
+}
+
+// Expand returns the userset tree of object#relation. Expansion always reads
+// the latest revision, which satisfies any consistency token.
+func (r *Relations) Expand(ctx context.Context, object models.ObjectRef, relation, consistency string) (*models.UsersetTree, string, error) {
+	if _, err := parseRevision(consistency); err != nil {
+		return nil, "", err
+	}
+
+	rw, err := r.lookup(object.Namespace, relation)
+	if err != nil {
+		return nil, "", err
+	}
+
+	revision, err := r.repo.Revision(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	tree, err := r.expand(ctx, object, relation, rw, 0)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return tree, formatRevision(revision), nil
+}
+
+// ListObjects returns a page of the IDs of the objects in a namespace the
+// subject holds the relation on. Candidates are the objects that appear in
+// any tuple, in ID order after the cursor, each checked against the latest
+// revision. A page checks at most models.ObjectPageCandidates of them and
+// then ends early, so that a subject related to few of many objects cannot
+// make one request walk the whole store.
+func (r *Relations) ListObjects(ctx context.Context, namespace, relation string, subject models.SubjectRef, consistency, cursor string, pageSize int) (*models.ObjectPage, string, error) {
+	if _, err := parseRevision(consistency); err != nil {
+		return nil, "", err
+	}
+
+	if _, err := r.lookup(namespace, relation); err != nil {
+		return nil, "", err
+	}
+	if err := r.validateSubject(subject); err != nil {
+		return nil, "", err
+	}
+
+	revision, err := r.repo.Revision(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if pageSize <= 0 {
+		pageSize = models.DefaultObjectPageSize
+	}
+	pageSize = min(pageSize, models.MaxObjectPageSize)
+
+	checker := r.newChecker()
+	page := &models.ObjectPage{ObjectIDs: []string{}}
+	for checked := 0; checked < models.ObjectPageCandidates; {
+		limit := min(pageSize, models.ObjectPageCandidates-checked)
+		ids, err := r.repo.ListObjectIDs(ctx, namespace, cursor, limit)
+		if err != nil {
+			return nil, "", err
+		}
+
+		for _, id := range ids {
+			allowed, err := checker.check(ctx, models.ObjectRef{Namespace: namespace, ID: id}, relation, subject, 0)
+			if err != nil {
+				return nil, "", err
+			}
+			if allowed {
+				page.ObjectIDs = append(page.ObjectIDs, id)
+			}
+			cursor = id
+			checked++
+
+			if len(page.ObjectIDs) == pageSize {
+				page.NextCursor = cursor
+				return page, formatRevision(revision), nil
+			}
+		}
+
+		// A short batch is the end of the candidates.
+		if len(ids) < limit {
+			return page, formatRevision(revision), nil
+		}
+	}
+	page.NextCursor = cursor
+
+	return page, formatRevision(revision), nil
+}
+
+func (r *Relations) expand(ctx context.Context, object models.ObjectRef, relation string, rw *rewrite, depth int) (*models.UsersetTree, error) {
+	if depth > r.opts.Config.Relations.MaxDepth {
+		return nil, models.ErrRelationDepthExceeded
+	}
+
+	node := &models.UsersetTree{Object: object, Relation: relation}
+
+	switch rw.op {
+	case rewriteThis:
+		tuples, err := r.repo.ReadTuples(ctx, object, relation)
+		if err != nil {
+			return nil, err
+		}
+		node.Operation = models.UsersetLeaf
+		for _, tuple := range tuples {
+			node.Subjects = append(node.Subjects, tuple.Subject)
+		}
+
+	case rewriteComputed:
+		target, _ := r.schema.rewrite(object.Namespace, rw.relation)
+		return r.expand(ctx, object, rw.relation, target, depth+1)
+
+	case rewriteTupleToUserset:
+		tuples, err := r.repo.ReadTuples(ctx, object, rw.tupleset)
+		if err != nil {
+			return nil, err
+		}
+		node.Operation = models.UsersetUnion
+		for _, tuple := range tuples {
+			target, ok := r.schema.rewrite(tuple.Subject.Namespace, rw.relation)
+			if !ok {
+				continue
+			}
+			child, err := r.expand(ctx, tuple.Subject.Object(), rw.relation, target, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			node.Children = append(node.Children, child)
+		}
+
+	case rewriteUnion, rewriteIntersection:
+		node.Operation = models.UsersetUnion
+		if rw.op == rewriteIntersection {
+			node.Operation = models.UsersetIntersection
+		}
+		for _, child := range rw.children {
+			expanded, err := r.expand(ctx, object, relation, child, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			node.Children = append(node.Children, expanded)
+		}
+	}
+
+	return node, nil
+}
+
+func (r *Relations) cached(ctx context.Context, key string) (bool, int64, bool) {
+	value, err := r.cache.Redis.Get(ctx, key).Result()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			_ = r.opts.Logger.ErrorContext(ctx, "relation cache read failed", "key", key, "error", err)
+		}
+		return false, 0, false
+	}
+
+	allowed, revision, ok := strings.Cut(value, ":")
+	if !ok {
+		return false, 0, false
+	}
+
+	parsed, err := strconv.ParseInt(revision, 10, 64)
+	if err != nil {
+		return false, 0, false
+	}
+
+	return allowed == "true", parsed, true
+}
+
+func (r *Relations) lookup(namespace, relation string) (*rewrite, error) {
+	if _, ok := r.schema.namespaces[namespace]; !ok {
+		return nil, fmt.Errorf("%w: %s", models.ErrUnknownNamespace, namespace)
+	}
+
+	rw, ok := r.schema.rewrite(namespace, relation)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s#%s", models.ErrUnknownRelation, namespace, relation)
+	}
+
+	return rw, nil
+}
+
+func (r *Relations) validateTuple(tuple models.RelationTuple) error {
+	if !validObjectID(tuple.Object.ID) {
+		return fmt.Errorf("%w: %s", models.ErrInvalidRelationTuple, tuple)
+	}
+
+	if _, err := r.lookup(tuple.Object.Namespace, tuple.Relation); err != nil {
+		return err
+	}
+
+	return r.validateSubject(tuple.Subject)
+}
+
+func (r *Relations) validateSubject(subject models.SubjectRef) error {
+	if !validObjectID(subject.ID) {
+		return fmt.Errorf("%w: subject %s", models.ErrInvalidRelationTuple, subject)
+	}
+
+	if subject.Relation != "" {
+		_, err := r.lookup(subject.Namespace, subject.Relation)
+		return err
+	}
+
+	if _, ok := r.schema.namespaces[subject.Namespace]; !ok {
+		return fmt.Errorf("%w: %s", models.ErrUnknownNamespace, subject.Namespace)
+	}
+
+	return nil
+}
+
+func (r *Relations) newChecker() *relationChecker {
+	return &relationChecker{relations: r, granted: map[string]bool{}, visiting: map[string]bool{}}
+}
+
+// relationChecker evaluates one request. It remembers granted relations so
+// that shared usersets are read once, and treats a relation that is still
+// being evaluated further up as not granting access, which breaks cycles such
+// as groups that contain each other. Denials are not remembered because they
+// may stem from such a cut.
+type relationChecker struct {
+	relations *Relations
+	granted   map[string]bool
+	visiting  map[string]bool
+}
+
+func (c *relationChecker) check(ctx context.Context, object models.ObjectRef, relation string, subject models.SubjectRef, depth int) (bool, error) {
+	if depth > c.relations.opts.Config.Relations.MaxDepth {
+		return false, models.ErrRelationDepthExceeded
+	}
+
+	// A userset always contains itself.
+	if subject.Relation == relation && subject.Object() == object {
+		return true, nil
+	}
+
+	key := models.RelationTuple{Object: object, Relation: relation, Subject: subject}.String()
+	if c.granted[key] {
+		return true, nil
+	}
+	if c.visiting[key] {
+		return false, nil
+	}
+
+	rw, err := c.relations.lookup(object.Namespace, relation)
+	if err != nil {
+		return false, err
+	}
+
+	c.visiting[key] = true
+	allowed, err := c.eval(ctx, object, relation, rw, subject, depth)
+	delete(c.visiting, key)
+	if err != nil {
+		return false, err
+	}
+
+	if allowed {
+		c.granted[key] = true
+	}
+	return allowed, nil
+}
+
+func (c *relationChecker) eval(ctx context.Context, object models.ObjectRef, relation string, rw *rewrite, subject models.SubjectRef, depth int) (bool, error) {
+	switch rw.op {
+	case rewriteThis:
+		tuple := models.RelationTuple{Object: object, Relation: relation, Subject: subject}
+		direct, err := c.relations.repo.HasTuple(ctx, tuple)
+		if err != nil || direct {
+			return direct, err
+		}
+
+		tuples, err := c.relations.repo.ReadTuples(ctx, object, relation)
+		if err != nil {
+			return false, err
+		}
+		for _, tuple := range tuples {
+			if tuple.Subject.Relation == "" {
+				continue
+			}
+			allowed, err := c.check(ctx, tuple.Subject.Object(), tuple.Subject.Relation, subject, depth+1)
+			if err != nil || allowed {
+				return allowed, err
+			}
+		}
+		return false, nil
+
+	case rewriteComputed:
+		return c.check(ctx, object, rw.relation, subject, depth+1)
+
+	case rewriteTupleToUserset:
+		tuples, err := c.relations.repo.ReadTuples(ctx, object, rw.tupleset)
+		if err != nil {
+			return false, err
+		}
+		for _, tuple := range tuples {
+			if _, ok := c.relations.schema.rewrite(tuple.Subject.Namespace, rw.relation); !ok {
+				continue
+			}
+			allowed, err := c.check(ctx, tuple.Subject.Object(), rw.relation, subject, depth+1)
+			if err != nil || allowed {
+				return allowed, err
+			}
+		}
+		return false, nil
+
+	case rewriteUnion:
+		for _, child := range rw.children {
+			allowed, err := c.eval(ctx, object, relation, child, subject, depth)
+			if err != nil || allowed {
+				return allowed, err
+			}
+		}
+		return false, nil
+
+	case rewriteIntersection:
+		for _, child := range rw.children {
+			allowed, err := c.eval(ctx, object, relation, child, subject, depth)
+			if err != nil || !allowed {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func validObjectID(id string) bool {
+	return id != "" && !strings.ContainsAny(id, "#@")
+}
+
+func formatRevision(revision int64) string {
+	return strconv.FormatInt(revision, 10)
+}
+
+func parseRevision(consistency string) (int64, error) {
+	if consistency == "" {
+		return 0, nil
+	}
+
+	revision, err := strconv.ParseInt(consistency, 10, 64)
+	if err != nil || revision < 0 {
+		return 0, models.ErrInvalidConsistency
+	}
+
+	return revision, nil
+}
@@ -0,0 +1,341 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// The relation schema declares the namespaces objects live in and how each
+// relation is computed:
+//
+//	namespace document {
+//	  relation parent
+//	  relation owner
+//	  relation editor = this | owner
+//	  relation viewer = this | editor | parent->viewer
+//	  relation auditor = viewer & parent->auditor
+//	}
+//
+// "this" stands for the tuples stored for the relation itself, a bare name is
+// the computed userset of another relation on the same object, and a->b
+// follows the objects related through a and takes their b relation. "&" binds
+// tighter than "|" and parentheses group. A relation without a definition is
+// "this".
+
+type rewriteOp int
+
+const (
+	rewriteThis rewriteOp = iota
+	rewriteComputed
+	rewriteTupleToUserset
+	rewriteUnion
+	rewriteIntersection
+)
+
+type rewrite struct {
+	op       rewriteOp
+	relation string
+	tupleset string
+	children []*rewrite
+}
+
+type namespaceDef struct {
+	name      string
+	relations map[string]*rewrite
+}
+
+type relationSchema struct {
+	namespaces map[string]*namespaceDef
+}
+
+func loadRelationSchema(path string) (*relationSchema, error) {
+	if path == "" {
+		return &relationSchema{namespaces: map[string]*namespaceDef{}}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error loading relation schema: %w", err)
+	}
+
+	schema, err := parseRelationSchema(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return schema, nil
+}
+
+func (s *relationSchema) rewrite(namespace, relation string) (*rewrite, bool) {
+	ns, ok := s.namespaces[namespace]
+	if !ok {
+		return nil, false
+	}
+
+	r, ok := ns.relations[relation]
+	return r, ok
+}
+
+type schemaToken struct {
+	text string
+	line int
+}
+
+type schemaParser struct {
+	tokens []schemaToken
+	pos    int
+}
+
+func parseRelationSchema(source string) (*relationSchema, error) {
+	tokens, err := tokenizeSchema(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &schemaParser{tokens: tokens}
+	schema := &relationSchema{namespaces: map[string]*namespaceDef{}}
+
+	for !p.done() {
+		ns, err := p.namespace()
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := schema.namespaces[ns.name]; exists {
+			return nil, fmt.Errorf("namespace %q is defined twice", ns.name)
+		}
+		schema.namespaces[ns.name] = ns
+	}
+
+	for _, ns := range schema.namespaces {
+		for name, r := range ns.relations {
+			if err := validateRewrite(ns, r); err != nil {
+				return nil, fmt.Errorf("%s#%s: %w", ns.name, name, err)
+			}
+		}
+	}
+
+	return schema, nil
+}
+
+// validateRewrite checks references within the namespace. The relation taken
+// through a tupleset depends on the objects stored at runtime, so it is not
+// checked here.
+func validateRewrite(ns *namespaceDef, r *rewrite) error {
+	switch r.op {
+	case rewriteComputed:
+		if _, ok := ns.relations[r.relation]; !ok {
+			return fmt.Errorf("unknown relation %q", r.relation)
+		}
+	case rewriteTupleToUserset:
+		if _, ok := ns.relations[r.tupleset]; !ok {
+			return fmt.Errorf("unknown relation %q", r.tupleset)
+		}
+	case rewriteUnion, rewriteIntersection:
+		for _, child := range r.children {
+			if err := validateRewrite(ns, child); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *schemaParser) namespace() (*namespaceDef, error) {
+	if err := p.expect("namespace"); err != nil {
+		return nil, err
+	}
+
+	name, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	ns := &namespaceDef{name: name, relations: map[string]*rewrite{}}
+	for !p.accept("}") {
+		if err := p.expect("relation"); err != nil {
+			return nil, err
+		}
+
+		relation, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := ns.relations[relation]; exists {
+			return nil, fmt.Errorf("relation %s#%s is defined twice", name, relation)
+		}
+
+		r := &rewrite{op: rewriteThis}
+		if p.accept("=") {
+			if r, err = p.union(); err != nil {
+				return nil, err
+			}
+		}
+		ns.relations[relation] = r
+	}
+
+	return ns, nil
+}
+
+func (p *schemaParser) union() (*rewrite, error) {
+	return p.binary("|", rewriteUnion, p.intersection)
+}
+
+func (p *schemaParser) intersection() (*rewrite, error) {
+	return p.binary("&", rewriteIntersection, p.term)
+}
+
+func (p *schemaParser) binary(operator string, op rewriteOp, operand func() (*rewrite, error)) (*rewrite, error) {
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	children := []*rewrite{first}
+	for p.accept(operator) {
+		next, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, next)
+	}
+
+	if len(children) == 1 {
+		return first, nil
+	}
+	return &rewrite{op: op, children: children}, nil
+}
+
+func (p *schemaParser) term() (*rewrite, error) {
+	if p.accept("(") {
+		r, err := p.union()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+
+	name, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "this" {
+		return &rewrite{op: rewriteThis}, nil
+	}
+
+	if p.accept("->") {
+		relation, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		return &rewrite{op: rewriteTupleToUserset, tupleset: name, relation: relation}, nil
+	}
+
+	return &rewrite{op: rewriteComputed, relation: name}, nil
+}
+
+func (p *schemaParser) identifier() (string, error) {
+	if p.done() {
+		return "", p.errorf("unexpected end of schema, expected a name")
+	}
+
+	token := p.tokens[p.pos]
+	if !isSchemaIdentifier(token.text) {
+		return "", p.errorf("expected a name, got %q", token.text)
+	}
+
+	p.pos++
+	return token.text, nil
+}
+
+func (p *schemaParser) expect(text string) error {
+	if !p.accept(text) {
+		if p.done() {
+			return p.errorf("unexpected end of schema, expected %q", text)
+		}
+		return p.errorf("expected %q, got %q", text, p.tokens[p.pos].text)
+	}
+	return nil
+}
+
+func (p *schemaParser) accept(text string) bool {
+	if p.done() || p.tokens[p.pos].text != text {
+		return false
+	}
+
+	p.pos++
+	return true
+}
+
+func (p *schemaParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *schemaParser) errorf(format string, args ...interface{}) error {
+	line := 0
+	if len(p.tokens) > 0 {
+		line = p.tokens[min(p.pos, len(p.tokens)-1)].line
+	}
+
+	return fmt.Errorf("schema line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func tokenizeSchema(source string) ([]schemaToken, error) {
+	var tokens []schemaToken
+
+	for number, line := range strings.Split(source, "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+
+		for i := 0; i < len(line); {
+			c := rune(line[i])
+			switch {
+			case unicode.IsSpace(c):
+				i++
+			case strings.HasPrefix(line[i:], "->"):
+				tokens = append(tokens, schemaToken{text: "->", line: number + 1})
+				i += 2
+			case strings.ContainsRune("{}=|&()", c):
+				tokens = append(tokens, schemaToken{text: string(c), line: number + 1})
+				i++
+			case isSchemaNameRune(c):
+				start := i
+				for i < len(line) && isSchemaNameRune(rune(line[i])) {
+					i++
+				}
+				tokens = append(tokens, schemaToken{text: line[start:i], line: number + 1})
+			default:
+				return nil, fmt.Errorf("schema line %d: unexpected character %q", number+1, c)
+			}
+		}
+	}
+
+	return tokens, nil
+}
+
+func isSchemaIdentifier(text string) bool {
+	if text == "" || unicode.IsDigit(rune(text[0])) {
+		return false
+	}
+	for _, c := range text {
+		if !isSchemaNameRune(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func isSchemaNameRune(c rune) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+// formatRewrite renders a rewrite with every union and intersection in
+// parentheses, to compare parsed rewrites.
+func formatRewrite(r *rewrite) string {
+	switch r.op {
+	case rewriteThis:
+		return "this"
+	case rewriteComputed:
+		return r.relation
+	case rewriteTupleToUserset:
+		return r.tupleset + "->" + r.relation
+	}
+
+	operator := " | "
+	if r.op == rewriteIntersection {
+		operator = " & "
+	}
+	children := make([]string, 0, len(r.children))
+	for _, child := range r.children {
+		children = append(children, formatRewrite(child))
+	}
+	return "(" + strings.Join(children, operator) + ")"
+}
+
+func TestParseRelationSchema(t *testing.T) {
+	tests := []struct {
+		name     string
+		relation string
+		want     string
+	}{
+		{name: "undefined relation is this", relation: "relation viewer", want: "this"},
+		{name: "this", relation: "relation viewer = this", want: "this"},
+		{name: "computed userset", relation: "relation viewer = owner", want: "owner"},
+		{name: "tuple to userset", relation: "relation viewer = parent->viewer", want: "parent->viewer"},
+		{name: "union", relation: "relation viewer = this | owner | parent->viewer", want: "(this | owner | parent->viewer)"},
+		{name: "intersection binds tighter", relation: "relation viewer = this | owner & parent->viewer", want: "(this | (owner & parent->viewer))"},
+		{name: "parentheses", relation: "relation viewer = (this | owner) & parent->viewer", want: "((this | owner) & parent->viewer)"},
+		{name: "comment", relation: "relation viewer = owner // | parent->viewer", want: "owner"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := "namespace folder {\n}\nnamespace document {\n  relation parent\n  relation owner\n  " + tt.relation + "\n}\n"
+			schema, err := parseRelationSchema(source)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r, ok := schema.rewrite("document", "viewer")
+			if !ok {
+				t.Fatal("document#viewer is missing")
+			}
+			if got := formatRewrite(r); got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRelationSchemaErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{name: "duplicate namespace", source: "namespace user {}\nnamespace user {}", want: `namespace "user" is defined twice`},
+		{name: "duplicate relation", source: "namespace doc {\n relation owner\n relation owner\n}", want: "doc#owner is defined twice"},
+		{name: "unknown computed relation", source: "namespace doc {\n relation viewer = owner\n}", want: `doc#viewer: unknown relation "owner"`},
+		{name: "unknown tupleset", source: "namespace doc {\n relation viewer = parent->viewer\n}", want: `doc#viewer: unknown relation "parent"`},
+		{name: "unknown relation in union", source: "namespace doc {\n relation viewer = this | owner\n}", want: `unknown relation "owner"`},
+		{name: "unexpected character", source: "namespace doc {\n relation viewer = this + owner\n}", want: "schema line 2: unexpected character '+'"},
+		{name: "upper case name", source: "namespace Doc {}", want: "schema line 1: unexpected character 'D'"},
+		{name: "name starting with a digit", source: "namespace 1doc {}", want: `schema line 1: expected a name, got "1doc"`},
+		{name: "missing brace", source: "namespace doc {\n relation owner\n", want: `unexpected end of schema, expected "relation"`},
+		{name: "missing operand", source: "namespace doc {\n relation owner\n relation viewer = owner |\n}", want: `schema line 4: expected a name, got "}"`},
+		{name: "unclosed parenthesis", source: "namespace doc {\n relation owner\n relation viewer = (owner\n}", want: `schema line 4: expected ")", got "}"`},
+		{name: "missing relation keyword", source: "namespace doc {\n owner\n}", want: `schema line 2: expected "relation", got "owner"`},
+		{name: "relation outside namespace", source: "relation owner", want: `schema line 1: expected "namespace", got "relation"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseRelationSchema(tt.source)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadRelationSchema(t *testing.T) {
+	schema, err := loadRelationSchema("../../../config/relations.schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, namespace := range []string{"user", "group", "folder", "document"} {
+		if _, ok := schema.namespaces[namespace]; !ok {
+			t.Errorf("namespace %s is missing", namespace)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/config"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeRelationRepo keeps tuples in memory, by object.
+type fakeRelationRepo struct {
+	ports.IRelationRepo
+	tuples map[models.ObjectRef][]models.RelationTuple
+	// candidates counts the object IDs ListObjectIDs returned.
+	candidates int
+}
+
+func (f *fakeRelationRepo) HasTuple(_ context.Context, tuple models.RelationTuple) (bool, error) {
+	return slices.Contains(f.tuples[tuple.Object], tuple), nil
+}
+
+func (f *fakeRelationRepo) ReadTuples(_ context.Context, object models.ObjectRef, relation string) ([]models.RelationTuple, error) {
+	var tuples []models.RelationTuple
+	for _, tuple := range f.tuples[object] {
+		if tuple.Relation == relation {
+			tuples = append(tuples, tuple)
+		}
+	}
+
+	return tuples, nil
+}
+
+func (f *fakeRelationRepo) ListObjectIDs(_ context.Context, namespace, after string, limit int) ([]string, error) {
+	var ids []string
+	for object := range f.tuples {
+		if object.Namespace == namespace && object.ID > after {
+			ids = append(ids, object.ID)
+		}
+	}
+	slices.Sort(ids)
+	ids = ids[:min(limit, len(ids))]
+	f.candidates += len(ids)
+
+	return ids, nil
+}
+
+func (f *fakeRelationRepo) Revision(context.Context) (int64, error) {
+	return 1, nil
+}
+
+const testRelationSchema = `
+namespace user {
+}
+
+namespace group {
+  relation member
+}
+
+namespace folder {
+  relation parent
+  relation owner
+  relation editor = this | owner | parent->editor
+  relation viewer = this | editor | parent->viewer
+}
+
+namespace document {
+  relation parent
+  relation owner
+  relation editor = this | owner | parent->editor
+  relation viewer = this | editor | parent->viewer
+  relation auditor = viewer & parent->owner
+}
+`
+
+func newTestRelations(t *testing.T, maxDepth int, tuples ...string) (*Relations, *fakeRelationRepo) {
+	t.Helper()
+
+	schema, err := parseRelationSchema(testRelationSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &fakeRelationRepo{tuples: map[models.ObjectRef][]models.RelationTuple{}}
+	for _, s := range tuples {
+		tuple := parseTestTuple(t, s)
+		repo.tuples[tuple.Object] = append(repo.tuples[tuple.Object], tuple)
+	}
+
+	cfg := &config.Config{}
+	cfg.Relations.MaxDepth = maxDepth
+
+	return &Relations{repo: repo, schema: schema, opts: &models.Options{Config: cfg}}, repo
+}
+
+// parseTestTuple reads object#relation@subject, e.g.
+// document:readme#viewer@group:eng#member.
+func parseTestTuple(t *testing.T, s string) models.RelationTuple {
+	t.Helper()
+
+	var tuple models.RelationTuple
+	object, rest, _ := strings.Cut(s, "#")
+	tuple.Object.Namespace, tuple.Object.ID, _ = strings.Cut(object, ":")
+	tuple.Relation, rest, _ = strings.Cut(rest, "@")
+	tuple.Subject = parseTestSubject(rest)
+	if tuple.Object.ID == "" || tuple.Relation == "" || tuple.Subject.ID == "" {
+		t.Fatalf("malformed tuple %q", s)
+	}
+
+	return tuple
+}
+
+func parseTestSubject(s string) models.SubjectRef {
+	var subject models.SubjectRef
+	object, relation, _ := strings.Cut(s, "#")
+	subject.Namespace, subject.ID, _ = strings.Cut(object, ":")
+	subject.Relation = relation
+
+	return subject
+}
+
+func TestRelationCheck(t *testing.T) {
+	r, _ := newTestRelations(t, 10,
+		"folder:root#owner@user:alice",
+		"folder:docs#parent@folder:root",
+		"document:readme#parent@folder:docs",
+		"document:readme#viewer@group:eng#member",
+		"group:eng#member@user:bob",
+		"group:eng#member@group:leads#member",
+		"group:leads#member@user:carol",
+		"document:readme#viewer@user:dave",
+	)
+
+	tests := []struct {
+		tuple   string
+		allowed bool
+	}{
+		{tuple: "document:readme#viewer@user:dave", allowed: true},
+		{tuple: "document:readme#editor@user:dave"},
+		// Computed usersets and tuple-to-userset through two folders.
+		{tuple: "document:readme#editor@user:alice", allowed: true},
+		{tuple: "document:readme#viewer@user:alice", allowed: true},
+		{tuple: "folder:docs#owner@user:alice"},
+		// Usersets, nested.
+		{tuple: "document:readme#viewer@user:bob", allowed: true},
+		{tuple: "document:readme#viewer@user:carol", allowed: true},
+		{tuple: "document:readme#viewer@group:eng#member", allowed: true},
+		{tuple: "document:readme#viewer@user:eve"},
+		// Intersections need both sides: dave views but does not own the
+		// parent folder, and alice owns the root folder but not docs.
+		{tuple: "document:readme#auditor@user:dave"},
+		{tuple: "document:readme#auditor@user:alice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tuple, func(t *testing.T) {
+			tuple := parseTestTuple(t, tt.tuple)
+			allowed, err := r.newChecker().check(context.Background(), tuple.Object, tuple.Relation, tuple.Subject, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if allowed != tt.allowed {
+				t.Fatalf("got %v, want %v", allowed, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestRelationCheckCycles(t *testing.T) {
+	r, _ := newTestRelations(t, 50,
+		"group:a#member@group:b#member",
+		"group:b#member@group:c#member",
+		"group:c#member@group:a#member",
+		"group:c#member@user:alice",
+		"folder:x#parent@folder:y",
+		"folder:y#parent@folder:x",
+	)
+
+	tests := []struct {
+		tuple   string
+		allowed bool
+	}{
+		{tuple: "group:a#member@user:alice", allowed: true},
+		{tuple: "group:b#member@user:alice", allowed: true},
+		{tuple: "group:a#member@user:bob"},
+		{tuple: "folder:x#viewer@user:alice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tuple, func(t *testing.T) {
+			tuple := parseTestTuple(t, tt.tuple)
+			allowed, err := r.newChecker().check(context.Background(), tuple.Object, tuple.Relation, tuple.Subject, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if allowed != tt.allowed {
+				t.Fatalf("got %v, want %v", allowed, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestRelationCheckDepth(t *testing.T) {
+	// A chain of ten groups, each a member of the next.
+	var tuples []string
+	for i := 0; i < 10; i++ {
+		tuples = append(tuples, fmt.Sprintf("group:g%d#member@group:g%d#member", i, i+1))
+	}
+	tuples = append(tuples, "group:g10#member@user:alice")
+
+	tests := []struct {
+		maxDepth int
+		err      error
+	}{
+		{maxDepth: 10},
+		{maxDepth: 9, err: models.ErrRelationDepthExceeded},
+		{maxDepth: 0, err: models.ErrRelationDepthExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("max depth %d", tt.maxDepth), func(t *testing.T) {
+			r, _ := newTestRelations(t, tt.maxDepth, tuples...)
+			tuple := parseTestTuple(t, "group:g0#member@user:alice")
+
+			allowed, err := r.newChecker().check(context.Background(), tuple.Object, tuple.Relation, tuple.Subject, 0)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if tt.err == nil && !allowed {
+				t.Fatal("the end of the chain was not reached")
+			}
+		})
+	}
+}
+
+func TestRelationExpandDepth(t *testing.T) {
+	r, _ := newTestRelations(t, 2,
+		"folder:a#parent@folder:b",
+		"folder:b#parent@folder:c",
+		"folder:c#parent@folder:d",
+	)
+
+	_, _, err := r.Expand(context.Background(), models.ObjectRef{Namespace: "folder", ID: "a"}, "viewer", "")
+	if !errors.Is(err, models.ErrRelationDepthExceeded) {
+		t.Fatalf("got %v, want ErrRelationDepthExceeded", err)
+	}
+}
+
+func TestRelationListObjects(t *testing.T) {
+	var tuples []string
+	for i := 0; i < 25; i++ {
+		tuples = append(tuples, fmt.Sprintf("document:d%02d#owner@user:u%d", i, i%5))
+	}
+	r, _ := newTestRelations(t, 10, tuples...)
+	subject := parseTestSubject("user:u0")
+
+	var (
+		objects []string
+		cursor  string
+		pages   int
+	)
+	for {
+		page, _, err := r.ListObjects(context.Background(), "document", "viewer", subject, "", cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.ObjectIDs) > 2 {
+			t.Fatalf("page of %d objects, want at most 2", len(page.ObjectIDs))
+		}
+		objects = append(objects, page.ObjectIDs...)
+		pages++
+
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	want := []string{"d00", "d05", "d10", "d15", "d20"}
+	if !slices.Equal(objects, want) {
+		t.Fatalf("got %v, want %v", objects, want)
+	}
+	if pages != 3 {
+		t.Fatalf("listed in %d pages, want 3", pages)
+	}
+}
+
+func TestRelationListObjectsBoundsCandidates(t *testing.T) {
+	tuples := make([]string, 0, models.ObjectPageCandidates+10)
+	for i := 0; i < models.ObjectPageCandidates+10; i++ {
+		tuples = append(tuples, fmt.Sprintf("document:d%05d#owner@user:bob", i))
+	}
+	tuples = append(tuples, "document:d99999#owner@user:alice")
+	r, repo := newTestRelations(t, 10, tuples...)
+	alice := parseTestSubject("user:alice")
+
+	page, _, err := r.ListObjects(context.Background(), "document", "viewer", alice, "", "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.ObjectIDs) != 0 || page.NextCursor == "" {
+		t.Fatalf("got %v with cursor %q, want an empty page with a cursor", page.ObjectIDs, page.NextCursor)
+	}
+	if repo.candidates != models.ObjectPageCandidates {
+		t.Fatalf("checked %d candidates, want %d", repo.candidates, models.ObjectPageCandidates)
+	}
+
+	page, _, err = r.ListObjects(context.Background(), "document", "viewer", alice, "", page.NextCursor, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(page.ObjectIDs, []string{"d99999"}) || page.NextCursor != "" {
+		t.Fatalf("got %v with cursor %q, want the last object and no cursor", page.ObjectIDs, page.NextCursor)
+	}
+}
@@ -1,17 +1,100 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"github.com/co1seam/ember-backend-auth/internal/adapters/events"
+	"github.com/co1seam/ember-backend-auth/internal/adapters/idp"
+	"github.com/co1seam/ember-backend-auth/internal/adapters/mail"
 	"github.com/co1seam/ember-backend-auth/internal/adapters/repository"
 	"github.com/co1seam/ember-backend-auth/internal/core/models"
 	"github.com/co1seam/ember-backend-auth/internal/ports"
 )
 
 type Service struct {
-	Authorization ports.IAuthService
+	Authorization   ports.IAuthService
+	OAuth           ports.IOAuthService
+	OIDC            ports.IOIDCService
+	Federation      ports.IFederationService
+	Account         ports.IAccountService
+	RBAC            ports.IRBACService
+	Relations       ports.IRelationService
+	Organizations   ports.IOrganizationService
+	Invitations     ports.IInvitationService
+	APIKeys         ports.IAPIKeyService
+	ServiceAccounts ports.IServiceAccountService
+	Admin           ports.IAdminService
+	Audit           ports.IAuditService
+	AuditChain      ports.IAuditChainService
+	AuditLog        ports.IAuditLog
+	Events          ports.IEventRelay
+	Webhooks        ports.IWebhookService
 }
 
-func NewService(repos *repository.Repository, opts *models.Options) *Service {
-	return &Service{
-		Authorization: NewAuthorization(repos.Authorization, repos.Cache, opts),
+func NewService(repos *repository.Repository, opts *models.Options) (*Service, error) {
+	keys, err := NewKeySet(&opts.Config.OIDC)
+	if err != nil {
+		return nil, err
+	}
+
+	mailer := mail.NewSMTP(&opts.Config.SMTP)
+	notifier := &securityNotifier{users: repos.User, audit: repos.Audit, mailer: mailer, opts: opts}
+
+	providers := make(map[string]ports.IIdentityProvider)
+	for name, provider := range idp.NewProviders(opts.Config) {
+		providers[name] = provider
+	}
+
+	rbac := NewRBAC(repos.RBAC, repos.Audit, opts)
+
+	oauth := NewOAuth(repos.OAuth, repos.Session, repos.User, repos.APIKey, rbac, repos.Audit, repos.Cache, keys, opts)
+
+	relations, err := NewRelations(repos.Relation, rbac, repos.Cache, opts)
+	if err != nil {
+		return nil, err
 	}
+
+	organizations := NewOrganizations(repos.Organization, rbac, repos.Audit, opts)
+
+	authorization := NewAuthorization(repos.Authorization, repos.User, organizations, repos.Audit, repos.Cache, mailer, opts)
+
+	auditChain := NewAuditChain(repos.Audit, keys, opts)
+
+	webhooks := NewWebhooks(repos.Webhook, rbac, repos.Audit, opts)
+
+	publishers, err := events.NewPublishers(&opts.Config.Events, repos.Cache)
+	if err != nil {
+		return nil, err
+	}
+	publishers = append(publishers, webhooks)
+
+	federation := NewFederation(providers, repos.Identity, repos.User, organizations, repos.Cache, notifier, opts)
+
+	return &Service{
+		Authorization:   authorization,
+		OAuth:           oauth,
+		OIDC:            NewOIDC(oauth, repos.User, keys, opts),
+		Federation:      federation,
+		Account:         NewAccount(repos.User, repos.Identity, federation, notifier, opts),
+		RBAC:            rbac,
+		Relations:       relations,
+		Organizations:   organizations,
+		Invitations:     NewInvitations(repos.Invitation, repos.Organization, repos.User, authorization, mailer, repos.Audit, opts),
+		APIKeys:         NewAPIKeys(repos.APIKey, rbac, repos.Audit, opts),
+		ServiceAccounts: NewServiceAccounts(repos.ServiceAccount, repos.OAuth, rbac, repos.Audit, opts),
+		Admin:           NewAdmin(repos.User, authorization, oauth, rbac, repos.Audit, opts),
+		Audit:           NewAudit(repos.Audit, rbac, opts),
+		AuditChain:      auditChain,
+		AuditLog:        NewAuditLog(repos.Audit, auditChain, webhooks, opts),
+		Events:          NewEventRelay(repos.Outbox, publishers, opts),
+		Webhooks:        webhooks,
+	}, nil
+}
+
+// Close stops the background work of the services, writing out what is
+// still queued.
+func (s *Service) Close(ctx context.Context) error {
+	// The relay and the audit log queue webhook deliveries, so they stop
+	// first.
+	return errors.Join(s.Events.Close(ctx), s.AuditLog.Close(ctx), s.Webhooks.Close(ctx))
 }
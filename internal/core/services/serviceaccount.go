@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"github.com/google/uuid"
+	"strings"
+)
+
+// ServiceAccounts manages machine identities for Ember services. A service
+// account obtains tokens with the client credentials grant, authenticating
+// with a client secret or with a JWT signed by one of its registered keys.
+type ServiceAccounts struct {
+	repo    ports.IServiceAccountRepo
+	clients ports.IClientRepo
+	rbac    ports.IRBACService
+	audit   ports.IAuditRepo
+	opts    *models.Options
+}
+
+func NewServiceAccounts(repo ports.IServiceAccountRepo, clients ports.IClientRepo, rbac ports.IRBACService, audit ports.IAuditRepo, opts *models.Options) *ServiceAccounts {
+	return &ServiceAccounts{repo: repo, clients: clients, rbac: rbac, audit: audit, opts: opts}
+}
+
+// CreateServiceAccount creates an account and returns its client secret,
+// which cannot be retrieved later. The actor may only delegate permissions
+// they hold themselves.
+func (s *ServiceAccounts) CreateServiceAccount(ctx context.Context, actorID, name, description string, permissions []string) (*models.ServiceAccount, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 255 {
+		return nil, "", fmt.Errorf("%w: a name of at most 255 characters is required", models.ErrInvalidServiceAccountInput)
+	}
+
+	grants, err := s.require(ctx, actorID)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, permission := range permissions {
+		if !grants.Has(permission) {
+			return nil, "", fmt.Errorf("%w: permission %q is not granted to the caller", models.ErrPermissionDenied, permission)
+		}
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	account := &models.ServiceAccount{
+		ID:          uuid.NewString(),
+		Name:        name,
+		Description: strings.TrimSpace(description),
+		Permissions: permissions,
+		CreatedBy:   actorID,
+	}
+	if account.Permissions == nil {
+		account.Permissions = []string{}
+	}
+
+	if err := s.repo.CreateServiceAccount(ctx, account, hashToken(secret)); err != nil {
+		return nil, "", err
+	}
+
+	account, err = s.repo.GetServiceAccount(ctx, account.ID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return account, secret, s.record(ctx, models.AuditServiceAccountCreated, actorID, account.ID, "")
+}
+
+func (s *ServiceAccounts) ListServiceAccounts(ctx context.Context, actorID string) ([]models.ServiceAccount, error) {
+	if _, err := s.require(ctx, actorID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.ListServiceAccounts(ctx)
+}
+
+// DeleteServiceAccount deletes an account. Access tokens it already holds
+// stay valid until they expire.
+func (s *ServiceAccounts) DeleteServiceAccount(ctx context.Context, actorID, accountID string) error {
+	if _, err := s.require(ctx, actorID); err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteServiceAccount(ctx, accountID); err != nil {
+		return err
+	}
+
+	return s.record(ctx, models.AuditServiceAccountDeleted, actorID, accountID, "")
+}
+
+// RotateSecret replaces the account's client secret; the old one stops
+// working immediately.
+func (s *ServiceAccounts) RotateSecret(ctx context.Context, actorID, accountID string) (string, error) {
+	if _, err := s.require(ctx, actorID); err != nil {
+		return "", err
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.repo.UpdateServiceAccountSecret(ctx, accountID, hashToken(secret)); err != nil {
+		return "", err
+	}
+
+	return secret, s.record(ctx, models.AuditServiceAccountCredentialsChanged, actorID, accountID, "secret_rotated")
+}
+
+func (s *ServiceAccounts) ListKeys(ctx context.Context, actorID, accountID string) ([]models.ClientKey, error) {
+	if err := s.requireAccount(ctx, actorID, accountID); err != nil {
+		return nil, err
+	}
+
+	return s.clients.ListClientKeys(ctx, accountID)
+}
+
+// AddKey registers a PEM encoded public key for private_key_jwt. The key ID
+// is the key's RFC 7638 thumbprint, which assertions name in their kid
+// header.
+func (s *ServiceAccounts) AddKey(ctx context.Context, actorID, accountID, publicKey string) (*models.ClientKey, error) {
+	_, kid, err := parsePublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", models.ErrInvalidServiceAccountInput, err)
+	}
+
+	if err := s.requireAccount(ctx, actorID, accountID); err != nil {
+		return nil, err
+	}
+
+	key := &models.ClientKey{ID: kid, ClientID: accountID, PublicKey: publicKey}
+	if err := s.clients.AddClientKey(ctx, key); err != nil {
+		return nil, err
+	}
+
+	return key, s.record(ctx, models.AuditServiceAccountCredentialsChanged, actorID, accountID, "key_added:"+kid)
+}
+
+func (s *ServiceAccounts) RemoveKey(ctx context.Context, actorID, accountID, keyID string) error {
+	if err := s.requireAccount(ctx, actorID, accountID); err != nil {
+		return err
+	}
+
+	if err := s.clients.RemoveClientKey(ctx, accountID, keyID); err != nil {
+		return err
+	}
+
+	return s.record(ctx, models.AuditServiceAccountCredentialsChanged, actorID, accountID, "key_removed:"+keyID)
+}
+
+// require checks that the actor may manage service accounts and returns
+// their grants.
+func (s *ServiceAccounts) require(ctx context.Context, actorID string) (*models.Grants, error) {
+	grants, err := s.rbac.Grants(ctx, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if !grants.Has(models.PermissionServiceAccountsManage) {
+		return nil, models.ErrPermissionDenied
+	}
+
+	return grants, nil
+}
+
+// requireAccount is require for operations on an existing account, so that
+// keys cannot be attached to ordinary OAuth clients.
+func (s *ServiceAccounts) requireAccount(ctx context.Context, actorID, accountID string) error {
+	if _, err := s.require(ctx, actorID); err != nil {
+		return err
+	}
+
+	_, err := s.repo.GetServiceAccount(ctx, accountID)
+	return err
+}
+
+func (s *ServiceAccounts) record(ctx context.Context, eventType, actorID, accountID, change string) error {
+	metadata := map[string]string{"service_account_id": accountID}
+	if change != "" {
+		metadata["change"] = change
+	}
+
+	return s.audit.Record(ctx, &models.AuditEvent{
+		Type:     eventType,
+		UserID:   actorID,
+		Outcome:  models.AuditOutcomeSuccess,
+		Metadata: metadata,
+	})
+}
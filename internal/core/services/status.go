@@ -0,0 +1,37 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+)
+
+// changeUserStatus moves the user to a new status if the state machine
+// allows it, and audits the change. Leaving the active status does not end
+// the user's sessions; callers revoke their tokens.
+func changeUserStatus(ctx context.Context, users ports.IUserRepo, audit ports.IAuditRepo, user *models.User, to, reason, actorID string) error {
+	if !models.CanTransition(user.Status, to) {
+		return fmt.Errorf("%w: %s to %s", models.ErrInvalidStatusTransition, user.Status, to)
+	}
+
+	change := models.StatusChange{From: user.Status, To: to, Reason: reason, ActorID: actorID}
+	if err := users.ChangeUserStatus(ctx, user.ID, change); err != nil {
+		return err
+	}
+
+	metadata := map[string]string{"from": change.From, "to": change.To}
+	if reason != "" {
+		metadata["reason"] = reason
+	}
+	if actorID != "" {
+		metadata["actor_id"] = actorID
+	}
+
+	return audit.Record(ctx, &models.AuditEvent{
+		Type:     models.AuditUserStatusChanged,
+		UserID:   user.ID,
+		Outcome:  models.AuditOutcomeSuccess,
+		Metadata: metadata,
+	})
+}
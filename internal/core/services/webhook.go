@@ -0,0 +1,650 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/co1seam/ember-backend-auth/config"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"github.com/co1seam/ember-backend-auth/internal/ports"
+	"github.com/google/uuid"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	webhookSecretPrefix = "whsec_"
+
+	// webhookCacheTTL is how long the active subscriptions are reused when
+	// dispatching events.
+	webhookCacheTTL = 10 * time.Second
+)
+
+var webhookEventTypePattern = regexp.MustCompile(`^(\*|[a-z_]+(\.[a-z_]+)*(\.\*)?)$`)
+
+// Webhooks manages webhook subscriptions and delivers events to them in the
+// background. Deliveries are signed with the subscription secret, retried
+// with exponential backoff and jitter, and a subscription failing too often
+// in a row is disabled. Managing subscriptions requires webhooks:manage.
+type Webhooks struct {
+	repo   ports.IWebhookRepo
+	rbac   ports.IRBACService
+	audit  ports.IAuditRepo
+	client *http.Client
+	opts   *models.Options
+
+	mu       sync.Mutex
+	active   []models.WebhookSubscription
+	cachedAt time.Time
+
+	stop chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+func NewWebhooks(repo ports.IWebhookRepo, rbac ports.IRBACService, audit ports.IAuditRepo, opts *models.Options) *Webhooks {
+	w := &Webhooks{
+		repo:   repo,
+		rbac:   rbac,
+		audit:  audit,
+		client: newWebhookClient(&opts.Config.Webhooks),
+		opts:   opts,
+		stop:   make(chan struct{}),
+	}
+
+	w.wg.Add(1)
+	go w.run()
+
+	return w
+}
+
+// newWebhookClient creates the client deliveries are sent with. Unless
+// private networks are allowed, it refuses to connect to addresses that
+// are not public, such as loopback, RFC 1918, link-local and unique local
+// addresses, so that webhooks cannot be used to reach this service's own
+// network or the cloud metadata endpoint. The check is made on the address
+// connected to, after DNS resolution, so that names resolving to such
+// addresses are caught too. Proxies are not used, as they would connect on
+// the client's behalf.
+func newWebhookClient(cfg *config.Webhooks) *http.Client {
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivateNetworks {
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			if !publicAddress(ip) {
+				return fmt.Errorf("connecting to %s is not allowed", ip)
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   cfg.Timeout,
+		// A redirect is a failed delivery; following it could send the
+		// event somewhere the subscription did not name.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598, which is
+// not routable on the internet either.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// publicAddress reports whether ip may be a webhook receiver on the
+// internet.
+func publicAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
+
+// CreateWebhook creates a subscription with a new secret, which is returned
+// in the subscription.
+func (w *Webhooks) CreateWebhook(ctx context.Context, actorID string, subscription *models.WebhookSubscription) (*models.WebhookSubscription, error) {
+	if err := w.require(ctx, actorID); err != nil {
+		return nil, err
+	}
+	if err := w.validateURL(subscription.URL); err != nil {
+		return nil, err
+	}
+	if err := validateEventTypes(subscription.EventTypes); err != nil {
+		return nil, err
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	subscription.Secret = webhookSecretPrefix + secret
+	subscription.Description = strings.TrimSpace(subscription.Description)
+	subscription.CreatedBy = actorID
+
+	if err := w.repo.CreateWebhook(ctx, subscription); err != nil {
+		return nil, err
+	}
+	w.invalidate()
+
+	return subscription, w.record(ctx, models.AuditWebhookCreated, actorID, subscription.ID, map[string]string{"url": subscription.URL})
+}
+
+func (w *Webhooks) GetWebhook(ctx context.Context, actorID, subscriptionID string) (*models.WebhookSubscription, error) {
+	if err := w.require(ctx, actorID); err != nil {
+		return nil, err
+	}
+
+	return w.getWebhook(ctx, subscriptionID)
+}
+
+func (w *Webhooks) ListWebhooks(ctx context.Context, actorID string) ([]models.WebhookSubscription, error) {
+	if err := w.require(ctx, actorID); err != nil {
+		return nil, err
+	}
+
+	return w.repo.ListWebhooks(ctx, false)
+}
+
+func (w *Webhooks) UpdateWebhook(ctx context.Context, actorID, subscriptionID string, update models.UpdateWebhookRequest) (*models.WebhookSubscription, error) {
+	if err := w.require(ctx, actorID); err != nil {
+		return nil, err
+	}
+
+	metadata := map[string]string{}
+	if update.URL != nil {
+		if err := w.validateURL(*update.URL); err != nil {
+			return nil, err
+		}
+		metadata["url"] = *update.URL
+	}
+	if update.EventTypes != nil {
+		if err := validateEventTypes(update.EventTypes); err != nil {
+			return nil, err
+		}
+		metadata["event_types"] = strings.Join(update.EventTypes, ",")
+	}
+	if update.Description != nil {
+		description := strings.TrimSpace(*update.Description)
+		update.Description = &description
+	}
+	if update.Active != nil {
+		metadata["active"] = strconv.FormatBool(*update.Active)
+	}
+
+	if _, err := w.getWebhook(ctx, subscriptionID); err != nil {
+		return nil, err
+	}
+	if err := w.repo.UpdateWebhook(ctx, subscriptionID, update); err != nil {
+		return nil, err
+	}
+	w.invalidate()
+
+	subscription, err := w.repo.GetWebhook(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return subscription, w.record(ctx, models.AuditWebhookUpdated, actorID, subscriptionID, metadata)
+}
+
+func (w *Webhooks) DeleteWebhook(ctx context.Context, actorID, subscriptionID string) error {
+	if err := w.require(ctx, actorID); err != nil {
+		return err
+	}
+
+	if _, err := w.getWebhook(ctx, subscriptionID); err != nil {
+		return err
+	}
+	if err := w.repo.DeleteWebhook(ctx, subscriptionID); err != nil {
+		return err
+	}
+	w.invalidate()
+
+	return w.record(ctx, models.AuditWebhookDeleted, actorID, subscriptionID, nil)
+}
+
+func (w *Webhooks) ListDeliveries(ctx context.Context, actorID string, filter models.WebhookDeliveryFilter) (*models.WebhookDeliveryPage, error) {
+	if err := w.require(ctx, actorID); err != nil {
+		return nil, err
+	}
+
+	if filter.SubscriptionID != "" {
+		if _, err := uuid.Parse(filter.SubscriptionID); err != nil {
+			return nil, fmt.Errorf("%w: invalid subscription_id", models.ErrInvalidWebhookInput)
+		}
+	}
+	switch filter.Status {
+	case "", models.WebhookDeliveryPending, models.WebhookDeliverySucceeded, models.WebhookDeliveryFailed:
+	default:
+		return nil, fmt.Errorf("%w: unknown status %q", models.ErrInvalidWebhookInput, filter.Status)
+	}
+	if filter.Before != "" {
+		if _, err := uuid.Parse(filter.Before); err != nil {
+			return nil, models.ErrInvalidCursor
+		}
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = models.DefaultWebhookPageSize
+	}
+	filter.Limit = min(filter.Limit, models.MaxWebhookPageSize)
+
+	// One delivery more than requested tells whether there is a next page.
+	limit := filter.Limit
+	filter.Limit++
+	deliveries, err := w.repo.ListWebhookDeliveries(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.WebhookDeliveryPage{Deliveries: deliveries}
+	if len(deliveries) > limit {
+		page.Deliveries = deliveries[:limit]
+		page.NextCursor = page.Deliveries[limit-1].ID
+	}
+
+	return page, nil
+}
+
+func (w *Webhooks) ListAttempts(ctx context.Context, actorID, deliveryID string) ([]models.WebhookAttempt, error) {
+	if err := w.require(ctx, actorID); err != nil {
+		return nil, err
+	}
+
+	if _, err := w.getDelivery(ctx, deliveryID); err != nil {
+		return nil, err
+	}
+
+	return w.repo.ListWebhookAttempts(ctx, deliveryID)
+}
+
+// ReplayDelivery sends a delivery again, whether it succeeded or failed, as
+// soon as its subscription is active.
+func (w *Webhooks) ReplayDelivery(ctx context.Context, actorID, deliveryID string) error {
+	if err := w.require(ctx, actorID); err != nil {
+		return err
+	}
+
+	delivery, err := w.getDelivery(ctx, deliveryID)
+	if err != nil {
+		return err
+	}
+	if err := w.repo.ReplayWebhookDelivery(ctx, deliveryID); err != nil {
+		return err
+	}
+
+	return w.record(ctx, models.AuditWebhookReplayed, actorID, delivery.SubscriptionID, map[string]string{
+		"delivery_id": deliveryID,
+		"event_id":    delivery.EventID,
+	})
+}
+
+// Dispatch queues the event for every active subscription that wants it.
+func (w *Webhooks) Dispatch(ctx context.Context, event *models.WebhookEvent) error {
+	subscriptions, err := w.activeWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+
+	var ids []string
+	for _, subscription := range subscriptions {
+		if subscription.Matches(event.Type) {
+			ids = append(ids, subscription.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return w.repo.CreateWebhookDeliveries(ctx, event, payload, ids)
+}
+
+// Name and Publish make the subscriptions a sink of the domain event relay.
+func (w *Webhooks) Name() string {
+	return "webhooks"
+}
+
+func (w *Webhooks) Publish(ctx context.Context, event *models.DomainEvent) error {
+	return w.Dispatch(ctx, &models.WebhookEvent{
+		ID:        event.ID,
+		Type:      event.Type,
+		CreatedAt: event.OccurredAt,
+		Data:      event.Data,
+	})
+}
+
+// Close stops delivering after the batch in progress.
+func (w *Webhooks) Close(ctx context.Context) error {
+	w.once.Do(func() { close(w.stop) })
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *Webhooks) run() {
+	defer w.wg.Done()
+
+	cfg := &w.opts.Config.Webhooks
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+
+		// A full batch suggests more deliveries are due.
+		for w.deliverBatch() >= cfg.BatchSize {
+			select {
+			case <-w.stop:
+				return
+			default:
+			}
+		}
+	}
+}
+
+// deliverBatch attempts a batch of due deliveries concurrently and returns
+// how many there were.
+func (w *Webhooks) deliverBatch() int {
+	cfg := &w.opts.Config.Webhooks
+
+	// The lease outlasts the request, so a delivery is only claimed again
+	// if this instance died while attempting it.
+	lease := cfg.Timeout + 30*time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), lease)
+	defer cancel()
+
+	deliveries, err := w.repo.ClaimWebhookDeliveries(ctx, cfg.BatchSize, lease)
+	if err != nil {
+		_ = w.opts.Logger.Error("failed to claim webhook deliveries", "error", err)
+		return 0
+	}
+	if len(deliveries) == 0 {
+		return 0
+	}
+
+	subscriptions, err := w.repo.ListWebhooks(ctx, true)
+	if err != nil {
+		_ = w.opts.Logger.Error("failed to load webhook subscriptions", "error", err)
+		return 0
+	}
+	byID := make(map[string]*models.WebhookSubscription, len(subscriptions))
+	for i := range subscriptions {
+		byID[subscriptions[i].ID] = &subscriptions[i]
+	}
+
+	var wg sync.WaitGroup
+	for i := range deliveries {
+		subscription, ok := byID[deliveries[i].SubscriptionID]
+		if !ok {
+			// Disabled since it was claimed; it is attempted once the
+			// subscription is active again.
+			continue
+		}
+
+		wg.Add(1)
+		go func(delivery *models.WebhookDelivery) {
+			defer wg.Done()
+			w.deliver(ctx, subscription, delivery)
+		}(&deliveries[i])
+	}
+	wg.Wait()
+
+	return len(deliveries)
+}
+
+func (w *Webhooks) deliver(ctx context.Context, subscription *models.WebhookSubscription, delivery *models.WebhookDelivery) {
+	cfg := &w.opts.Config.Webhooks
+
+	attempt := w.send(ctx, subscription, delivery)
+
+	var next time.Time
+	if !attempt.Succeeded() && delivery.Attempts+1 < cfg.MaxAttempts {
+		next = time.Now().Add(webhookBackoff(delivery.Attempts+1, cfg.BaseBackoff, cfg.MaxBackoff))
+	}
+
+	disabled, err := w.repo.RecordWebhookAttempt(ctx, subscription.ID, attempt, next, cfg.DisableAfter)
+	if err != nil {
+		_ = w.opts.Logger.Error("failed to record webhook attempt", "delivery_id", delivery.ID, "error", err)
+		return
+	}
+	if disabled {
+		w.invalidate()
+		_ = w.opts.Logger.Error("webhook subscription disabled after repeated failures", "subscription_id", subscription.ID,
+			"url", subscription.URL, "failures", cfg.DisableAfter)
+	}
+}
+
+// send posts the delivery payload once.
+func (w *Webhooks) send(ctx context.Context, subscription *models.WebhookSubscription, delivery *models.WebhookDelivery) *models.WebhookAttempt {
+	attempt := &models.WebhookAttempt{DeliveryID: delivery.ID}
+	start := time.Now()
+	defer func() { attempt.Duration = time.Since(start) }()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Ember-Webhooks/1.0")
+	req.Header.Set(models.WebhookDeliveryHeader, delivery.ID)
+	req.Header.Set(models.WebhookEventTypeHeader, delivery.EventType)
+	req.Header.Set(models.WebhookSignatureHeader, signWebhook(subscription.Secret, time.Now(), delivery.Payload))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	attempt.StatusCode = resp.StatusCode
+	if !attempt.Succeeded() {
+		attempt.Error = "unexpected status " + resp.Status
+	}
+
+	return attempt
+}
+
+// signWebhook computes the signature header. The timestamp lets receivers
+// reject old requests replayed by someone who captured them.
+func signWebhook(secret string, at time.Time, payload []byte) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff is the delay before the attempt following the given number
+// of attempts: base doubled for every further attempt, capped at max, with
+// the upper half randomized so that failing receivers are not hit in waves.
+func webhookBackoff(attempts int, base, max time.Duration) time.Duration {
+	delay := max
+	if shift := attempts - 1; shift < 32 {
+		delay = min(base<<shift, max)
+	}
+	if delay <= 0 {
+		delay = max
+	}
+
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+func (w *Webhooks) activeWebhooks(ctx context.Context) ([]models.WebhookSubscription, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.active != nil && time.Since(w.cachedAt) < webhookCacheTTL {
+		return w.active, nil
+	}
+
+	subscriptions, err := w.repo.ListWebhooks(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	if subscriptions == nil {
+		subscriptions = []models.WebhookSubscription{}
+	}
+	w.active, w.cachedAt = subscriptions, time.Now()
+
+	return subscriptions, nil
+}
+
+func (w *Webhooks) invalidate() {
+	w.mu.Lock()
+	w.active = nil
+	w.mu.Unlock()
+}
+
+func (w *Webhooks) validateURL(raw string) error {
+	target, err := url.Parse(raw)
+	if err != nil || target.Host == "" || target.User != nil {
+		return fmt.Errorf("%w: invalid URL", models.ErrInvalidWebhookInput)
+	}
+
+	switch {
+	case target.Scheme == "https":
+	case target.Scheme == "http" && w.opts.Config.Webhooks.AllowHTTP:
+	default:
+		return fmt.Errorf("%w: the URL must use https", models.ErrInvalidWebhookInput)
+	}
+
+	// Addresses are checked again when delivering, as names may resolve to
+	// anything; this only turns away URLs that can never be delivered to.
+	if !w.opts.Config.Webhooks.AllowPrivateNetworks {
+		host := target.Hostname()
+		if ip, err := netip.ParseAddr(host); (err == nil && !publicAddress(ip)) || host == "localhost" || strings.HasSuffix(host, ".localhost") {
+			return fmt.Errorf("%w: the URL must point to a public address", models.ErrInvalidWebhookInput)
+		}
+	}
+
+	return nil
+}
+
+func validateEventTypes(eventTypes []string) error {
+	if len(eventTypes) == 0 {
+		return fmt.Errorf("%w: at least one event type is required", models.ErrInvalidWebhookInput)
+	}
+	for _, eventType := range eventTypes {
+		if !webhookEventTypePattern.MatchString(eventType) {
+			return fmt.Errorf("%w: invalid event type %q", models.ErrInvalidWebhookInput, eventType)
+		}
+	}
+
+	return nil
+}
+
+func (w *Webhooks) require(ctx context.Context, actorID string) error {
+	allowed, err := w.rbac.CheckPermission(ctx, actorID, models.PermissionWebhooksManage)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return models.ErrPermissionDenied
+	}
+
+	return nil
+}
+
+func (w *Webhooks) getWebhook(ctx context.Context, subscriptionID string) (*models.WebhookSubscription, error) {
+	if _, err := uuid.Parse(subscriptionID); err != nil {
+		return nil, models.ErrNotFound
+	}
+
+	return w.repo.GetWebhook(ctx, subscriptionID)
+}
+
+func (w *Webhooks) getDelivery(ctx context.Context, deliveryID string) (*models.WebhookDelivery, error) {
+	if _, err := uuid.Parse(deliveryID); err != nil {
+		return nil, models.ErrNotFound
+	}
+
+	return w.repo.GetWebhookDelivery(ctx, deliveryID)
+}
+
+func (w *Webhooks) record(ctx context.Context, eventType, actorID, subscriptionID string, metadata map[string]string) error {
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	metadata["subscription_id"] = subscriptionID
+
+	return w.audit.Record(ctx, &models.AuditEvent{
+		Type:     eventType,
+		UserID:   actorID,
+		Outcome:  models.AuditOutcomeSuccess,
+		Metadata: metadata,
+	})
+}
+
+// auditWebhookEvent turns an audit event into a webhook event.
+func auditWebhookEvent(event *models.AuditEvent) (*models.WebhookEvent, error) {
+	data, err := json.Marshal(struct {
+		UserID    string            `json:"user_id,omitempty"`
+		OrgID     string            `json:"org_id,omitempty"`
+		SessionID string            `json:"session_id,omitempty"`
+		IP        string            `json:"ip,omitempty"`
+		UserAgent string            `json:"user_agent,omitempty"`
+		Outcome   string            `json:"outcome"`
+		Reason    string            `json:"reason,omitempty"`
+		Metadata  map[string]string `json:"metadata,omitempty"`
+	}{event.UserID, event.OrgID, event.SessionID, event.IP, event.UserAgent, event.Outcome, event.Reason, event.Metadata})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.WebhookEvent{
+		ID:        uuid.NewString(),
+		Type:      event.Type,
+		CreatedAt: event.CreateAt,
+		Data:      data,
+	}, nil
+}
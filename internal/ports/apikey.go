@@ -0,0 +1,25 @@
+package ports
+
+import (
+	"context"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"time"
+)
+
+type (
+	IAPIKeyRepo interface {
+		CreateAPIKey(ctx context.Context, key *models.APIKey, keyHash string) (string, error)
+		GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error)
+		ListAPIKeys(ctx context.Context, userID string) ([]models.APIKey, error)
+		RevokeAPIKey(ctx context.Context, userID, keyID string) error
+		RevokeUserAPIKeys(ctx context.Context, userID string) error
+		TouchAPIKey(ctx context.Context, keyID string) error
+	}
+
+	IAPIKeyService interface {
+		CreateAPIKey(ctx context.Context, userID, name string, scopes []string, ttl time.Duration) (*models.APIKey, string, error)
+		ListAPIKeys(ctx context.Context, userID string) ([]models.APIKey, error)
+		RevokeAPIKey(ctx context.Context, userID, keyID string) error
+		Authenticate(ctx context.Context, key string) (*models.APIKey, error)
+	}
+)
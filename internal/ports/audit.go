@@ -0,0 +1,46 @@
+package ports
+
+import (
+	"context"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"io"
+	"time"
+)
+
+type (
+	IAuditRepo interface {
+		Record(ctx context.Context, event *models.AuditEvent) error
+		RecordBatch(ctx context.Context, events []*models.AuditEvent) error
+		QueryAuditEvents(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error)
+		PurgeAuditEvents(ctx context.Context, before time.Time) ([]models.AuditPurgedRange, error)
+		ChainEvents(ctx context.Context, chainID string, afterSeq int64, limit int) ([]models.AuditEvent, error)
+		AuditChains(ctx context.Context) ([]models.AuditChainHead, error)
+		AuditChain(ctx context.Context, chainID string) (*models.AuditChainHead, error)
+		UncheckpointedChains(ctx context.Context) ([]models.AuditChainHead, error)
+		RecordCheckpoint(ctx context.Context, checkpoint *models.AuditCheckpoint) error
+		AuditCheckpoints(ctx context.Context, chainID string) ([]models.AuditCheckpoint, error)
+		RecordPurgeWatermark(ctx context.Context, watermark *models.AuditPurgeWatermark) error
+		AuditPurgeWatermark(ctx context.Context, chainID string) (*models.AuditPurgeWatermark, error)
+	}
+
+	// IAuditLog records audit events without making the caller wait for the
+	// database.
+	IAuditLog interface {
+		Log(ctx context.Context, event *models.AuditEvent)
+		Close(ctx context.Context) error
+	}
+
+	// IAuditChainService keeps the audit chains tamper-evident. It is meant
+	// for operators, so it does not check permissions.
+	IAuditChainService interface {
+		Checkpoint(ctx context.Context) error
+		Purge(ctx context.Context, before time.Time) (int64, error)
+		Verify(ctx context.Context, chainID string) (*models.AuditChainReport, error)
+		VerifyAll(ctx context.Context) ([]models.AuditChainReport, error)
+		Export(ctx context.Context, filter models.AuditFilter, format string, w io.Writer) (int, error)
+	}
+
+	IAuditService interface {
+		QueryEvents(ctx context.Context, actorID string, filter models.AuditFilter) (*models.AuditPage, error)
+	}
+)
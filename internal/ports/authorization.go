@@ -13,5 +13,6 @@ type (
 		CRUD
 		SendOTP(ctx context.Context, email string) error
 		VerifyOTP(ctx context.Context, otp string) (string, error)
+		CheckStatus(ctx context.Context, userID string) error
 	}
 )
@@ -0,0 +1,26 @@
+package ports
+
+import (
+	"context"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"time"
+)
+
+type (
+	IOutboxRepo interface {
+		PublishOutboxEvents(ctx context.Context, limit int, lease, maxBackoff time.Duration, publish func(event *models.DomainEvent) error) (int, error)
+		PurgeOutboxEvents(ctx context.Context, before time.Time) (int64, error)
+	}
+
+	// IEventPublisher delivers domain events to a sink. Publishing the same
+	// event again must be harmless, as delivery is at least once.
+	IEventPublisher interface {
+		Name() string
+		Publish(ctx context.Context, event *models.DomainEvent) error
+	}
+
+	// IEventRelay publishes the outbox in the background.
+	IEventRelay interface {
+		Close(ctx context.Context) error
+	}
+)
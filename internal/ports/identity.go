@@ -0,0 +1,40 @@
+package ports
+
+import (
+	"context"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"time"
+)
+
+type (
+	IIdentityRepo interface {
+		GetIdentity(ctx context.Context, provider, subject string) (*models.LinkedIdentity, error)
+		ListIdentities(ctx context.Context, userID string) ([]models.LinkedIdentity, error)
+		CreateIdentity(ctx context.Context, identity *models.LinkedIdentity) error
+		CreateUserWithIdentity(ctx context.Context, user *models.User, identity *models.LinkedIdentity) (string, error)
+		TouchIdentity(ctx context.Context, provider, subject string) error
+		DeleteIdentity(ctx context.Context, userID, provider, subject string) error
+	}
+
+	// IIdentityProvider is an upstream OpenID Connect or OAuth 2.0 provider
+	// users can sign in with.
+	IIdentityProvider interface {
+		Name() string
+		AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error)
+		Exchange(ctx context.Context, code, codeVerifier, nonce string) (*models.ExternalIdentity, error)
+	}
+
+	IAccountService interface {
+		ListLoginMethods(ctx context.Context, userID string) ([]models.LoginMethod, error)
+		LinkIdentity(ctx context.Context, userID string, authTime time.Time, provider, returnTo string) (string, error)
+		UnlinkIdentity(ctx context.Context, userID, provider, subject string) error
+	}
+
+	IFederationService interface {
+		Providers() []string
+		Begin(ctx context.Context, provider, returnTo, linkUserID string) (string, string, error)
+		BeginLink(ctx context.Context, provider, returnTo, userID string) (string, error)
+		ContinueLink(ctx context.Context, provider, ticket, userID string) (string, string, error)
+		Complete(ctx context.Context, provider, code, state, binding string) (*models.FederatedLogin, error)
+	}
+)
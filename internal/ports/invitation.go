@@ -0,0 +1,28 @@
+package ports
+
+import (
+	"context"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"time"
+)
+
+type (
+	IInvitationRepo interface {
+		CreateInvitation(ctx context.Context, invitation *models.Invitation, tokenHash string) (string, error)
+		GetInvitation(ctx context.Context, orgID, invitationID string) (*models.Invitation, error)
+		GetInvitationByTokenHash(ctx context.Context, tokenHash string) (*models.Invitation, error)
+		ListInvitations(ctx context.Context, orgID string) ([]models.Invitation, error)
+		RenewInvitation(ctx context.Context, orgID, invitationID, tokenHash string, expiresAt time.Time) error
+		RevokeInvitation(ctx context.Context, orgID, invitationID string) error
+		DeleteInvitation(ctx context.Context, orgID, invitationID string) error
+		AcceptInvitation(ctx context.Context, invitationID, userID string) error
+	}
+
+	IInvitationService interface {
+		CreateInvitation(ctx context.Context, actorID, orgID, email, role string, ttl time.Duration) (*models.Invitation, error)
+		ListInvitations(ctx context.Context, actorID, orgID string) ([]models.Invitation, error)
+		ResendInvitation(ctx context.Context, actorID, orgID, invitationID string, ttl time.Duration) (*models.Invitation, error)
+		RevokeInvitation(ctx context.Context, actorID, orgID, invitationID string) error
+		AcceptInvitation(ctx context.Context, token, userID string, signUp *models.SignUpRequest) (*models.Invitation, error)
+	}
+)
@@ -0,0 +1,8 @@
+package ports
+
+import "context"
+
+type IMailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+	SendTemplate(ctx context.Context, to, name string, data interface{}) error
+}
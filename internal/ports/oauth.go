@@ -0,0 +1,59 @@
+package ports
+
+import (
+	"context"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"time"
+)
+
+type (
+	IClientRepo interface {
+		GetClient(ctx context.Context, clientID string) (*models.Client, error)
+		CreateClient(ctx context.Context, client *models.Client) error
+		ListClientKeys(ctx context.Context, clientID string) ([]models.ClientKey, error)
+		AddClientKey(ctx context.Context, key *models.ClientKey) error
+		RemoveClientKey(ctx context.Context, clientID, keyID string) error
+	}
+
+	IConsentRepo interface {
+		GetConsent(ctx context.Context, userID, clientID string) (*models.Consent, error)
+		SaveConsent(ctx context.Context, consent *models.Consent) error
+		RevokeConsent(ctx context.Context, userID, clientID string) error
+	}
+
+	IOAuthRepo interface {
+		IClientRepo
+		IConsentRepo
+	}
+
+	ISessionRepo interface {
+		CreateSession(ctx context.Context, session *models.Session) (string, error)
+		GetSession(ctx context.Context, sessionID string) (*models.Session, error)
+		GetSessionByRefreshToken(ctx context.Context, refreshTokenHash string) (*models.Session, error)
+		RotateRefreshToken(ctx context.Context, sessionID, oldHash, newHash string, expiresAt time.Time) error
+		RevokeSession(ctx context.Context, sessionID string) error
+		RevokeUserSessions(ctx context.Context, userID string) error
+	}
+
+	IOAuthService interface {
+		LookupClient(ctx context.Context, clientID, redirectURI string) (*models.Client, error)
+		ValidateAuthorizeRequest(client *models.Client, req models.AuthorizeRequest) error
+		RequiresLogin(req models.AuthorizeRequest, authTime time.Time) bool
+		Authorize(ctx context.Context, req models.AuthorizeRequest, userID string, authTime time.Time) (string, error)
+		NeedsConsent(ctx context.Context, client *models.Client, userID, scope string) (bool, error)
+		GrantConsent(ctx context.Context, userID, clientID, scope string) error
+		Token(ctx context.Context, req models.TokenRequest) (*models.TokenResponse, error)
+		Revoke(ctx context.Context, token, hint, clientID, clientSecret string) error
+		Introspect(ctx context.Context, token, hint, clientID, clientSecret string) (*models.Introspection, error)
+		InspectToken(ctx context.Context, token, hint string) (*models.Introspection, error)
+		RotateRefreshToken(ctx context.Context, token string) (*models.Introspection, error)
+		RevokeSignIn(ctx context.Context, token string) (*models.Introspection, error)
+		RevokeUserTokens(ctx context.Context, userID string) error
+	}
+
+	IOIDCService interface {
+		Discovery() *models.DiscoveryDocument
+		JWKS() models.JSONWebKeySet
+		UserInfo(ctx context.Context, accessToken string) (*models.UserInfo, error)
+	}
+)
@@ -0,0 +1,38 @@
+package ports
+
+import (
+	"context"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+)
+
+type (
+	IOrganizationRepo interface {
+		CreateOrganization(ctx context.Context, org *models.Organization, ownerID string) (string, error)
+		GetOrganization(ctx context.Context, orgID string) (*models.Organization, error)
+		ListMemberships(ctx context.Context, userID string) ([]models.Membership, error)
+		GetMembership(ctx context.Context, orgID, userID string) (*models.Membership, error)
+		ListMembers(ctx context.Context, orgID string) ([]models.Membership, error)
+		AddMember(ctx context.Context, orgID, userID, role string) error
+		UpdateMemberRole(ctx context.Context, orgID, userID, role string) error
+		RemoveMember(ctx context.Context, orgID, userID string) error
+		AddDomain(ctx context.Context, orgID, domain, role string) error
+		ListDomains(ctx context.Context, orgID string) ([]models.OrganizationDomain, error)
+		RemoveDomain(ctx context.Context, orgID, domain string) error
+		JoinByDomain(ctx context.Context, userID, domain string) (string, error)
+	}
+
+	IOrganizationService interface {
+		CreateOrganization(ctx context.Context, actorID, name, slug string) (*models.Organization, error)
+		ListOrganizations(ctx context.Context, userID string) ([]models.Membership, error)
+		Membership(ctx context.Context, orgID, userID string) (*models.Membership, error)
+		DefaultMembership(ctx context.Context, userID string) (*models.Membership, error)
+		ListMembers(ctx context.Context, actorID, orgID string) ([]models.Membership, error)
+		AddMember(ctx context.Context, actorID, orgID, userID, role string) error
+		UpdateMember(ctx context.Context, actorID, orgID, userID, role string) error
+		RemoveMember(ctx context.Context, actorID, orgID, userID string) error
+		AddDomain(ctx context.Context, actorID, orgID, domain, role string) error
+		ListDomains(ctx context.Context, actorID, orgID string) ([]models.OrganizationDomain, error)
+		RemoveDomain(ctx context.Context, actorID, orgID, domain string) error
+		AutoJoin(ctx context.Context, userID, email string) (string, error)
+	}
+)
@@ -0,0 +1,24 @@
+package ports
+
+import (
+	"context"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+)
+
+type (
+	IRBACRepo interface {
+		ListRoles(ctx context.Context) ([]models.Role, error)
+		GetGrants(ctx context.Context, userID string) (*models.Grants, error)
+		AssignRole(ctx context.Context, userID, role, grantedBy string) error
+		RevokeRole(ctx context.Context, userID, role string) error
+	}
+
+	IRBACService interface {
+		Grants(ctx context.Context, userID string) (*models.Grants, error)
+		CheckPermission(ctx context.Context, userID, permission string) (bool, error)
+		ListRoles(ctx context.Context) ([]models.Role, error)
+		UserGrants(ctx context.Context, actorID, userID string) (*models.Grants, error)
+		AssignRole(ctx context.Context, actorID, userID, role string) error
+		RevokeRole(ctx context.Context, actorID, userID, role string) error
+	}
+)
@@ -0,0 +1,26 @@
+package ports
+
+import (
+	"context"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+)
+
+type (
+	IRelationRepo interface {
+		WriteTuples(ctx context.Context, writes, deletes []models.RelationTuple) (int64, error)
+		HasTuple(ctx context.Context, tuple models.RelationTuple) (bool, error)
+		ReadTuples(ctx context.Context, object models.ObjectRef, relation string) ([]models.RelationTuple, error)
+		ListObjectIDs(ctx context.Context, namespace, after string, limit int) ([]string, error)
+		Revision(ctx context.Context) (int64, error)
+	}
+
+	// IRelationService answers relationship-based authorization questions.
+	// Every answer comes with a consistency token; passing a token back
+	// guarantees an answer at least as fresh as the state it was issued for.
+	IRelationService interface {
+		WriteTuples(ctx context.Context, actorID string, writes, deletes []models.RelationTuple) (string, error)
+		Check(ctx context.Context, tuple models.RelationTuple, consistency string) (bool, string, error)
+		Expand(ctx context.Context, object models.ObjectRef, relation, consistency string) (*models.UsersetTree, string, error)
+		ListObjects(ctx context.Context, namespace, relation string, subject models.SubjectRef, consistency, cursor string, pageSize int) (*models.ObjectPage, string, error)
+	}
+)
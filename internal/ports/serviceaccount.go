@@ -0,0 +1,26 @@
+package ports
+
+import (
+	"context"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+)
+
+type (
+	IServiceAccountRepo interface {
+		CreateServiceAccount(ctx context.Context, account *models.ServiceAccount, secretHash string) error
+		GetServiceAccount(ctx context.Context, accountID string) (*models.ServiceAccount, error)
+		ListServiceAccounts(ctx context.Context) ([]models.ServiceAccount, error)
+		UpdateServiceAccountSecret(ctx context.Context, accountID, secretHash string) error
+		DeleteServiceAccount(ctx context.Context, accountID string) error
+	}
+
+	IServiceAccountService interface {
+		CreateServiceAccount(ctx context.Context, actorID, name, description string, permissions []string) (*models.ServiceAccount, string, error)
+		ListServiceAccounts(ctx context.Context, actorID string) ([]models.ServiceAccount, error)
+		DeleteServiceAccount(ctx context.Context, actorID, accountID string) error
+		RotateSecret(ctx context.Context, actorID, accountID string) (string, error)
+		ListKeys(ctx context.Context, actorID, accountID string) ([]models.ClientKey, error)
+		AddKey(ctx context.Context, actorID, accountID, publicKey string) (*models.ClientKey, error)
+		RemoveKey(ctx context.Context, actorID, accountID, keyID string) error
+	}
+)
@@ -0,0 +1,29 @@
+package ports
+
+import (
+	"context"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+)
+
+type IUserRepo interface {
+	GetUser(ctx context.Context, userID string) (*models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	HasPassword(ctx context.Context, userID string) (bool, error)
+	ListUsers(ctx context.Context, filter models.UserFilter) ([]models.User, error)
+	UpdateUser(ctx context.Context, userID string, update models.UpdateUserRequest) error
+	VerifyEmail(ctx context.Context, userID string) error
+	ChangeUserStatus(ctx context.Context, userID string, change models.StatusChange) error
+}
+
+type IAdminService interface {
+	ListUsers(ctx context.Context, actorID string, filter models.UserFilter) (*models.UserPage, error)
+	GetUser(ctx context.Context, actorID, userID string) (*models.User, error)
+	CreateUser(ctx context.Context, actorID string, user models.SignUpRequest, emailVerified bool) (*models.User, error)
+	UpdateUser(ctx context.Context, actorID, userID string, update models.UpdateUserRequest) (*models.User, error)
+	DisableUser(ctx context.Context, actorID, userID, reason string) error
+	EnableUser(ctx context.Context, actorID, userID, reason string) error
+	LockUser(ctx context.Context, actorID, userID, reason string) error
+	DeleteUser(ctx context.Context, actorID, userID, reason string) error
+	ForceLogout(ctx context.Context, actorID, userID string) error
+	SetPassword(ctx context.Context, actorID, userID, password string) error
+}
@@ -0,0 +1,43 @@
+package ports
+
+import (
+	"context"
+	"github.com/co1seam/ember-backend-auth/internal/core/models"
+	"time"
+)
+
+type (
+	IWebhookRepo interface {
+		CreateWebhook(ctx context.Context, subscription *models.WebhookSubscription) error
+		GetWebhook(ctx context.Context, subscriptionID string) (*models.WebhookSubscription, error)
+		ListWebhooks(ctx context.Context, activeOnly bool) ([]models.WebhookSubscription, error)
+		UpdateWebhook(ctx context.Context, subscriptionID string, update models.UpdateWebhookRequest) error
+		DeleteWebhook(ctx context.Context, subscriptionID string) error
+		CreateWebhookDeliveries(ctx context.Context, event *models.WebhookEvent, payload []byte, subscriptionIDs []string) error
+		ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error)
+		RecordWebhookAttempt(ctx context.Context, subscriptionID string, attempt *models.WebhookAttempt, next time.Time, disableAfter int) (bool, error)
+		GetWebhookDelivery(ctx context.Context, deliveryID string) (*models.WebhookDelivery, error)
+		ListWebhookDeliveries(ctx context.Context, filter models.WebhookDeliveryFilter) ([]models.WebhookDelivery, error)
+		ListWebhookAttempts(ctx context.Context, deliveryID string) ([]models.WebhookAttempt, error)
+		ReplayWebhookDelivery(ctx context.Context, deliveryID string) error
+	}
+
+	// IWebhookDispatcher queues events for the webhook subscriptions that
+	// want them.
+	IWebhookDispatcher interface {
+		Dispatch(ctx context.Context, event *models.WebhookEvent) error
+	}
+
+	IWebhookService interface {
+		IWebhookDispatcher
+		CreateWebhook(ctx context.Context, actorID string, subscription *models.WebhookSubscription) (*models.WebhookSubscription, error)
+		GetWebhook(ctx context.Context, actorID, subscriptionID string) (*models.WebhookSubscription, error)
+		ListWebhooks(ctx context.Context, actorID string) ([]models.WebhookSubscription, error)
+		UpdateWebhook(ctx context.Context, actorID, subscriptionID string, update models.UpdateWebhookRequest) (*models.WebhookSubscription, error)
+		DeleteWebhook(ctx context.Context, actorID, subscriptionID string) error
+		ListDeliveries(ctx context.Context, actorID string, filter models.WebhookDeliveryFilter) (*models.WebhookDeliveryPage, error)
+		ListAttempts(ctx context.Context, actorID, deliveryID string) ([]models.WebhookAttempt, error)
+		ReplayDelivery(ctx context.Context, actorID, deliveryID string) error
+		Close(ctx context.Context) error
+	}
+)
@@ -1,3 +1,7 @@
 module github.com/co1seam/ember-backend-auth/pkg/logger
 
 go 1.24.1
+
+require go.opentelemetry.io/otel/trace v1.34.0
+
+require go.opentelemetry.io/otel v1.34.0 // indirect
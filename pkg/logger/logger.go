@@ -3,6 +3,7 @@ package logger
 import (
 	"context"
 	"fmt"
+	"go.opentelemetry.io/otel/trace"
 	"io"
 	"log/slog"
 	"os"
@@ -64,8 +65,13 @@ func (l *Logger) toAttrs(args []any) []slog.Attr {
 	return attrs
 }
 
-func (l *Logger) log(level slog.Level, msg string, args ...any) error {
-	if !l.handler.Enabled(l.ctx, level) {
+// log writes a record. When ctx carries a span, the record gets its trace
+// and span IDs, so logs can be found from a trace and the other way round.
+func (l *Logger) log(ctx context.Context, level slog.Level, msg string, args ...any) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !l.handler.Enabled(ctx, level) {
 		return fmt.Errorf("logger isn't enabled")
 	}
 
@@ -73,7 +79,13 @@ func (l *Logger) log(level slog.Level, msg string, args ...any) error {
 	runtime.Callers(2, pcs[:])
 	r := slog.NewRecord(time.Now(), level, msg, pcs[0])
 	r.Add(args...)
-	if err := l.handler.Handle(l.ctx, r); err != nil {
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		r.AddAttrs(
+			slog.String("trace_id", span.TraceID().String()),
+			slog.String("span_id", span.SpanID().String()),
+		)
+	}
+	if err := l.handler.Handle(ctx, r); err != nil {
 		return err
 	}
 
@@ -81,17 +93,33 @@ func (l *Logger) log(level slog.Level, msg string, args ...any) error {
 }
 
 func (l *Logger) Debug(msg string, args ...any) error {
-	return l.log(slog.LevelDebug, msg, args...)
+	return l.log(l.ctx, slog.LevelDebug, msg, args...)
+}
+
+func (l *Logger) DebugContext(ctx context.Context, msg string, args ...any) error {
+	return l.log(ctx, slog.LevelDebug, msg, args...)
 }
 
 func (l *Logger) Info(msg string, args ...any) error {
-	return l.log(slog.LevelInfo, msg, args...)
+	return l.log(l.ctx, slog.LevelInfo, msg, args...)
+}
+
+func (l *Logger) InfoContext(ctx context.Context, msg string, args ...any) error {
+	return l.log(ctx, slog.LevelInfo, msg, args...)
 }
 
 func (l *Logger) Warn(msg string, args ...any) error {
-	return l.log(slog.LevelWarn, msg, args...)
+	return l.log(l.ctx, slog.LevelWarn, msg, args...)
+}
+
+func (l *Logger) WarnContext(ctx context.Context, msg string, args ...any) error {
+	return l.log(ctx, slog.LevelWarn, msg, args...)
 }
 
 func (l *Logger) Error(msg string, args ...any) error {
-	return l.log(slog.LevelError, msg, args...)
+	return l.log(l.ctx, slog.LevelError, msg, args...)
+}
+
+func (l *Logger) ErrorContext(ctx context.Context, msg string, args ...any) error {
+	return l.log(ctx, slog.LevelError, msg, args...)
 }